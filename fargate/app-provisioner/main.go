@@ -4,13 +4,22 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/build"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/gitsource"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/image"
 	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/pusher_config"
 	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/status"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/transient"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -24,6 +33,12 @@ import (
 	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/utils"
 )
 
+// buildTimeout is how long the provisioner waits for a deployer task to build and push an image
+const buildTimeout = 2 * time.Hour
+
+// pushRetry is kaniko's --push-retry, so that a registry timeout while pushing does not fail the build
+const pushRetry = "--push-retry=3"
+
 func main() {
 	log.Println("Running app Provisioner")
 	ctx := context.Background()
@@ -42,10 +57,10 @@ func main() {
 	applicationsTable := os.Getenv("APPLICATIONS_TABLE")
 	accountsTable := os.Getenv("ACCOUNTS_TABLE")
 
-	var tag string
-	tag = os.Getenv("SOURCE_TAG")
-	if tag == "" {
-		tag = "latest"
+	refType, ref := sourceRef()
+	buildOptions, err := build.FromEnv()
+	if err != nil {
+		log.Fatalf("error reading build options: %v\n", err)
 	}
 
 	// Initializing environment
@@ -70,14 +85,14 @@ func main() {
 
 	appProvisioner := awsProvisioner.NewAWSProvisioner(cfg,
 
-		accountId, action, env, utils.ExtractGitUrl(sourceUrl), storageId, computeNodeUuid, utils.AppSlug(sourceUrl, computeNodeUuid), runOnGPU, roleName)
+		accountId, action, env, utils.ExtractGitUrl(sourceUrl), storageId, computeNodeUuid, utils.AppSlug(build.Source(sourceUrl, buildOptions.ContextDir), computeNodeUuid), runOnGPU, roleName)
 	applicationsStore := store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, applicationsTable)
 	statusManager := status.NewManager(applicationsStore, applicationUuid)
 
 	// deploymentId will only be present if this is not a DELETE or ADD_TO_APPSTORE.
 	// ADD_TO_APPSTORE handles its own status manager setup.
 	var deploymentId string
-	if action == "CREATE" || action == "DEPLOY" {
+	if action == "CREATE" || action == "DEPLOY" || action == "ROLLBACK" {
 		deploymentsTable := os.Getenv(provisioner.DeploymentsTableNameKey)
 		deploymentId = os.Getenv(provisioner.DeploymentIdKey)
 		deploymentsStore := store_dynamodb.NewDeploymentsStore(dynamoDBClient, deploymentsTable)
@@ -91,25 +106,49 @@ func main() {
 		statusManager = statusManager.WithPusher(pusherConfig)
 	}
 
+	// the provisioner task is running, so the service's provisioning step is over
+	if deploymentId != "" {
+		statusManager.EndStep(ctx, store_dynamodb.StepProvisioning, store_dynamodb.StepSucceeded)
+	}
+
 	// POST provisioning actions
 	switch action {
 	case "CREATE":
 		ecsClient := ecs.NewFromConfig(cfg)
-		if err := Create(ctx, applicationUuid, deploymentId, sourceUrl, appProvisioner, ecsClient, statusManager); err != nil {
-			statusManager.SetErrorStatus(ctx, err)
-			log.Fatal(err)
+		authToken, err := sourceToken(ctx, ssm.NewFromConfig(cfg))
+		if err != nil {
+			fail(ctx, action, statusManager, err)
+		}
+		credentials := sourceCredentials(os.Getenv("SOURCE_TYPE"), sourceUrl, authToken)
+		if err := Create(ctx, cfg, applicationUuid, deploymentId, sourceUrl, buildOptions, credentials, appProvisioner, ecsClient, statusManager); err != nil {
+			fail(ctx, action, statusManager, err)
 		}
 	case "DELETE":
 		if err := Delete(ctx, applicationUuid, appProvisioner, applicationsStore); err != nil {
-			statusManager.UpdateApplicationStatus(ctx, err.Error(), true)
-			log.Fatal(err)
+			fail(ctx, action, statusManager, err)
 		}
 	case "DEPLOY":
-		// Build and deploy
+		// Build and deploy. A deployment of a release, a branch or a commit builds it rather than the default branch.
+		buildUrl := sourceUrl
+		if ref != "" {
+			buildUrl = gitsource.ParseContext(sourceUrl).AtRef(refType, ref).String()
+		}
 		ecsClient := ecs.NewFromConfig(cfg)
-		if err := Redeploy(ctx, applicationUuid, deploymentId, sourceUrl, destinationUrl, appProvisioner, ecsClient, statusManager); err != nil {
-			statusManager.SetErrorStatus(ctx, err)
-			log.Fatal(err)
+		authToken, err := sourceToken(ctx, ssm.NewFromConfig(cfg))
+		if err != nil {
+			fail(ctx, action, statusManager, err)
+		}
+		credentials := sourceCredentials(os.Getenv("SOURCE_TYPE"), sourceUrl, authToken)
+		if err := Redeploy(ctx, cfg, applicationUuid, deploymentId, buildUrl, buildOptions, credentials, destinationUrl, appProvisioner, ecsClient, statusManager); err != nil {
+			fail(ctx, action, statusManager, err)
+		}
+	case "ROLLBACK":
+		// Repoint the application at an image an earlier deployment built
+		rollbackOf := os.Getenv("ROLLBACK_OF")
+		imageTag := os.Getenv("IMAGE_TAG")
+		imageDigest := os.Getenv("IMAGE_DIGEST")
+		if err := Rollback(ctx, cfg, applicationUuid, deploymentId, rollbackOf, imageTag, imageDigest, destinationUrl, appProvisioner, statusManager); err != nil {
+			fail(ctx, action, statusManager, err)
 		}
 	case "ADD_TO_APPSTORE":
 		// APPLICATIONS_TABLE points to the versions table for appstore deployments
@@ -124,13 +163,17 @@ func main() {
 		} else {
 			appStoreStatusManager = appStoreStatusManager.WithPusher(pusherConfig)
 		}
+		appStoreStatusManager.EndStep(ctx, store_dynamodb.StepProvisioning, store_dynamodb.StepSucceeded)
 
 		ecsClient := ecs.NewFromConfig(cfg)
-		authToken := os.Getenv("AUTH_TOKEN")
-		err := AddToAppstore(ctx, applicationUuid, appStoreDeploymentId, sourceUrl, tag, authToken, appProvisioner, ecsClient, appStoreStatusManager, versionStore)
+		authToken, err := sourceToken(ctx, ssm.NewFromConfig(cfg))
 		if err != nil {
-			appStoreStatusManager.SetErrorStatus(ctx, err)
-			log.Fatal(err)
+			fail(ctx, action, appStoreStatusManager, err)
+		}
+		sourceType := os.Getenv("SOURCE_TYPE")
+		err = AddToAppstore(ctx, cfg, applicationUuid, appStoreDeploymentId, sourceType, sourceUrl, refType, ref, buildOptions, authToken, appProvisioner, ecsClient, appStoreStatusManager, versionStore)
+		if err != nil {
+			fail(ctx, action, appStoreStatusManager, err)
 		}
 	default:
 		unknownActionStatus := fmt.Sprintf("error: unknown provision action: %s", action)
@@ -138,13 +181,108 @@ func main() {
 		log.Fatalf("action not supported: %s", action)
 	}
 
+	// a failed deployment may be retried, so its token is left to expire
+	forgetSourceToken(ctx, ssm.NewFromConfig(cfg))
 	log.Println("provisioning complete")
 }
 
-func Create(ctx context.Context, applicationUuid string, deploymentId string, sourceUrl string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager) error {
+// sourceToken returns the token of a private source. The service keeps the token of a queued provisioner task in
+// the SSM parameter named by AUTH_TOKEN_PARAMETER, rather than with the task's job.
+func sourceToken(ctx context.Context, ssmClient *ssm.Client) (string, error) {
+	name := os.Getenv(provisioner.SourceTokenParameterKey)
+	if name == "" {
+		return os.Getenv("AUTH_TOKEN"), nil
+	}
+	out, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting source token: %w", err)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+// forgetSourceToken deletes the SSM parameter holding the source token, once the deployment no longer needs it
+func forgetSourceToken(ctx context.Context, ssmClient *ssm.Client) {
+	name := os.Getenv(provisioner.SourceTokenParameterKey)
+	if name == "" {
+		return
+	}
+	if _, err := ssmClient.DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: aws.String(name)}); err != nil {
+		log.Printf("warning: unable to delete source token %s: %s\n", name, err.Error())
+	}
+}
+
+// sourceRef returns the type and name of the git ref the service asked to build, SOURCE_COMMIT, SOURCE_BRANCH or
+// SOURCE_TAG, or an empty ref for the default branch.
+func sourceRef() (string, string) {
+	if commit := os.Getenv("SOURCE_COMMIT"); commit != "" {
+		return gitsource.RefTypeCommit, commit
+	}
+	if branch := os.Getenv("SOURCE_BRANCH"); branch != "" {
+		return gitsource.RefTypeBranch, branch
+	}
+	if tag := os.Getenv("SOURCE_TAG"); tag != "" {
+		return gitsource.RefTypeTag, tag
+	}
+	return "", ""
+}
+
+// sourceCredentials returns the credentials that authenticate token, the token the service sent for a private
+// source, with the host of sourceUrl. They are empty for a public source.
+func sourceCredentials(sourceType string, sourceUrl string, token string) gitsource.Credentials {
+	return gitsource.TokenCredentials(sourceType, gitsource.ParseContext(sourceUrl).HTTPSUrl(), token)
+}
+
+// resolveSource pins the build context to the commit its ref points at now, so that the commit recorded is the one
+// built. A source whose refs cannot be listed is built as it is given, for kaniko to clone, without a commit.
+func resolveSource(ctx context.Context, sourceUrl string, credentials gitsource.Credentials) (gitsource.Context, error) {
+	source, err := gitsource.Resolve(ctx, http.DefaultClient, sourceUrl, credentials)
+	if err == nil {
+		return source, nil
+	}
+	unresolved, ok := gitsource.Unresolved(sourceUrl, err)
+	if !ok {
+		return gitsource.Context{}, fmt.Errorf("error resolving source commit: %w", err)
+	}
+	log.Printf("warning: building %s without resolving its commit: %s\n", sourceUrl, err.Error())
+	return unresolved, nil
+}
+
+// gitCredentialsEnvironment returns the deployer environment kaniko authenticates with a private source with
+func gitCredentialsEnvironment(credentials gitsource.Credentials) []types.KeyValuePair {
+	if credentials.Password == "" {
+		return nil
+	}
+	return []types.KeyValuePair{
+		{Name: aws.String("GIT_USERNAME"), Value: aws.String(credentials.Username)},
+		{Name: aws.String("GIT_PASSWORD"), Value: aws.String(credentials.Password)},
+	}
+}
+
+// fail records that action failed and exits. A transient failure of an action that is retried only has its error
+// recorded, and exits with statemachine.RetryExitCode for the status listener to run the deployment again.
+func fail(ctx context.Context, action string, statusManager *status.Manager, err error) {
+	if _, retried := statemachine.Policy(action); retried && transient.Is(err) {
+		statusManager.SetTransientError(ctx, err)
+		log.Printf("transient failure, exiting for a retry: %s\n", err.Error())
+		os.Exit(statemachine.RetryExitCode)
+	}
+	if action == "DELETE" {
+		statusManager.SetDeleteErrorStatus(ctx, err)
+	} else {
+		statusManager.SetErrorStatus(ctx, err)
+	}
+	log.Fatal(err)
+}
+
+func Create(ctx context.Context, cfg aws.Config, applicationUuid string, deploymentId string, sourceUrl string, buildOptions build.Options, credentials gitsource.Credentials, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager) error {
+	statusManager.StartStep(ctx, store_dynamodb.StepTerraformApply)
 	if err := appProvisioner.Create(ctx); err != nil {
 		return fmt.Errorf("error creating infrastructure: %w", err)
 	}
+	statusManager.EndStep(ctx, store_dynamodb.StepTerraformApply, store_dynamodb.StepSucceeded)
 	// parse output file created after infrastructure creation
 	parser := parser.NewOutputParser("/usr/src/app/terraform/infrastructure/outputs.json")
 	outputs, err := parser.Run(ctx)
@@ -163,27 +301,33 @@ func Create(ctx context.Context, applicationUuid string, deploymentId string, so
 	if err != nil {
 		return fmt.Errorf("error updating application record: %w", err)
 	}
+	// terraform registered the task definition, which is recorded on the application now
+	statusManager.CompleteStep(ctx, store_dynamodb.StepTaskDefinitionRegistered)
 
 	// Build and deploy
 	log.Println("Initiating new Deployment Fargate Task: CREATE")
-	if err := Deploy(ctx, applicationUuid, deploymentId, sourceUrl, store_application.DestinationUrl, appProvisioner, ecsClient); err != nil {
+	if err := Deploy(ctx, cfg, applicationUuid, deploymentId, sourceUrl, buildOptions, credentials, store_application.DestinationUrl, appProvisioner, ecsClient, statusManager); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func AddToAppstore(ctx context.Context, applicationUuid string, deploymentId string, sourceUrl string, tag string, authToken string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager, versionStore store_dynamodb.AppStoreVersionDBStore) error {
+func AddToAppstore(ctx context.Context, cfg aws.Config, applicationUuid string, deploymentId string, sourceType string, sourceUrl string, refType string, ref string, buildOptions build.Options, authToken string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager, versionStore store_dynamodb.AppStoreVersionDBStore) error {
 	// Get the pre-existing private ECR URL from environment variable
 	ecrRepoUrl := os.Getenv("APPSTORE_PRIVATE_ECR_URL")
 	if ecrRepoUrl == "" {
 		return fmt.Errorf("APPSTORE_PRIVATE_ECR_URL environment variable is not set")
 	}
 
-	// Generate unique tag using source URL hash: {hash}-{source_tag}
-	// This ensures each source gets unique tags in the shared ECR repo
-	sourceUrlHash := utils.GenerateHash(sourceUrl)
-	uniqueTag := fmt.Sprintf("%d-%s", sourceUrlHash, tag)
+	// Generate unique tag using source URL hash: {hash}-{source_ref}
+	// This ensures each source, and each application in a monorepo, gets unique tags in the shared ECR repo
+	sourceUrlHash := utils.GenerateHash(build.Source(sourceUrl, buildOptions.ContextDir))
+	imageRef := "latest"
+	if ref != "" {
+		imageRef = utils.ImageTag(ref)
+	}
+	uniqueTag := fmt.Sprintf("%d-%s", sourceUrlHash, imageRef)
 	destinationUrl := fmt.Sprintf("%s:%s", ecrRepoUrl, uniqueTag)
 
 	log.Printf("Using private ECR repository with unique tag: %s", destinationUrl)
@@ -195,29 +339,123 @@ func AddToAppstore(ctx context.Context, applicationUuid string, deploymentId str
 	statusManager.UpdateApplicationStatus(ctx, "deploying", false)
 
 	// Build and push
-	log.Printf("Initiating new Deployment Fargate Task: ADD_TO_APPSTORE - sourceUrl: %s, tag: %s, destinationUrl: %s", sourceUrl, tag, destinationUrl)
+	log.Printf("Initiating new Deployment Fargate Task: ADD_TO_APPSTORE - sourceUrl: %s, %s: %s, destinationUrl: %s", sourceUrl, refType, ref, destinationUrl)
 	applicationsTable := os.Getenv("APPLICATIONS_TABLE")
-	if err := PrivateDeploy(ctx, applicationUuid, deploymentId, sourceUrl, tag, destinationUrl, authToken, applicationsTable, appProvisioner, ecsClient); err != nil {
+	if err := PrivateDeploy(ctx, cfg, applicationUuid, deploymentId, sourceType, sourceUrl, refType, ref, buildOptions, destinationUrl, authToken, applicationsTable, appProvisioner, ecsClient, statusManager); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func Redeploy(ctx context.Context, applicationUuid string, deploymentId string, sourceUrl string, destinationUrl string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager) error {
+func Redeploy(ctx context.Context, cfg aws.Config, applicationUuid string, deploymentId string, sourceUrl string, buildOptions build.Options, credentials gitsource.Credentials, destinationUrl string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager) error {
 	log.Println("Initiating new Deployment Fargate Task: DEPLOY")
 	statusManager.UpdateApplicationStatus(ctx, "re-deploying", false)
-	if err := Deploy(ctx, applicationUuid, deploymentId, sourceUrl, destinationUrl, appProvisioner, ecsClient); err != nil {
+
+	// A rollback pins the task definition to a digest, so point it back at latest before building a new image
+	application, err := statusManager.ApplicationsStore.GetById(ctx, applicationUuid)
+	if err != nil {
+		return fmt.Errorf("error getting application: %w", err)
+	}
+	if application.ApplicationId != "" {
+		_, accountEcsClient, err := accountClients(ctx, cfg, appProvisioner)
+		if err != nil {
+			return err
+		}
+		taskDefinitionArn, err := image.PointTaskDefinition(ctx, accountEcsClient, application.ApplicationId, destinationUrl, destinationUrl)
+		if err != nil {
+			return err
+		}
+		if taskDefinitionArn != application.ApplicationId {
+			log.Printf("unpinned application image: %s", taskDefinitionArn)
+			if err := statusManager.ApplicationsStore.UpdateTaskDefinition(ctx, taskDefinitionArn, applicationUuid); err != nil {
+				return fmt.Errorf("error updating application task definition: %w", err)
+			}
+			statusManager.CompleteStep(ctx, store_dynamodb.StepTaskDefinitionRegistered)
+		}
+	}
+
+	if err := Deploy(ctx, cfg, applicationUuid, deploymentId, sourceUrl, buildOptions, credentials, destinationUrl, appProvisioner, ecsClient, statusManager); err != nil {
 		return err
 	}
 	return nil
 }
 
-func Deploy(ctx context.Context, applicationUuid string, deploymentId string, sourceUrl string, destinationUrl string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client) error {
+// Rollback points the application's task definition at the image built by an earlier deployment, identified by its
+// per-deployment tag or, if known, its digest. Nothing is rebuilt, so the rollback deployment finishes here rather
+// than in a deployer task.
+func Rollback(ctx context.Context, cfg aws.Config, applicationUuid string, deploymentId string, rollbackOf string, imageTag string, imageDigest string, destinationUrl string, appProvisioner provisioner.Provisioner, statusManager *status.Manager) error {
+	log.Printf("Rolling back to deployment %s (%s)", rollbackOf, imageTag)
+	statusManager.UpdateApplicationStatus(ctx, "rolling-back", false)
+
+	application, err := statusManager.ApplicationsStore.GetById(ctx, applicationUuid)
+	if err != nil {
+		return fmt.Errorf("error getting application: %w", err)
+	}
+	ecrClient, ecsClient, err := accountClients(ctx, cfg, appProvisioner)
+	if err != nil {
+		return err
+	}
+	repositoryName := image.RepositoryName(destinationUrl)
+	if imageDigest == "" {
+		if imageDigest, err = image.ResolveDigest(ctx, ecrClient, repositoryName, imageTag); err != nil {
+			return err
+		}
+	}
+	// keep latest on the running image so a task definition that is not pinned still runs it
+	if err := image.Retag(ctx, ecrClient, repositoryName, imageDigest, image.LatestTag); err != nil {
+		return err
+	}
+	statusManager.StartStep(ctx, store_dynamodb.StepTaskDefinitionRegistered)
+	taskDefinitionArn, err := image.PointTaskDefinition(ctx, ecsClient, application.ApplicationId, destinationUrl, image.Pinned(destinationUrl, imageDigest))
+	if err != nil {
+		return err
+	}
+	if err := statusManager.ApplicationsStore.UpdateTaskDefinition(ctx, taskDefinitionArn, applicationUuid); err != nil {
+		return fmt.Errorf("error updating application task definition: %w", err)
+	}
+	statusManager.EndStep(ctx, store_dynamodb.StepTaskDefinitionRegistered, store_dynamodb.StepSucceeded)
+
+	statusManager.SetDeploymentImage(ctx, imageTag, imageDigest)
+	if err := statusManager.DeploymentsStore.SetImage(ctx, applicationUuid, rollbackOf, imageTag, imageDigest); err != nil {
+		log.Printf("warning: error recording digest on deployment %s: %s\n", rollbackOf, err.Error())
+	}
+	if err := statusManager.DeploymentsStore.SetStopped(ctx, applicationUuid, deploymentId, time.Now()); err != nil {
+		return err
+	}
+	statusManager.EndStep(ctx, store_dynamodb.StepDone, store_dynamodb.StepSucceeded)
+	statusManager.UpdateApplicationStatus(ctx, "deployed", false)
+	return nil
+}
+
+// accountClients returns ECR and ECS clients acting in the application's account
+func accountClients(ctx context.Context, cfg aws.Config, appProvisioner provisioner.Provisioner) (*ecr.Client, *ecs.Client, error) {
+	creds, err := appProvisioner.AssumeRole(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error assuming role: %w", err)
+	}
+	provider := credentials.NewStaticCredentialsProvider(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken)
+	ecrClient := ecr.NewFromConfig(cfg, func(o *ecr.Options) {
+		o.Credentials = provider
+	})
+	ecsClient := ecs.NewFromConfig(cfg, func(o *ecs.Options) {
+		o.Credentials = provider
+	})
+	return ecrClient, ecsClient, nil
+}
+
+// Deploy builds the application from sourceUrl with buildOptions in a deployer task and pushes it to destinationUrl,
+// then records what was built on the deployment. credentials authenticate with a private source.
+func Deploy(ctx context.Context, cfg aws.Config, applicationUuid string, deploymentId string, sourceUrl string, buildOptions build.Options, credentials gitsource.Credentials, destinationUrl string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager) error {
+	source, err := resolveSource(ctx, sourceUrl, credentials)
+	if err != nil {
+		return err
+	}
 	creds, err := appProvisioner.AssumeRole(ctx)
 	if err != nil {
 		return fmt.Errorf("error assuming role: %w", err)
 	}
+	imageTag := image.DeploymentTag(deploymentId)
 
 	accessKeyId := "AWS_ACCESS_KEY_ID"
 	accessKeyIdValue := creds.AccessKeyID
@@ -233,8 +471,14 @@ func Deploy(ctx context.Context, applicationUuid string, deploymentId string, so
 	SecurityGroup := os.Getenv("SECURITY_GROUP")
 	TaskDefContainerName := os.Getenv("DEPLOYER_TASK_DEF_CONTAINER_NAME")
 
+	deployerTaskDefinitionArn, deregister, err := deployerTaskDefinition(ctx, ecsClient, TaskDefinitionArn, TaskDefContainerName, buildOptions.Secrets)
+	if err != nil {
+		return err
+	}
+	defer deregister()
+
 	runTaskIn := &ecs.RunTaskInput{
-		TaskDefinition: aws.String(TaskDefinitionArn),
+		TaskDefinition: aws.String(deployerTaskDefinitionArn),
 		Cluster:        aws.String(cluster),
 		NetworkConfiguration: &types.NetworkConfiguration{
 			AwsvpcConfiguration: &types.AwsVpcConfiguration{
@@ -246,9 +490,11 @@ func Deploy(ctx context.Context, applicationUuid string, deploymentId string, so
 		Overrides: &types.TaskOverride{
 			ContainerOverrides: []types.ContainerOverride{
 				{
-					Name:    &TaskDefContainerName,
-					Command: []string{"--context", sourceUrl, "--destination", destinationUrl, "--force"},
-					Environment: []types.KeyValuePair{
+					Name: &TaskDefContainerName,
+					// the per-deployment tag keeps this build addressable after latest moves on
+					Command: append([]string{"--context", source.String(), "--destination", destinationUrl,
+						"--destination", fmt.Sprintf("%s:%s", destinationUrl, imageTag), "--force", pushRetry}, buildOptions.Args()...),
+					Environment: append([]types.KeyValuePair{
 						{
 							Name:  &accessKeyId,
 							Value: &accessKeyIdValue,
@@ -261,7 +507,7 @@ func Deploy(ctx context.Context, applicationUuid string, deploymentId string, so
 							Name:  &secretAccessKey,
 							Value: &secretAccessKeyValue,
 						},
-					},
+					}, gitCredentialsEnvironment(credentials)...),
 				},
 			},
 		},
@@ -272,115 +518,135 @@ func Deploy(ctx context.Context, applicationUuid string, deploymentId string, so
 		},
 	}
 
+	statusManager.StartStep(ctx, store_dynamodb.StepImageBuild)
 	taskRunner := runner.NewECSTaskRunner(ecsClient, runTaskIn)
 	runTaskOut, err := taskRunner.Run(ctx)
 	if err != nil {
 		return fmt.Errorf("error running deployment task: %w", err)
 	}
 	if err := runner.GetRunFailures(runTaskOut); err != nil {
-		return fmt.Errorf("error: run failures: %w", err)
+		// ECS turns tasks away while it is short of capacity
+		return transient.Errorf("error: run failures: %w", err)
+	}
+	statusManager.SetDeploymentImage(ctx, imageTag, "")
+	stopped, ok, err := waitForBuild(ctx, ecsClient, runTaskOut, source, statusManager)
+	if err != nil || !ok {
+		return err
 	}
+	// credentials assumed before the build may have expired
+	ecrClient, _, err := accountClients(ctx, cfg, appProvisioner)
+	if err != nil {
+		log.Printf("warning: unable to record image of deployment %s: %s\n", deploymentId, err.Error())
+		return nil
+	}
+	recordBuild(ctx, ecrClient, stopped, image.RepositoryName(destinationUrl), imageTag, statusManager)
 	return nil
 }
 
-func Delete(ctx context.Context, applicationUuid string, appProvisioner provisioner.Provisioner, applicationsStore store_dynamodb.DynamoDBStore) error {
-	log.Println("Deleting", applicationUuid)
-
-	if err := appProvisioner.Delete(ctx); err != nil {
-		return fmt.Errorf("error deleting infrastructure: :%w", err)
+// deployerTaskDefinition returns the deployer task definition to run a build with secrets with. Build secrets are
+// set by ECS from the task definition, so that they are not in the task's overrides, which takes a revision of the
+// task definition for the build. The returned func deregisters it, and may be deferred from the start of the build,
+// as a running task keeps its deregistered task definition.
+func deployerTaskDefinition(ctx context.Context, ecsClient *ecs.Client, taskDefinitionArn string, containerName string, secrets []build.Secret) (string, func(), error) {
+	deployerTaskDefinitionArn, err := build.WithSecrets(ctx, ecsClient, taskDefinitionArn, containerName, secrets)
+	if err != nil {
+		return "", nil, fmt.Errorf("error registering deployer task definition with build secrets: %w", err)
 	}
-
-	if err := applicationsStore.Delete(ctx, applicationUuid); err != nil {
-		return fmt.Errorf("error deleting application from store: %w", err)
+	if deployerTaskDefinitionArn == taskDefinitionArn {
+		return taskDefinitionArn, func() {}, nil
 	}
-	return nil
+	return deployerTaskDefinitionArn, func() { deregisterTaskDefinition(ctx, ecsClient, deployerTaskDefinitionArn) }, nil
 }
 
-func PublicDeploy(ctx context.Context, applicationUuid string, deploymentId string, sourceUrl string, tag string, destinationUrl string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client) error {
-	creds, err := appProvisioner.GetProvisionerCreds(ctx)
-	if err != nil {
-		return fmt.Errorf("error retrieving credentials: %w", err)
+// deregisterTaskDefinition deregisters the revision of the deployer task definition registered for a build
+func deregisterTaskDefinition(ctx context.Context, ecsClient *ecs.Client, taskDefinitionArn string) {
+	if _, err := ecsClient.DeregisterTaskDefinition(ctx, &ecs.DeregisterTaskDefinitionInput{
+		TaskDefinition: aws.String(taskDefinitionArn),
+	}); err != nil {
+		log.Printf("warning: unable to deregister task definition %s: %s\n", taskDefinitionArn, err.Error())
 	}
+}
 
-	deploymentSourceUrl, err := utils.DetermineSourceURL(sourceUrl, tag)
+// waitForBuild records the commit and deployer task definition of a build, then waits for its deployer task to
+// stop. It reports false if the build did not push an image, or if waiting failed. The status listener reports
+// the outcome of the build either way, so failures here are only logged, except for a deployer task that stopped
+// for a reason running it again may not hit, or could not reach a registry: that is returned as a transient error,
+// for the deployment to be retried.
+func waitForBuild(ctx context.Context, ecsClient *ecs.Client, runTaskOut *ecs.RunTaskOutput, source gitsource.Context, statusManager *status.Manager) (types.Task, bool, error) {
+	if len(runTaskOut.Tasks) == 0 {
+		return types.Task{}, false, nil
+	}
+	task := runTaskOut.Tasks[0]
+	statusManager.SetBuildMetadata(ctx, store_dynamodb.BuildMetadata{
+		CommitSha:              source.Commit,
+		DeployerTaskDefinition: aws.ToString(task.TaskDefinitionArn),
+	})
+
+	log.Printf("waiting for deployer task %s to build commit %s", aws.ToString(task.TaskArn), source.Commit)
+	stopped, err := runner.WaitForStop(ctx, ecsClient, aws.ToString(task.ClusterArn), aws.ToString(task.TaskArn), buildTimeout)
 	if err != nil {
-		return fmt.Errorf("error determining sourceUrl variable for deployment: %w", err)
+		log.Printf("warning: unable to record build: %s\n", err.Error())
+		return types.Task{}, false, nil
+	}
+	if !runner.Succeeded(stopped) {
+		stoppedReason := aws.ToString(stopped.StoppedReason)
+		log.Printf("deployer task %s did not succeed: %s", aws.ToString(stopped.TaskArn), stoppedReason)
+		statusManager.EndStep(ctx, store_dynamodb.StepImageBuild, store_dynamodb.StepFailed)
+		if transient.Task(stopped) {
+			return types.Task{}, false, transient.Errorf("deployer task %s stopped: %s", aws.ToString(stopped.TaskArn), stoppedReason)
+		}
+		return types.Task{}, false, nil
 	}
+	statusManager.EndStep(ctx, store_dynamodb.StepImageBuild, store_dynamodb.StepSucceeded)
+	return stopped, true, nil
+}
 
-	accessKeyId := "AWS_ACCESS_KEY_ID"
-	accessKeyIdValue := creds.AccessKeyID
-	secretAccessKey := "AWS_SECRET_ACCESS_KEY"
-	secretAccessKeyValue := creds.SecretAccessKey
-	sessionToken := "AWS_SESSION_TOKEN"
-	sessionTokenValue := creds.SessionToken
+// recordBuild records the image a successful build pushed and how long it took. kaniko builds and pushes in the
+// one deployer task, so the push step is the image being found in the repository after the task has stopped.
+func recordBuild(ctx context.Context, ecrClient image.ECRAPI, stopped types.Task, repositoryName string, imageTag string, statusManager *status.Manager) {
+	statusManager.StartStep(ctx, store_dynamodb.StepImagePush)
+	detail, err := image.Describe(ctx, ecrClient, repositoryName, imageTag)
+	if err != nil {
+		log.Printf("warning: unable to record image: %s\n", err.Error())
+		statusManager.EndStep(ctx, store_dynamodb.StepImagePush, store_dynamodb.StepFailed)
+		return
+	}
+	statusManager.EndStep(ctx, store_dynamodb.StepImagePush, store_dynamodb.StepSucceeded)
+	statusManager.SetDeploymentImage(ctx, imageTag, aws.ToString(detail.ImageDigest))
+	statusManager.SetBuildMetadata(ctx, store_dynamodb.BuildMetadata{
+		ImageSizeBytes:       aws.ToInt64(detail.ImageSizeInBytes),
+		BuildDurationSeconds: int64(runner.RunDuration(stopped).Seconds()),
+	})
+}
 
-	TaskDefinitionArn := os.Getenv("DEPLOYER_TASK_DEF_ARN")
-	subIdStr := os.Getenv("SUBNET_IDS")
-	SubNetIds := strings.Split(subIdStr, ",")
-	cluster := os.Getenv("CLUSTER_ARN")
-	SecurityGroup := os.Getenv("SECURITY_GROUP")
-	TaskDefContainerName := os.Getenv("DEPLOYER_TASK_DEF_CONTAINER_NAME")
+func Delete(ctx context.Context, applicationUuid string, appProvisioner provisioner.Provisioner, applicationsStore store_dynamodb.DynamoDBStore) error {
+	log.Println("Deleting", applicationUuid)
 
-	runTaskIn := &ecs.RunTaskInput{
-		TaskDefinition: aws.String(TaskDefinitionArn),
-		Cluster:        aws.String(cluster),
-		NetworkConfiguration: &types.NetworkConfiguration{
-			AwsvpcConfiguration: &types.AwsVpcConfiguration{
-				Subnets:        SubNetIds,
-				SecurityGroups: []string{SecurityGroup},
-				AssignPublicIp: types.AssignPublicIpEnabled,
-			},
-		},
-		Overrides: &types.TaskOverride{
-			ContainerOverrides: []types.ContainerOverride{
-				{
-					Name:    &TaskDefContainerName,
-					Command: []string{"--context", deploymentSourceUrl, "--destination", fmt.Sprintf("%s:%s", destinationUrl, tag), "--force"},
-					Environment: []types.KeyValuePair{
-						{
-							Name:  &accessKeyId,
-							Value: &accessKeyIdValue,
-						},
-						{
-							Name:  &sessionToken,
-							Value: &sessionTokenValue,
-						},
-						{
-							Name:  &secretAccessKey,
-							Value: &secretAccessKeyValue,
-						},
-					},
-				},
-			},
-		},
-		LaunchType: types.LaunchTypeFargate,
-		Tags: []types.Tag{
-			{Key: aws.String(provisioner.DeploymentIdTag), Value: aws.String(deploymentId)},
-			{Key: aws.String(provisioner.ApplicationIdTag), Value: aws.String(applicationUuid)},
-		},
+	if err := appProvisioner.Delete(ctx); err != nil {
+		return fmt.Errorf("error deleting infrastructure: :%w", err)
 	}
 
-	taskRunner := runner.NewECSTaskRunner(ecsClient, runTaskIn)
-	runTaskOut, err := taskRunner.Run(ctx)
-	if err != nil {
-		return fmt.Errorf("error running deployment task: %w", err)
-	}
-	if err := runner.GetRunFailures(runTaskOut); err != nil {
-		return fmt.Errorf("error: run failures: %w", err)
+	if err := applicationsStore.Delete(ctx, applicationUuid); err != nil {
+		return fmt.Errorf("error deleting application from store: %w", err)
 	}
 	return nil
 }
 
-func PrivateDeploy(ctx context.Context, applicationUuid string, deploymentId string, sourceUrl string, tag string, destinationUrl string, authToken string, applicationsTable string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client) error {
+func PrivateDeploy(ctx context.Context, cfg aws.Config, applicationUuid string, deploymentId string, sourceType string, sourceUrl string, refType string, ref string, buildOptions build.Options, destinationUrl string, authToken string, applicationsTable string, appProvisioner provisioner.Provisioner, ecsClient *ecs.Client, statusManager *status.Manager) error {
 	creds, err := appProvisioner.GetProvisionerCreds(ctx)
 	if err != nil {
 		return fmt.Errorf("error retrieving credentials: %w", err)
 	}
 
-	deploymentSourceUrl, err := utils.DetermineSourceURL(sourceUrl, tag)
+	deploymentSourceUrl, err := utils.DetermineSourceURL(sourceUrl, refType, ref)
 	if err != nil {
 		return fmt.Errorf("error determining sourceUrl variable for deployment: %w", err)
 	}
+	credentials := sourceCredentials(sourceType, deploymentSourceUrl, authToken)
+	source, err := resolveSource(ctx, deploymentSourceUrl, credentials)
+	if err != nil {
+		return err
+	}
 
 	// destinationUrl already contains the full image reference with unique tag
 	// Format: {ecr_repo}:{source_hash}-{source_tag}
@@ -414,16 +680,17 @@ func PrivateDeploy(ctx context.Context, applicationUuid string, deploymentId str
 		},
 	}
 
-	// Add GIT_TOKEN for kaniko to authenticate with private GitHub repos
-	if authToken != "" {
-		envVars = append(envVars, types.KeyValuePair{
-			Name:  aws.String("GIT_TOKEN"),
-			Value: aws.String(authToken),
-		})
+	// kaniko authenticates with private repos as the user each host expects a token under
+	envVars = append(envVars, gitCredentialsEnvironment(credentials)...)
+
+	deployerTaskDefinitionArn, deregister, err := deployerTaskDefinition(ctx, ecsClient, TaskDefinitionArn, TaskDefContainerName, buildOptions.Secrets)
+	if err != nil {
+		return err
 	}
+	defer deregister()
 
 	runTaskIn := &ecs.RunTaskInput{
-		TaskDefinition: aws.String(TaskDefinitionArn),
+		TaskDefinition: aws.String(deployerTaskDefinitionArn),
 		Cluster:        aws.String(cluster),
 		NetworkConfiguration: &types.NetworkConfiguration{
 			AwsvpcConfiguration: &types.AwsVpcConfiguration{
@@ -436,7 +703,7 @@ func PrivateDeploy(ctx context.Context, applicationUuid string, deploymentId str
 			ContainerOverrides: []types.ContainerOverride{
 				{
 					Name:        &TaskDefContainerName,
-					Command:     []string{"--context", deploymentSourceUrl, "--destination", destinationUrl, "--force"},
+					Command:     append([]string{"--context", source.String(), "--destination", destinationUrl, "--force", pushRetry}, buildOptions.Args()...),
 					Environment: envVars,
 				},
 			},
@@ -456,13 +723,20 @@ func PrivateDeploy(ctx context.Context, applicationUuid string, deploymentId str
 		})
 	}
 
+	statusManager.StartStep(ctx, store_dynamodb.StepImageBuild)
 	taskRunner := runner.NewECSTaskRunner(ecsClient, runTaskIn)
 	runTaskOut, err := taskRunner.Run(ctx)
 	if err != nil {
 		return fmt.Errorf("error running deployment task: %w", err)
 	}
 	if err := runner.GetRunFailures(runTaskOut); err != nil {
-		return fmt.Errorf("error: run failures: %w", err)
+		return transient.Errorf("error: run failures: %w", err)
 	}
-	return nil
+	stopped, ok, err := waitForBuild(ctx, ecsClient, runTaskOut, source, statusManager)
+	if ok {
+		// the appstore repository is in this account
+		imageTag := strings.TrimPrefix(destinationUrl, image.Repository(destinationUrl)+":")
+		recordBuild(ctx, ecr.NewFromConfig(cfg), stopped, image.RepositoryName(destinationUrl), imageTag, statusManager)
+	}
+	return err
 }
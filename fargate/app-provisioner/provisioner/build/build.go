@@ -0,0 +1,96 @@
+// Package build reads the options the service asks an application's image to be built with and turns them into
+// kaniko flags.
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// ContextDirKey is the env var holding the directory of the repository to build from, for monorepos
+const ContextDirKey = "SOURCE_CONTEXT_DIR"
+
+// DockerfileKey is the env var holding the path of the Dockerfile, relative to the build context directory
+const DockerfileKey = "SOURCE_DOCKERFILE"
+
+// BuildArgsKey is the env var holding the build args, as a JSON object
+const BuildArgsKey = "SOURCE_BUILD_ARGS"
+
+// TargetKey is the env var holding the stage of a multi-stage Dockerfile to build
+const TargetKey = "SOURCE_TARGET"
+
+// SecretsKey is the env var referencing the build secrets, as a JSON array of Secret
+const SecretsKey = "SOURCE_BUILD_SECRETS"
+
+// Options are how an application's image is built. The zero value builds the Dockerfile at the root of the
+// repository.
+type Options struct {
+	ContextDir string
+	Dockerfile string
+	BuildArgs  map[string]string
+	Target     string
+	// Secrets are passed as build args too, with values ECS sets in the deployer's environment
+	Secrets []Secret
+}
+
+// FromEnv returns the options set in the provisioner's environment
+func FromEnv() (Options, error) {
+	options := Options{
+		ContextDir: os.Getenv(ContextDirKey),
+		Dockerfile: os.Getenv(DockerfileKey),
+		Target:     os.Getenv(TargetKey),
+	}
+	if buildArgs := os.Getenv(BuildArgsKey); buildArgs != "" {
+		if err := json.Unmarshal([]byte(buildArgs), &options.BuildArgs); err != nil {
+			return Options{}, fmt.Errorf("error parsing %s: %w", BuildArgsKey, err)
+		}
+	}
+	if secrets := os.Getenv(SecretsKey); secrets != "" {
+		if err := json.Unmarshal([]byte(secrets), &options.Secrets); err != nil {
+			return Options{}, fmt.Errorf("error parsing %s: %w", SecretsKey, err)
+		}
+	}
+	return options, nil
+}
+
+// Args returns the kaniko flags for the options that are set. Build args are in order of name, so that the same
+// options always give the same command. A secret is given by its name only, which kaniko takes the value of from its
+// environment, in place of a build arg of the same name.
+func (o Options) Args() []string {
+	var args []string
+	if o.ContextDir != "" {
+		args = append(args, "--context-sub-path", o.ContextDir)
+	}
+	if o.Dockerfile != "" {
+		args = append(args, "--dockerfile", o.Dockerfile)
+	}
+	names := make([]string, 0, len(o.BuildArgs))
+	for name := range o.BuildArgs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if !slices.ContainsFunc(o.Secrets, func(s Secret) bool { return s.Name == name }) {
+			args = append(args, "--build-arg", fmt.Sprintf("%s=%s", name, o.BuildArgs[name]))
+		}
+	}
+	for _, secret := range o.Secrets {
+		args = append(args, "--build-arg", secret.Name)
+	}
+	if o.Target != "" {
+		args = append(args, "--target", o.Target)
+	}
+	return args
+}
+
+// Source returns the identity of the application built from contextDir of the repository at sourceUrl, which
+// names its resources. It is sourceUrl for applications at the root of their repository, so that their resources
+// keep their names.
+func Source(sourceUrl string, contextDir string) string {
+	if contextDir == "" {
+		return sourceUrl
+	}
+	return fmt.Sprintf("%s//%s", sourceUrl, contextDir)
+}
@@ -0,0 +1,66 @@
+package build_test
+
+import (
+	"testing"
+
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/build"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(build.ContextDirKey, "processors/segmentation")
+	t.Setenv(build.DockerfileKey, "docker/Dockerfile")
+	t.Setenv(build.BuildArgsKey, `{"VERSION":"1.0"}`)
+	t.Setenv(build.TargetKey, "runtime")
+	t.Setenv(build.SecretsKey, `[{"name":"PIP_INDEX_URL","store":"ssm","path":"dev/build-secrets/N:organization:1/pypi"}]`)
+
+	options, err := build.FromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, build.Options{
+		ContextDir: "processors/segmentation",
+		Dockerfile: "docker/Dockerfile",
+		BuildArgs:  map[string]string{"VERSION": "1.0"},
+		Target:     "runtime",
+		Secrets:    []build.Secret{{Name: "PIP_INDEX_URL", Store: build.StoreSSM, Path: "dev/build-secrets/N:organization:1/pypi"}},
+	}, options)
+
+	t.Setenv(build.BuildArgsKey, "VERSION=1.0")
+	_, err = build.FromEnv()
+	assert.Error(t, err)
+}
+
+func TestArgs(t *testing.T) {
+	assert.Empty(t, build.Options{}.Args())
+
+	options := build.Options{
+		ContextDir: "processors/segmentation",
+		Dockerfile: "docker/Dockerfile",
+		BuildArgs:  map[string]string{"VERSION": "1.0", "BASE_IMAGE": "python:3.12"},
+		Target:     "runtime",
+	}
+	assert.Equal(t, []string{
+		"--context-sub-path", "processors/segmentation",
+		"--dockerfile", "docker/Dockerfile",
+		"--build-arg", "BASE_IMAGE=python:3.12",
+		"--build-arg", "VERSION=1.0",
+		"--target", "runtime",
+	}, options.Args())
+
+	// A secret takes the place of a build arg of the same name, and its value is never in the command
+	options.Secrets = []build.Secret{{Name: "VERSION", Store: build.StoreSecretsManager, Path: "dev/version"}}
+	assert.Equal(t, []string{
+		"--context-sub-path", "processors/segmentation",
+		"--dockerfile", "docker/Dockerfile",
+		"--build-arg", "BASE_IMAGE=python:3.12",
+		"--build-arg", "VERSION",
+		"--target", "runtime",
+	}, options.Args())
+}
+
+func TestSource(t *testing.T) {
+	sourceUrl := "https://github.com/org/monorepo"
+	assert.Equal(t, sourceUrl, build.Source(sourceUrl, ""))
+	assert.Equal(t, "https://github.com/org/monorepo//processors/segmentation", build.Source(sourceUrl, "processors/segmentation"))
+	assert.NotEqual(t, build.Source(sourceUrl, "processors/a"), build.Source(sourceUrl, "processors/b"))
+}
@@ -0,0 +1,83 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/taskdef"
+)
+
+// Secret stores are the services a build secret may be kept in
+const (
+	StoreSSM            = "ssm"
+	StoreSecretsManager = "secretsmanager"
+)
+
+// Secret references a value the image is built with that must not be seen outside the build: not in the
+// deployer's overrides, nor in its command. ECS reads it when the deployer task starts and sets the env var Name,
+// which kaniko passes as the build arg of that name.
+type Secret struct {
+	Name string `json:"name"`
+	// Store is StoreSSM or StoreSecretsManager
+	Store string `json:"store"`
+	// Path is the name of the parameter or secret, without a leading slash
+	Path string `json:"path"`
+}
+
+// ValueFrom returns the ARN of the secret in the given region and account, for a container definition
+func (s Secret) ValueFrom(region string, accountId string) (string, error) {
+	switch s.Store {
+	case StoreSSM:
+		return fmt.Sprintf("arn:aws:ssm:%s:%s:parameter/%s", region, accountId, s.Path), nil
+	case StoreSecretsManager:
+		return fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s", region, accountId, s.Path), nil
+	}
+	return "", fmt.Errorf("build secret %s has unknown store %q", s.Name, s.Store)
+}
+
+// TaskDefinitionAPI is an interface only containing the ECS client methods used by WithSecrets
+type TaskDefinitionAPI = taskdef.API
+
+// WithSecrets registers a revision of the deployer task definition whose container containerName has secrets set in
+// its environment, and returns its ARN. The secrets are kept in the deployer's region and account. Without secrets
+// the deployer task definition is returned as it is. Container overrides cannot set secrets, which is why each
+// build with secrets has a revision of its own.
+func WithSecrets(ctx context.Context, api TaskDefinitionAPI, taskDefinitionArn string, containerName string, secrets []Secret) (string, error) {
+	if len(secrets) == 0 {
+		return taskDefinitionArn, nil
+	}
+	// arn:aws:ecs:{region}:{account}:task-definition/{family}:{revision}
+	parts := strings.Split(taskDefinitionArn, ":")
+	if len(parts) < 6 {
+		return "", fmt.Errorf("%s is not a task definition ARN", taskDefinitionArn)
+	}
+	region, accountId := parts[3], parts[4]
+	containerSecrets := make([]types.Secret, len(secrets))
+	for i, secret := range secrets {
+		valueFrom, err := secret.ValueFrom(region, accountId)
+		if err != nil {
+			return "", err
+		}
+		containerSecrets[i] = types.Secret{Name: aws.String(secret.Name), ValueFrom: aws.String(valueFrom)}
+	}
+
+	return taskdef.Revise(ctx, api, taskDefinitionArn, func(current []types.ContainerDefinition) ([]types.ContainerDefinition, bool, error) {
+		found := false
+		containers := make([]types.ContainerDefinition, len(current))
+		for i, container := range current {
+			if aws.ToString(container.Name) == containerName {
+				container.Secrets = slices.Concat(container.Secrets, containerSecrets)
+				found = true
+			}
+			containers[i] = container
+		}
+		if !found {
+			return nil, false, fmt.Errorf("task definition %s has no container %s", taskDefinitionArn, containerName)
+		}
+		return containers, true, nil
+	})
+}
@@ -0,0 +1,83 @@
+package build_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/build"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deployerTaskDefinitionArn = "arn:aws:ecs:us-east-1:123456789012:task-definition/dev-app-deployer:3"
+
+type mockTaskDefinitionAPI struct {
+	registered *ecs.RegisterTaskDefinitionInput
+}
+
+func (m *mockTaskDefinitionAPI) DescribeTaskDefinition(_ context.Context, params *ecs.DescribeTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{
+		TaskDefinition: &types.TaskDefinition{
+			TaskDefinitionArn: params.TaskDefinition,
+			Family:            aws.String("dev-app-deployer"),
+			ContainerDefinitions: []types.ContainerDefinition{
+				{Name: aws.String("app-deployer")},
+				{Name: aws.String("sidecar")},
+			},
+		},
+		Tags: []types.Tag{{Key: aws.String("service"), Value: aws.String("app-deploy-service")}},
+	}, nil
+}
+
+func (m *mockTaskDefinitionAPI) RegisterTaskDefinition(_ context.Context, params *ecs.RegisterTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.RegisterTaskDefinitionOutput, error) {
+	m.registered = params
+	return &ecs.RegisterTaskDefinitionOutput{
+		TaskDefinition: &types.TaskDefinition{
+			TaskDefinitionArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/dev-app-deployer:4"),
+		},
+	}, nil
+}
+
+func TestValueFrom(t *testing.T) {
+	valueFrom, err := build.Secret{Name: "PIP_INDEX_URL", Store: build.StoreSSM, Path: "dev/pypi"}.ValueFrom("us-east-1", "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:ssm:us-east-1:123456789012:parameter/dev/pypi", valueFrom)
+
+	valueFrom, err = build.Secret{Name: "NPM_TOKEN", Store: build.StoreSecretsManager, Path: "dev/npm"}.ValueFrom("us-east-1", "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:secretsmanager:us-east-1:123456789012:secret:dev/npm", valueFrom)
+
+	_, err = build.Secret{Name: "NPM_TOKEN", Store: "vault", Path: "dev/npm"}.ValueFrom("us-east-1", "123456789012")
+	assert.Error(t, err)
+}
+
+func TestWithSecrets(t *testing.T) {
+	api := &mockTaskDefinitionAPI{}
+
+	arn, err := build.WithSecrets(context.Background(), api, deployerTaskDefinitionArn, "app-deployer", nil)
+	require.NoError(t, err)
+	assert.Equal(t, deployerTaskDefinitionArn, arn)
+	assert.Nil(t, api.registered)
+
+	secrets := []build.Secret{{Name: "PIP_INDEX_URL", Store: build.StoreSSM, Path: "dev/pypi"}}
+	arn, err = build.WithSecrets(context.Background(), api, deployerTaskDefinitionArn, "app-deployer", secrets)
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:task-definition/dev-app-deployer:4", arn)
+	require.NotNil(t, api.registered)
+	assert.Equal(t, "dev-app-deployer", aws.ToString(api.registered.Family))
+	assert.Len(t, api.registered.Tags, 1)
+	assert.Equal(t, []types.Secret{{
+		Name:      aws.String("PIP_INDEX_URL"),
+		ValueFrom: aws.String("arn:aws:ssm:us-east-1:123456789012:parameter/dev/pypi"),
+	}}, api.registered.ContainerDefinitions[0].Secrets)
+	assert.Empty(t, api.registered.ContainerDefinitions[1].Secrets)
+
+	_, err = build.WithSecrets(context.Background(), api, deployerTaskDefinitionArn, "missing", secrets)
+	assert.Error(t, err)
+
+	_, err = build.WithSecrets(context.Background(), api, "dev-app-deployer", "app-deployer", secrets)
+	assert.Error(t, err)
+}
@@ -17,3 +17,6 @@ const ApplicationIdTag = "ApplicationId"
 // ApplicationsTableTag overrides the default applications table for the deployment.
 // Used by appstore deployments to point the status handler at the appstore-specific table.
 const ApplicationsTableTag = "ApplicationsTable"
+
+// SourceTokenParameterKey is the env var naming the SSM parameter that holds the token of a private source
+const SourceTokenParameterKey = "AUTH_TOKEN_PARAMETER"
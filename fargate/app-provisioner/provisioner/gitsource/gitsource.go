@@ -0,0 +1,259 @@
+// Package gitsource resolves the kaniko git build context of an application to the commit that will be built.
+package gitsource
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrRefNotFound is returned when the remote does not advertise the requested ref
+var ErrRefNotFound = errors.New("ref not found")
+
+// Ref types name what a deployment builds: a tag, the head of a branch, or a commit by its full SHA
+const (
+	RefTypeTag    = "tag"
+	RefTypeBranch = "branch"
+	RefTypeCommit = "commit"
+)
+
+// Context is a kaniko git build context, git://{host}/{path}[#{ref}[#{commit}]].
+type Context struct {
+	Repository string
+	Ref        string
+	Commit     string
+}
+
+// ParseContext splits a kaniko git build context into its parts.
+func ParseContext(contextUrl string) Context {
+	parts := strings.SplitN(contextUrl, "#", 3)
+	c := Context{Repository: parts[0]}
+	if len(parts) > 1 {
+		c.Ref = parts[1]
+	}
+	if len(parts) > 2 {
+		c.Commit = parts[2]
+	}
+	return c
+}
+
+// AtRef returns the context of ref in the context's repository, a tag or branch name or a full commit SHA by
+// refType. A commit has no ref until it is resolved. An empty ref is the default branch.
+func (c Context) AtRef(refType string, ref string) Context {
+	at := Context{Repository: c.Repository}
+	switch {
+	case ref == "":
+	case refType == RefTypeCommit:
+		at.Commit = ref
+	case refType == RefTypeBranch:
+		at.Ref = "refs/heads/" + strings.TrimPrefix(ref, "refs/heads/")
+	default:
+		at.Ref = "refs/tags/" + strings.TrimPrefix(ref, "refs/tags/")
+	}
+	return at
+}
+
+// String returns the context in the form kaniko accepts. kaniko only checks out a commit given with a ref, so a
+// commit without one is only meaningful to Resolve.
+func (c Context) String() string {
+	switch {
+	case c.Commit != "":
+		return fmt.Sprintf("%s#%s#%s", c.Repository, c.Ref, c.Commit)
+	case c.Ref != "":
+		return fmt.Sprintf("%s#%s", c.Repository, c.Ref)
+	default:
+		return c.Repository
+	}
+}
+
+// HTTPSUrl is the URL git clones the context's repository from. kaniko clones git:// contexts over https.
+func (c Context) HTTPSUrl() string {
+	if rest, ok := strings.CutPrefix(c.Repository, "git://"); ok {
+		return "https://" + rest
+	}
+	return c.Repository
+}
+
+// Credentials authenticate git over https, as the user and password of basic auth
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// TokenCredentials returns the credentials that authenticate token with the host of a repository of sourceType.
+// Each host expects a token under a different user name. A source without a type is typed by its host.
+func TokenCredentials(sourceType string, repositoryUrl string, token string) Credentials {
+	if token == "" {
+		return Credentials{}
+	}
+	if sourceType == "" {
+		host := ""
+		if u, err := url.Parse(repositoryUrl); err == nil {
+			host = strings.ToLower(u.Hostname())
+		}
+		switch {
+		case host == "github.com":
+			sourceType = "github"
+		case host == "bitbucket.org":
+			sourceType = "bitbucket"
+		case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+			sourceType = "gitlab"
+		}
+	}
+	switch strings.ToLower(sourceType) {
+	case "github":
+		return Credentials{Username: "x-access-token", Password: token}
+	case "gitlab":
+		return Credentials{Username: "oauth2", Password: token}
+	case "bitbucket":
+		return Credentials{Username: "x-token-auth", Password: token}
+	}
+	return Credentials{Username: "git", Password: token}
+}
+
+// Resolve returns the context pinned to the commit its ref currently points at. A context without a ref is
+// pinned to the remote's default branch. A context that already names a commit and a ref is returned unchanged,
+// and one naming only a commit is given the default branch as its ref. kaniko fetches the commit after cloning the
+// ref, so it need not be on the branch.
+func Resolve(ctx context.Context, client *http.Client, contextUrl string, credentials Credentials) (Context, error) {
+	c := ParseContext(contextUrl)
+	if c.Commit != "" && c.Ref != "" {
+		return c, nil
+	}
+	refs, err := ListRefs(ctx, client, c.HTTPSUrl(), credentials)
+	if err != nil {
+		return Context{}, err
+	}
+	if c.Commit != "" {
+		if refs.Head == "" {
+			return Context{}, fmt.Errorf("error resolving %s: HEAD: %w", contextUrl, ErrRefNotFound)
+		}
+		c.Ref = refs.Head
+		return c, nil
+	}
+	ref, commit, err := refs.Resolve(c.Ref)
+	if err != nil {
+		return Context{}, fmt.Errorf("error resolving %s: %w", contextUrl, err)
+	}
+	c.Ref = ref
+	c.Commit = commit
+	return c, nil
+}
+
+// Unresolved returns the context of contextUrl as given, for a build to go ahead after Resolve failed with err.
+// kaniko clones the repository itself, and may be able to where listing its refs failed, so only the commit the
+// build records is lost. It reports false if kaniko could not build the context either: a ref the remote does not
+// have, or a commit without a ref, which kaniko cannot check out.
+func Unresolved(contextUrl string, err error) (Context, bool) {
+	c := ParseContext(contextUrl)
+	if errors.Is(err, ErrRefNotFound) || (c.Commit != "" && c.Ref == "") {
+		return Context{}, false
+	}
+	return c, true
+}
+
+// Refs are the refs a remote advertises, by name, and the ref its HEAD points at.
+type Refs struct {
+	Head   string
+	Commit map[string]string
+}
+
+// Resolve returns the full name of ref and the commit it points at. Short branch and tag names are accepted,
+// annotated tags are peeled to their commit, and an empty ref means HEAD.
+func (r Refs) Resolve(ref string) (string, string, error) {
+	if ref == "" || ref == "HEAD" {
+		if r.Head == "" {
+			return "", "", fmt.Errorf("HEAD: %w", ErrRefNotFound)
+		}
+		ref = r.Head
+	}
+	for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref} {
+		if peeled, ok := r.Commit[name+"^{}"]; ok {
+			return name, peeled, nil
+		}
+		if commit, ok := r.Commit[name]; ok {
+			return name, commit, nil
+		}
+	}
+	return "", "", fmt.Errorf("%s: %w", ref, ErrRefNotFound)
+}
+
+// ListRefs lists the refs of the repository at repositoryUrl using git's smart HTTP protocol, as git ls-remote
+// does. credentials, if set, authenticate the request.
+func ListRefs(ctx context.Context, client *http.Client, repositoryUrl string, credentials Credentials) (Refs, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(repositoryUrl, "/")+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return Refs{}, fmt.Errorf("error creating refs request: %w", err)
+	}
+	if credentials.Password != "" {
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Refs{}, fmt.Errorf("error listing refs of %s: %w", repositoryUrl, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Refs{}, fmt.Errorf("error listing refs of %s: %s", repositoryUrl, resp.Status)
+	}
+	return parseRefs(resp.Body)
+}
+
+// parseRefs reads a git-upload-pack ref advertisement. Each line is "{commit} {ref}", and the first ref line also
+// carries the capabilities after a NUL, among them symref=HEAD:{ref}.
+func parseRefs(body io.Reader) (Refs, error) {
+	refs := Refs{Commit: map[string]string{}}
+	r := bufio.NewReader(body)
+	for {
+		line, err := readPktLine(r)
+		if err == io.EOF {
+			return refs, nil
+		}
+		if err != nil {
+			return Refs{}, err
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line, capabilities, _ := strings.Cut(strings.TrimSuffix(line, "\n"), "\x00")
+		for _, capability := range strings.Fields(capabilities) {
+			if target, ok := strings.CutPrefix(capability, "symref=HEAD:"); ok {
+				refs.Head = target
+			}
+		}
+		commit, name, ok := strings.Cut(line, " ")
+		if ok {
+			refs.Commit[name] = commit
+		}
+	}
+}
+
+// readPktLine returns the payload of the next pkt-line, or an empty string for a flush packet.
+func readPktLine(r *bufio.Reader) (string, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", err
+	}
+	n, err := strconv.ParseUint(string(size[:]), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("malformed pkt-line length %q", size)
+	}
+	if n == 0 {
+		return "", nil
+	}
+	if n < 4 {
+		return "", fmt.Errorf("malformed pkt-line length %d", n)
+	}
+	payload := make([]byte, n-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
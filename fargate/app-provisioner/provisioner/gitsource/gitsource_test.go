@@ -0,0 +1,149 @@
+package gitsource_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/gitsource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mainCommit   = "1111111111111111111111111111111111111111"
+	tagObject    = "2222222222222222222222222222222222222222"
+	taggedCommit = "3333333333333333333333333333333333333333"
+)
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+func advertisement() string {
+	return pktLine("# service=git-upload-pack\n") + "0000" +
+		pktLine(mainCommit+" HEAD\x00multi_ack symref=HEAD:refs/heads/main agent=git/2\n") +
+		pktLine(mainCommit+" refs/heads/main\n") +
+		pktLine(tagObject+" refs/tags/v1.0.0\n") +
+		pktLine(taggedCommit+" refs/tags/v1.0.0^{}\n") +
+		"0000"
+}
+
+func TestParseContext(t *testing.T) {
+	c := gitsource.ParseContext("git://github.com/org/repo#refs/tags/v1#abc")
+	assert.Equal(t, gitsource.Context{Repository: "git://github.com/org/repo", Ref: "refs/tags/v1", Commit: "abc"}, c)
+	assert.Equal(t, "git://github.com/org/repo#refs/tags/v1#abc", c.String())
+	assert.Equal(t, "https://github.com/org/repo", c.HTTPSUrl())
+
+	assert.Equal(t, "git://github.com/org/repo", gitsource.ParseContext("git://github.com/org/repo").String())
+}
+
+func TestAtRef(t *testing.T) {
+	c := gitsource.ParseContext("git://github.com/org/repo#refs/tags/v1#abc")
+	assert.Equal(t, "git://github.com/org/repo#refs/tags/v2", c.AtRef(gitsource.RefTypeTag, "v2").String())
+	assert.Equal(t, "git://github.com/org/repo#refs/heads/feature/x", c.AtRef(gitsource.RefTypeBranch, "feature/x").String())
+	assert.Equal(t, "git://github.com/org/repo##def", c.AtRef(gitsource.RefTypeCommit, "def").String())
+	assert.Equal(t, "git://github.com/org/repo", c.AtRef(gitsource.RefTypeBranch, "").String())
+	assert.Equal(t, gitsource.Context{Repository: "git://github.com/org/repo", Commit: "def"}, gitsource.ParseContext("git://github.com/org/repo##def"))
+}
+
+func TestResolve(t *testing.T) {
+	var auth string
+	// kaniko contexts are cloned over https
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/org/repo/info/refs", r.URL.Path)
+		assert.Equal(t, "git-upload-pack", r.URL.Query().Get("service"))
+		auth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(advertisement()))
+	}))
+	defer server.Close()
+	repository := strings.Replace(server.URL, "https://", "git://", 1) + "/org/repo"
+
+	refs, err := gitsource.ListRefs(context.Background(), server.Client(), server.URL+"/org/repo", gitsource.Credentials{Username: "x-access-token", Password: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/main", refs.Head)
+	assert.NotEmpty(t, auth)
+
+	// the default branch, when no ref is given
+	ref, commit, err := refs.Resolve("")
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/main", ref)
+	assert.Equal(t, mainCommit, commit)
+
+	// annotated tags resolve to the commit, not the tag object
+	ref, commit, err = refs.Resolve("v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "refs/tags/v1.0.0", ref)
+	assert.Equal(t, taggedCommit, commit)
+
+	_, _, err = refs.Resolve("refs/heads/missing")
+	assert.ErrorIs(t, err, gitsource.ErrRefNotFound)
+
+	// a context naming a commit is not looked up
+	pinned, err := gitsource.Resolve(context.Background(), server.Client(), repository+"#refs/heads/main#abc", gitsource.Credentials{})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", pinned.Commit)
+
+	// a commit without a ref is checked out from the default branch
+	pinned, err = gitsource.Resolve(context.Background(), server.Client(), repository+"##abc", gitsource.Credentials{})
+	require.NoError(t, err)
+	assert.Equal(t, gitsource.Context{Repository: repository, Ref: "refs/heads/main", Commit: "abc"}, pinned)
+}
+
+func TestListRefsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := gitsource.ListRefs(context.Background(), server.Client(), server.URL+"/org/missing", gitsource.Credentials{})
+	assert.Error(t, err)
+}
+
+func TestUnresolved(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	repository := server.URL + "/org/private"
+
+	// kaniko clones the repository itself, so a ref is still built when listing it fails
+	_, err := gitsource.Resolve(context.Background(), server.Client(), repository+"#refs/tags/v1.0.0", gitsource.Credentials{})
+	require.Error(t, err)
+	source, ok := gitsource.Unresolved(repository+"#refs/tags/v1.0.0", err)
+	assert.True(t, ok)
+	assert.Equal(t, gitsource.Context{Repository: repository, Ref: "refs/tags/v1.0.0"}, source)
+
+	// but not a commit without a ref, which kaniko cannot check out
+	_, err = gitsource.Resolve(context.Background(), server.Client(), repository+"##abc", gitsource.Credentials{})
+	require.Error(t, err)
+	_, ok = gitsource.Unresolved(repository+"##abc", err)
+	assert.False(t, ok)
+
+	// nor a ref the remote does not have
+	_, ok = gitsource.Unresolved(repository+"#refs/tags/v9.9.9", fmt.Errorf("error resolving: %w", gitsource.ErrRefNotFound))
+	assert.False(t, ok)
+}
+
+func TestTokenCredentials(t *testing.T) {
+	tests := []struct {
+		sourceType    string
+		repositoryUrl string
+		username      string
+	}{
+		{"github", "https://github.com/org/repo", "x-access-token"},
+		{"gitlab", "https://code.example.edu/lab/repo", "oauth2"},
+		{"bitbucket", "https://bitbucket.org/workspace/repo", "x-token-auth"},
+		{"", "https://gitlab.com/group/subgroup/repo", "oauth2"},
+		{"", "https://github.com/org/repo", "x-access-token"},
+		{"", "https://git.example.edu/lab/repo", "git"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, gitsource.Credentials{Username: tt.username, Password: "token"},
+			gitsource.TokenCredentials(tt.sourceType, tt.repositoryUrl, "token"), tt.repositoryUrl)
+	}
+	assert.Equal(t, gitsource.Credentials{}, gitsource.TokenCredentials("github", "https://github.com/org/repo", ""))
+}
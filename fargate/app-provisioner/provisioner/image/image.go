@@ -0,0 +1,147 @@
+// Package image manages the application images the deployer pushes to ECR and the task definitions that run them.
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/taskdef"
+)
+
+// LatestTag is the tag the application's task definition runs unless it has been pinned by a rollback
+const LatestTag = "latest"
+
+// ECRAPI is an interface only containing the ECR client methods used by this package
+type ECRAPI interface {
+	DescribeImages(ctx context.Context, params *ecr.DescribeImagesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeImagesOutput, error)
+	BatchGetImage(ctx context.Context, params *ecr.BatchGetImageInput, optFns ...func(*ecr.Options)) (*ecr.BatchGetImageOutput, error)
+	PutImage(ctx context.Context, params *ecr.PutImageInput, optFns ...func(*ecr.Options)) (*ecr.PutImageOutput, error)
+}
+
+// TaskDefinitionAPI is an interface only containing the ECS client methods used by this package
+type TaskDefinitionAPI = taskdef.API
+
+// DeploymentTag is the tag each build is pushed with in addition to latest. It is never reused, so it identifies
+// the image a deployment built for as long as the image is kept.
+func DeploymentTag(deploymentId string) string {
+	return fmt.Sprintf("deployment-%s", deploymentId)
+}
+
+// Pinned returns the reference to the image in repositoryUrl with the given digest.
+func Pinned(repositoryUrl string, digest string) string {
+	return fmt.Sprintf("%s@%s", repositoryUrl, digest)
+}
+
+// IsPinned reports whether an image reference names an image by digest.
+func IsPinned(image string) bool {
+	return strings.Contains(image, "@")
+}
+
+// Same reports whether two image references name the same image, treating a reference with no tag as latest.
+func Same(a string, b string) bool {
+	return normalize(a) == normalize(b)
+}
+
+func normalize(image string) string {
+	if IsPinned(image) || Repository(image) != image {
+		return image
+	}
+	return fmt.Sprintf("%s:%s", image, LatestTag)
+}
+
+// Repository strips any tag or digest from an image reference.
+func Repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// a colon before the last slash belongs to a registry port, not a tag
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// RepositoryName returns the ECR repository name from a repository URL of the form
+// {account}.dkr.ecr.{region}.amazonaws.com/{name}.
+func RepositoryName(repositoryUrl string) string {
+	repository := Repository(repositoryUrl)
+	if i := strings.Index(repository, "/"); i >= 0 {
+		return repository[i+1:]
+	}
+	return repository
+}
+
+// Describe returns the details of the image with the given tag.
+func Describe(ctx context.Context, api ECRAPI, repositoryName string, tag string) (ecrTypes.ImageDetail, error) {
+	out, err := api.DescribeImages(ctx, &ecr.DescribeImagesInput{
+		RepositoryName: aws.String(repositoryName),
+		ImageIds:       []ecrTypes.ImageIdentifier{{ImageTag: aws.String(tag)}},
+	})
+	if err != nil {
+		return ecrTypes.ImageDetail{}, fmt.Errorf("error describing image %s:%s: %w", repositoryName, tag, err)
+	}
+	if len(out.ImageDetails) == 0 || aws.ToString(out.ImageDetails[0].ImageDigest) == "" {
+		return ecrTypes.ImageDetail{}, fmt.Errorf("image %s:%s not found", repositoryName, tag)
+	}
+	return out.ImageDetails[0], nil
+}
+
+// ResolveDigest returns the digest of the image with the given tag.
+func ResolveDigest(ctx context.Context, api ECRAPI, repositoryName string, tag string) (string, error) {
+	detail, err := Describe(ctx, api, repositoryName, tag)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(detail.ImageDigest), nil
+}
+
+// Retag points tag at the image with the given digest.
+func Retag(ctx context.Context, api ECRAPI, repositoryName string, digest string, tag string) error {
+	out, err := api.BatchGetImage(ctx, &ecr.BatchGetImageInput{
+		RepositoryName: aws.String(repositoryName),
+		ImageIds:       []ecrTypes.ImageIdentifier{{ImageDigest: aws.String(digest)}},
+	})
+	if err != nil {
+		return fmt.Errorf("error getting image %s@%s: %w", repositoryName, digest, err)
+	}
+	if len(out.Images) == 0 {
+		return fmt.Errorf("image %s@%s not found", repositoryName, digest)
+	}
+	found := out.Images[0]
+	_, err = api.PutImage(ctx, &ecr.PutImageInput{
+		RepositoryName:         aws.String(repositoryName),
+		ImageManifest:          found.ImageManifest,
+		ImageManifestMediaType: found.ImageManifestMediaType,
+		ImageDigest:            aws.String(digest),
+		ImageTag:               aws.String(tag),
+	})
+	var alreadyTagged *ecrTypes.ImageAlreadyExistsException
+	if err != nil && !errors.As(err, &alreadyTagged) {
+		return fmt.Errorf("error tagging image %s@%s as %s: %w", repositoryName, digest, tag, err)
+	}
+	return nil
+}
+
+// PointTaskDefinition registers a revision of the task definition in which every container running an image from
+// repositoryUrl runs image instead, and returns its ARN. If no container needs to change, the ARN it was given is
+// returned and nothing is registered.
+func PointTaskDefinition(ctx context.Context, api TaskDefinitionAPI, taskDefinitionArn string, repositoryUrl string, image string) (string, error) {
+	return taskdef.Revise(ctx, api, taskDefinitionArn, func(current []ecsTypes.ContainerDefinition) ([]ecsTypes.ContainerDefinition, bool, error) {
+		changed := false
+		containers := make([]ecsTypes.ContainerDefinition, len(current))
+		for i, container := range current {
+			if Repository(aws.ToString(container.Image)) == Repository(repositoryUrl) && !Same(aws.ToString(container.Image), image) {
+				container.Image = aws.String(image)
+				changed = true
+			}
+			containers[i] = container
+		}
+		return containers, changed, nil
+	})
+}
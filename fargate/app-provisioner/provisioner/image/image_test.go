@@ -0,0 +1,127 @@
+package image_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/image"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const repositoryUrl = "123456789012.dkr.ecr.us-east-1.amazonaws.com/app-3672999531"
+
+func TestRepositoryName(t *testing.T) {
+	assert.Equal(t, "app-3672999531", image.RepositoryName(repositoryUrl))
+	assert.Equal(t, "app-3672999531", image.RepositoryName(repositoryUrl+":latest"))
+	assert.Equal(t, "app-3672999531", image.RepositoryName(image.Pinned(repositoryUrl, "sha256:abc")))
+	assert.Equal(t, "localhost:5000/app", image.Repository("localhost:5000/app:v1"))
+}
+
+func TestSame(t *testing.T) {
+	assert.True(t, image.Same(repositoryUrl, repositoryUrl+":latest"))
+	assert.False(t, image.Same(repositoryUrl, image.Pinned(repositoryUrl, "sha256:abc")))
+	assert.False(t, image.Same(repositoryUrl, repositoryUrl+":"+image.DeploymentTag("d1")))
+}
+
+type fakeECR struct {
+	digests map[string]string
+	puts    []ecr.PutImageInput
+	putErr  error
+}
+
+func (f *fakeECR) DescribeImages(_ context.Context, params *ecr.DescribeImagesInput, _ ...func(*ecr.Options)) (*ecr.DescribeImagesOutput, error) {
+	out := &ecr.DescribeImagesOutput{}
+	if digest, ok := f.digests[aws.ToString(params.ImageIds[0].ImageTag)]; ok {
+		out.ImageDetails = []ecrTypes.ImageDetail{{ImageDigest: aws.String(digest)}}
+	}
+	return out, nil
+}
+
+func (f *fakeECR) BatchGetImage(_ context.Context, params *ecr.BatchGetImageInput, _ ...func(*ecr.Options)) (*ecr.BatchGetImageOutput, error) {
+	return &ecr.BatchGetImageOutput{Images: []ecrTypes.Image{{
+		ImageId:       &params.ImageIds[0],
+		ImageManifest: aws.String("{}"),
+	}}}, nil
+}
+
+func (f *fakeECR) PutImage(_ context.Context, params *ecr.PutImageInput, _ ...func(*ecr.Options)) (*ecr.PutImageOutput, error) {
+	f.puts = append(f.puts, *params)
+	return &ecr.PutImageOutput{}, f.putErr
+}
+
+func TestResolveDigest(t *testing.T) {
+	api := &fakeECR{digests: map[string]string{"deployment-d1": "sha256:abc"}}
+
+	digest, err := image.ResolveDigest(context.Background(), api, "app", "deployment-d1")
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:abc", digest)
+
+	_, err = image.ResolveDigest(context.Background(), api, "app", "deployment-gone")
+	assert.Error(t, err)
+}
+
+func TestRetag(t *testing.T) {
+	api := &fakeECR{}
+	require.NoError(t, image.Retag(context.Background(), api, "app", "sha256:abc", image.LatestTag))
+	require.Len(t, api.puts, 1)
+	assert.Equal(t, "latest", aws.ToString(api.puts[0].ImageTag))
+	assert.Equal(t, "sha256:abc", aws.ToString(api.puts[0].ImageDigest))
+
+	// latest already pointing at the digest is not an error
+	api.putErr = &ecrTypes.ImageAlreadyExistsException{Message: aws.String("exists")}
+	assert.NoError(t, image.Retag(context.Background(), api, "app", "sha256:abc", image.LatestTag))
+}
+
+type fakeTaskDefinitions struct {
+	current    ecsTypes.TaskDefinition
+	registered []ecs.RegisterTaskDefinitionInput
+}
+
+func (f *fakeTaskDefinitions) DescribeTaskDefinition(_ context.Context, _ *ecs.DescribeTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &f.current}, nil
+}
+
+func (f *fakeTaskDefinitions) RegisterTaskDefinition(_ context.Context, params *ecs.RegisterTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.RegisterTaskDefinitionOutput, error) {
+	f.registered = append(f.registered, *params)
+	return &ecs.RegisterTaskDefinitionOutput{TaskDefinition: &ecsTypes.TaskDefinition{
+		TaskDefinitionArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/app:2"),
+	}}, nil
+}
+
+func TestPointTaskDefinition(t *testing.T) {
+	api := &fakeTaskDefinitions{current: ecsTypes.TaskDefinition{
+		Family: aws.String("app"),
+		Cpu:    aws.String("2048"),
+		ContainerDefinitions: []ecsTypes.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String(repositoryUrl)},
+			{Name: aws.String("sidecar"), Image: aws.String("public.ecr.aws/sidecar:1")},
+		},
+	}}
+	pinned := image.Pinned(repositoryUrl, "sha256:abc")
+
+	arn, err := image.PointTaskDefinition(context.Background(), api, "arn:app:1", repositoryUrl, pinned)
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:task-definition/app:2", arn)
+	require.Len(t, api.registered, 1)
+	registered := api.registered[0]
+	assert.Equal(t, "2048", aws.ToString(registered.Cpu))
+	assert.Equal(t, pinned, aws.ToString(registered.ContainerDefinitions[0].Image))
+	assert.Equal(t, "public.ecr.aws/sidecar:1", aws.ToString(registered.ContainerDefinitions[1].Image))
+}
+
+func TestPointTaskDefinitionUnchanged(t *testing.T) {
+	api := &fakeTaskDefinitions{current: ecsTypes.TaskDefinition{
+		ContainerDefinitions: []ecsTypes.ContainerDefinition{{Image: aws.String(repositoryUrl + ":latest")}},
+	}}
+
+	arn, err := image.PointTaskDefinition(context.Background(), api, "arn:app:1", repositoryUrl, repositoryUrl)
+	require.NoError(t, err)
+	assert.Equal(t, "arn:app:1", arn)
+	assert.Empty(t, api.registered)
+}
@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// WaitForStop waits up to maxWait for a task to stop and returns its final description.
+func WaitForStop(ctx context.Context, client ecs.DescribeTasksAPIClient, cluster string, taskArn string, maxWait time.Duration) (types.Task, error) {
+	out, err := ecs.NewTasksStoppedWaiter(client).WaitForOutput(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   []string{taskArn},
+	}, maxWait)
+	if err != nil {
+		return types.Task{}, fmt.Errorf("error waiting for task %s to stop: %w", taskArn, err)
+	}
+	if len(out.Tasks) == 0 {
+		return types.Task{}, fmt.Errorf("task %s not found", taskArn)
+	}
+	return out.Tasks[0], nil
+}
+
+// Succeeded reports whether every container of a stopped task exited with status 0.
+func Succeeded(task types.Task) bool {
+	for _, container := range task.Containers {
+		if container.ExitCode == nil || *container.ExitCode != 0 {
+			return false
+		}
+	}
+	return len(task.Containers) > 0
+}
+
+// RunDuration is how long a stopped task's containers ran, from the task starting to its containers exiting. It
+// excludes provisioning and image pulls.
+func RunDuration(task types.Task) time.Duration {
+	if task.StartedAt == nil || task.ExecutionStoppedAt == nil {
+		return 0
+	}
+	return task.ExecutionStoppedAt.Sub(*task.StartedAt)
+}
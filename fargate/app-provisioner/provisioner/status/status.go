@@ -2,9 +2,10 @@ package status
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/status/events"
 	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 	pennsievePusher "github.com/pennsieve/pennsieve-go-core/pkg/models/pusher"
 	"github.com/pusher/pusher-http-go/v5"
 	"log"
@@ -58,7 +59,16 @@ func (m *Manager) WithPusher(pusherConfig *pennsievePusher.Config) *Manager {
 }
 
 func (m *Manager) SetErrorStatus(ctx context.Context, err error) {
-	msg := fmt.Sprintf("error: %s", err.Error())
+	m.setFailedStatus(ctx, statemachine.ErrorStatus(err.Error()))
+}
+
+// SetDeleteErrorStatus records that deleting the application failed with err. Only the delete itself records this
+// status, as an application being deleted takes no other error.
+func (m *Manager) SetDeleteErrorStatus(ctx context.Context, err error) {
+	m.setFailedStatus(ctx, statemachine.DeleteErrorStatus(err.Error()))
+}
+
+func (m *Manager) setFailedStatus(ctx context.Context, msg string) {
 	if appStoreErr := m.StatusStore.UpdateStatus(ctx, msg, m.ApplicationId); appStoreErr != nil {
 		log.Printf("warning: error updating applications table with error: %s: %s\n", msg, appStoreErr.Error())
 	}
@@ -68,10 +78,75 @@ func (m *Manager) SetErrorStatus(ctx context.Context, err error) {
 		}
 	}
 	m.sendApplicationStatusEvent(msg, true)
+	m.EndStep(ctx, store_dynamodb.StepDone, store_dynamodb.StepFailed)
+}
+
+// SetTransientError records a transient failure on the current deployment. Its status is left alone, as the status
+// listener retries the deployment, or marks it errored once it is out of attempts.
+func (m *Manager) SetTransientError(ctx context.Context, err error) {
+	if m.DeploymentsStore == nil {
+		return
+	}
+	if storeErr := m.DeploymentsStore.SetLastError(ctx, m.ApplicationId, m.DeploymentId, err.Error()); storeErr != nil {
+		log.Printf("warning: error recording last error on deployment %s: %s\n", m.DeploymentId, storeErr.Error())
+	}
+}
+
+// StartStep appends the start of step to the current deployment's timeline.
+func (m *Manager) StartStep(ctx context.Context, step string) {
+	m.appendStep(ctx, step, "")
+}
+
+// EndStep appends the end of step, with its outcome, to the current deployment's timeline.
+func (m *Manager) EndStep(ctx context.Context, step string, outcome string) {
+	m.appendStep(ctx, step, outcome)
+}
+
+// CompleteStep appends a step that started and ended, successfully, in a single call.
+func (m *Manager) CompleteStep(ctx context.Context, step string) {
+	m.StartStep(ctx, step)
+	m.EndStep(ctx, step, store_dynamodb.StepSucceeded)
+}
+
+func (m *Manager) appendStep(ctx context.Context, step string, outcome string) {
+	if m.DeploymentsStore == nil {
+		return
+	}
+	event := store_dynamodb.StepEvent{Step: step, Outcome: outcome, Time: time.Now().UTC()}
+	if err := m.DeploymentsStore.AppendStep(ctx, m.ApplicationId, m.DeploymentId, event); err != nil {
+		log.Printf("warning: error appending %s step to deployment %s: %s\n", step, m.DeploymentId, err.Error())
+	}
+	m.sendDeploymentStepEvent(event)
+}
+
+// SetDeploymentImage records the image tag, and digest if known, of the current deployment.
+func (m *Manager) SetDeploymentImage(ctx context.Context, imageTag string, imageDigest string) {
+	if m.DeploymentsStore == nil {
+		return
+	}
+	if err := m.DeploymentsStore.SetImage(ctx, m.ApplicationId, m.DeploymentId, imageTag, imageDigest); err != nil {
+		log.Printf("warning: error recording image %s on deployment %s: %s\n", imageTag, m.DeploymentId, err.Error())
+	}
+}
+
+// SetBuildMetadata records what the current deployment built.
+func (m *Manager) SetBuildMetadata(ctx context.Context, metadata store_dynamodb.BuildMetadata) {
+	if m.DeploymentsStore == nil {
+		return
+	}
+	if err := m.DeploymentsStore.SetBuildMetadata(ctx, m.ApplicationId, m.DeploymentId, metadata); err != nil {
+		log.Printf("warning: error recording build metadata on deployment %s: %s\n", m.DeploymentId, err.Error())
+	}
 }
 
 func (m *Manager) UpdateApplicationStatus(ctx context.Context, newStatus string, isError bool) {
-	if err := m.StatusStore.UpdateStatus(ctx, newStatus, m.ApplicationId); err != nil {
+	err := m.StatusStore.UpdateStatus(ctx, newStatus, m.ApplicationId)
+	if errors.Is(err, statemachine.ErrIllegalTransition) {
+		// the record has moved on, so the update is not applied, and not announced
+		log.Printf("warning: rejected illegal status transition of application %s: %s\n", m.ApplicationId, err.Error())
+		return
+	}
+	if err != nil {
 		log.Printf("warning: error updating status of application %s to %q: %s\n", m.ApplicationId, newStatus, err.Error())
 	}
 	m.sendApplicationStatusEvent(newStatus, isError)
@@ -101,3 +176,22 @@ func (m *Manager) sendApplicationStatusEvent(status string, isErrorStatus bool)
 		log.Printf("warning: error updating pusher application channel %s with status: %s: %s\n", channel, status, err.Error())
 	}
 }
+
+func (m *Manager) sendDeploymentStepEvent(step store_dynamodb.StepEvent) {
+	if m.Pusher == nil {
+		log.Printf("warning: no Pusher client configured")
+		return
+	}
+	channel := events.ApplicationStatusChannel(m.ApplicationId)
+	event := events.DeploymentStepEvent{
+		ApplicationId: m.ApplicationId,
+		DeploymentId:  m.DeploymentId,
+		Step:          step.Step,
+		Outcome:       step.Outcome,
+		Time:          step.Time,
+		Source:        m.HandlerName,
+	}
+	if err := m.Pusher.Trigger(channel, events.DeploymentStepEventName, event); err != nil {
+		log.Printf("warning: error updating pusher application channel %s with step: %s: %s\n", channel, step.Step, err.Error())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 )
 
 // AppStoreVersionDBStore operates on the appstore versions table.
@@ -31,16 +32,19 @@ func (r *AppStoreVersionDatabaseStore) UpdateStatus(ctx context.Context, newStat
 		return fmt.Errorf("error marshaling key for version status update: %w", err)
 	}
 
-	_, err = r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	in := &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.TableName),
 		Key:       key,
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":s": &types.AttributeValueMemberS{Value: newStatus},
 		},
 		UpdateExpression: aws.String("set registrationStatus = :s"),
-	})
-	if err != nil {
-		return fmt.Errorf("error updating appstore version status: %w", err)
+	}
+	if err := withTransition(in, statemachine.Version, newStatus); err != nil {
+		return err
+	}
+	if _, err = r.DB.UpdateItem(ctx, in); err != nil {
+		return fmt.Errorf("error updating appstore version status: %w", transitionError(err, statemachine.Version, newStatus))
 	}
 
 	return nil
@@ -52,7 +56,7 @@ func (r *AppStoreVersionDatabaseStore) UpdateDestinationUrl(ctx context.Context,
 		return fmt.Errorf("error marshaling key for version destination update: %w", err)
 	}
 
-	_, err = r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	in := &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.TableName),
 		Key:       key,
 		ExpressionAttributeValues: map[string]types.AttributeValue{
@@ -60,9 +64,12 @@ func (r *AppStoreVersionDatabaseStore) UpdateDestinationUrl(ctx context.Context,
 			":s": &types.AttributeValueMemberS{Value: status},
 		},
 		UpdateExpression: aws.String("set destinationUrl = :d, registrationStatus = :s"),
-	})
-	if err != nil {
-		return fmt.Errorf("error updating appstore version destination URL: %w", err)
+	}
+	if err := withTransition(in, statemachine.Version, status); err != nil {
+		return err
+	}
+	if _, err = r.DB.UpdateItem(ctx, in); err != nil {
+		return fmt.Errorf("error updating appstore version destination URL: %w", transitionError(err, statemachine.Version, status))
 	}
 
 	return nil
@@ -1,5 +1,10 @@
 package store_dynamodb
 
+import "time"
+
+// DeploymentStatusStopped is the ECS lastStatus of a finished deployment
+const DeploymentStatusStopped = "STOPPED"
+
 type DeploymentKey struct {
 	ApplicationId string `dynamodbav:"applicationId"`
 	DeploymentId  string `dynamodbav:"deploymentId"`
@@ -7,5 +12,55 @@ type DeploymentKey struct {
 
 type Deployment struct {
 	DeploymentKey
-	Errored bool `dynamodbav:"errored,omitempty"`
+	Action      string     `dynamodbav:"action"`
+	LastStatus  string     `dynamodbav:"lastStatus"`
+	StoppedAt   *time.Time `dynamodbav:"stoppedAt,omitempty"`
+	Errored     bool       `dynamodbav:"errored,omitempty"`
+	ImageTag    string     `dynamodbav:"imageTag,omitempty"`
+	ImageDigest string     `dynamodbav:"imageDigest,omitempty"`
+	// LastError is the transient error the deployment's last attempt failed with
+	LastError string `dynamodbav:"lastError,omitempty"`
+	BuildMetadata
+	Timeline []StepEvent `dynamodbav:"timeline,omitempty"`
+}
+
+// BuildMetadata records how a deployment was built. Fields are recorded as they become known: the commit and
+// deployer task definition when the build starts, the rest once it has pushed the image.
+type BuildMetadata struct {
+	CommitSha              string `dynamodbav:"commitSha,omitempty"`
+	DeployerTaskDefinition string `dynamodbav:"deployerTaskDefinition,omitempty"`
+	ImageSizeBytes         int64  `dynamodbav:"imageSizeBytes,omitempty"`
+	BuildDurationSeconds   int64  `dynamodbav:"buildDurationSeconds,omitempty"`
+}
+
+// DeploymentLastErrorField is the attribute holding a deployment's LastError
+const DeploymentLastErrorField = "lastError"
+
+// DeploymentTimelineField is the attribute holding a deployment's StepEvents
+const DeploymentTimelineField = "timeline"
+
+// Deployment steps, in the order they usually happen. Not every deployment has every step: only a new application
+// runs terraform, and a rollback builds nothing.
+const (
+	StepProvisioning             = "provisioning"
+	StepTerraformApply           = "terraform_apply"
+	StepTaskDefinitionRegistered = "task_definition_registered"
+	StepImageBuild               = "image_build"
+	StepImagePush                = "image_push"
+	StepDone                     = "done"
+)
+
+// Outcomes of a step. A step that has started but not ended has no outcome.
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepCancelled = "cancelled"
+)
+
+// StepEvent is an entry in a deployment's append-only timeline: a step starting, or ending with an outcome. The
+// service, the provisioner and the status listener each append the steps they see.
+type StepEvent struct {
+	Step    string    `dynamodbav:"step"`
+	Outcome string    `dynamodbav:"outcome,omitempty"`
+	Time    time.Time `dynamodbav:"time"`
 }
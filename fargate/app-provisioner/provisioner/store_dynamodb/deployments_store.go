@@ -3,8 +3,11 @@ package store_dynamodb
 import (
 	"context"
 	"fmt"
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
@@ -50,3 +53,168 @@ func (s *DeploymentsStore) SetErroredFlag(ctx context.Context, applicationId str
 
 	return nil
 }
+
+// SetLastError records the error a deployment failed with on its last attempt, when that failure was transient and
+// the deployment may be retried.
+func (s *DeploymentsStore) SetLastError(ctx context.Context, applicationId string, deploymentId string, lastError string) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment %s last error update: %w", deploymentId, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       key,
+		ExpressionAttributeNames: map[string]string{
+			"#lastError": DeploymentLastErrorField,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":lastError": &types.AttributeValueMemberS{Value: lastError},
+		},
+		UpdateExpression: aws.String("set #lastError = :lastError"),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating last error on deployment %s: %w", deploymentId, err)
+	}
+
+	return nil
+}
+
+// SetImage records the image a deployment built or rolled back to. imageDigest may be empty if it is not yet known,
+// in which case any digest already recorded is left alone.
+func (s *DeploymentsStore) SetImage(ctx context.Context, applicationId string, deploymentId string, imageTag string, imageDigest string) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment %s image update: %w", deploymentId, err)
+	}
+
+	values := map[string]types.AttributeValue{
+		":t": &types.AttributeValueMemberS{Value: imageTag},
+	}
+	updateExpression := "set imageTag = :t"
+	if imageDigest != "" {
+		values[":d"] = &types.AttributeValueMemberS{Value: imageDigest}
+		updateExpression += ", imageDigest = :d"
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		ExpressionAttributeValues: values,
+		UpdateExpression:          aws.String(updateExpression),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating image on deployment %s: %w", deploymentId, err)
+	}
+
+	return nil
+}
+
+// SetStopped marks a deployment that ran no deployer task as finished, as the status listener would have for one
+// that did.
+func (s *DeploymentsStore) SetStopped(ctx context.Context, applicationId string, deploymentId string, stoppedAt time.Time) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment %s stopped update: %w", deploymentId, err)
+	}
+	stopped, err := attributevalue.Marshal(stoppedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("error marshaling stoppedAt for deployment %s: %w", deploymentId, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       key,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s": &types.AttributeValueMemberS{Value: DeploymentStatusStopped},
+			":t": stopped,
+		},
+		UpdateExpression: aws.String("set lastStatus = :s, desiredStatus = :s, stoppedAt = :t, updatedAt = :t"),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating deployment %s as stopped: %w", deploymentId, err)
+	}
+
+	return nil
+}
+
+// SetBuildMetadata records the fields of metadata that are set, leaving the others as they are.
+func (s *DeploymentsStore) SetBuildMetadata(ctx context.Context, applicationId string, deploymentId string, metadata BuildMetadata) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment %s build update: %w", deploymentId, err)
+	}
+	// omitempty leaves out the fields that are not known yet
+	fields, err := attributevalue.MarshalMap(metadata)
+	if err != nil {
+		return fmt.Errorf("error marshaling build metadata for deployment %s: %w", deploymentId, err)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	var update expression.UpdateBuilder
+	for name, value := range fields {
+		update = update.Set(expression.Name(name), expression.Value(value))
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("error building build metadata update for deployment %s: %w", deploymentId, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating build metadata on deployment %s: %w", deploymentId, err)
+	}
+
+	return nil
+}
+
+// AppendStep adds event to the end of the deployment's timeline.
+func (s *DeploymentsStore) AppendStep(ctx context.Context, applicationId string, deploymentId string, event StepEvent) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment %s timeline update: %w", deploymentId, err)
+	}
+	timeline := expression.Name(DeploymentTimelineField)
+	update := expression.Set(timeline, expression.ListAppend(
+		expression.IfNotExists(timeline, expression.Value([]StepEvent{})),
+		expression.Value([]StepEvent{event})))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("error building timeline update for deployment %s: %w", deploymentId, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+	})
+	if err != nil {
+		return fmt.Errorf("error appending %s step to deployment %s: %w", event.Step, deploymentId, err)
+	}
+
+	return nil
+}
@@ -9,12 +9,15 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 )
 
 type DynamoDBStore interface {
 	Update(context.Context, Application, string) error
 	UpdateStatus(ctx context.Context, newStatus string, applicationUuid string) error
 	Get(context.Context, string, string) ([]Application, error)
+	GetById(context.Context, string) (Application, error)
+	UpdateTaskDefinition(ctx context.Context, taskDefinitionArn string, applicationUuid string) error
 	Delete(context.Context, string) error
 }
 
@@ -33,7 +36,7 @@ func (r *ApplicationDatabaseStore) Update(ctx context.Context, application Appli
 		return fmt.Errorf("error marshaling key for update: %w", err)
 	}
 
-	_, err = r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	in := &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.TableName),
 		Key:       key,
 		ExpressionAttributeValues: map[string]types.AttributeValue{
@@ -43,9 +46,12 @@ func (r *ApplicationDatabaseStore) Update(ctx context.Context, application Appli
 			":s": &types.AttributeValueMemberS{Value: application.Status},
 		},
 		UpdateExpression: aws.String("set applicationId = :i, applicationContainerName = :c, destinationUrl = :d, registrationStatus = :s"),
-	})
-	if err != nil {
-		return fmt.Errorf("error updating application: %w", err)
+	}
+	if err := withTransition(in, statemachine.Application, application.Status); err != nil {
+		return err
+	}
+	if _, err = r.DB.UpdateItem(ctx, in); err != nil {
+		return fmt.Errorf("error updating application: %w", transitionError(err, statemachine.Application, application.Status))
 	}
 
 	return nil
@@ -57,21 +63,70 @@ func (r *ApplicationDatabaseStore) UpdateStatus(ctx context.Context, newStatus s
 		return fmt.Errorf("error marshaling key for status update: %w", err)
 	}
 
-	_, err = r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	in := &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.TableName),
 		Key:       key,
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":s": &types.AttributeValueMemberS{Value: newStatus},
 		},
 		UpdateExpression: aws.String("set registrationStatus = :s"),
+	}
+	if err := withTransition(in, statemachine.Application, newStatus); err != nil {
+		return err
+	}
+	if _, err = r.DB.UpdateItem(ctx, in); err != nil {
+		return fmt.Errorf("error updating application status: %w", transitionError(err, statemachine.Application, newStatus))
+	}
+
+	return nil
+}
+
+func (r *ApplicationDatabaseStore) UpdateTaskDefinition(ctx context.Context, taskDefinitionArn string, applicationUuid string) error {
+	key, err := attributevalue.MarshalMap(ApplicationKey{Uuid: applicationUuid})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for task definition update: %w", err)
+	}
+
+	_, err = r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.TableName),
+		Key:       key,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":i": &types.AttributeValueMemberS{Value: taskDefinitionArn},
+		},
+		UpdateExpression: aws.String("set applicationId = :i"),
 	})
 	if err != nil {
-		return fmt.Errorf("error updating application status: %w", err)
+		return fmt.Errorf("error updating application task definition: %w", err)
 	}
 
 	return nil
 }
 
+func (r *ApplicationDatabaseStore) GetById(ctx context.Context, applicationUuid string) (Application, error) {
+	key, err := attributevalue.MarshalMap(ApplicationKey{Uuid: applicationUuid})
+	if err != nil {
+		return Application{}, fmt.Errorf("error marshaling application key: %w", err)
+	}
+
+	response, err := r.DB.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:       key,
+		TableName: aws.String(r.TableName),
+	})
+	if err != nil {
+		return Application{}, fmt.Errorf("error getting application: %w", err)
+	}
+	if response.Item == nil {
+		return Application{}, fmt.Errorf("application not found: %s", applicationUuid)
+	}
+
+	var application Application
+	if err := attributevalue.UnmarshalMap(response.Item, &application); err != nil {
+		return Application{}, fmt.Errorf("error unmarshaling application: %w", err)
+	}
+
+	return application, nil
+}
+
 func (r *ApplicationDatabaseStore) Get(ctx context.Context, computeNodeUuid string, sourceUrl string) ([]Application, error) {
 	applications := []Application{}
 	filt1 := expression.Name("computeNodeUuid").Equal((expression.Value(computeNodeUuid)))
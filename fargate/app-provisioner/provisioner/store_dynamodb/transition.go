@@ -0,0 +1,47 @@
+package store_dynamodb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+)
+
+// withTransition conditions a status update on the record existing and on machine allowing the record's current
+// status to change to newStatus.
+func withTransition(in *dynamodb.UpdateItemInput, machine statemachine.Machine, newStatus string) error {
+	condition, err := machine.Condition(newStatus)
+	if err != nil {
+		return err
+	}
+	in.ConditionExpression = aws.String(condition.And("attribute_exists(uuid)"))
+	in.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+	if condition.Expression == "" {
+		return nil
+	}
+	if in.ExpressionAttributeNames == nil {
+		in.ExpressionAttributeNames = map[string]string{}
+	}
+	in.ExpressionAttributeNames[statemachine.NamePlaceholder] = statemachine.Attribute
+	for placeholder, value := range condition.Values {
+		in.ExpressionAttributeValues[placeholder] = &types.AttributeValueMemberS{Value: value}
+	}
+	return nil
+}
+
+// transitionError returns the error for a failed update made withTransition. A record that exists failed the
+// transition; one that does not is reported as is.
+func transitionError(err error, machine statemachine.Machine, newStatus string) error {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) || len(conditionFailed.Item) == 0 {
+		return err
+	}
+	current := ""
+	if status, ok := conditionFailed.Item[statemachine.Attribute].(*types.AttributeValueMemberS); ok {
+		current = status.Value
+	}
+	return fmt.Errorf("%w: %w", machine.Rejected(current, newStatus), err)
+}
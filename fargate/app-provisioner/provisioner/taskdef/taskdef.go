@@ -0,0 +1,67 @@
+// Package taskdef registers revisions of the ECS task definitions the provisioner runs or deploys.
+package taskdef
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// API is an interface only containing the ECS client methods used by Revise
+type API interface {
+	DescribeTaskDefinition(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error)
+	RegisterTaskDefinition(ctx context.Context, params *ecs.RegisterTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.RegisterTaskDefinitionOutput, error)
+}
+
+// Revise registers a revision of the task definition whose containers are those edit returns, and returns its ARN.
+// Everything else is copied from the task definition. If edit reports that nothing changed, nothing is registered
+// and taskDefinitionArn is returned.
+func Revise(ctx context.Context, api API, taskDefinitionArn string, edit func(containers []types.ContainerDefinition) ([]types.ContainerDefinition, bool, error)) (string, error) {
+	out, err := api.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(taskDefinitionArn),
+		Include:        []types.TaskDefinitionField{types.TaskDefinitionFieldTags},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error describing task definition %s: %w", taskDefinitionArn, err)
+	}
+	containers, changed, err := edit(out.TaskDefinition.ContainerDefinitions)
+	if err != nil {
+		return "", err
+	}
+	if !changed {
+		return taskDefinitionArn, nil
+	}
+
+	registered, err := api.RegisterTaskDefinition(ctx, registerInput(out, containers))
+	if err != nil {
+		return "", fmt.Errorf("error registering revision of task definition %s: %w", aws.ToString(out.TaskDefinition.Family), err)
+	}
+	return aws.ToString(registered.TaskDefinition.TaskDefinitionArn), nil
+}
+
+// registerInput returns the input registering the described task definition again, with containers
+func registerInput(out *ecs.DescribeTaskDefinitionOutput, containers []types.ContainerDefinition) *ecs.RegisterTaskDefinitionInput {
+	current := out.TaskDefinition
+	return &ecs.RegisterTaskDefinitionInput{
+		Family:                  current.Family,
+		ContainerDefinitions:    containers,
+		Cpu:                     current.Cpu,
+		Memory:                  current.Memory,
+		NetworkMode:             current.NetworkMode,
+		RequiresCompatibilities: current.RequiresCompatibilities,
+		TaskRoleArn:             current.TaskRoleArn,
+		ExecutionRoleArn:        current.ExecutionRoleArn,
+		Volumes:                 current.Volumes,
+		EphemeralStorage:        current.EphemeralStorage,
+		PlacementConstraints:    current.PlacementConstraints,
+		RuntimePlatform:         current.RuntimePlatform,
+		ProxyConfiguration:      current.ProxyConfiguration,
+		InferenceAccelerators:   current.InferenceAccelerators,
+		IpcMode:                 current.IpcMode,
+		PidMode:                 current.PidMode,
+		Tags:                    out.Tags,
+	}
+}
@@ -0,0 +1,102 @@
+package taskdef_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/taskdef"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAPI struct {
+	current    *types.TaskDefinition
+	registered *ecs.RegisterTaskDefinitionInput
+}
+
+func (m *mockAPI) DescribeTaskDefinition(_ context.Context, _ *ecs.DescribeTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{
+		TaskDefinition: m.current,
+		Tags:           []types.Tag{{Key: aws.String("service"), Value: aws.String("app-deploy-service")}},
+	}, nil
+}
+
+func (m *mockAPI) RegisterTaskDefinition(_ context.Context, params *ecs.RegisterTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.RegisterTaskDefinitionOutput, error) {
+	m.registered = params
+	return &ecs.RegisterTaskDefinitionOutput{
+		TaskDefinition: &types.TaskDefinition{TaskDefinitionArn: aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/app:2")},
+	}, nil
+}
+
+// registeredFields are the fields a task definition is registered with that it can also be described with
+func registeredFields() []string {
+	described := reflect.TypeOf(types.TaskDefinition{})
+	registered := reflect.TypeOf(ecs.RegisterTaskDefinitionInput{})
+	var fields []string
+	for i := 0; i < registered.NumField(); i++ {
+		name := registered.Field(i).Name
+		if _, ok := described.FieldByName(name); ok && registered.Field(i).IsExported() {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// set sets v to a value that is not its zero value
+func set(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		set(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+	case reflect.String:
+		v.SetString("set")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	}
+}
+
+func TestReviseCopiesTaskDefinition(t *testing.T) {
+	current := &types.TaskDefinition{}
+	for _, name := range registeredFields() {
+		set(reflect.ValueOf(current).Elem().FieldByName(name))
+	}
+	api := &mockAPI{current: current}
+	containers := []types.ContainerDefinition{{Name: aws.String("app")}}
+
+	arn, err := taskdef.Revise(context.Background(), api, "arn:aws:ecs:us-east-1:123456789012:task-definition/app:1",
+		func([]types.ContainerDefinition) ([]types.ContainerDefinition, bool, error) {
+			return containers, true, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:task-definition/app:2", arn)
+	require.NotNil(t, api.registered)
+	registered := reflect.ValueOf(api.registered).Elem()
+	for _, name := range registeredFields() {
+		if name == "ContainerDefinitions" {
+			continue
+		}
+		assert.False(t, registered.FieldByName(name).IsZero(), "%s is not copied", name)
+	}
+	assert.Equal(t, containers, api.registered.ContainerDefinitions)
+	assert.Equal(t, "app-deploy-service", aws.ToString(api.registered.Tags[0].Value))
+}
+
+func TestReviseUnchanged(t *testing.T) {
+	api := &mockAPI{current: &types.TaskDefinition{}}
+
+	arn, err := taskdef.Revise(context.Background(), api, "arn:aws:ecs:us-east-1:123456789012:task-definition/app:1",
+		func(current []types.ContainerDefinition) ([]types.ContainerDefinition, bool, error) {
+			return current, false, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:task-definition/app:1", arn)
+	assert.Nil(t, api.registered)
+}
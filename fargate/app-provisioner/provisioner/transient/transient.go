@@ -0,0 +1,109 @@
+// Package transient classifies provisioner failures that running the provisioner again may not hit, such as AWS
+// throttling, a terraform state lock held by a run that has since finished, or a deployer task that could not
+// start. A deployment that fails transiently is retried rather than marked errored.
+package transient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+)
+
+// Error marks a failure as transient
+type Error struct {
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errorf returns a transient Error formatted as by fmt.Errorf
+func Errorf(format string, a ...any) error {
+	return &Error{Err: fmt.Errorf(format, a...)}
+}
+
+// apiErrorCodes are AWS error codes worth retrying beyond the SDK's own retries, on top of its throttling codes
+var apiErrorCodes = []string{
+	"RequestTimeout",
+	"RequestTimeoutException",
+	"ServiceUnavailable",
+	"InternalError",
+	"InternalFailure",
+	"ConcurrentModificationException",
+}
+
+// messages are found in the output of terraform, and in errors from the network
+var messages = []string{
+	"Error acquiring the state lock",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"connection reset by peer",
+	"Rate exceeded",
+}
+
+// Is reports whether err is a transient failure
+func Is(err error) bool {
+	if err == nil {
+		return false
+	}
+	var transientError *Error
+	if errors.As(err, &transientError) {
+		return true
+	}
+
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		code := apiError.ErrorCode()
+		if _, ok := retry.DefaultThrottleErrorCodes[code]; ok {
+			return true
+		}
+		for _, c := range apiErrorCodes {
+			if code == c {
+				return true
+			}
+		}
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+
+	text := err.Error()
+	// terraform reports its errors on stderr, which is only kept on the error of the script that ran it
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		text += "\n" + string(exitError.Stderr)
+	}
+	for _, message := range messages {
+		if strings.Contains(text, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// Task reports whether a stopped task failed transiently: a container exited with statemachine.RetryExitCode, as
+// the deployer does when it cannot reach a registry, or ECS stopped the task for a reason running it again may not
+// hit.
+func Task(task types.Task) bool {
+	for _, container := range task.Containers {
+		if container.ExitCode != nil && *container.ExitCode == statemachine.RetryExitCode {
+			return true
+		}
+	}
+	return statemachine.TransientStop(string(task.StopCode), aws.ToString(task.StoppedReason))
+}
@@ -0,0 +1,52 @@
+package transient_test
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go"
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/transient"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIs(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized to perform sts:AssumeRole"}
+	stateLock := &exec.ExitError{Stderr: []byte("Error: Error acquiring the state lock\n\nConditionalCheckFailedException")}
+
+	assert.True(t, transient.Is(fmt.Errorf("error assuming role: %w", throttled)))
+	assert.True(t, transient.Is(stateLock))
+	assert.True(t, transient.Is(transient.Errorf("deployer task %s did not start", "task-1")))
+	assert.True(t, transient.Is(errors.New(`Get "https://api.github.com": net/http: TLS handshake timeout`)))
+
+	assert.False(t, transient.Is(fmt.Errorf("error assuming role: %w", denied)))
+	assert.False(t, transient.Is(&exec.ExitError{Stderr: []byte("Error: Unsupported argument")}))
+	assert.False(t, transient.Is(errors.New("invalid source url")))
+	assert.False(t, transient.Is(nil))
+}
+
+func TestTask(t *testing.T) {
+	exited := func(exitCode int32) types.Task {
+		return types.Task{
+			StopCode:      types.TaskStopCodeEssentialContainerExited,
+			StoppedReason: aws.String("Essential container in task exited"),
+			Containers:    []types.Container{{ExitCode: aws.Int32(exitCode)}},
+		}
+	}
+
+	// the deployer could not push its image to ECR
+	assert.True(t, transient.Task(exited(statemachine.RetryExitCode)))
+	assert.True(t, transient.Task(types.Task{
+		StopCode:      types.TaskStopCodeTaskFailedToStart,
+		StoppedReason: aws.String("CannotPullContainerError: pull image manifest has been retried 5 time(s)"),
+	}))
+
+	// the build itself failed
+	assert.False(t, transient.Task(exited(1)))
+	assert.False(t, transient.Task(types.Task{Containers: []types.Container{{}}}))
+}
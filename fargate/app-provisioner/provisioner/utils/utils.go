@@ -1,12 +1,13 @@
 package utils
 
 import (
-	"errors"
 	"fmt"
 	"hash/fnv"
 	"net/url"
 	"regexp"
 	"strings"
+
+	"github.com/pennsieve/app-deploy-service/app-provisioner/provisioner/gitsource"
 )
 
 func ExtractGitUrl(uri string) string {
@@ -29,15 +30,34 @@ func AppSlug(s string, t string) string {
 	return fmt.Sprint(GenerateHash(sourceUrlComputeNodeSlug))
 }
 
-var ErrTagRequired = errors.New("tag is required for https source URLs")
+// scpLikeURL matches the scp-like form of an ssh URL, git@host:path
+var scpLikeURL = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):([^/].*)$`)
 
-func DetermineSourceURL(sourceURL string, tag string) (string, error) {
+// DetermineSourceURL returns the kaniko git build context of ref in the repository at sourceURL: a tag, a branch or
+// a full commit SHA by refType, or the default branch if ref is empty. kaniko clones git:// contexts over https, so
+// https, ssh and scp-like URLs of any git host are rewritten to git://{host}/{path}. Any other URL is already a
+// build context.
+func DetermineSourceURL(sourceURL string, refType string, ref string) (string, error) {
+	var newSourceURL string
 	if matched, _ := regexp.MatchString(`^https?://`, sourceURL); matched {
-		if tag == "" {
-			return "", errors.New("tag is required for https source URLs")
+		newSourceURL = strings.Replace(sourceURL, "https://", "git://", 1)
+	} else if rest, ok := strings.CutPrefix(sourceURL, "ssh://"); ok {
+		u, err := url.Parse("ssh://" + rest)
+		if err != nil {
+			return "", fmt.Errorf("invalid source URL %s: %w", sourceURL, err)
 		}
-		newSourceURL := strings.Replace(sourceURL, "https://", "git://", 1)
-		return fmt.Sprintf("%s#refs/tags/%s", newSourceURL, tag), nil
+		newSourceURL = fmt.Sprintf("git://%s%s", u.Hostname(), u.Path)
+	} else if m := scpLikeURL.FindStringSubmatch(sourceURL); m != nil {
+		newSourceURL = fmt.Sprintf("git://%s/%s", m[1], m[2])
+	} else {
+		return sourceURL, nil
 	}
-	return sourceURL, nil
+	return gitsource.Context{Repository: newSourceURL}.AtRef(refType, ref).String(), nil
+}
+
+var invalidImageTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// ImageTag returns ref as an image tag, which cannot hold the slashes of a branch such as feature/x
+func ImageTag(ref string) string {
+	return invalidImageTagChars.ReplaceAllString(ref, "-")
 }
@@ -53,24 +53,61 @@ func TestDetermineSourceURL(t *testing.T) {
 	sourceURL := "https://github.com/owner/repo"
 	tag := "v1.0.0"
 	expected := "git://github.com/owner/repo#refs/tags/v1.0.0"
-	got, _ := utils.DetermineSourceURL(sourceURL, tag)
+	got, _ := utils.DetermineSourceURL(sourceURL, "tag", tag)
 	if got != expected {
 		t.Errorf("expected %s, got %s", expected, got)
 	}
 
+	// without a ref, the default branch is built
 	sourceURL = "https://github.com/owner/repo"
-	tag = ""
-	got, err := utils.DetermineSourceURL(sourceURL, tag)
-	if err.Error() != utils.ErrTagRequired.Error() {
-		t.Errorf("expected to get error: %s, got nil instead", utils.ErrTagRequired)
+	expected = "git://github.com/owner/repo"
+	got, err := utils.DetermineSourceURL(sourceURL, "", "")
+	assert.NoError(t, err)
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
 	}
 
 	sourceURL = "git://github.com/owner/repo"
 	tag = "v1.0.0"
 	expected = "git://github.com/owner/repo"
-	got, _ = utils.DetermineSourceURL(sourceURL, tag)
+	got, _ = utils.DetermineSourceURL(sourceURL, "tag", tag)
 	if got != expected {
 		t.Errorf("expected %s, got %s", expected, got)
 	}
 
 }
+
+func TestDetermineSourceURLRefTypes(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	for _, tt := range []struct {
+		refType  string
+		ref      string
+		expected string
+	}{
+		{"branch", "feature/x", "git://github.com/owner/repo#refs/heads/feature/x"},
+		{"commit", sha, "git://github.com/owner/repo##" + sha},
+		{"tag", "v1.0.0", "git://github.com/owner/repo#refs/tags/v1.0.0"},
+	} {
+		got, err := utils.DetermineSourceURL("https://github.com/owner/repo", tt.refType, tt.ref)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, got, tt.refType)
+	}
+}
+
+func TestDetermineSourceURLOtherHosts(t *testing.T) {
+	for sourceURL, expected := range map[string]string{
+		"https://gitlab.example.edu/lab/group/repo":   "git://gitlab.example.edu/lab/group/repo#refs/tags/v1.0.0",
+		"ssh://git@bitbucket.org/workspace/repo.git":  "git://bitbucket.org/workspace/repo.git#refs/tags/v1.0.0",
+		"git@gitlab.com:group/repo.git":               "git://gitlab.com/group/repo.git#refs/tags/v1.0.0",
+		"ssh://git@git.example.edu:2222/lab/repo.git": "git://git.example.edu/lab/repo.git#refs/tags/v1.0.0",
+	} {
+		got, err := utils.DetermineSourceURL(sourceURL, "tag", "v1.0.0")
+		assert.NoError(t, err, sourceURL)
+		assert.Equal(t, expected, got, sourceURL)
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	assert.Equal(t, "v1.0.0", utils.ImageTag("v1.0.0"))
+	assert.Equal(t, "feature-x", utils.ImageTag("feature/x"))
+}
@@ -8,11 +8,14 @@ require (
 	github.com/aws/aws-sdk-go-v2/config v1.27.15
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue v1.13.17
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression v1.7.17
+	github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs v1.63.1
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.32.3
 	github.com/aws/aws-sdk-go-v2/service/ecs v1.41.10
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.97.1
 	github.com/aws/aws-sdk-go-v2/service/ssm v1.56.9
+	github.com/aws/smithy-go v1.24.2
 	github.com/google/uuid v1.3.0
+	github.com/pennsieve/app-deploy-service/statemachine v0.0.0
 	github.com/pennsieve/github-client v0.0.1
 	github.com/pennsieve/pennsieve-go-core v1.13.7
 	github.com/pusher/pusher-http-go/v5 v5.1.1
@@ -36,7 +39,6 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sso v1.20.8 // indirect
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.24.2 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.28.9 // indirect
-	github.com/aws/smithy-go v1.24.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
@@ -49,3 +51,6 @@ require (
 	golang.org/x/sys v0.21.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// statemachine is shared by the service, status listener and provisioner
+replace github.com/pennsieve/app-deploy-service/statemachine => ../../statemachine
@@ -3,152 +3,104 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/pennsieve/app-deploy-service/service/mappers"
 	"github.com/pennsieve/app-deploy-service/service/models"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
 )
 
 func GetAppPermissionsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "GetAppPermissionsHandler"
-
-	appId := request.PathParameters["id"]
-
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	if !authorizer.HasOrgRole(claims, role.Viewer) {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusUnauthorized,
-			Body:       handlerError(handlerName, ErrNotPermitted),
-		}, nil
-	}
+	return newHandler("GetAppPermissionsHandler", getAppPermissions, RequireOrgRole(role.Viewer))(ctx, request)
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+func getAppPermissions(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
 	if err != nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
 
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	appStoreStore := store_dynamodb.NewAppStoreDatabaseStore(dynamoDBClient, os.Getenv(appstoreApplicationsTableNameKey))
-	appAccessStore := store_dynamodb.NewAppAccessDatabaseStore(dynamoDBClient, os.Getenv(appAccessTableNameKey))
+	appId := request.PathParameters["id"]
+	appAccessStore := deps.AppAccess
 
-	app, err := appStoreStore.GetById(ctx, appId)
-	if err != nil || app == nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrAppNotFound),
-		}, nil
+	app, err := deps.AppStore.GetById(ctx, appId)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	if app == nil {
+		return events.APIGatewayV2HTTPResponse{}, ErrAppNotFound
 	}
 
-	if !CanAccessApp(ctx, claims, app, appAccessStore) {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusForbidden,
-			Body:       handlerError(handlerName, ErrNotPermitted),
-		}, nil
+	if !CanAccessApp(ctx, deps.Claims, app, appAccessStore) {
+		return events.APIGatewayV2HTTPResponse{}, ErrNotPermitted
 	}
 
 	accessItems, err := appAccessStore.GetByApp(ctx, appId)
 	if err != nil {
-		log.Printf("%s: error fetching access entries: %v", handlerName, err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error fetching access entries: %w", ErrDynamoDB, err)
 	}
 
-	permissions := models.AppPermissions{
+	response, err := jsonResponse(http.StatusOK, models.AppPermissions{
 		Visibility: app.Visibility,
 		OwnerId:    app.OwnerId,
 		Access:     mappers.AppAccessItemsToModels(accessItems),
-	}
-
-	m, err := json.Marshal(permissions)
-	if err != nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
-	}
-
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(m),
-	}, nil
+	})
+	return withETag(response, err, app.Version)
 }
 
 func PutAppPermissionsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "PutAppPermissionsHandler"
-
-	appId := request.PathParameters["id"]
+	return newHandler("PutAppPermissionsHandler", putAppPermissions, RequireOrgRole(role.Viewer))(ctx, request)
+}
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	if !authorizer.HasOrgRole(claims, role.Viewer) {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusUnauthorized,
-			Body:       handlerError(handlerName, ErrNotPermitted),
-		}, nil
+func putAppPermissions(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
 
+	appId := request.PathParameters["id"]
+	claims := deps.Claims
+
 	var req models.SetPermissionsRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusBadRequest,
-			Body:       handlerError(handlerName, ErrUnmarshaling),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
 	}
 
 	if req.Visibility != "public" && req.Visibility != "private" {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusBadRequest,
-			Body:       handlerError(handlerName, ErrInvalidVisibility),
-		}, nil
-	}
-
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, ErrInvalidVisibility
 	}
 
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	appStoreStore := store_dynamodb.NewAppStoreDatabaseStore(dynamoDBClient, os.Getenv(appstoreApplicationsTableNameKey))
-	appAccessStore := store_dynamodb.NewAppAccessDatabaseStore(dynamoDBClient, os.Getenv(appAccessTableNameKey))
+	appStoreStore := deps.AppStore
+	appAccessStore := deps.AppAccess
 
 	app, err := appStoreStore.GetById(ctx, appId)
-	if err != nil || app == nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrAppNotFound),
-		}, nil
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	if app == nil {
+		return events.APIGatewayV2HTTPResponse{}, ErrAppNotFound
 	}
 
 	if !IsAppOwner(ctx, claims, app) {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusForbidden,
-			Body:       handlerError(handlerName, ErrNotOwner),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, ErrNotOwner
+	}
+
+	ifMatch, err := checkIfMatch(request, app.Version)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("appstore application %s: %w", appId, err)
 	}
 
-	if err := appStoreStore.UpdateVisibility(ctx, appId, req.Visibility); err != nil {
-		log.Printf("%s: error updating visibility: %v", handlerName, err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+	err = appStoreStore.UpdateVisibility(ctx, appId, req.Visibility, app.Version)
+	if errors.Is(err, store_dynamodb.ErrVersionConflict) {
+		return events.APIGatewayV2HTTPResponse{}, versionConflict("appstore application "+appId, ifMatch)
+	}
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error updating visibility: %w", ErrDynamoDB, err)
 	}
 
 	now := time.Now().UTC().String()
@@ -213,29 +165,13 @@ func PutAppPermissionsHandler(ctx context.Context, request events.APIGatewayV2HT
 	}
 
 	if err := appAccessStore.ReplaceByApp(ctx, appId, accessEntries); err != nil {
-		log.Printf("%s: error replacing access entries: %v", handlerName, err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error replacing access entries: %w", ErrDynamoDB, err)
 	}
 
-	permissions := models.AppPermissions{
+	response, err := jsonResponse(http.StatusOK, models.AppPermissions{
 		Visibility: req.Visibility,
 		OwnerId:    app.OwnerId,
 		Access:     mappers.AppAccessItemsToModels(accessEntries),
-	}
-
-	m, err := json.Marshal(permissions)
-	if err != nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
-	}
-
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(m),
-	}, nil
+	})
+	return withETag(response, err, app.Version+1)
 }
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/mappers"
+	"github.com/pennsieve/app-deploy-service/service/schedule"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+)
+
+// autoDeployCatchUp is how far back the poller looks for a scheduled time it has not deployed. It is longer than
+// the interval the poller runs at, so a late or failed poll does not skip a scheduled deployment, but a schedule
+// set long after it last deployed, or an application that could not be deployed for a while, does not deploy for
+// each time it missed.
+const autoDeployCatchUp = time.Hour
+
+// AutoDeployHandler deploys the applications whose auto-deploy policy is due. It is invoked on a schedule, so the
+// event itself is not used.
+func AutoDeployHandler(ctx context.Context, _ json.RawMessage) error {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	deps := NewDependencies(ctx, "AutoDeployHandler", cfg, events.APIGatewayV2HTTPRequest{})
+	providers, err := newSourceProviders(ctx, deps)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	return autoDeploy(ctx, deps, providers, time.Now())
+}
+
+// autoDeploy deploys every application with a schedule that names a time since it last deployed on schedule, or a
+// tag pattern that matches a newer tag than the one its last deployment built. Applications in the middle of a
+// deployment are left for a later poll. A failure to deploy one application is logged and the others carry on.
+func autoDeploy(ctx context.Context, deps *Dependencies, providers sourceProviders, now time.Time) error {
+	applications, err := deps.Applications.ListAutoDeploy(ctx)
+	if err != nil {
+		return err
+	}
+	// repositories are often shared, so each one's tags are listed once per poll
+	tagsBySource := map[string][]string{}
+	for _, application := range applications {
+		logger := deps.Logger.With(slog.String("applicationId", application.Uuid))
+		if application.AutoDeploy == nil {
+			continue
+		}
+		if !statemachine.Application.CanTransition(application.Status, string(statemachine.Pending)) {
+			logger.Debug("application cannot be deployed", slog.String("status", application.Status))
+			continue
+		}
+
+		var req deploymentRequest
+		var err error
+		switch {
+		case application.AutoDeploy.Schedule != "":
+			req, err = scheduledDeployment(ctx, deps, application, now)
+		case application.AutoDeploy.TagPattern != "":
+			req, err = tagDeployment(ctx, deps, providers, tagsBySource, application)
+		}
+		if err != nil {
+			logger.Error("error checking auto-deploy policy", slog.Any("error", err))
+			continue
+		}
+		if req.Trigger == "" {
+			continue
+		}
+
+		req.OrganizationId = application.OrganizationId
+		req.UserId = application.UserId
+		// a deployment that starts while this one is being requested should not make it fail
+		req.Queue = true
+		response, err := deployApplication(ctx, deps, mappers.StoreToModel(application), req)
+		if err != nil {
+			logger.Error("error auto-deploying application", slog.String("trigger", req.Trigger), slog.Any("error", err))
+			continue
+		}
+		logger.Info("auto-deployed application",
+			slog.String("trigger", req.Trigger),
+			slog.String("tag", req.Tag),
+			slog.String("deploymentId", response.DeploymentId),
+			slog.Bool("queued", response.Queued))
+	}
+	return nil
+}
+
+// scheduledDeployment returns a request for a deployment if the application's schedule names a time since it
+// last deployed on schedule, or within autoDeployCatchUp, and this poll is the one to record it. Otherwise the
+// request has no trigger.
+func scheduledDeployment(ctx context.Context, deps *Dependencies, application store_dynamodb.Application, now time.Time) (deploymentRequest, error) {
+	s, err := schedule.Parse(application.AutoDeploy.Schedule)
+	if err != nil {
+		return deploymentRequest{}, fmt.Errorf("schedule %q: %w", application.AutoDeploy.Schedule, err)
+	}
+	from := now.Add(-autoDeployCatchUp)
+	if application.AutoDeployedAt != nil && application.AutoDeployedAt.After(from) {
+		from = *application.AutoDeployedAt
+	}
+	next := s.Next(from)
+	if next.IsZero() || next.After(now) {
+		return deploymentRequest{}, nil
+	}
+	marked, err := deps.Applications.MarkAutoDeployed(ctx, application.Uuid, application.AutoDeployedAt, now)
+	if err != nil {
+		return deploymentRequest{}, err
+	}
+	if !marked {
+		// another poll got there first
+		return deploymentRequest{}, nil
+	}
+	return deploymentRequest{Trigger: store_dynamodb.DeploymentTriggerSchedule}, nil
+}
+
+// tagDeployment returns a request to deploy the latest tag matching the application's pattern, if its last
+// deployment built a different one. Otherwise the request has no trigger.
+func tagDeployment(ctx context.Context, deps *Dependencies, providers sourceProviders, tagsBySource map[string][]string, application store_dynamodb.Application) (deploymentRequest, error) {
+	names, ok := tagsBySource[application.SourceUrl]
+	if !ok {
+		var err error
+		if names, err = providers(application.SourceType, application.SourceUrl).ListTags(ctx, application.SourceUrl); err != nil {
+			return deploymentRequest{}, err
+		}
+		tagsBySource[application.SourceUrl] = names
+	}
+	latest := latestTag(names, application.AutoDeploy.TagPattern)
+	if latest == "" {
+		return deploymentRequest{}, nil
+	}
+
+	deployed, err := lastDeployedTag(ctx, deps, application.Uuid)
+	if err != nil {
+		return deploymentRequest{}, err
+	}
+	if deployed == latest {
+		return deploymentRequest{}, nil
+	}
+	return deploymentRequest{Tag: latest, Trigger: store_dynamodb.DeploymentTriggerTag}, nil
+}
+
+// lastDeployedTag returns the tag the application's latest deployment built, or "" if there is none or it did not
+// name a tag
+func lastDeployedTag(ctx context.Context, deps *Dependencies, applicationUuid string) (string, error) {
+	page, err := deps.Deployments.List(ctx, applicationUuid, store_dynamodb.DeploymentQuery{
+		Limit:      1,
+		Descending: true,
+		Action:     "DEPLOY",
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	if len(page.Deployments) == 0 {
+		return "", nil
+	}
+	return page.Deployments[0].Tag, nil
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTags lists the same tags for every repository and counts the repositories listed
+type fakeTags struct {
+	tags  []string
+	calls int
+}
+
+func (f *fakeTags) ListTags(_ context.Context, _ string) ([]string, error) {
+	f.calls++
+	return f.tags, nil
+}
+
+func (f *fakeTags) GetContent(context.Context, string, string, string) ([]byte, error) {
+	return nil, nil
+}
+
+// providers returns f as the provider of every source
+func (f *fakeTags) providers(string, string) SourceProvider {
+	return f
+}
+
+func TestScheduledDeployment(t *testing.T) {
+	store := &fakeApplicationsStore{applications: map[string]store_dynamodb.Application{
+		"app-1": {Uuid: "app-1", AutoDeploy: &store_dynamodb.AutoDeployPolicy{Schedule: "0 3 * * *"}},
+	}}
+	deps := newTestDependencies()
+	deps.Applications = store
+	now := time.Date(2026, 10, 16, 3, 2, 0, 0, time.UTC)
+
+	req, err := scheduledDeployment(context.Background(), deps, store.applications["app-1"], now)
+	require.NoError(t, err)
+	assert.Equal(t, store_dynamodb.DeploymentTriggerSchedule, req.Trigger)
+	assert.Equal(t, now, *store.applications["app-1"].AutoDeployedAt)
+
+	// the scheduled time has been deployed
+	req, err = scheduledDeployment(context.Background(), deps, store.applications["app-1"], now.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, req.Trigger)
+
+	// the next one is due the next day
+	req, err = scheduledDeployment(context.Background(), deps, store.applications["app-1"], now.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, store_dynamodb.DeploymentTriggerSchedule, req.Trigger)
+}
+
+func TestScheduledDeploymentCatchUp(t *testing.T) {
+	lastDeployed := time.Date(2026, 10, 10, 3, 0, 0, 0, time.UTC)
+	store := &fakeApplicationsStore{applications: map[string]store_dynamodb.Application{
+		"app-1": {Uuid: "app-1", AutoDeploy: &store_dynamodb.AutoDeployPolicy{Schedule: "0 3 * * *"}, AutoDeployedAt: &lastDeployed},
+	}}
+	deps := newTestDependencies()
+	deps.Applications = store
+
+	// times missed more than autoDeployCatchUp ago are skipped
+	req, err := scheduledDeployment(context.Background(), deps, store.applications["app-1"], time.Date(2026, 10, 16, 5, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, req.Trigger)
+
+	// and another poll that read the same application does not deploy it again
+	stale := store.applications["app-1"]
+	req, err = scheduledDeployment(context.Background(), deps, stale, time.Date(2026, 10, 16, 3, 5, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.NotEmpty(t, req.Trigger)
+	req, err = scheduledDeployment(context.Background(), deps, stale, time.Date(2026, 10, 16, 3, 6, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, req.Trigger)
+}
+
+func TestTagDeployment(t *testing.T) {
+	deployed := builtDeployment("current", 1)
+	deployed.Tag = "v1.9.0"
+	deps := newTestDependencies()
+	deps.Deployments = store_dynamodb.NewDeploymentsStore(&historyDeploymentsTable{history: []store_dynamodb.Deployment{deployed}}, "deployments")
+	tags := &fakeTags{tags: []string{"v1.9.0", "v1.10.0", "v2.0.0-rc1", "nightly"}}
+	application := store_dynamodb.Application{
+		Uuid:       "app-1",
+		SourceUrl:  "https://github.com/org/repo",
+		AutoDeploy: &store_dynamodb.AutoDeployPolicy{TagPattern: "v1.*"},
+	}
+	tagsBySource := map[string][]string{}
+
+	req, err := tagDeployment(context.Background(), deps, tags.providers, tagsBySource, application)
+	require.NoError(t, err)
+	assert.Equal(t, deploymentRequest{Tag: "v1.10.0", Trigger: store_dynamodb.DeploymentTriggerTag}, req)
+
+	// the last deployment built the latest matching tag already
+	application.AutoDeploy.TagPattern = "v1.9.*"
+	req, err = tagDeployment(context.Background(), deps, tags.providers, tagsBySource, application)
+	require.NoError(t, err)
+	assert.Empty(t, req.Trigger)
+
+	// no tag matches
+	application.AutoDeploy.TagPattern = "release-*"
+	req, err = tagDeployment(context.Background(), deps, tags.providers, tagsBySource, application)
+	require.NoError(t, err)
+	assert.Empty(t, req.Trigger)
+
+	// the repository's tags were listed once
+	assert.Equal(t, 1, tags.calls)
+}
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"v1.2.0", "v1.10.0", "v1.9.3", "v2.0.0-rc1", "v2.0.0-rc2", "latest"}
+	assert.Equal(t, "v2.0.0-rc2", latestTag(tags, "v*"))
+	assert.Equal(t, "v2.0.0", latestTag(append(tags, "v2.0.0"), "v*"))
+	assert.Equal(t, "v1.10.0", latestTag(tags, "v1.*"))
+	assert.Equal(t, "", latestTag(tags, "release-*"))
+}
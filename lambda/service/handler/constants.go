@@ -7,10 +7,56 @@ const applicationsTableNameKey = "APPLICATIONS_TABLE"
 const appstoreApplicationsTableNameKey = "APPSTORE_APPLICATIONS_TABLE"
 const appstoreVersionsTableNameKey = "APPSTORE_VERSIONS_TABLE"
 const appAccessTableNameKey = "APP_ACCESS_TABLE"
+const idempotencyTableNameKey = "IDEMPOTENCY_TABLE"
+const deploymentLeasesTableNameKey = "DEPLOYMENT_LEASES_TABLE"
+const deploymentJobsTableNameKey = "DEPLOYMENT_JOBS_TABLE"
+const provisionerLogGroupKey = "PROVISIONER_LOG_GROUP"
+const deployerLogGroupKey = "DEPLOYER_LOG_GROUP"
+
+// sourceTagKey, sourceBranchKey and sourceCommitKey name the git tag, branch or commit a provisioner task builds,
+// rather than the source's default branch
+const sourceTagKey = "SOURCE_TAG"
+const sourceBranchKey = "SOURCE_BRANCH"
+const sourceCommitKey = "SOURCE_COMMIT"
+
+// sourceAuthTokenKey names the token a provisioner task authenticates with a private source with
+const sourceAuthTokenKey = "AUTH_TOKEN"
+
+// sourceTokenParameterKey names the SSM parameter holding the token of a queued provisioner task, which is given it
+// in place of sourceAuthTokenKey so that the token is not stored with the job
+const sourceTokenParameterKey = "AUTH_TOKEN_PARAMETER"
+
+// sourceTokensPathKey names the env var holding the path that the tokens of queued provisioner tasks are kept
+// below, in SSM
+const sourceTokensPathKey = "SOURCE_TOKENS_PATH"
+
+// The build options of a provisioner task's image: the directory of the repository to build from, the path of its
+// Dockerfile, its build args as a JSON object and the stage of the Dockerfile to build
+const sourceContextDirKey = "SOURCE_CONTEXT_DIR"
+const sourceDockerfileKey = "SOURCE_DOCKERFILE"
+const sourceBuildArgsKey = "SOURCE_BUILD_ARGS"
+const sourceTargetKey = "SOURCE_TARGET"
+
+// sourceBuildSecretsKey names the provisioner env var referencing an application's build secrets, as a JSON array
+const sourceBuildSecretsKey = "SOURCE_BUILD_SECRETS"
+
+// buildSecretsPathKey names the env var holding the path that organizations' build secrets are kept below, in SSM
+// and Secrets Manager alike. Each organization's are below a path of its own.
+const buildSecretsPathKey = "BUILD_SECRETS_PATH"
 
 // ECS Task tags for deployment tracking
 const deploymentIdTag = "DeploymentId"
 const applicationIdTag = "ApplicationId"
 
+// computeNodeUuidTag is added by the dispatcher, which counts running provisioner tasks per compute node with it
+const computeNodeUuidTag = "ComputeNodeUuid"
+
+// deploymentCancelledReason is the stopped reason given to ECS when a deployment is cancelled. The status
+// Lambda looks for it to record the deployment as cancelled rather than errored, so the two must match.
+const deploymentCancelledReason = "Deployment cancelled"
+
+// deploymentStatusCancelled is the application status after its deployment is cancelled
+const deploymentStatusCancelled = "cancelled"
+
 // Special identifier for appstore deployments (used for workspace and compute node)
 const appstoreIdentifier = "APP_STORE"
@@ -2,8 +2,9 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
@@ -11,28 +12,22 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/pennsieve/app-deploy-service/service/models"
-	"github.com/pennsieve/app-deploy-service/service/runner"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 )
 
 func DeleteApplicationHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "DeleteApplicationHandler"
-	uuid := request.PathParameters["id"]
+	return newHandler("DeleteApplicationHandler", deleteApplication, RequireClaims())(ctx, request)
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+func deleteApplication(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
+	uuid := request.PathParameters["id"]
 
 	TaskDefinitionArn := os.Getenv("TASK_DEF_ARN")
 	subIdStr := os.Getenv("SUBNET_IDS")
@@ -42,29 +37,31 @@ func DeleteApplicationHandler(ctx context.Context, request events.APIGatewayV2HT
 	envValue := os.Getenv("ENV")
 	TaskDefContainerName := os.Getenv("TASK_DEF_CONTAINER_NAME")
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	organizationId := claims.OrgClaim.NodeId
-	userId := claims.UserClaim.NodeId
+	organizationId := deps.Claims.OrgClaim.NodeId
+	userId := deps.Claims.UserClaim.NodeId
 
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	applicationsTable := os.Getenv("APPLICATIONS_TABLE")
+	applicationsTable := os.Getenv(applicationsTableNameKey)
 
 	applicationIdKey := "APPLICATION_UUID"
 
-	dynamo_store := store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, applicationsTable)
-	statusManager := NewStatusManager(handlerName, dynamo_store, uuid)
-	application, err := dynamo_store.GetById(ctx, uuid)
+	statusManager := NewStatusManager(deps.HandlerName, deps.Applications, uuid)
+	application, err := deps.Applications.GetById(ctx, uuid)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	if application.Uuid == "" {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", uuid, ErrNoRecordsFound)
+	}
+	ifMatch, err := checkIfMatch(request, application.Version)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrNoRecordsFound),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", uuid, err)
+	}
+	err = statusManager.UpdateApplicationStatusAtVersion(ctx, uuid, "deleting", application.Version)
+	if errors.Is(err, store_dynamodb.ErrVersionConflict) {
+		return events.APIGatewayV2HTTPResponse{}, versionConflict("application "+uuid, ifMatch)
 	}
-	statusManager.UpdateApplicationStatus(ctx, uuid, "deleting")
 
-	client := ecs.NewFromConfig(cfg)
-	log.Println("Initiating new Provisioning Fargate Task.")
+	deps.Logger.Info("Initiating new Provisioning Fargate Task.")
 	envKey := "ENV"
 	organizationIdKey := "ORG_ID"
 	organizationIdValue := organizationId
@@ -162,45 +159,23 @@ func DeleteApplicationHandler(ctx context.Context, request events.APIGatewayV2HT
 		},
 		LaunchType: types.LaunchTypeFargate,
 	}
-
-	taskRunner := runner.NewECSTaskRunner(client, runTaskIn)
-	runTaskOut, err := taskRunner.Run(ctx)
-	if err != nil {
-		log.Println(err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
-	}
-	if err := runner.GetRunFailures(runTaskOut); err != nil {
-		log.Println(err)
-		// assuming here that if there were failures, then no tasks started.
-		// seems safe since for now we are only starting one task
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
+	// the provisioner names the application's resources after its source and build context directory
+	if contextDir := application.Build.GetContextDir(); contextDir != "" {
+		overrides := &runTaskIn.Overrides.ContainerOverrides[0]
+		overrides.Environment = append(overrides.Environment, types.KeyValuePair{Name: aws.String(sourceContextDirKey), Value: aws.String(contextDir)})
 	}
-	// we expect one task
-	if len(runTaskOut.Tasks) > 0 {
-		log.Printf("started deletion of application %s from %s in task %s",
-			application.ApplicationId,
-			sourceUrlValue,
-			aws.ToString(runTaskOut.Tasks[0].TaskArn))
+
+	job := newDeploymentJob(actionValue, application.ApplicationId, "", computeNodeUuidValue)
+	if err := queueProvisionerTask(ctx, deps, job, runTaskIn); err != nil {
+		deps.Logger.Error("error queueing task", slog.Any("error", err))
+		return events.APIGatewayV2HTTPResponse{}, statusManager.SetDeleteErrorStatus(ctx, ErrQueueingTask)
 	}
-	m, err := json.Marshal(models.ApplicationResponse{
+	deps.Logger.Info("queued deletion of application",
+		slog.String("applicationId", application.ApplicationId),
+		slog.String("sourceUrl", sourceUrlValue),
+		slog.String("jobId", job.JobId))
+
+	return jsonResponse(http.StatusAccepted, models.ApplicationResponse{
 		Message: "Application deletion initiated",
 	})
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
-	}
-
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusAccepted,
-		Body:       string(m),
-	}, nil
 }
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staleApplicationsStore returns each application as it was before its last update, as if it had been changed by
+// another request between the handler's read and its write.
+type staleApplicationsStore struct {
+	*fakeApplicationsStore
+}
+
+func (s staleApplicationsStore) GetById(ctx context.Context, uuid string) (store_dynamodb.Application, error) {
+	application, err := s.fakeApplicationsStore.GetById(ctx, uuid)
+	application.Version--
+	return application, err
+}
+
+func TestDeleteApplicationRejectsConcurrentUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "without If-Match", status: http.StatusConflict},
+		{name: "with If-Match", headers: map[string]string{"If-Match": `"2"`}, status: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newPatchTestStore()
+			ctx := newPatchTestContext(store, "N:organization:1")
+			deps, _ := DependenciesFromContext(ctx)
+			deps.Applications = staleApplicationsStore{store}
+
+			response, err := DeleteApplicationHandler(ctx, events.APIGatewayV2HTTPRequest{
+				PathParameters: map[string]string{"id": "app-1"},
+				Headers:        tt.headers,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, response.StatusCode, response.Body)
+			assert.Empty(t, store.statuses)
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/google/uuid"
+	"github.com/pennsieve/app-deploy-service/service/runner"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+)
+
+const dispatchAccountLimitKey = "DISPATCH_ACCOUNT_LIMIT"
+const dispatchComputeNodeLimitKey = "DISPATCH_COMPUTE_NODE_LIMIT"
+const provisionerTaskFamilyKey = "PROVISIONER_TASK_FAMILY"
+
+// Limits used when the dispatcher's environment does not set them
+const defaultDispatchAccountLimit = 20
+const defaultDispatchComputeNodeLimit = 5
+
+// maxDispatchAttempts is how many times ECS may turn a job away for lack of capacity before it is failed
+const maxDispatchAttempts = 8
+
+// sourceTokenLifetime is how long the token of a queued provisioner task is kept for, long enough for the job to
+// wait for capacity and for its deployment to be retried
+const sourceTokenLifetime = 24 * time.Hour
+
+// Delays between a job's attempts start at dispatchRetryBaseDelay and double up to dispatchRetryMaxDelay
+const dispatchRetryBaseDelay = 30 * time.Second
+const dispatchRetryMaxDelay = 15 * time.Minute
+
+// DispatchLimits bound how many provisioner tasks run at once
+type DispatchLimits struct {
+	// Account limits the provisioner tasks running in the account
+	Account int
+	// ComputeNode limits the provisioner tasks running for any one compute node
+	ComputeNode int
+}
+
+// dispatchLimits reads the dispatcher's limits from its environment
+func dispatchLimits() DispatchLimits {
+	return DispatchLimits{
+		Account:     intEnv(dispatchAccountLimitKey, defaultDispatchAccountLimit),
+		ComputeNode: intEnv(dispatchComputeNodeLimitKey, defaultDispatchComputeNodeLimit),
+	}
+}
+
+func intEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// newDeploymentJob returns a job for the provisioner task of action. Jobs with a deployment share its id.
+func newDeploymentJob(action string, applicationId string, deploymentId string, computeNodeUuid string) store_dynamodb.DeploymentJob {
+	jobId := deploymentId
+	if jobId == "" {
+		jobId = uuid.NewString()
+	}
+	return store_dynamodb.DeploymentJob{
+		JobId:           jobId,
+		Status:          store_dynamodb.JobStatusPending,
+		Action:          action,
+		ApplicationId:   applicationId,
+		DeploymentId:    deploymentId,
+		ComputeNodeUuid: computeNodeUuid,
+	}
+}
+
+// SourceTokensAPI is an interface only containing the SSM client methods used to keep the tokens of queued
+// provisioner tasks
+type SourceTokensAPI interface {
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// queueProvisionerTask stores job with the provisioner task it runs, for the dispatcher to run once there is
+// capacity for it. The task's source token is kept apart from the job.
+func queueProvisionerTask(ctx context.Context, deps *Dependencies, job store_dynamodb.DeploymentJob, runTaskIn *ecs.RunTaskInput) error {
+	if deps.Jobs == nil {
+		return fmt.Errorf("missing deployment jobs table: %w", ErrConfig)
+	}
+	if err := referenceSourceToken(ctx, deps, job.JobId, runTaskIn); err != nil {
+		return err
+	}
+	runTask, err := json.Marshal(runTaskIn)
+	if err != nil {
+		return fmt.Errorf("%w: provisioner task of job %s: %w", ErrMarshaling, job.JobId, err)
+	}
+	now := time.Now().UTC()
+	job.RunTask = string(runTask)
+	job.CreatedAt = now
+	job.NextAttemptAt = now
+	if err := deps.Jobs.Insert(ctx, job); err != nil {
+		return fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	return nil
+}
+
+// referenceSourceToken moves the token of a private source out of the environment of a provisioner task, which is
+// stored with its job, into an SSM parameter that expires once the job is done with it. The task is given the name
+// of the parameter in its place.
+func referenceSourceToken(ctx context.Context, deps *Dependencies, jobId string, runTaskIn *ecs.RunTaskInput) error {
+	if runTaskIn.Overrides == nil {
+		return nil
+	}
+	for i, override := range runTaskIn.Overrides.ContainerOverrides {
+		index := slices.IndexFunc(override.Environment, func(pair types.KeyValuePair) bool {
+			return aws.ToString(pair.Name) == sourceAuthTokenKey
+		})
+		if index < 0 {
+			continue
+		}
+		token := aws.ToString(override.Environment[index].Value)
+		environment := slices.Delete(slices.Clone(override.Environment), index, index+1)
+		if token != "" {
+			name, err := putSourceToken(ctx, deps, jobId, token)
+			if err != nil {
+				return err
+			}
+			environment = append(environment, types.KeyValuePair{Name: aws.String(sourceTokenParameterKey), Value: aws.String(name)})
+		}
+		runTaskIn.Overrides.ContainerOverrides[i].Environment = environment
+	}
+	return nil
+}
+
+// putSourceToken keeps the token of job's provisioner task in SSM, and returns the name of its parameter
+func putSourceToken(ctx context.Context, deps *Dependencies, jobId string, token string) (string, error) {
+	root := strings.Trim(os.Getenv(sourceTokensPathKey), "/")
+	if root == "" || deps.SourceTokens == nil {
+		return "", fmt.Errorf("%s not set: %w", sourceTokensPathKey, ErrConfig)
+	}
+	name := fmt.Sprintf("/%s/%s", root, jobId)
+	// only advanced parameters can expire
+	policies := fmt.Sprintf(`[{"Type":"Expiration","Version":"1.0","Attributes":{"Timestamp":"%s"}}]`,
+		time.Now().UTC().Add(sourceTokenLifetime).Format(time.RFC3339))
+	if _, err := deps.SourceTokens.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(token),
+		Type:      ssmTypes.ParameterTypeSecureString,
+		Tier:      ssmTypes.ParameterTierAdvanced,
+		Policies:  aws.String(policies),
+		Overwrite: aws.Bool(true),
+	}); err != nil {
+		return "", fmt.Errorf("error storing source token of job %s: %w", jobId, err)
+	}
+	return name, nil
+}
+
+// DispatchJobsHandler runs pending deployment jobs. It is invoked when a job becomes pending, when a provisioner
+// task stops and on a schedule, for jobs waiting to be retried, so the event itself is not used.
+func DispatchJobsHandler(ctx context.Context, _ json.RawMessage) error {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	deps := NewDependencies(ctx, "DispatchJobsHandler", cfg, events.APIGatewayV2HTTPRequest{})
+	return dispatchJobs(ctx, deps, dispatchLimits(), time.Now())
+}
+
+// dispatchJobs runs pending jobs, oldest first, while the running provisioner tasks are within limits. A job whose
+// compute node is at its limit is passed over for later jobs. Once ECS turns a job away for lack of capacity no
+// more jobs are run until the next dispatch. Each job is claimed before it is run, so a job another dispatch has
+// run, or is running, is skipped. Jobs whose task was run but could not be recorded as dispatched are returned as
+// an error once the other jobs have been dispatched.
+func dispatchJobs(ctx context.Context, deps *Dependencies, limits DispatchLimits, now time.Time) error {
+	jobs, err := deps.Jobs.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	running, err := runner.RunningTasks(ctx, deps.ECSTasks, &ecs.ListTasksInput{
+		Cluster: aws.String(os.Getenv("CLUSTER_ARN")),
+		Family:  aws.String(os.Getenv(provisionerTaskFamilyKey)),
+	})
+	if err != nil {
+		return err
+	}
+	total := len(running)
+	perNode := map[string]int{}
+	for _, task := range running {
+		perNode[runner.TagValue(task.Tags, computeNodeUuidTag)]++
+	}
+
+	var unrecorded []error
+	for _, job := range jobs {
+		logger := deps.Logger.With(slog.String("jobId", job.JobId), slog.String("applicationId", job.ApplicationId))
+		if job.NextAttemptAt.After(now) {
+			continue
+		}
+		if total >= limits.Account {
+			logger.Info("account limit of running provisioner tasks reached", slog.Int("running", total))
+			return errors.Join(unrecorded...)
+		}
+		if job.ComputeNodeUuid != "" && perNode[job.ComputeNodeUuid] >= limits.ComputeNode {
+			logger.Info("compute node limit of running provisioner tasks reached",
+				slog.String("computeNodeUuid", job.ComputeNodeUuid))
+			continue
+		}
+
+		claimed, err := deps.Jobs.Claim(ctx, job.JobId, job.Attempts)
+		if err != nil {
+			return errors.Join(append(unrecorded, err)...)
+		}
+		if !claimed {
+			logger.Info("job already claimed by another dispatch")
+			continue
+		}
+
+		taskArn, err := runJob(ctx, deps, job)
+		if runner.IsCapacityError(err) {
+			attempts := job.Attempts + 1
+			if attempts < maxDispatchAttempts {
+				logger.Warn("no capacity for provisioner task, retrying later",
+					slog.Int("attempts", attempts), slog.Any("error", err))
+				if retryErr := deps.Jobs.Retry(ctx, job.JobId, attempts, now.Add(dispatchRetryDelay(attempts)), err); retryErr != nil {
+					logger.Error("error scheduling retry of job", slog.Any("error", retryErr))
+				}
+				return errors.Join(unrecorded...)
+			}
+			failJob(ctx, deps, job, attempts, err, now)
+			return errors.Join(unrecorded...)
+		}
+		if err != nil {
+			failJob(ctx, deps, job, job.Attempts+1, err, now)
+			continue
+		}
+		total++
+		perNode[job.ComputeNodeUuid]++
+
+		// the task is running, so the job is left dispatching rather than failed if it cannot be recorded
+		if err := deps.Jobs.SetDispatched(ctx, job.JobId, taskArn, now); err != nil {
+			logger.Error("error recording dispatched job", slog.String("taskArn", taskArn), slog.Any("error", err))
+			unrecorded = append(unrecorded, fmt.Errorf("%w: job %s: %w", ErrDynamoDB, job.JobId, err))
+		}
+		if job.DeploymentId != "" && taskArn != "" {
+			jobStatusManager(ctx, deps, job).SetProvisionerTask(ctx, taskArn)
+		}
+	}
+	return errors.Join(unrecorded...)
+}
+
+// runJob runs the provisioner task of a claimed job and returns the task it was run as
+func runJob(ctx context.Context, deps *Dependencies, job store_dynamodb.DeploymentJob) (string, error) {
+	var runTaskIn ecs.RunTaskInput
+	if err := json.Unmarshal([]byte(job.RunTask), &runTaskIn); err != nil {
+		return "", fmt.Errorf("error unmarshaling provisioner task of job %s: %w", job.JobId, err)
+	}
+	if job.ComputeNodeUuid != "" {
+		runTaskIn.Tags = append(runTaskIn.Tags, types.Tag{
+			Key:   aws.String(computeNodeUuidTag),
+			Value: aws.String(job.ComputeNodeUuid),
+		})
+	}
+
+	runTaskOut, err := runner.NewECSTaskRunner(deps.ECSRunner, &runTaskIn).Run(ctx)
+	if err != nil {
+		return "", err
+	}
+	// assuming here that if there were failures, then no tasks started.
+	// seems safe since for now we are only starting one task
+	if err := runner.GetRunFailures(runTaskOut); err != nil {
+		return "", err
+	}
+	var taskArn string
+	// we expect one task
+	if len(runTaskOut.Tasks) > 0 {
+		taskArn = aws.ToString(runTaskOut.Tasks[0].TaskArn)
+	}
+	deps.Logger.Info("dispatched job",
+		slog.String("jobId", job.JobId),
+		slog.String("action", job.Action),
+		slog.String("taskArn", taskArn))
+	return taskArn, nil
+}
+
+// failJob records that job could not be run, failing its application or version and its deployment. A deployment
+// gives up its lease, as no provisioner task will stop to release it.
+func failJob(ctx context.Context, deps *Dependencies, job store_dynamodb.DeploymentJob, attempts int, cause error, now time.Time) {
+	deps.Logger.Error("error running provisioner task of job",
+		slog.String("jobId", job.JobId),
+		slog.String("action", job.Action),
+		slog.Int("attempts", attempts),
+		slog.Any("error", cause))
+	if err := deps.Jobs.SetFailed(ctx, job.JobId, attempts, cause, now); err != nil {
+		deps.Logger.Error("error recording failed job", slog.String("jobId", job.JobId), slog.Any("error", err))
+	}
+	if job.Action == "DELETE" {
+		jobStatusManager(ctx, deps, job).SetDeleteErrorStatus(ctx, ErrRunningFargateTask)
+	} else {
+		jobStatusManager(ctx, deps, job).SetErrorStatus(ctx, ErrRunningFargateTask)
+	}
+	if job.DeploymentId != "" && (job.Action == "DEPLOY" || job.Action == "ROLLBACK") {
+		releaseDeploymentLease(ctx, deps, job.ApplicationId, job.DeploymentId)
+	}
+}
+
+// jobStatusManager returns the StatusManager for the application, or app store version, that job provisions
+func jobStatusManager(ctx context.Context, deps *Dependencies, job store_dynamodb.DeploymentJob) *StatusManager {
+	var statusManager *StatusManager
+	if job.Action == "ADD_TO_APPSTORE" {
+		statusManager = NewAppStoreStatusManager(deps.HandlerName, deps.AppStoreVersions, job.ApplicationId)
+	} else {
+		statusManager = NewStatusManager(deps.HandlerName, deps.Applications, job.ApplicationId)
+	}
+	if job.DeploymentId != "" {
+		statusManager = statusManager.WithDeployment(deps.Deployments, job.DeploymentId)
+	}
+	return statusManager.WithPusher(deps.PusherClient(ctx))
+}
+
+// dispatchRetryDelay is how long a job waits before its next attempt, after ECS turned it away attempts times
+func dispatchRetryDelay(attempts int) time.Duration {
+	delay := dispatchRetryBaseDelay
+	for i := 1; i < attempts && delay < dispatchRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, dispatchRetryMaxDelay)
+}
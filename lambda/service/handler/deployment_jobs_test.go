@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeJobsTable returns pending as the pending jobs and records the jobs inserted and the updates made. Updates
+// setting a job to a status in reject fail their condition.
+type fakeJobsTable struct {
+	pending  []store_dynamodb.DeploymentJob
+	inserted []store_dynamodb.DeploymentJob
+	updates  []*dynamodb.UpdateItemInput
+	reject   map[string][]string
+}
+
+func (f *fakeJobsTable) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	var job store_dynamodb.DeploymentJob
+	if err := attributevalue.UnmarshalMap(params.Item, &job); err != nil {
+		return nil, err
+	}
+	f.inserted = append(f.inserted, job)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeJobsTable) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.updates = append(f.updates, params)
+	jobId := params.Key[store_dynamodb.DeploymentJobIdField].(*types.AttributeValueMemberS).Value
+	for _, status := range f.reject[jobId] {
+		if slices.Contains(updateValues(params), status) {
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("failed")}
+		}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// updateValues returns the string values of an update, which include the status it sets
+func updateValues(in *dynamodb.UpdateItemInput) []string {
+	var values []string
+	for _, v := range in.ExpressionAttributeValues {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			values = append(values, s.Value)
+		}
+	}
+	return values
+}
+
+// updatedJobs returns the job each update was made to, with what the update did to it, in turn
+func updatedJobs(jobs *fakeJobsTable) []string {
+	var updated []string
+	for _, in := range jobs.updates {
+		jobId := in.Key[store_dynamodb.DeploymentJobIdField].(*types.AttributeValueMemberS).Value
+		values := updateValues(in)
+		switch {
+		case slices.Contains(values, store_dynamodb.JobStatusDispatched):
+			updated = append(updated, jobId+" dispatched")
+		case slices.Contains(values, store_dynamodb.JobStatusFailed):
+			updated = append(updated, jobId+" failed")
+		case strings.Contains(aws.ToString(in.ConditionExpression), "AND"):
+			// only a claim is conditioned on the job's attempts as well as its status
+			updated = append(updated, jobId+" claimed")
+		default:
+			updated = append(updated, jobId+" retried")
+		}
+	}
+	return updated
+}
+
+func (f *fakeJobsTable) Query(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	out := &dynamodb.QueryOutput{}
+	for _, job := range f.pending {
+		item, err := attributevalue.MarshalMap(job)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+// fakeDispatchECS has running provisioner tasks on the given compute nodes and records the tasks it runs. While
+// failure is set, RunTask reports it instead of running the task.
+type fakeDispatchECS struct {
+	running []string
+	failure string
+	ran     []*ecs.RunTaskInput
+}
+
+func (f *fakeDispatchECS) ListTasks(_ context.Context, _ *ecs.ListTasksInput, _ ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+	out := &ecs.ListTasksOutput{}
+	for i := range f.running {
+		out.TaskArns = append(out.TaskArns, string(rune('a'+i)))
+	}
+	return out, nil
+}
+
+func (f *fakeDispatchECS) DescribeTasks(_ context.Context, params *ecs.DescribeTasksInput, _ ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	out := &ecs.DescribeTasksOutput{}
+	for _, arn := range params.Tasks {
+		out.Tasks = append(out.Tasks, ecstypes.Task{
+			TaskArn: aws.String(arn),
+			Tags:    []ecstypes.Tag{{Key: aws.String(computeNodeUuidTag), Value: aws.String(f.running[arn[0]-'a'])}},
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeDispatchECS) StopTask(_ context.Context, _ *ecs.StopTaskInput, _ ...func(*ecs.Options)) (*ecs.StopTaskOutput, error) {
+	return &ecs.StopTaskOutput{}, nil
+}
+
+func (f *fakeDispatchECS) RunTask(_ context.Context, params *ecs.RunTaskInput, _ ...func(*ecs.Options)) (*ecs.RunTaskOutput, error) {
+	if f.failure != "" {
+		return &ecs.RunTaskOutput{Failures: []ecstypes.Failure{{Reason: aws.String(f.failure)}}}, nil
+	}
+	f.ran = append(f.ran, params)
+	return &ecs.RunTaskOutput{Tasks: []ecstypes.Task{{TaskArn: aws.String("task-" + aws.ToString(params.TaskDefinition))}}}, nil
+}
+
+// fakeSourceTokens records the source tokens put in SSM
+type fakeSourceTokens struct {
+	put []*ssm.PutParameterInput
+}
+
+func (f *fakeSourceTokens) PutParameter(_ context.Context, params *ssm.PutParameterInput, _ ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.put = append(f.put, params)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func pendingJob(jobId string, computeNodeUuid string, createdAt time.Time) store_dynamodb.DeploymentJob {
+	job := newDeploymentJob("DELETE", "app-"+jobId, "", computeNodeUuid)
+	job.JobId = jobId
+	job.CreatedAt = createdAt
+	job.NextAttemptAt = createdAt
+	job.RunTask = `{"TaskDefinition":"` + jobId + `"}`
+	return job
+}
+
+func newDispatchTestDependencies(jobs *fakeJobsTable, tasks *fakeDispatchECS) *Dependencies {
+	deps := newTestDependencies()
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+	deps.ECSTasks = tasks
+	deps.ECSRunner = tasks
+	return deps
+}
+
+func ranTasks(tasks *fakeDispatchECS) []string {
+	var ran []string
+	for _, in := range tasks.ran {
+		ran = append(ran, aws.ToString(in.TaskDefinition))
+	}
+	return ran
+}
+
+func TestDispatchJobsComputeNodeLimit(t *testing.T) {
+	now := time.Now()
+	jobs := &fakeJobsTable{pending: []store_dynamodb.DeploymentJob{
+		pendingJob("job-1", "node-a", now.Add(-3*time.Minute)),
+		pendingJob("job-2", "node-a", now.Add(-2*time.Minute)),
+		pendingJob("job-3", "node-b", now.Add(-time.Minute)),
+	}}
+	tasks := &fakeDispatchECS{}
+	deps := newDispatchTestDependencies(jobs, tasks)
+
+	require.NoError(t, dispatchJobs(context.Background(), deps, DispatchLimits{Account: 10, ComputeNode: 1}, now))
+	assert.Equal(t, []string{"job-1", "job-3"}, ranTasks(tasks))
+	assert.Contains(t, tasks.ran[0].Tags, ecstypes.Tag{Key: aws.String(computeNodeUuidTag), Value: aws.String("node-a")})
+	// each job is claimed before it is run and recorded as dispatched after
+	assert.Equal(t, []string{"job-1 claimed", "job-1 dispatched", "job-3 claimed", "job-3 dispatched"}, updatedJobs(jobs))
+}
+
+func TestDispatchJobsAccountLimit(t *testing.T) {
+	now := time.Now()
+	jobs := &fakeJobsTable{pending: []store_dynamodb.DeploymentJob{pendingJob("job-1", "node-a", now)}}
+	tasks := &fakeDispatchECS{running: []string{"node-b", "node-c"}}
+	deps := newDispatchTestDependencies(jobs, tasks)
+
+	require.NoError(t, dispatchJobs(context.Background(), deps, DispatchLimits{Account: 2, ComputeNode: 5}, now))
+	assert.Empty(t, tasks.ran)
+	assert.Empty(t, jobs.updates)
+}
+
+func TestDispatchJobsWaitsForNextAttempt(t *testing.T) {
+	now := time.Now()
+	later := pendingJob("job-1", "node-a", now.Add(-time.Minute))
+	later.NextAttemptAt = now.Add(time.Minute)
+	jobs := &fakeJobsTable{pending: []store_dynamodb.DeploymentJob{later, pendingJob("job-2", "node-a", now)}}
+	tasks := &fakeDispatchECS{}
+	deps := newDispatchTestDependencies(jobs, tasks)
+
+	require.NoError(t, dispatchJobs(context.Background(), deps, DispatchLimits{Account: 10, ComputeNode: 5}, now))
+	assert.Equal(t, []string{"job-2"}, ranTasks(tasks))
+}
+
+func TestDispatchJobsRetriesWithoutCapacity(t *testing.T) {
+	now := time.Now()
+	jobs := &fakeJobsTable{pending: []store_dynamodb.DeploymentJob{
+		pendingJob("job-1", "node-a", now.Add(-time.Minute)),
+		pendingJob("job-2", "node-b", now),
+	}}
+	tasks := &fakeDispatchECS{failure: "Capacity is unavailable at this time. Please try again later or in a different availability zone"}
+	deps := newDispatchTestDependencies(jobs, tasks)
+
+	require.NoError(t, dispatchJobs(context.Background(), deps, DispatchLimits{Account: 10, ComputeNode: 5}, now))
+	// the first job is left to retry and the second is not attempted
+	assert.Equal(t, []string{"job-1 claimed", "job-1 retried"}, updatedJobs(jobs))
+	retry := jobs.updates[1]
+	assert.Contains(t, updateValues(retry), store_dynamodb.JobStatusPending)
+	assert.NotContains(t, aws.ToString(retry.UpdateExpression), "expiresAt")
+}
+
+func TestDispatchJobsSkipsClaimedJobs(t *testing.T) {
+	now := time.Now()
+	jobs := &fakeJobsTable{
+		pending: []store_dynamodb.DeploymentJob{
+			pendingJob("job-1", "node-a", now.Add(-time.Minute)),
+			pendingJob("job-2", "node-a", now),
+		},
+		// job-1 has been claimed by another dispatch since the index was read
+		reject: map[string][]string{"job-1": {store_dynamodb.JobStatusDispatching}},
+	}
+	tasks := &fakeDispatchECS{}
+	deps := newDispatchTestDependencies(jobs, tasks)
+
+	require.NoError(t, dispatchJobs(context.Background(), deps, DispatchLimits{Account: 10, ComputeNode: 5}, now))
+	assert.Equal(t, []string{"job-2"}, ranTasks(tasks))
+	assert.Equal(t, []string{"job-1 claimed", "job-2 claimed", "job-2 dispatched"}, updatedJobs(jobs))
+}
+
+func TestDispatchJobsReportsUnrecordedDispatch(t *testing.T) {
+	now := time.Now()
+	jobs := &fakeJobsTable{
+		pending: []store_dynamodb.DeploymentJob{
+			pendingJob("job-1", "node-a", now.Add(-time.Minute)),
+			pendingJob("job-2", "node-b", now),
+		},
+		reject: map[string][]string{"job-1": {store_dynamodb.JobStatusDispatched}},
+	}
+	tasks := &fakeDispatchECS{}
+	deps := newDispatchTestDependencies(jobs, tasks)
+
+	err := dispatchJobs(context.Background(), deps, DispatchLimits{Account: 10, ComputeNode: 5}, now)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrDynamoDB))
+	assert.Contains(t, err.Error(), "job-1")
+	// the running task is not failed and later jobs are still dispatched
+	assert.Equal(t, []string{"job-1", "job-2"}, ranTasks(tasks))
+	assert.Equal(t, []string{"job-1 claimed", "job-1 dispatched", "job-2 claimed", "job-2 dispatched"}, updatedJobs(jobs))
+}
+
+func TestDispatchRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, dispatchRetryDelay(1))
+	assert.Equal(t, time.Minute, dispatchRetryDelay(2))
+	assert.Equal(t, 8*time.Minute, dispatchRetryDelay(5))
+	assert.Equal(t, dispatchRetryMaxDelay, dispatchRetryDelay(maxDispatchAttempts))
+}
+
+func tokenTaskInput(token string) *ecs.RunTaskInput {
+	return &ecs.RunTaskInput{Overrides: &ecstypes.TaskOverride{ContainerOverrides: []ecstypes.ContainerOverride{{
+		Environment: []ecstypes.KeyValuePair{
+			{Name: aws.String("ACTION"), Value: aws.String("ADD_TO_APPSTORE")},
+			{Name: aws.String(sourceAuthTokenKey), Value: aws.String(token)},
+		},
+	}}}}
+}
+
+func TestQueueProvisionerTaskKeepsTokenOutOfJob(t *testing.T) {
+	t.Setenv(sourceTokensPathKey, "/dev/app-deploy-service/source-tokens/")
+	jobs := &fakeJobsTable{}
+	tokens := &fakeSourceTokens{}
+	deps := newTestDependencies()
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+	deps.SourceTokens = tokens
+
+	job := newDeploymentJob("ADD_TO_APPSTORE", "version-1", "deploy-1", "")
+	require.NoError(t, queueProvisionerTask(context.Background(), deps, job, tokenTaskInput("ghp_secret")))
+
+	require.Len(t, jobs.inserted, 1)
+	assert.NotContains(t, jobs.inserted[0].RunTask, "ghp_secret")
+	assert.NotContains(t, jobs.inserted[0].RunTask, `"`+sourceAuthTokenKey+`"`)
+	require.Len(t, tokens.put, 1)
+	put := tokens.put[0]
+	assert.Equal(t, "/dev/app-deploy-service/source-tokens/deploy-1", aws.ToString(put.Name))
+	assert.Equal(t, ssmTypes.ParameterTypeSecureString, put.Type)
+	assert.Contains(t, aws.ToString(put.Policies), "Expiration")
+	assert.Equal(t, "/dev/app-deploy-service/source-tokens/deploy-1", jobEnvironment(t, jobs.inserted[0])[sourceTokenParameterKey])
+}
+
+func TestQueueProvisionerTaskWithoutToken(t *testing.T) {
+	jobs := &fakeJobsTable{}
+	tokens := &fakeSourceTokens{}
+	deps := newTestDependencies()
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+	deps.SourceTokens = tokens
+
+	// a public source is sent with an empty token, which needs no parameter
+	job := newDeploymentJob("ADD_TO_APPSTORE", "version-1", "deploy-1", "")
+	require.NoError(t, queueProvisionerTask(context.Background(), deps, job, tokenTaskInput("")))
+
+	require.Len(t, jobs.inserted, 1)
+	environment := jobEnvironment(t, jobs.inserted[0])
+	assert.NotContains(t, environment, sourceAuthTokenKey)
+	assert.NotContains(t, environment, sourceTokenParameterKey)
+	assert.Empty(t, tokens.put)
+}
+
+func TestQueueProvisionerTaskWithoutTokensPath(t *testing.T) {
+	t.Setenv(sourceTokensPathKey, "")
+	jobs := &fakeJobsTable{}
+	deps := newTestDependencies()
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+	deps.SourceTokens = &fakeSourceTokens{}
+
+	job := newDeploymentJob("DEPLOY", "app-1", "deploy-1", "")
+	err := queueProvisionerTask(context.Background(), deps, job, tokenTaskInput("ghp_secret"))
+	assert.ErrorIs(t, err, ErrConfig)
+	// the job is not queued with its token
+	assert.Empty(t, jobs.inserted)
+}
+
+func TestFailJobOfDelete(t *testing.T) {
+	jobs := &fakeJobsTable{}
+	applications := &fakeApplicationsStore{}
+	deps := newTestDependencies()
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+	deps.Applications = applications
+
+	// only the delete itself takes a deleting application out of deleting
+	failJob(context.Background(), deps, newDeploymentJob("DELETE", "app-1", "", ""), 1, errors.New("no capacity"), time.Now())
+	failJob(context.Background(), deps, newDeploymentJob("CREATE", "app-2", "", ""), 1, errors.New("no capacity"), time.Now())
+
+	assert.Equal(t, "delete-error: "+ErrRunningFargateTask.Error(), applications.statuses["app-1"])
+	assert.Equal(t, "error: "+ErrRunningFargateTask.Error(), applications.statuses["app-2"])
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/service/validation"
+)
+
+// enqueueAttempts is how many times a deployment tries to queue behind, or take, a lease that keeps changing hands
+const enqueueAttempts = 3
+
+// deploymentQueueParam reads the queue query parameter of a deployment request. With queue=true a deployment waits
+// for one already in progress instead of failing.
+func deploymentQueueParam(params map[string]string) (bool, error) {
+	v := &validation.Validator{}
+	if queue, ok := params["queue"]; ok {
+		validation.Field(v, "queue", queue, validation.OneOf("true", "false"))
+	}
+	if fields := v.Errors(); len(fields) > 0 {
+		return false, NewValidationError(fields...)
+	}
+	return params["queue"] == "true", nil
+}
+
+// acquireDeploymentLease takes the application's deployment lease for deploymentId. If another deployment holds
+// it, a DeploymentInProgressError is returned, unless queue is set, when it returns false so the deployment can be
+// queued instead.
+func acquireDeploymentLease(ctx context.Context, deps *Dependencies, applicationId string, deploymentId string, queue bool) (bool, error) {
+	if deps.Leases == nil {
+		return false, fmt.Errorf("missing deployment leases table: %w", ErrConfig)
+	}
+	acquired, held, err := deps.Leases.Acquire(ctx, applicationId, deploymentId, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	if !acquired && !queue {
+		return false, &DeploymentInProgressError{DeploymentId: held.DeploymentId}
+	}
+	return acquired, nil
+}
+
+// initialDeploymentStatus is the LastStatus a new deployment is stored with
+func initialDeploymentStatus(leased bool) string {
+	if leased {
+		return store_dynamodb.DeploymentStatusNotStarted
+	}
+	return store_dynamodb.DeploymentStatusQueued
+}
+
+// startDeployment queues the deployment's provisioner task for the dispatcher if it holds the application's lease.
+// Otherwise the task is stored as a waiting job, the deployment is queued behind the lease's holder and true is
+// returned. The lease may be released while the deployment is being queued, in which case it is taken and the
+// deployment started after all.
+func startDeployment(ctx context.Context, deps *Dependencies, statusManager *StatusManager, job store_dynamodb.DeploymentJob, runTaskIn *ecs.RunTaskInput, leased bool) (bool, error) {
+	applicationId, deploymentId := statusManager.ApplicationId, statusManager.DeploymentId
+	if !leased {
+		// the job is stored first, so that it is there to release as soon as the deployment is handed the lease
+		job.Status = store_dynamodb.JobStatusWaiting
+		if err := queueProvisionerTask(ctx, deps, job, runTaskIn); err != nil {
+			deps.Logger.Error("error queueing task", slog.Any("error", err))
+			return false, statusManager.SetErrorStatus(ctx, ErrQueueingTask)
+		}
+		queued, err := enqueueDeployment(ctx, deps, applicationId, deploymentId)
+		if err != nil {
+			if _, cancelErr := deps.Jobs.Cancel(ctx, deploymentId, time.Now()); cancelErr != nil {
+				deps.Logger.Error("error cancelling job of deployment", slog.Any("error", cancelErr))
+			}
+			return false, statusManager.SetErrorStatus(ctx, err)
+		}
+		if queued {
+			deps.Logger.Info("queued deployment of application",
+				slog.String("deploymentId", deploymentId),
+				slog.String("applicationId", applicationId))
+			return true, nil
+		}
+		if !startQueuedDeployment(ctx, deps, applicationId, store_dynamodb.QueuedDeployment{DeploymentId: deploymentId}) {
+			releaseDeploymentLease(ctx, deps, applicationId, deploymentId)
+			return false, fmt.Errorf("%w: deployment %s could not be started", ErrQueueingTask, deploymentId)
+		}
+		return false, nil
+	}
+
+	statusManager.UpdateApplicationStatus(ctx, applicationId, "pending")
+	statusManager.StartStep(ctx, store_dynamodb.StepProvisioning)
+	if err := queueProvisionerTask(ctx, deps, job, runTaskIn); err != nil {
+		deps.Logger.Error("error queueing task", slog.Any("error", err))
+		err = statusManager.SetErrorStatus(ctx, ErrQueueingTask)
+		releaseDeploymentLease(ctx, deps, applicationId, deploymentId)
+		return false, err
+	}
+	return false, nil
+}
+
+// enqueueDeployment adds the deployment to the application's lease queue. It returns false if there was no lease
+// to queue behind, having taken the lease for the deployment instead.
+func enqueueDeployment(ctx context.Context, deps *Dependencies, applicationId string, deploymentId string) (bool, error) {
+	queued := store_dynamodb.QueuedDeployment{DeploymentId: deploymentId}
+	for attempt := 0; attempt < enqueueAttempts; attempt++ {
+		ok, err := deps.Leases.Enqueue(ctx, applicationId, queued, time.Now())
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+		}
+		if ok {
+			return true, nil
+		}
+		acquired, _, err := deps.Leases.Acquire(ctx, applicationId, deploymentId, time.Now())
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+		}
+		if acquired {
+			return false, nil
+		}
+		// another deployment took the lease in between, so queue behind that one
+	}
+	return false, fmt.Errorf("%w: lease of application %s kept changing while queueing deployment %s", ErrDynamoDB, applicationId, deploymentId)
+}
+
+// releaseDeploymentLease gives up the lease of a deployment that will not run its provisioner task, starting the
+// next queued deployment. Normally the status listener releases the lease when the provisioner task stops.
+func releaseDeploymentLease(ctx context.Context, deps *Dependencies, applicationId string, deploymentId string) {
+	for {
+		next, err := deps.Leases.Release(ctx, applicationId, deploymentId, time.Now())
+		if err != nil {
+			deps.Logger.Error("error releasing deployment lease",
+				slog.String("applicationId", applicationId),
+				slog.String("deploymentId", deploymentId),
+				slog.Any("error", err))
+			return
+		}
+		if next == nil || startQueuedDeployment(ctx, deps, applicationId, *next) {
+			return
+		}
+		// the next deployment did not start either, so pass the lease on again
+		deploymentId = next.DeploymentId
+	}
+}
+
+// startQueuedDeployment releases the waiting job of a deployment that has been handed the lease, for the dispatcher
+// to run. It returns false if the deployment will not run, so that the lease should be released again.
+func startQueuedDeployment(ctx context.Context, deps *Dependencies, applicationId string, queued store_dynamodb.QueuedDeployment) bool {
+	logger := deps.Logger.With(slog.String("applicationId", applicationId), slog.String("deploymentId", queued.DeploymentId))
+	if err := deps.Deployments.Dispatch(ctx, applicationId, queued.DeploymentId); err != nil {
+		if !errors.Is(err, store_dynamodb.ErrDeploymentNotQueued) {
+			logger.Error("error dispatching queued deployment", slog.Any("error", err))
+		}
+		return false
+	}
+
+	statusManager := NewStatusManager(deps.HandlerName, deps.Applications, applicationId).
+		WithDeployment(deps.Deployments, queued.DeploymentId).
+		WithPusher(deps.PusherClient(ctx))
+	released, err := deps.Jobs.Release(ctx, queued.DeploymentId, time.Now())
+	if err != nil || !released {
+		logger.Error("error releasing job of queued deployment", slog.Bool("released", released), slog.Any("error", err))
+		statusManager.SetErrorStatus(ctx, ErrQueueingTask)
+		return false
+	}
+
+	statusManager.UpdateApplicationStatus(ctx, applicationId, "pending")
+	statusManager.StartStep(ctx, store_dynamodb.StepProvisioning)
+	logger.Info("released job of queued deployment")
+	return true
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLeaseTable holds one lease. Updates fail their condition while heldBy is set, as Acquire's would.
+type fakeLeaseTable struct {
+	heldBy  string
+	updates []*dynamodb.UpdateItemInput
+}
+
+func (f *fakeLeaseTable) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (f *fakeLeaseTable) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.updates = append(f.updates, params)
+	if f.heldBy != "" && params.ReturnValuesOnConditionCheckFailure == types.ReturnValuesOnConditionCheckFailureAllOld {
+		item, err := attributevalue.MarshalMap(store_dynamodb.DeploymentLease{ApplicationId: "app-1", DeploymentId: f.heldBy})
+		if err != nil {
+			return nil, err
+		}
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("failed"), Item: item}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeLeaseTable) DeleteItem(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDeploymentQueueParam(t *testing.T) {
+	queue, err := deploymentQueueParam(map[string]string{})
+	require.NoError(t, err)
+	assert.False(t, queue)
+
+	queue, err = deploymentQueueParam(map[string]string{"queue": "true"})
+	require.NoError(t, err)
+	assert.True(t, queue)
+
+	_, err = deploymentQueueParam(map[string]string{"queue": "yes"})
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestAcquireDeploymentLeaseInProgress(t *testing.T) {
+	deps := newTestDependencies()
+	deps.Leases = store_dynamodb.NewDeploymentLeaseStore(&fakeLeaseTable{heldBy: "deploy-0"}, "leases")
+
+	_, err := acquireDeploymentLease(context.Background(), deps, "app-1", "deploy-1", false)
+	assert.ErrorIs(t, err, ErrDeploymentInProgress)
+
+	response := errorResponse("TestHandler", "test-request", err)
+	assert.Equal(t, 409, response.StatusCode)
+	assertErrorCode(t, response, CodeDeploymentInProgress)
+	assert.Equal(t, "deploy-0", decodeErrorResponse(t, response).DeploymentId)
+
+	leased, err := acquireDeploymentLease(context.Background(), deps, "app-1", "deploy-1", true)
+	require.NoError(t, err)
+	assert.False(t, leased)
+}
+
+func TestQueuedRunTaskRoundTrips(t *testing.T) {
+	in := &ecs.RunTaskInput{
+		TaskDefinition: aws.String("provisioner"),
+		Cluster:        aws.String("cluster"),
+		NetworkConfiguration: &ecstypes.NetworkConfiguration{
+			AwsvpcConfiguration: &ecstypes.AwsVpcConfiguration{
+				Subnets:        []string{"subnet-1", "subnet-2"},
+				SecurityGroups: []string{"sg-1"},
+				AssignPublicIp: ecstypes.AssignPublicIpEnabled,
+			},
+		},
+		Overrides: &ecstypes.TaskOverride{
+			ContainerOverrides: []ecstypes.ContainerOverride{{
+				Name:        aws.String("provisioner"),
+				Environment: []ecstypes.KeyValuePair{{Name: aws.String(deploymentIdKey), Value: aws.String("deploy-1")}},
+			}},
+		},
+		LaunchType: ecstypes.LaunchTypeFargate,
+		Tags:       []ecstypes.Tag{{Key: aws.String(deploymentIdTag), Value: aws.String("deploy-1")}},
+	}
+
+	runTask, err := json.Marshal(in)
+	require.NoError(t, err)
+	var out ecs.RunTaskInput
+	require.NoError(t, json.Unmarshal(runTask, &out))
+	assert.Equal(t, in, &out)
+}
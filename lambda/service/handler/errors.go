@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"net/http"
+	"strings"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/pennsieve/app-deploy-service/service/models"
 )
 
 var ErrUnmarshaling = errors.New("error unmarshaling body")
-var ErrUnsupportedPath = errors.New("unsupported path")
+var ErrMethodNotAllowed = errors.New("method not allowed")
 var ErrUnsupportedRoute = errors.New("unsupported route")
 var ErrRunningFargateTask = errors.New("error running fargate task")
 var ErrConfig = errors.New("error loading AWS config")
@@ -17,24 +20,199 @@ var ErrNoRecordsFound = errors.New("error no records found")
 var ErrRecordExists = errors.New("error record already exists")
 var ErrMarshaling = errors.New("error marshaling item")
 var ErrDynamoDB = errors.New("error performing action on DynamoDB table")
+var ErrUnauthorized = errors.New("unauthorized")
 var ErrNotPermitted = errors.New("not permitted")
 var ErrStoringApplication = errors.New("error storing application")
 var ErrStoringDeployment = errors.New("error storing deployment")
 var ErrSourceURL = errors.New("error determining source URL")
 var ErrMissingParams = errors.New("missing required query parameters")
+var ErrMissingPathParams = errors.New("missing required path parameters")
 var ErrAppNotFound = errors.New("application not found")
 var ErrInvalidVisibility = errors.New("visibility must be 'public' or 'private'")
 var ErrNotOwner = errors.New("only the app owner can manage permissions")
+var ErrInternal = errors.New("internal server error")
+var ErrValidation = errors.New("request validation failed")
+var ErrConcurrentUpdate = errors.New("modified by another request, fetch it again and retry")
+var ErrPreconditionFailed = errors.New("If-Match does not match the current ETag")
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+var ErrIdempotentRequestInProgress = errors.New("a request with this idempotency key is still in progress")
+var ErrDeploymentFinished = errors.New("deployment has already finished")
+var ErrStoppingFargateTask = errors.New("error stopping fargate task")
+var ErrNoRollbackTarget = errors.New("no earlier successful deployment to roll back to")
+var ErrReadingLogs = errors.New("error reading deployment logs")
+var ErrDeploymentInProgress = errors.New("another deployment of the application is in progress")
+var ErrQueueingTask = errors.New("error queueing provisioner task")
 
-func handlerError(handlerName string, errorMessage error) string {
-	log.Printf("%s: %s", handlerName, errorMessage.Error())
-	m, err := json.Marshal(models.ApplicationResponse{
-		Message: errorMessage.Error(),
-	})
-	if err != nil {
-		log.Printf("%s: error marshalling error message %s: %s", handlerName, errorMessage.Error(), err.Error())
-		return err.Error()
+// Error codes are part of the API contract: clients branch on them, so existing values must never change.
+const (
+	CodeMalformedBody         = "MALFORMED_BODY"
+	CodeMissingQueryParameter = "MISSING_QUERY_PARAMETER"
+	CodeMissingPathParameter  = "MISSING_PATH_PARAMETER"
+	CodeInvalidVisibility     = "INVALID_VISIBILITY"
+	CodeValidationFailed      = "VALIDATION_FAILED"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeForbidden             = "FORBIDDEN"
+	CodeNotAppOwner           = "NOT_APP_OWNER"
+	CodeNotFound              = "NOT_FOUND"
+	CodeAppNotFound           = "APP_NOT_FOUND"
+	CodeRouteNotFound         = "ROUTE_NOT_FOUND"
+	CodeMethodNotAllowed      = "METHOD_NOT_ALLOWED"
+	CodeAlreadyExists         = "ALREADY_EXISTS"
+	CodeConcurrentUpdate      = "CONCURRENT_UPDATE"
+	CodePreconditionFailed    = "PRECONDITION_FAILED"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	CodeRequestInProgress     = "REQUEST_IN_PROGRESS"
+	CodeDeploymentFinished    = "DEPLOYMENT_FINISHED"
+	CodeNoRollbackTarget      = "NO_ROLLBACK_TARGET"
+	CodeDeploymentInProgress  = "DEPLOYMENT_IN_PROGRESS"
+	CodeConfiguration         = "CONFIGURATION_ERROR"
+	CodeDatabase              = "DATABASE_ERROR"
+	CodeSerialization         = "SERIALIZATION_ERROR"
+	CodeStoringApplication    = "STORING_APPLICATION_FAILED"
+	CodeStoringDeployment     = "STORING_DEPLOYMENT_FAILED"
+	CodeDeploymentStartFailed = "DEPLOYMENT_START_FAILED"
+	CodeQueueingFailed        = "QUEUEING_FAILED"
+	CodeDeploymentStopFailed  = "DEPLOYMENT_STOP_FAILED"
+	CodeSourceURL             = "SOURCE_URL_ERROR"
+	CodeReadingLogs           = "LOGS_UNAVAILABLE"
+	CodeInternal              = "INTERNAL_ERROR"
+)
+
+// errorCodes maps each sentinel error to the status code and error code it is returned with, whichever handler
+// returns it. Errors are matched with errors.Is, so handlers may wrap a sentinel to add context.
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrUnmarshaling, http.StatusBadRequest, CodeMalformedBody},
+	{ErrMissingParams, http.StatusBadRequest, CodeMissingQueryParameter},
+	{ErrMissingPathParams, http.StatusBadRequest, CodeMissingPathParameter},
+	{ErrInvalidVisibility, http.StatusBadRequest, CodeInvalidVisibility},
+	{ErrValidation, http.StatusBadRequest, CodeValidationFailed},
+	{ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized},
+	{ErrNotPermitted, http.StatusForbidden, CodeForbidden},
+	{ErrNotOwner, http.StatusForbidden, CodeNotAppOwner},
+	{ErrNoRecordsFound, http.StatusNotFound, CodeNotFound},
+	{ErrAppNotFound, http.StatusNotFound, CodeAppNotFound},
+	{ErrUnsupportedRoute, http.StatusNotFound, CodeRouteNotFound},
+	{ErrMethodNotAllowed, http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	{ErrRecordExists, http.StatusConflict, CodeAlreadyExists},
+	{ErrConcurrentUpdate, http.StatusConflict, CodeConcurrentUpdate},
+	{ErrPreconditionFailed, http.StatusPreconditionFailed, CodePreconditionFailed},
+	{ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused},
+	{ErrIdempotentRequestInProgress, http.StatusConflict, CodeRequestInProgress},
+	{ErrDeploymentFinished, http.StatusConflict, CodeDeploymentFinished},
+	{ErrNoRollbackTarget, http.StatusConflict, CodeNoRollbackTarget},
+	{ErrDeploymentInProgress, http.StatusConflict, CodeDeploymentInProgress},
+	{ErrConfig, http.StatusInternalServerError, CodeConfiguration},
+	{ErrDynamoDB, http.StatusInternalServerError, CodeDatabase},
+	{ErrMarshaling, http.StatusInternalServerError, CodeSerialization},
+	{ErrStoringApplication, http.StatusInternalServerError, CodeStoringApplication},
+	{ErrStoringDeployment, http.StatusInternalServerError, CodeStoringDeployment},
+	{ErrRunningFargateTask, http.StatusInternalServerError, CodeDeploymentStartFailed},
+	{ErrQueueingTask, http.StatusInternalServerError, CodeQueueingFailed},
+	{ErrStoppingFargateTask, http.StatusInternalServerError, CodeDeploymentStopFailed},
+	{ErrSourceURL, http.StatusInternalServerError, CodeSourceURL},
+	{ErrReadingLogs, http.StatusInternalServerError, CodeReadingLogs},
+}
+
+// ValidationError reports the fields of a request that failed validation. It matches ErrValidation.
+type ValidationError struct {
+	Fields []models.FieldError
+}
+
+// NewValidationError returns a ValidationError for the given field errors.
+func NewValidationError(fields ...models.FieldError) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
 	}
+	return ErrValidation.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// DeploymentInProgressError is returned when an application's deployment lease is held by another deployment.
+// It matches ErrDeploymentInProgress.
+type DeploymentInProgressError struct {
+	DeploymentId string
+}
+
+func (e *DeploymentInProgressError) Error() string {
+	return ErrDeploymentInProgress.Error() + ": " + e.DeploymentId
+}
+
+func (e *DeploymentInProgressError) Unwrap() error {
+	return ErrDeploymentInProgress
+}
 
-	return string(m)
+// StatusCode returns the HTTP status code for err along with the sentinel it matched.
+// Errors that match no sentinel are reported as ErrInternal with a 500.
+func StatusCode(err error) (int, error) {
+	status, sentinel, _ := classifyError(err)
+	return status, sentinel
+}
+
+// ErrorCode returns the stable error code for err, or CodeInternal if it matches no sentinel.
+func ErrorCode(err error) string {
+	_, _, code := classifyError(err)
+	return code
+}
+
+func classifyError(err error) (int, error, string) {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.status, e.err, e.code
+		}
+	}
+	return http.StatusInternalServerError, ErrInternal, CodeInternal
+}
+
+// errorResponse builds the response for an error returned by a handler. Client errors keep any context the
+// handler wrapped around the sentinel; server errors only expose the sentinel so AWS error details are not leaked.
+// It does not log err: HandleErrors does, with the detail kept out of the response.
+func errorResponse(handlerName string, requestId string, err error) events.APIGatewayV2HTTPResponse {
+	status, sentinel, code := classifyError(err)
+	public := err
+	if status >= http.StatusInternalServerError {
+		public = sentinel
+	}
+
+	body := models.ErrorResponse{
+		Code:      code,
+		Status:    status,
+		Message:   public.Error(),
+		RequestId: requestId,
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		body.Details = validationErr.Fields
+	}
+	var inProgressErr *DeploymentInProgressError
+	if errors.As(err, &inProgressErr) {
+		body.DeploymentId = inProgressErr.DeploymentId
+	}
+
+	m, marshalErr := json.Marshal(body)
+	if marshalErr != nil {
+		log.Printf("%s: error marshalling error response %s: %s", handlerName, err.Error(), marshalErr.Error())
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: http.StatusInternalServerError,
+			Headers:    map[string]string{},
+			Body:       ErrMarshaling.Error(),
+		}
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(m),
+	}
 }
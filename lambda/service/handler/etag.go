@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/mappers"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+)
+
+// entityTag is the ETag of a stored record at the given version. It changes whenever a client-editable field
+// changes; status updates made by the service do not change it.
+func entityTag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// withETag sets the ETag header on a successful response.
+func withETag(response events.APIGatewayV2HTTPResponse, err error, version int64) (events.APIGatewayV2HTTPResponse, error) {
+	if err != nil {
+		return response, err
+	}
+	if response.Headers == nil {
+		response.Headers = map[string]string{}
+	}
+	response.Headers["ETag"] = entityTag(version)
+	return response, nil
+}
+
+// appStoreVersionsWithETags maps versions to models with the ETag of each version's record. A list cannot carry
+// an ETag header per item, so it is returned in the body instead.
+func appStoreVersionsWithETags(versions []store_dynamodb.AppStoreVersion) []models.AppStoreVersion {
+	result := mappers.AppStoreVersionsToModels(versions)
+	for i := range result {
+		result[i].ETag = entityTag(versions[i].RecordVersion)
+	}
+	return result
+}
+
+// checkIfMatch compares the request's If-Match header with the version of the record it would change. It
+// reports whether the header was sent, and returns ErrPreconditionFailed if none of the listed tags match.
+// Requests without If-Match are allowed, so existing clients keep working; their writes are still conditional
+// on the version the handler read.
+func checkIfMatch(request events.APIGatewayV2HTTPRequest, version int64) (bool, error) {
+	header := headerValue(request.Headers, "If-Match")
+	if header == "" {
+		return false, nil
+	}
+	current := entityTag(version)
+	for _, tag := range strings.Split(header, ",") {
+		// If-Match uses the strong comparison, so weak tags never match
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == current {
+			return true, nil
+		}
+	}
+	return true, fmt.Errorf("%w: If-Match %s, current ETag %s", ErrPreconditionFailed, header, current)
+}
+
+// versionConflict is the error for a conditional write that lost a race. A client that sent If-Match asked for
+// the write to depend on the version it saw, so it gets 412; otherwise the conflict is reported as 409.
+func versionConflict(resource string, ifMatch bool) error {
+	if ifMatch {
+		return fmt.Errorf("%s: %w", resource, ErrPreconditionFailed)
+	}
+	return fmt.Errorf("%s: %w", resource, ErrConcurrentUpdate)
+}
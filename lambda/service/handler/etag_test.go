@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		sent    bool
+		matches bool
+	}{
+		{"no header", "", false, true},
+		{"current", `"3"`, true, true},
+		{"wildcard", "*", true, true},
+		{"one of several", `"1", "3"`, true, true},
+		{"stale", `"2"`, true, false},
+		{"weak", `W/"3"`, true, false},
+		{"unquoted", `3`, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := events.APIGatewayV2HTTPRequest{Headers: map[string]string{}}
+			if tt.header != "" {
+				request.Headers["if-match"] = tt.header
+			}
+			sent, err := checkIfMatch(request, 3)
+			assert.Equal(t, tt.sent, sent)
+			if tt.matches {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrPreconditionFailed)
+			}
+		})
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	assert.ErrorIs(t, versionConflict("application a", true), ErrPreconditionFailed)
+	assert.ErrorIs(t, versionConflict("application a", false), ErrConcurrentUpdate)
+}
+
+func TestAppStoreVersionsWithETags(t *testing.T) {
+	versions := appStoreVersionsWithETags([]store_dynamodb.AppStoreVersion{
+		{Uuid: "v1", Version: "v1.0.0"},
+		{Uuid: "v2", Version: "v1.1.0", RecordVersion: 2},
+	})
+	require.Len(t, versions, 2)
+	assert.Equal(t, `"0"`, versions[0].ETag)
+	assert.Equal(t, `"2"`, versions[1].ETag)
+	assert.Equal(t, "v1.1.0", versions[1].Version)
+}
+
+func TestGetApplicationSetsETag(t *testing.T) {
+	ctx := newPatchTestContext(newPatchTestStore(), "N:organization:1")
+
+	response, err := GetApplicationHandler(ctx, events.APIGatewayV2HTTPRequest{PathParameters: map[string]string{"id": "app-1"}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, `"3"`, response.Headers["ETag"])
+}
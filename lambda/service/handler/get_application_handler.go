@@ -2,50 +2,33 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/pennsieve/app-deploy-service/service/models"
-	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
 )
 
 func GetApplicationHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "GetApplicationHandler"
-	uuid := request.PathParameters["id"]
+	return newHandler("GetApplicationHandler", getApplication)(ctx, request)
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+func getApplication(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	applicationsTable := os.Getenv("APPLICATIONS_TABLE")
+	uuid := request.PathParameters["id"]
 
-	dynamo_store := store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, applicationsTable)
-	application, err := dynamo_store.GetById(ctx, uuid)
+	application, err := deps.Applications.GetById(ctx, uuid)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
 	}
 	if application.Uuid == "" {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrNoRecordsFound),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", uuid, ErrNoRecordsFound)
 	}
 
-	m, err := json.Marshal(models.Application{
+	response, err := jsonResponse(http.StatusOK, models.Application{
 		Uuid:                     application.Uuid,
 		ApplicationId:            application.ApplicationId,
 		ApplicationContainerName: application.ApplicationContainerName,
@@ -82,16 +65,5 @@ func GetApplicationHandler(ctx context.Context, request events.APIGatewayV2HTTPR
 		UserId:           application.UserId,
 		Status:           application.Status,
 	})
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
-	}
-	response := events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(m),
-	}
-	return response, nil
+	return withETag(response, err, application.Version)
 }
@@ -2,63 +2,102 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/pennsieve/app-deploy-service/service/mappers"
+	"github.com/pennsieve/app-deploy-service/service/models"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/app-deploy-service/service/validation"
+)
+
+const (
+	defaultApplicationsLimit = 50
+	maxApplicationsLimit     = 100
 )
 
 func GetApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "GetApplicationsHandler"
-	queryParams := request.QueryStringParameters
-	log.Println(queryParams)
+	return newHandler("GetApplicationsHandler", getApplications, RequireClaims())(ctx, request)
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+func getApplications(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	applicationsTable := os.Getenv("APPLICATIONS_TABLE")
+	queryParams := request.QueryStringParameters
+	organizationId := deps.Claims.OrgClaim.NodeId
+	deps.Logger.Info("listing applications",
+		slog.Any("queryParams", queryParams),
+		slog.String("organizationId", organizationId))
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	organizationId := claims.OrgClaim.NodeId
+	query, err := applicationQuery(queryParams)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
 
-	log.Println("claims.OrgClaim.NodeId", claims.OrgClaim.NodeId)
-	log.Println("claims.OrgClaim.IntId", claims.OrgClaim.IntId)
+	page, err := deps.Applications.List(ctx, organizationId, query)
+	if errors.Is(err, store_dynamodb.ErrInvalidPageToken) {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(models.FieldError{
+			Field: "nextToken", Code: validation.CodeInvalid, Message: "is not a valid token for this query",
+		})
+	}
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
 
-	dynamo_store := store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, applicationsTable)
+	return jsonResponse(http.StatusOK, models.ApplicationsPage{
+		Applications: mappers.DynamoDBApplicationToJsonApplication(page.Applications),
+		NextToken:    page.NextPageToken,
+	})
+}
 
-	dynamoApplications, err := dynamo_store.Get(ctx, organizationId, queryParams)
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+// applicationQuery reads paging, sorting and filtering from the query string. Applications are sorted newest
+// first by default, and by name in ascending order.
+func applicationQuery(params map[string]string) (store_dynamodb.ApplicationQuery, error) {
+	v := &validation.Validator{}
+	if limit, ok := params["limit"]; ok {
+		validation.Field(v, "limit", limit, validation.IntBetween(1, maxApplicationsLimit))
+	}
+	if sortBy, ok := params["sort"]; ok {
+		validation.Field(v, "sort", sortBy, validation.OneOf(store_dynamodb.ApplicationSortCreatedAt, store_dynamodb.ApplicationSortName))
+	}
+	if order, ok := params["order"]; ok {
+		validation.Field(v, "order", order, validation.OneOf("asc", "desc"))
+	}
+	if fields := v.Errors(); len(fields) > 0 {
+		return store_dynamodb.ApplicationQuery{}, NewValidationError(fields...)
 	}
 
-	m, err := json.Marshal(mappers.DynamoDBApplicationToJsonApplication(dynamoApplications))
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
+	query := store_dynamodb.ApplicationQuery{
+		Limit:     defaultApplicationsLimit,
+		SortBy:    store_dynamodb.ApplicationSortCreatedAt,
+		Filters:   map[string]string{},
+		PageToken: params["nextToken"],
+	}
+	if limit, ok := params["limit"]; ok {
+		n, _ := strconv.Atoi(limit)
+		query.Limit = int32(n)
+	}
+	if sortBy, ok := params["sort"]; ok {
+		query.SortBy = sortBy
+	}
+	switch params["order"] {
+	case "asc":
+		query.Descending = false
+	case "desc":
+		query.Descending = true
+	default:
+		query.Descending = query.SortBy == store_dynamodb.ApplicationSortCreatedAt
 	}
-	response := events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(m),
+	for _, name := range store_dynamodb.ApplicationFilterAttributes {
+		if value, ok := params[name]; ok && value != "" {
+			query.Filters[name] = value
+		}
 	}
-	return response, nil
+	return query, nil
 }
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplicationQueryDefaults(t *testing.T) {
+	query, err := applicationQuery(map[string]string{"organization_id": "N:organization:1"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(defaultApplicationsLimit), query.Limit)
+	assert.Equal(t, store_dynamodb.ApplicationSortCreatedAt, query.SortBy)
+	assert.True(t, query.Descending)
+	assert.Empty(t, query.Filters)
+}
+
+func TestApplicationQueryParams(t *testing.T) {
+	query, err := applicationQuery(map[string]string{
+		"limit":              "20",
+		"sort":               "name",
+		"nextToken":          "abc",
+		"registrationStatus": "registered",
+		"sourceType":         "github",
+		"unknown":            "ignored",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(20), query.Limit)
+	assert.Equal(t, store_dynamodb.ApplicationSortName, query.SortBy)
+	assert.False(t, query.Descending)
+	assert.Equal(t, "abc", query.PageToken)
+	assert.Equal(t, map[string]string{"registrationStatus": "registered", "sourceType": "github"}, query.Filters)
+}
+
+func TestGetApplicationsRejectsInvalidQuery(t *testing.T) {
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	ctx := WithDependencies(context.Background(), deps)
+
+	response, err := GetApplicationsHandler(ctx, events.APIGatewayV2HTTPRequest{
+		QueryStringParameters: map[string]string{"limit": "500", "sort": "size", "order": "up"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	body := decodeErrorResponse(t, response)
+	assert.Equal(t, CodeValidationFailed, body.Code)
+	var fields []string
+	for _, f := range body.Details {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{"limit", "sort", "order"}, fields)
+}
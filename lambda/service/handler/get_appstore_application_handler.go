@@ -2,85 +2,67 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/pennsieve/app-deploy-service/service/mappers"
 	"github.com/pennsieve/app-deploy-service/service/models"
-	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
 	ghsync "github.com/pennsieve/github-client/pkg/github/sync"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 )
 
 func GetAppstoreApplicationHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "GetAppstoreApplicationHandler"
-
-	appId := request.PathParameters["id"]
-	if appId == "" {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusBadRequest,
-			Body:       handlerError(handlerName, ErrMissingParams),
-		}, nil
-	}
+	return newHandler("GetAppstoreApplicationHandler", getAppstoreApplication)(ctx, request)
+}
 
-	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+func getAppstoreApplication(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
 
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	appStoreStore := store_dynamodb.NewAppStoreDatabaseStore(dynamoDBClient, os.Getenv(appstoreApplicationsTableNameKey))
-	versionStore := store_dynamodb.NewAppStoreVersionDatabaseStore(dynamoDBClient, os.Getenv(appstoreVersionsTableNameKey))
-	deploymentsStore := store_dynamodb.NewDeploymentsStore(dynamoDBClient, os.Getenv(deploymentsTableNameKey))
-	appAccessStore := store_dynamodb.NewAppAccessDatabaseStore(dynamoDBClient, os.Getenv(appAccessTableNameKey))
+	appId := request.PathParameters["id"]
+	if appId == "" {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: id", ErrMissingPathParams)
+	}
 
-	app, err := appStoreStore.GetById(ctx, appId)
+	app, err := deps.AppStore.GetById(ctx, appId)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
 	}
 	if app == nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrAppNotFound),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, ErrAppNotFound
 	}
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	log.Printf("%s: caller org=%s user=%s", handlerName, claims.OrgClaim.NodeId, claims.UserClaim.NodeId)
+	if deps.Claims == nil {
+		return events.APIGatewayV2HTTPResponse{}, ErrUnauthorized
+	}
+	deps.Logger.Info("getting appstore application",
+		slog.String("organizationId", deps.Claims.OrgClaim.NodeId),
+		slog.String("userId", deps.Claims.UserClaim.NodeId))
 
-	if !CanAccessApp(ctx, claims, app, appAccessStore) {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusForbidden,
-			Body:       handlerError(handlerName, ErrNotPermitted),
-		}, nil
+	if !CanAccessApp(ctx, deps.Claims, app, deps.AppAccess) {
+		return events.APIGatewayV2HTTPResponse{}, ErrNotPermitted
 	}
 
 	application := mappers.AppStoreAppToModel(*app)
 
-	dynamoVersions, err := versionStore.GetByApplicationId(ctx, application.Uuid)
+	dynamoVersions, err := deps.AppStoreVersions.GetByApplicationId(ctx, application.Uuid)
 	if err != nil {
-		log.Printf("error fetching versions for application %s: %v", application.Uuid, err)
+		deps.Logger.Warn("error fetching versions for application",
+			slog.String("applicationId", application.Uuid), slog.Any("error", err))
 	} else {
-		versions := mappers.AppStoreVersionsToModels(dynamoVersions)
+		versions := appStoreVersionsWithETags(dynamoVersions)
 		for j := range versions {
-			deployments, err := deploymentsStore.GetHistory(ctx, versions[j].Uuid)
+			deployments, err := deps.Deployments.GetHistory(ctx, versions[j].Uuid)
 			if err != nil {
-				log.Printf("error fetching deployments for version %s: %v", versions[j].Uuid, err)
+				deps.Logger.Warn("error fetching deployments for version",
+					slog.String("versionId", versions[j].Uuid), slog.Any("error", err))
 				continue
 			}
 			versions[j].Deployments = mappers.DeploymentItemsToModels(deployments)
@@ -96,13 +78,14 @@ func GetAppstoreApplicationHandler(ctx context.Context, request events.APIGatewa
 
 	assets := map[string]string{}
 	if tag != "" {
-		assets = fetchAssets(ctx, cfg, app.SourceUrl, tag)
+		assets = fetchAssets(ctx, deps.Config, app.SourceUrl, app.Build.GetContextDir(), tag)
 	}
 
 	detail := models.AppStoreApplicationDetail{
 		Uuid:             application.Uuid,
 		SourceUrl:        application.SourceUrl,
 		SourceType:       application.SourceType,
+		ContextDir:       application.ContextDir,
 		IsPrivate:        application.IsPrivate,
 		Visibility:       application.Visibility,
 		OwnerId:          application.OwnerId,
@@ -112,19 +95,8 @@ func GetAppstoreApplicationHandler(ctx context.Context, request events.APIGatewa
 		Assets:           assets,
 	}
 
-	m, err := json.Marshal(detail)
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
-	}
-
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(m),
-	}, nil
+	response, err := jsonResponse(http.StatusOK, detail)
+	return withETag(response, err, app.Version)
 }
 
 // latestVersionTag returns the Version tag of the most recently created version,
@@ -145,14 +117,14 @@ func latestVersionTag(versions []models.AppStoreVersion) string {
 	return latest
 }
 
-func fetchAssets(ctx context.Context, cfg aws.Config, sourceUrl string, tag string) map[string]string {
+func fetchAssets(ctx context.Context, cfg aws.Config, sourceUrl string, contextDir string, tag string) map[string]string {
 	bucket := os.Getenv("CONTENT_SYNC_BUCKET")
 	if bucket == "" {
 		log.Println("warning: CONTENT_SYNC_BUCKET not set, skipping asset fetch")
 		return map[string]string{}
 	}
 
-	namespace := buildNamespace(sourceUrl, tag)
+	namespace := buildNamespace(sourceUrl, contextDir, tag)
 	s3Client := s3.NewFromConfig(cfg)
 	dest := ghsync.NewS3Destination(s3Client, bucket)
 
@@ -47,7 +47,7 @@ func TestGetAppstoreApplicationHandler_DynamoDBError(t *testing.T) {
 func TestFetchAssets_NoBucket(t *testing.T) {
 	t.Setenv("CONTENT_SYNC_BUCKET", "")
 
-	assets := fetchAssets(t.Context(), aws.Config{}, "https://github.com/org/repo", "main")
+	assets := fetchAssets(t.Context(), aws.Config{}, "https://github.com/org/repo", "", "main")
 	assert.Empty(t, assets)
 }
 
@@ -55,7 +55,7 @@ func TestFetchAssets_WithBucketNoS3(t *testing.T) {
 	t.Setenv("CONTENT_SYNC_BUCKET", "test-bucket")
 	t.Setenv("CONTENT_SYNC_FILES", "application.json,README.md")
 
-	assets := fetchAssets(t.Context(), aws.Config{}, "https://github.com/org/repo", "main")
+	assets := fetchAssets(t.Context(), aws.Config{}, "https://github.com/org/repo", "", "main")
 	// S3 calls will fail, so no assets returned
 	assert.Empty(t, assets)
 }
@@ -64,7 +64,7 @@ func TestFetchAssets_CustomSyncFiles(t *testing.T) {
 	t.Setenv("CONTENT_SYNC_BUCKET", "test-bucket")
 	t.Setenv("CONTENT_SYNC_FILES", "custom.json")
 
-	assets := fetchAssets(t.Context(), aws.Config{}, "https://github.com/org/repo", "v1.0.0")
+	assets := fetchAssets(t.Context(), aws.Config{}, "https://github.com/org/repo", "", "v1.0.0")
 	assert.Empty(t, assets)
 }
 
@@ -2,67 +2,47 @@ package handler
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
 	ghsync "github.com/pennsieve/github-client/pkg/github/sync"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 )
 
 func GetAppStoreAssetHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "GetAppStoreAssetHandler"
-
-	file := request.QueryStringParameters["file"]
-	if file == "" {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusBadRequest,
-			Body:       handlerError(handlerName, ErrMissingParams),
-		}, nil
-	}
+	return newHandler("GetAppStoreAssetHandler", getAppStoreAsset)(ctx, request)
+}
 
-	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+func getAppStoreAsset(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
 
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	appStore := store_dynamodb.NewAppStoreDatabaseStore(dynamoDBClient, os.Getenv(appstoreApplicationsTableNameKey))
+	file := request.QueryStringParameters["file"]
+	if file == "" {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: file", ErrMissingParams)
+	}
 
 	appId := request.PathParameters["id"]
 	tag := request.QueryStringParameters["tag"]
 
-	app, err := appStore.GetById(ctx, appId)
+	app, err := deps.AppStore.GetById(ctx, appId)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
 	}
 	if app == nil {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrAppNotFound),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, ErrAppNotFound
 	}
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	appAccessStore := store_dynamodb.NewAppAccessDatabaseStore(dynamoDBClient, os.Getenv(appAccessTableNameKey))
-	if !CanAccessApp(ctx, claims, app, appAccessStore) {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusForbidden,
-			Body:       handlerError(handlerName, ErrNotPermitted),
-		}, nil
+	if deps.Claims == nil {
+		return events.APIGatewayV2HTTPResponse{}, ErrUnauthorized
+	}
+	if !CanAccessApp(ctx, deps.Claims, app, deps.AppAccess) {
+		return events.APIGatewayV2HTTPResponse{}, ErrNotPermitted
 	}
 
 	if tag == "" {
@@ -71,25 +51,19 @@ func GetAppStoreAssetHandler(ctx context.Context, request events.APIGatewayV2HTT
 
 	bucket := os.Getenv("CONTENT_SYNC_BUCKET")
 	if bucket == "" {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("CONTENT_SYNC_BUCKET not set: %w", ErrConfig)
 	}
 
-	namespace := buildNamespace(app.SourceUrl, tag)
+	namespace := buildNamespace(app.SourceUrl, app.Build.GetContextDir(), tag)
 	key := namespace + "/" + file
 
-	s3Client := s3.NewFromConfig(cfg)
+	s3Client := s3.NewFromConfig(deps.Config)
 	dest := ghsync.NewS3Destination(s3Client, bucket)
 
 	data, contentType, err := dest.Read(ctx, key)
 	if err != nil {
-		log.Printf("error reading %s from S3: %v", key, err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrNoRecordsFound),
-		}, nil
+		deps.Logger.Warn("error reading asset from S3", slog.String("key", key), slog.Any("error", err))
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("asset %s: %w", file, ErrNoRecordsFound)
 	}
 
 	return events.APIGatewayV2HTTPResponse{
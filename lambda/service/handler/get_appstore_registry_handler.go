@@ -2,17 +2,12 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/pennsieve/app-deploy-service/service/models"
-	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 )
 
 // GetAppStoreRegistryHandler resolves an appstore image URL for an authorized
@@ -24,126 +19,74 @@ import (
 // Query parameters:
 //   - sourceUrl: the git repository URL identifying the application
 //   - version: the specific version tag (e.g., "v1.0.7")
+//   - contextDir: optional, the build context directory of an application in a monorepo
 func GetAppStoreRegistryHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "GetAppStoreRegistryHandler"
+	return newHandler("GetAppStoreRegistryHandler", getAppStoreRegistry, RequireClaims())(ctx, request)
+}
+
+func getAppStoreRegistry(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
 
 	sourceUrl := request.QueryStringParameters["sourceUrl"]
 	version := request.QueryStringParameters["version"]
 
 	if sourceUrl == "" || version == "" {
-		log.Printf("%s: missing required query parameters: sourceUrl=%q, version=%q", handlerName, sourceUrl, version)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusBadRequest,
-			Body:       handlerError(handlerName, ErrMissingParams),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: sourceUrl=%q, version=%q", ErrMissingParams, sourceUrl, version)
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	// Look up the app by sourceUrl and, for monorepos, contextDir
+	apps, err := deps.AppStore.GetBySourceUrl(ctx, sourceUrl)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
-	}
-
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	applicationsTable := os.Getenv(appstoreApplicationsTableNameKey)
-	versionsTable := os.Getenv(appstoreVersionsTableNameKey)
-	appStoreStore := store_dynamodb.NewAppStoreDatabaseStore(dynamoDBClient, applicationsTable)
-	versionStore := store_dynamodb.NewAppStoreVersionDatabaseStore(dynamoDBClient, versionsTable)
-
-	// Look up the app by sourceUrl
-	apps, err := appStoreStore.GetBySourceUrl(ctx, sourceUrl)
-	if err != nil {
-		log.Printf("%s: error querying appstore: %v", handlerName, err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error querying appstore: %w", ErrDynamoDB, err)
 	}
+	apps = appsInContextDir(apps, request.QueryStringParameters["contextDir"])
 
 	if len(apps) == 0 {
-		resp := models.RegistryImageResponse{
+		return jsonResponse(http.StatusNotFound, models.RegistryImageResponse{
 			Authorized: false,
 			Message:    "application not found in app store",
-		}
-		m, _ := json.Marshal(resp)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       string(m),
-		}, nil
+		})
 	}
 
 	// Look up the specific version
-	versions, err := versionStore.GetByApplicationIdAndVersion(ctx, apps[0].Uuid, version)
+	versions, err := deps.AppStoreVersions.GetByApplicationIdAndVersion(ctx, apps[0].Uuid, version)
 	if err != nil {
-		log.Printf("%s: error querying version: %v", handlerName, err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error querying version: %w", ErrDynamoDB, err)
 	}
 
 	if len(versions) == 0 {
-		resp := models.RegistryImageResponse{
+		return jsonResponse(http.StatusNotFound, models.RegistryImageResponse{
 			Authorized: false,
 			Message:    "version not found for this application",
-		}
-		m, _ := json.Marshal(resp)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       string(m),
-		}, nil
+		})
 	}
 
 	ver := versions[0]
 	if ver.DestinationUrl == "" || ver.Status != "deployed" {
-		resp := models.RegistryImageResponse{
+		return jsonResponse(http.StatusNotFound, models.RegistryImageResponse{
 			Authorized: false,
 			Message:    "version is not yet deployed",
-		}
-		m, _ := json.Marshal(resp)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       string(m),
-		}, nil
+		})
 	}
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	appAccessTable := os.Getenv(appAccessTableNameKey)
-	appAccessStore := store_dynamodb.NewAppAccessDatabaseStore(dynamoDBClient, appAccessTable)
-
-	if !CanAccessApp(ctx, claims, &apps[0], appAccessStore) {
-		resp := models.RegistryImageResponse{
+	if !CanAccessApp(ctx, deps.Claims, &apps[0], deps.AppAccess) {
+		return jsonResponse(http.StatusForbidden, models.RegistryImageResponse{
 			Authorized: false,
 			Message:    "user does not have access to this application",
-		}
-		m, _ := json.Marshal(resp)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusForbidden,
-			Body:       string(m),
-		}, nil
+		})
 	}
 
-	log.Printf("%s: authorizing image %s (source: %s, version: %s)",
-		handlerName, ver.DestinationUrl, sourceUrl, version)
+	deps.Logger.Info("authorizing image",
+		slog.String("imageUrl", ver.DestinationUrl),
+		slog.String("sourceUrl", sourceUrl),
+		slog.String("version", version))
 
-	resp := models.RegistryImageResponse{
+	response, err := jsonResponse(http.StatusOK, models.RegistryImageResponse{
 		Authorized: true,
 		ImageUrl:   ver.DestinationUrl,
-	}
-	m, err := json.Marshal(resp)
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
-	}
-
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(m),
-	}, nil
+	})
+	return withETag(response, err, ver.RecordVersion)
 }
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDeploymentIncludesBuildMetadata(t *testing.T) {
+	t.Setenv(deploymentsTableNameKey, "deployments")
+	deployment := builtDeployment("deploy-1", 1)
+	deployment.WorkspaceNodeId = "N:organization:1"
+	deployment.ImageDigest = "sha256:abc"
+	deployment.CommitSha = "1111111111111111111111111111111111111111"
+	deployment.DeployerTaskDefinition = "arn:aws:ecs:us-east-1:123456789012:task-definition/deployer:12"
+	deployment.ImageSizeBytes = 123456
+	deployment.BuildDurationSeconds = 95
+
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Deployments = store_dynamodb.NewDeploymentsStore(&fakeDeploymentsTable{deployment: &deployment}, "deployments")
+	ctx := WithDependencies(context.Background(), deps)
+
+	response, err := GetDeploymentHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"id": "app-1", "deploymentId": "deploy-1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var body models.Deployment
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	assert.Equal(t, "deployment-deploy-1", body.ImageTag)
+	assert.Equal(t, "sha256:abc", body.ImageDigest)
+	assert.Equal(t, deployment.CommitSha, body.CommitSha)
+	assert.Equal(t, deployment.DeployerTaskDefinition, body.DeployerTaskDefinition)
+	assert.Equal(t, int64(123456), body.ImageSizeBytes)
+	assert.Equal(t, int64(95), body.BuildDurationSeconds)
+}
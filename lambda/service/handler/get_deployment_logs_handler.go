@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/tasklogs"
+	"github.com/pennsieve/app-deploy-service/service/validation"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+)
+
+const (
+	defaultDeploymentLogsLimit = 100
+	maxDeploymentLogsLimit     = 1000
+)
+
+// deploymentLogSource is a task of a deployment whose output can be read
+type deploymentLogSource struct {
+	name      string
+	group     string
+	container string
+	taskArn   string
+}
+
+func GetDeploymentLogsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return newHandler("GetDeploymentLogsHandler", getDeploymentLogs, RequireOrgRole(role.Viewer))(ctx, request)
+}
+
+// getDeploymentLogs returns the provisioner and deployer output of a deployment from CloudWatch Logs, a page of
+// each stream at a time. Unlike the deployment itself, the output of App Store deployments is only visible to
+// the workspace that started them, since build output can include details of the source repository.
+func getDeploymentLogs(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	provisionerLogGroup := os.Getenv(provisionerLogGroupKey)
+	deployerLogGroup := os.Getenv(deployerLogGroupKey)
+	if len(provisionerLogGroup) == 0 || len(deployerLogGroup) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("missing log group env var value: %w", ErrConfig)
+	}
+
+	applicationId := request.PathParameters["id"]
+	if len(applicationId) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: id", ErrMissingPathParams)
+	}
+	deploymentId := request.PathParameters["deploymentId"]
+	if len(deploymentId) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: deploymentId", ErrMissingPathParams)
+	}
+
+	limit, tokens, err := deploymentLogsQuery(request.QueryStringParameters)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	deployment, err := deps.Deployments.Get(ctx, applicationId, deploymentId)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error getting deployment %s: %w", ErrDynamoDB, deploymentId, err)
+	}
+	if deployment == nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("deployment %s: %w", deploymentId, ErrNoRecordsFound)
+	}
+	if deployment.WorkspaceNodeId != deps.Claims.OrgClaim.NodeId {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("user not permitted to view deployment logs: %w", ErrNotPermitted)
+	}
+
+	sources := []deploymentLogSource{
+		{name: "provisioner", group: provisionerLogGroup, container: os.Getenv("TASK_DEF_CONTAINER_NAME"), taskArn: deployment.ProvisionerTaskArn},
+		{name: "deployer", group: deployerLogGroup, container: os.Getenv("DEPLOYER_TASK_DEF_CONTAINER_NAME"), taskArn: deployment.TaskArn},
+	}
+
+	logs := models.DeploymentLogs{}
+	next := map[string]string{}
+	more := false
+	for _, source := range sources {
+		stream := models.LogStream{Source: source.name, Events: []models.LogEvent{}}
+		// a task that has not been started yet has nothing to read
+		if source.taskArn != "" {
+			page, err := tasklogs.Read(ctx, deps.Logs, source.group,
+				tasklogs.StreamName(tasklogs.StreamPrefix, source.container, source.taskArn), tokens[source.name], limit)
+			if errors.Is(err, tasklogs.ErrInvalidToken) {
+				return events.APIGatewayV2HTTPResponse{}, invalidLogsTokenError()
+			}
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrReadingLogs, err)
+			}
+			for _, event := range page.Events {
+				stream.Events = append(stream.Events, models.LogEvent{Timestamp: event.Timestamp, Message: event.Message})
+			}
+			if page.NextToken != "" {
+				next[source.name] = page.NextToken
+			}
+			more = more || page.More
+		}
+		logs.Streams = append(logs.Streams, stream)
+	}
+
+	switch {
+	case more:
+		logs.NextToken = encodeLogsToken(next)
+	case !deployment.Finished():
+		logs.FollowToken = encodeLogsToken(next)
+	}
+
+	return jsonResponse(http.StatusOK, logs)
+}
+
+// deploymentLogsQuery reads the per-stream limit and the position to read from out of the query string.
+func deploymentLogsQuery(params map[string]string) (int32, map[string]string, error) {
+	v := &validation.Validator{}
+	if limit, ok := params["limit"]; ok {
+		validation.Field(v, "limit", limit, validation.IntBetween(1, maxDeploymentLogsLimit))
+	}
+	if fields := v.Errors(); len(fields) > 0 {
+		return 0, nil, NewValidationError(fields...)
+	}
+
+	limit := int32(defaultDeploymentLogsLimit)
+	if value, ok := params["limit"]; ok {
+		n, _ := strconv.Atoi(value)
+		limit = int32(n)
+	}
+
+	tokens := map[string]string{}
+	if token := params["nextToken"]; token != "" {
+		var err error
+		if tokens, err = decodeLogsToken(token); err != nil {
+			return 0, nil, invalidLogsTokenError()
+		}
+	}
+	return limit, tokens, nil
+}
+
+func invalidLogsTokenError() error {
+	return NewValidationError(models.FieldError{
+		Field: "nextToken", Code: validation.CodeInvalid, Message: "is not a valid token for this deployment",
+	})
+}
+
+// encodeLogsToken wraps the CloudWatch Logs token of each stream into one opaque token.
+func encodeLogsToken(tokens map[string]string) string {
+	data, _ := json.Marshal(tokens)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeLogsToken(token string) (map[string]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	tokens := map[string]string{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
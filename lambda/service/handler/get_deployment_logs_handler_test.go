@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLogs serves log streams by name. Forward tokens are the index of the next event.
+type fakeLogs struct {
+	streams map[string][]string
+}
+
+func (f *fakeLogs) GetLogEvents(_ context.Context, params *cloudwatchlogs.GetLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	messages, ok := f.streams[aws.ToString(params.LogStreamName)]
+	if !ok {
+		return nil, &logsTypes.ResourceNotFoundException{Message: aws.String("The specified log stream does not exist.")}
+	}
+	start := 0
+	if params.NextToken != nil {
+		n, err := strconv.Atoi(aws.ToString(params.NextToken))
+		if err != nil {
+			return nil, &logsTypes.InvalidParameterException{Message: aws.String("The specified nextToken is invalid.")}
+		}
+		start = n
+	}
+	end := min(start+int(aws.ToInt32(params.Limit)), len(messages))
+	out := &cloudwatchlogs.GetLogEventsOutput{NextForwardToken: aws.String(strconv.Itoa(end))}
+	for _, message := range messages[start:end] {
+		out.Events = append(out.Events, logsTypes.OutputLogEvent{Timestamp: aws.Int64(1717027200000), Message: aws.String(message)})
+	}
+	return out, nil
+}
+
+func newLogsTestContext(t *testing.T, deployment store_dynamodb.Deployment, org string) context.Context {
+	t.Setenv(provisionerLogGroupKey, "provisioner-logs")
+	t.Setenv(deployerLogGroupKey, "deployer-logs")
+	t.Setenv("TASK_DEF_CONTAINER_NAME", "app-provisioner")
+	t.Setenv("DEPLOYER_TASK_DEF_CONTAINER_NAME", "app-deployer")
+
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", org, nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Deployments = store_dynamodb.NewDeploymentsStore(&fakeDeploymentsTable{deployment: &deployment}, "deployments")
+	deps.Logs = &fakeLogs{streams: map[string][]string{
+		"fargate/app-provisioner/prov1": {"provisioning", "starting build"},
+		"fargate/app-deployer/dep1":     {"building", "pushing", "done"},
+	}}
+	return WithDependencies(context.Background(), deps)
+}
+
+func getLogs(t *testing.T, ctx context.Context, query map[string]string) models.DeploymentLogs {
+	t.Helper()
+	response, err := GetDeploymentLogsHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters:        map[string]string{"id": "app-1", "deploymentId": "deploy-1"},
+		QueryStringParameters: query,
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+	var logs models.DeploymentLogs
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &logs))
+	return logs
+}
+
+func messages(stream models.LogStream) []string {
+	var out []string
+	for _, event := range stream.Events {
+		out = append(out, event.Message)
+	}
+	return out
+}
+
+func TestGetDeploymentLogsPages(t *testing.T) {
+	deployment := builtDeployment("deploy-1", 1)
+	deployment.WorkspaceNodeId = "N:organization:1"
+	deployment.ProvisionerTaskArn = "arn:aws:ecs:us-east-1:123456789012:task/cluster/prov1"
+	deployment.TaskArn = "arn:aws:ecs:us-east-1:123456789012:task/cluster/dep1"
+	ctx := newLogsTestContext(t, deployment, "N:organization:1")
+
+	first := getLogs(t, ctx, map[string]string{"limit": "2"})
+	require.Len(t, first.Streams, 2)
+	assert.Equal(t, "provisioner", first.Streams[0].Source)
+	assert.Equal(t, []string{"provisioning", "starting build"}, messages(first.Streams[0]))
+	assert.Equal(t, "deployer", first.Streams[1].Source)
+	assert.Equal(t, []string{"building", "pushing"}, messages(first.Streams[1]))
+	require.NotEmpty(t, first.NextToken)
+	assert.Empty(t, first.FollowToken)
+
+	second := getLogs(t, ctx, map[string]string{"limit": "2", "nextToken": first.NextToken})
+	assert.Empty(t, second.Streams[0].Events)
+	assert.Equal(t, []string{"done"}, messages(second.Streams[1]))
+
+	// a finished deployment is not followed once its logs are read
+	last := getLogs(t, ctx, map[string]string{"limit": "2", "nextToken": second.NextToken})
+	assert.Empty(t, last.NextToken)
+	assert.Empty(t, last.FollowToken)
+}
+
+func TestGetDeploymentLogsFollowsRunningDeployment(t *testing.T) {
+	deployment := builtDeployment("deploy-1", 0)
+	deployment.WorkspaceNodeId = "N:organization:1"
+	deployment.LastStatus = "PROVISIONING"
+	deployment.ProvisionerTaskArn = "arn:aws:ecs:us-east-1:123456789012:task/cluster/prov1"
+	ctx := newLogsTestContext(t, deployment, "N:organization:1")
+
+	logs := getLogs(t, ctx, nil)
+	assert.Equal(t, []string{"provisioning", "starting build"}, messages(logs.Streams[0]))
+	// the deployer has not started, so has no stream yet
+	assert.Empty(t, logs.Streams[1].Events)
+
+	caughtUp := getLogs(t, ctx, map[string]string{"nextToken": logs.NextToken})
+	assert.Empty(t, caughtUp.Streams[0].Events)
+	assert.Empty(t, caughtUp.NextToken)
+	assert.NotEmpty(t, caughtUp.FollowToken)
+}
+
+func TestGetDeploymentLogsOtherWorkspace(t *testing.T) {
+	// App Store deployments can be viewed by anyone, but not their logs
+	deployment := builtDeployment("deploy-1", 1)
+	deployment.WorkspaceNodeId = appstoreIdentifier
+	ctx := newLogsTestContext(t, deployment, "N:organization:1")
+
+	response, err := GetDeploymentLogsHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"id": "app-1", "deploymentId": "deploy-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+}
+
+func TestGetDeploymentLogsInvalidToken(t *testing.T) {
+	deployment := builtDeployment("deploy-1", 1)
+	deployment.WorkspaceNodeId = "N:organization:1"
+	deployment.TaskArn = "arn:aws:ecs:us-east-1:123456789012:task/cluster/dep1"
+	ctx := newLogsTestContext(t, deployment, "N:organization:1")
+
+	for _, token := range []string{"not-a-token!", encodeLogsToken(map[string]string{"deployer": "garbage"})} {
+		response, err := GetDeploymentLogsHandler(ctx, events.APIGatewayV2HTTPRequest{
+			PathParameters:        map[string]string{"id": "app-1", "deploymentId": "deploy-1"},
+			QueryStringParameters: map[string]string{"nextToken": token},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assertErrorCode(t, response, CodeValidationFailed)
+	}
+}
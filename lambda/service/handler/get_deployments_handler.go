@@ -2,96 +2,117 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/pennsieve/app-deploy-service/service/mappers"
 	"github.com/pennsieve/app-deploy-service/service/models"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/app-deploy-service/service/validation"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
-	"net/http"
-	"os"
-	"slices"
 )
 
+const maxDeploymentsLimit = 100
+
 func GetDeploymentsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "GetDeploymentsHandler"
+	return newHandler("GetDeploymentsHandler", getDeployments, RequireOrgRole(role.Viewer))(ctx, request)
+}
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	if !authorizer.HasOrgRole(claims, role.Viewer) {
-		responseErr := logError(handlerName, "user not permitted to view deployments for workspace", nil)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusUnauthorized,
-			Body:       handlerError(handlerName, responseErr),
-		}, nil
+func getDeployments(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
+	expectedOrganizationId := deps.Claims.OrgClaim.NodeId
 
-	expectedOrganizationId := claims.OrgClaim.NodeId
-
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		responseErr := logError(handlerName, "error getting AWS config", err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, responseErr),
-		}, nil
-	}
-	deploymentsTable := os.Getenv(deploymentsTableNameKey)
-	if len(deploymentsTable) == 0 {
-		responseErr := logError(handlerName, "missing deployments table env var value", nil)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, responseErr),
-		}, nil
-	}
-	deploymentsStore := store_dynamodb.NewDeploymentsStore(dynamodb.NewFromConfig(cfg), deploymentsTable)
+	if len(os.Getenv(deploymentsTableNameKey)) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("missing deployments table env var value: %w", ErrConfig)
+	}
 
 	applicationId := request.PathParameters["id"]
 	if len(applicationId) == 0 {
-		responseErr := logError(handlerName, "missing path parameter 'id'", nil)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusBadRequest,
-			Body:       handlerError(handlerName, responseErr),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: id", ErrMissingPathParams)
+	}
+
+	query, err := deploymentQuery(request.QueryStringParameters)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
 
-	deploymentItems, err := deploymentsStore.GetHistory(ctx, applicationId)
+	page, err := deps.Deployments.List(ctx, applicationId, query)
+	if errors.Is(err, store_dynamodb.ErrInvalidPageToken) {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(models.FieldError{
+			Field: "nextToken", Code: validation.CodeInvalid, Message: "is not a valid token for this application",
+		})
+	}
 	if err != nil {
-		responseErr := logError(handlerName, fmt.Sprintf("error getting application %s deployments", applicationId), err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, responseErr),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error getting application %s deployments: %w", ErrDynamoDB, applicationId, err)
 	}
 
-	if !IsAuthorized(expectedOrganizationId, deploymentItems...) {
-		responseErr := logError(handlerName, "user not permitted to view deployment", nil)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusUnauthorized,
-			Body:       handlerError(handlerName, responseErr),
-		}, nil
+	if !IsAuthorized(expectedOrganizationId, page.Deployments...) {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("user not permitted to view deployment: %w", ErrNotPermitted)
 	}
 
-	var deployments models.Deployments
-	deployments.Deployments = mappers.DeploymentItemsToModels(deploymentItems)
-	slices.SortFunc(deployments.Deployments, models.DeploymentsByInitiatedAtAsc)
+	return jsonResponse(http.StatusOK, models.Deployments{
+		Deployments: mappers.DeploymentItemsToModels(page.Deployments),
+		NextToken:   page.NextPageToken,
+	})
+}
 
-	response, err := json.Marshal(deployments)
-	if err != nil {
-		responseErr := logError(handlerName, "error marshalling response", err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, responseErr),
-		}, nil
+// deploymentQuery reads paging and filters from the query string. Without a limit every matching deployment
+// is returned, oldest first unless order=desc.
+func deploymentQuery(params map[string]string) (store_dynamodb.DeploymentQuery, error) {
+	v := &validation.Validator{}
+	if limit, ok := params["limit"]; ok {
+		validation.Field(v, "limit", limit, validation.IntBetween(1, maxDeploymentsLimit))
+	}
+	if order, ok := params["order"]; ok {
+		validation.Field(v, "order", order, validation.OneOf("asc", "desc"))
+	}
+	for _, name := range []string{"since", "until"} {
+		if value, ok := params[name]; ok {
+			validation.Field(v, name, value, validation.RFC3339())
+		}
+	}
+	if errored, ok := params["errored"]; ok {
+		validation.Field(v, "errored", errored, validation.OneOf("true", "false"))
+	}
+	if fields := v.Errors(); len(fields) > 0 {
+		return store_dynamodb.DeploymentQuery{}, NewValidationError(fields...)
 	}
 
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(response),
-	}, nil
+	query := store_dynamodb.DeploymentQuery{
+		Descending: params["order"] == "desc",
+		Action:     params["action"],
+		PageToken:  params["nextToken"],
+	}
+	if limit, ok := params["limit"]; ok {
+		n, _ := strconv.Atoi(limit)
+		query.Limit = int32(n)
+	}
+	if since, ok := params["since"]; ok {
+		t, _ := time.Parse(time.RFC3339, since)
+		query.Since = &t
+	}
+	if until, ok := params["until"]; ok {
+		t, _ := time.Parse(time.RFC3339, until)
+		query.Until = &t
+	}
+	if query.Since != nil && query.Until != nil && query.Until.Before(*query.Since) {
+		return store_dynamodb.DeploymentQuery{}, NewValidationError(models.FieldError{
+			Field: "until", Code: validation.CodeInvalidRange, Message: "must not be before since",
+		})
+	}
+	if errored, ok := params["errored"]; ok {
+		b := errored == "true"
+		query.Errored = &b
+	}
+	return query, nil
 }
 
 // IsAuthorized just checks that all the deployments in deploymentItems have the currentWorkspaceId (the one from the claims).
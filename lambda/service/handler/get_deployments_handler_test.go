@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeploymentQueryDefaults(t *testing.T) {
+	query, err := deploymentQuery(map[string]string{"organization_id": "N:organization:1"})
+	require.NoError(t, err)
+	assert.Zero(t, query.Limit)
+	assert.False(t, query.Descending)
+	assert.Nil(t, query.Since)
+	assert.Nil(t, query.Until)
+	assert.Nil(t, query.Errored)
+}
+
+func TestDeploymentQueryParams(t *testing.T) {
+	query, err := deploymentQuery(map[string]string{
+		"limit":     "25",
+		"order":     "desc",
+		"nextToken": "abc",
+		"since":     "2024-05-01T00:00:00Z",
+		"until":     "2024-05-02T00:00:00+02:00",
+		"action":    "DEPLOY",
+		"errored":   "true",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(25), query.Limit)
+	assert.True(t, query.Descending)
+	assert.Equal(t, "abc", query.PageToken)
+	assert.True(t, query.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, query.Until.Equal(time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "DEPLOY", query.Action)
+	require.NotNil(t, query.Errored)
+	assert.True(t, *query.Errored)
+}
+
+func TestDeploymentQueryRejectsReversedRange(t *testing.T) {
+	_, err := deploymentQuery(map[string]string{"since": "2024-05-02T00:00:00Z", "until": "2024-05-01T00:00:00Z"})
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestGetDeploymentsRejectsInvalidQuery(t *testing.T) {
+	t.Setenv(deploymentsTableNameKey, "deployments")
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	ctx := WithDependencies(context.Background(), deps)
+
+	response, err := GetDeploymentsHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters:        map[string]string{"id": "app-1"},
+		QueryStringParameters: map[string]string{"limit": "0", "order": "newest", "since": "yesterday", "errored": "maybe"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	body := decodeErrorResponse(t, response)
+	assert.Equal(t, CodeValidationFailed, body.Code)
+	var fields []string
+	for _, f := range body.Details {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{"limit", "order", "since", "errored"}, fields)
+}
@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pennsieve/app-deploy-service/service/mappers"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+)
+
+// gitHubWebhookSecretParameterKey names the SSM parameter holding the secret GitHub signs webhook deliveries with
+const gitHubWebhookSecretParameterKey = "GITHUB_WEBHOOK_SECRET_PARAMETER"
+
+// GitHub webhook delivery headers
+const (
+	gitHubEventHeader     = "X-GitHub-Event"
+	gitHubSignatureHeader = "X-Hub-Signature-256"
+)
+
+// gitHubWebhookSecret returns the webhook secret. It is a variable so tests can avoid SSM.
+var gitHubWebhookSecret = func(ctx context.Context, deps *Dependencies) (string, error) {
+	name := strings.TrimSpace(os.Getenv(gitHubWebhookSecretParameterKey))
+	if name == "" {
+		return "", fmt.Errorf("%s is not set", gitHubWebhookSecretParameterKey)
+	}
+	out, err := ssm.NewFromConfig(deps.Config).GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting GitHub webhook secret from SSM: %w", err)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+// gitHubWebhookEvent holds the fields of push and release events that say which tag of which repository is new
+type gitHubWebhookEvent struct {
+	Ref     string `json:"ref"`
+	Deleted bool   `json:"deleted"`
+	Action  string `json:"action"`
+	Release *struct {
+		ID      int    `json:"id"`
+		TagName string `json:"tag_name"`
+		Draft   bool   `json:"draft"`
+	} `json:"release"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HtmlUrl  string `json:"html_url"`
+		CloneUrl string `json:"clone_url"`
+		SshUrl   string `json:"ssh_url"`
+		GitUrl   string `json:"git_url"`
+	} `json:"repository"`
+}
+
+// GitHubWebhookHandler receives GitHub webhook deliveries at the webhook Lambda's function URL. A pushed tag deploys
+// the applications whose auto-deploy tag pattern matches it, and a published release also adds its tag to the
+// appstore applications of the repository.
+func GitHubWebhookHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return newHandler("GitHubWebhookHandler", postGitHubWebhook)(ctx, request)
+}
+
+func postGitHubWebhook(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		if body, err = base64.StdEncoding.DecodeString(request.Body); err != nil {
+			return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+		}
+	}
+
+	secret, err := gitHubWebhookSecret(ctx, deps)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	if !validWebhookSignature(secret, body, headerValue(request.Headers, gitHubSignatureHeader)) {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("invalid webhook signature: %w", ErrUnauthorized)
+	}
+
+	eventName := headerValue(request.Headers, gitHubEventHeader)
+	var event gitHubWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+	}
+	tag, releaseId, ok := webhookTag(eventName, event)
+	if !ok {
+		deps.Logger.Info("ignoring webhook delivery", slog.String("event", eventName), slog.String("action", event.Action))
+		return jsonResponse(http.StatusOK, models.WebhookResponse{Deployments: []models.DeployApplicationResponse{}})
+	}
+	deps.Logger.Info("received new tag",
+		slog.String("event", eventName),
+		slog.String("repository", event.Repository.FullName),
+		slog.String("tag", tag))
+
+	deployments, err := deployWebhookTag(ctx, deps, event.Repository.FullName, tag)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	if releaseId != 0 {
+		published, err := publishWebhookRelease(ctx, deps, webhookSourceUrls(event), tag, releaseId)
+		if err != nil {
+			return events.APIGatewayV2HTTPResponse{}, err
+		}
+		deployments = append(deployments, published...)
+	}
+
+	status := http.StatusOK
+	if len(deployments) > 0 {
+		status = http.StatusAccepted
+	}
+	return jsonResponse(status, models.WebhookResponse{Deployments: deployments})
+}
+
+// validWebhookSignature reports whether signature is the sha256= HMAC of body that GitHub sends with a delivery
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// webhookTag returns the tag a delivery reports as new, and the ID of its release if it is a published release. It
+// is false for events, such as branch pushes, deleted tags and draft releases, that do not.
+func webhookTag(eventName string, event gitHubWebhookEvent) (string, int, bool) {
+	switch eventName {
+	case "push":
+		tag, ok := strings.CutPrefix(event.Ref, "refs/tags/")
+		if !ok || event.Deleted || tag == "" {
+			return "", 0, false
+		}
+		return tag, 0, true
+	case "release":
+		if event.Action != "published" || event.Release == nil || event.Release.Draft || event.Release.TagName == "" {
+			return "", 0, false
+		}
+		return event.Release.TagName, event.Release.ID, true
+	}
+	return "", 0, false
+}
+
+// webhookSourceUrls returns the URLs a repository may have been registered in the appstore with
+func webhookSourceUrls(event gitHubWebhookEvent) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, u := range []string{
+		event.Repository.HtmlUrl,
+		event.Repository.HtmlUrl + ".git",
+		event.Repository.CloneUrl,
+		event.Repository.SshUrl,
+		event.Repository.GitUrl,
+	} {
+		if u != "" && u != ".git" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// deployWebhookTag deploys tag to each application of the repository named fullName whose auto-deploy tag pattern
+// matches it, if it is newer than the tag the application last deployed, so that a tag pushed to maintain an older
+// release does not replace a newer one. A failure to deploy one application is logged and the others carry on.
+func deployWebhookTag(ctx context.Context, deps *Dependencies, fullName string, tag string) ([]models.DeployApplicationResponse, error) {
+	applications, err := deps.Applications.ListAutoDeploy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	deployments := []models.DeployApplicationResponse{}
+	for _, application := range applications {
+		logger := deps.Logger.With(slog.String("applicationId", application.Uuid))
+		if application.AutoDeploy == nil || application.AutoDeploy.TagPattern == "" {
+			continue
+		}
+		if owner, repo, err := gitHubRepository(application.SourceUrl); err != nil || !strings.EqualFold(owner+"/"+repo, fullName) {
+			continue
+		}
+		if ok, _ := path.Match(application.AutoDeploy.TagPattern, tag); !ok {
+			continue
+		}
+		if !statemachine.Application.CanTransition(application.Status, string(statemachine.Pending)) {
+			// the poller deploys the tag once the application can be deployed again
+			logger.Info("application cannot be deployed", slog.String("status", application.Status))
+			continue
+		}
+		deployed, err := lastDeployedTag(ctx, deps, application.Uuid)
+		if err != nil {
+			logger.Error("error getting last deployed tag", slog.Any("error", err))
+			continue
+		}
+		if deployed != "" && compareVersions(tag, deployed) <= 0 {
+			continue
+		}
+
+		response, err := deployApplication(ctx, deps, mappers.StoreToModel(application), deploymentRequest{
+			OrganizationId: application.OrganizationId,
+			UserId:         application.UserId,
+			Queue:          true,
+			Tag:            tag,
+			Trigger:        store_dynamodb.DeploymentTriggerWebhook,
+		})
+		if err != nil {
+			logger.Error("error deploying application", slog.String("tag", tag), slog.Any("error", err))
+			continue
+		}
+		logger.Info("deployed application from webhook",
+			slog.String("tag", tag),
+			slog.String("deploymentId", response.DeploymentId),
+			slog.Bool("queued", response.Queued))
+		deployments = append(deployments, response)
+	}
+	return deployments, nil
+}
+
+// publishWebhookRelease adds the release of tag to each appstore application registered with one of sourceUrls that
+// does not have it yet, on behalf of the application's owner. Private applications are skipped: the token they were
+// added with is not stored, so they are still published with POST /store.
+func publishWebhookRelease(ctx context.Context, deps *Dependencies, sourceUrls []string, tag string, releaseId int) ([]models.DeployApplicationResponse, error) {
+	deployments := []models.DeployApplicationResponse{}
+	seen := map[string]bool{}
+	for _, sourceUrl := range sourceUrls {
+		applications, err := deps.AppStore.GetBySourceUrl(ctx, sourceUrl)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+		}
+		for _, application := range applications {
+			if seen[application.Uuid] {
+				continue
+			}
+			seen[application.Uuid] = true
+			logger := deps.Logger.With(slog.String("applicationId", application.Uuid))
+			if application.IsPrivate {
+				logger.Warn("not publishing release of private appstore application", slog.String("tag", tag))
+				continue
+			}
+			versions, err := deps.AppStoreVersions.GetByApplicationIdAndVersion(ctx, application.Uuid, tag)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+			}
+			if len(versions) > 0 {
+				logger.Info("appstore application already has release", slog.String("tag", tag))
+				continue
+			}
+
+			response, err := publishToAppStore(ctx, deps, models.AppStoreDeployment{
+				Source: models.DeploymentSource{
+					SourceType:   application.SourceType,
+					Url:          application.SourceUrl,
+					Tag:          tag,
+					BuildOptions: mappers.BuildOptionsToModel(application.Build),
+				},
+				Release: models.Release{ID: releaseId},
+			}, application.OwnerId)
+			if err != nil {
+				logger.Error("error publishing release", slog.String("tag", tag), slog.Any("error", err))
+				continue
+			}
+			logger.Info("published release from webhook",
+				slog.String("tag", tag),
+				slog.String("deploymentId", response.DeploymentId))
+			deployments = append(deployments, response)
+		}
+	}
+	return deployments, nil
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+func webhookSignature(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookRequest(event string, body string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-github-event":      event,
+			"x-hub-signature-256": webhookSignature(testWebhookSecret, body),
+		},
+		Body: body,
+	}
+}
+
+func newWebhookTestContext(t *testing.T, deps *Dependencies) context.Context {
+	secret := gitHubWebhookSecret
+	gitHubWebhookSecret = func(context.Context, *Dependencies) (string, error) {
+		return testWebhookSecret, nil
+	}
+	t.Cleanup(func() { gitHubWebhookSecret = secret })
+	return WithDependencies(context.Background(), deps)
+}
+
+func TestValidWebhookSignature(t *testing.T) {
+	body := []byte(`{"zen":"Keep it logically awesome."}`)
+	signature := webhookSignature(testWebhookSecret, string(body))
+
+	assert.True(t, validWebhookSignature(testWebhookSecret, body, signature))
+	assert.False(t, validWebhookSignature("other-secret", body, signature))
+	assert.False(t, validWebhookSignature(testWebhookSecret, []byte(`{}`), signature))
+	assert.False(t, validWebhookSignature(testWebhookSecret, body, ""))
+	assert.False(t, validWebhookSignature(testWebhookSecret, body, "sha1=abc"))
+	assert.False(t, validWebhookSignature("", body, webhookSignature("", string(body))))
+}
+
+func TestWebhookTag(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventName string
+		body      string
+		tag       string
+		releaseId int
+		ok        bool
+	}{
+		{"pushed tag", "push", `{"ref":"refs/tags/v1.2.0"}`, "v1.2.0", 0, true},
+		{"pushed branch", "push", `{"ref":"refs/heads/main"}`, "", 0, false},
+		{"deleted tag", "push", `{"ref":"refs/tags/v1.2.0","deleted":true}`, "", 0, false},
+		{"published release", "release", `{"action":"published","release":{"id":42,"tag_name":"v1.2.0"}}`, "v1.2.0", 42, true},
+		{"edited release", "release", `{"action":"edited","release":{"id":42,"tag_name":"v1.2.0"}}`, "", 0, false},
+		{"draft release", "release", `{"action":"published","release":{"id":42,"tag_name":"v1.2.0","draft":true}}`, "", 0, false},
+		{"ping", "ping", `{"zen":"Keep it logically awesome."}`, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var event gitHubWebhookEvent
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &event))
+			tag, releaseId, ok := webhookTag(tt.eventName, event)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.tag, tag)
+			assert.Equal(t, tt.releaseId, releaseId)
+		})
+	}
+}
+
+func TestWebhookSourceUrls(t *testing.T) {
+	var event gitHubWebhookEvent
+	require.NoError(t, json.Unmarshal([]byte(`{"repository":{
+		"full_name":"org/repo",
+		"html_url":"https://github.com/org/repo",
+		"clone_url":"https://github.com/org/repo.git",
+		"ssh_url":"git@github.com:org/repo.git",
+		"git_url":"git://github.com/org/repo.git"
+	}}`), &event))
+
+	assert.Equal(t, []string{
+		"https://github.com/org/repo",
+		"https://github.com/org/repo.git",
+		"git@github.com:org/repo.git",
+		"git://github.com/org/repo.git",
+	}, webhookSourceUrls(event))
+}
+
+func TestGitHubWebhookInvalidSignature(t *testing.T) {
+	ctx := newWebhookTestContext(t, newTestDependencies())
+	request := webhookRequest("push", `{"ref":"refs/tags/v1.2.0"}`)
+	request.Headers["x-hub-signature-256"] = webhookSignature("other-secret", request.Body)
+
+	response, err := GitHubWebhookHandler(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	assertErrorCode(t, response, CodeUnauthorized)
+}
+
+func TestGitHubWebhookIgnoredEvent(t *testing.T) {
+	ctx := newWebhookTestContext(t, newTestDependencies())
+
+	response, err := GitHubWebhookHandler(ctx, webhookRequest("ping", `{"zen":"Keep it logically awesome."}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var body models.WebhookResponse
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	assert.Empty(t, body.Deployments)
+}
+
+func TestGitHubWebhookDeploysPushedTag(t *testing.T) {
+	deployed := builtDeployment("current", 1)
+	deployed.Tag = "v1.1.0"
+	store := &fakeApplicationsStore{applications: map[string]store_dynamodb.Application{
+		"app-1": {
+			Uuid:       "app-1",
+			Status:     string(statemachine.Deployed),
+			SourceUrl:  "https://github.com/Org/Repo.git",
+			AutoDeploy: &store_dynamodb.AutoDeployPolicy{TagPattern: "v*"},
+		},
+		"other-repository": {
+			Uuid:       "other-repository",
+			Status:     string(statemachine.Deployed),
+			SourceUrl:  "https://github.com/org/other",
+			AutoDeploy: &store_dynamodb.AutoDeployPolicy{TagPattern: "v*"},
+		},
+		"other-pattern": {
+			Uuid:       "other-pattern",
+			Status:     string(statemachine.Deployed),
+			SourceUrl:  "https://github.com/org/repo",
+			AutoDeploy: &store_dynamodb.AutoDeployPolicy{TagPattern: "release-*"},
+		},
+	}}
+	deps := newTestDependencies()
+	deps.Applications = store
+	deps.Deployments = store_dynamodb.NewDeploymentsStore(&historyDeploymentsTable{history: []store_dynamodb.Deployment{deployed}}, "deployments")
+	deps.Leases = store_dynamodb.NewDeploymentLeaseStore(&fakeLeaseTable{heldBy: "deploy-0"}, "leases")
+	jobs := &fakeJobsTable{}
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+	ctx := newWebhookTestContext(t, deps)
+
+	// a tag older than the one deployed is not deployed
+	response, err := GitHubWebhookHandler(ctx, webhookRequest("push", `{"ref":"refs/tags/v1.0.1","repository":{"full_name":"org/repo"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Empty(t, jobs.inserted)
+
+	response, err = GitHubWebhookHandler(ctx, webhookRequest("push", `{"ref":"refs/tags/v1.2.0","repository":{"full_name":"org/repo"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	var body models.WebhookResponse
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	require.Len(t, body.Deployments, 1)
+	assert.True(t, body.Deployments[0].Queued)
+	// the deployment waits for the lease as a job
+	require.Len(t, jobs.inserted, 1)
+	assert.Equal(t, "app-1", jobs.inserted[0].ApplicationId)
+	assert.Equal(t, body.Deployments[0].DeploymentId, jobs.inserted[0].JobId)
+}
@@ -16,17 +16,23 @@ func init() {
 }
 
 func AppDeployServiceHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	requestLogger := logger
 	if lc, ok := lambdacontext.FromContext(ctx); ok {
-		logger = logger.With(slog.String("requestID", lc.AwsRequestID))
+		requestLogger = logger.With(slog.String("requestID", lc.AwsRequestID))
 	}
 
-	logger.Info("request parameters",
+	requestLogger.Info("request parameters",
 		"routeKey", request.RouteKey,
 		"pathParameters", request.PathParameters,
 		"rawPath", request.RawPath,
 		"requestContext.routeKey", request.RequestContext.RouteKey,
 		"requestContext.http.path", request.RequestContext.HTTP.Path)
 
+	return newRouter().Start(ctx, request)
+}
+
+// newRouter builds the route table. It is also the source of the OpenAPI document served at /openapi.json.
+func newRouter() Router {
 	router := NewLambdaRouter()
 	// register routes based on their supported methods - to be deprecated
 	router.POST("/v1", PostApplicationsHandler)
@@ -34,8 +40,12 @@ func AppDeployServiceHandler(ctx context.Context, request events.APIGatewayV2HTT
 	router.GET("/{id}", GetApplicationHandler)
 	router.GET("/{id}/deployments", GetDeploymentsHandler)
 	router.GET("/{id}/deployments/{deploymentId}", GetDeploymentHandler)
+	router.GET("/{id}/deployments/{deploymentId}/logs", GetDeploymentLogsHandler)
+	router.POST("/{id}/deployments/{deploymentId}/cancel", PostDeploymentCancelHandler)
+	router.POST("/{id}/rollback", PostApplicationRollbackHandler)
 	router.DELETE("/{id}", DeleteApplicationHandler)
 	router.PUT("/{id}", PutApplicationsHandler)
+	router.PATCH("/{id}", PatchApplicationHandler)
 	router.POST("/deploy", PostApplicationDeployHandler)
 
 	// AppStore routes
@@ -53,5 +63,8 @@ func AppDeployServiceHandler(ctx context.Context, request events.APIGatewayV2HTT
 	router.GET("/store/{id}/permissions", GetAppPermissionsHandler)
 	router.PUT("/store/{id}/permissions", PutAppPermissionsHandler)
 
-	return router.Start(ctx, request)
+	// API description
+	router.GET("/openapi.json", GetOpenAPIHandler)
+
+	return router
 }
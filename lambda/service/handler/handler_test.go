@@ -51,14 +51,139 @@ func TestUnknownRouteReturnsNotFound(t *testing.T) {
 	request := newRequest("POST", "POST /unknownEndpoint", "/unknownEndpoint", nil)
 	resp, _ := AppDeployServiceHandler(context.Background(), request)
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
-	assert.Equal(t, ErrUnsupportedRoute.Error(), resp.Body)
+	assertErrorCode(t, resp, CodeRouteNotFound)
 }
 
-func TestUnsupportedMethodReturnsUnprocessableEntity(t *testing.T) {
-	request := newRequest("PATCH", "PATCH /", "/", nil)
+func TestUnsupportedMethodReturnsMethodNotAllowed(t *testing.T) {
+	request := newRequest("PATCH", "PATCH /store", "/store", nil)
 	resp, _ := AppDeployServiceHandler(context.Background(), request)
-	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
-	assert.Equal(t, ErrUnsupportedPath.Error(), resp.Body)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assertErrorCode(t, resp, CodeMethodNotAllowed)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", resp.Headers["Allow"])
+}
+
+func TestUnknownPathWithUnsupportedMethodReturnsNotFound(t *testing.T) {
+	request := newRequest("PATCH", "PATCH /unknownEndpoint", "/unknownEndpoint", nil)
+	resp, _ := AppDeployServiceHandler(context.Background(), request)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assertErrorCode(t, resp, CodeRouteNotFound)
+}
+
+func TestMethodNotAllowedPerPath(t *testing.T) {
+	router := newTestRouter()
+
+	tests := []struct {
+		name     string
+		method   string
+		routeKey string
+		rawPath  string
+		allow    string
+	}{
+		{"PATCH root", "PATCH", "PATCH /", "/", "GET, HEAD, OPTIONS, POST"},
+		{"POST app by id", "POST", "POST /{id}", "/123", "DELETE, GET, HEAD, OPTIONS, PUT"},
+		{"DELETE deploy", "DELETE", "DELETE /deploy", "/deploy", "OPTIONS, POST"},
+		{"POST store registry", "POST", "POST /store/registry", "/store/registry", "GET, HEAD, OPTIONS"},
+		{"DELETE store permissions", "DELETE", "DELETE /store/{id}/permissions", "/store/123/permissions", "GET, HEAD, OPTIONS, PUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := newRequest(tt.method, tt.routeKey, tt.rawPath, nil)
+			resp, err := router.Start(context.Background(), request)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+			assert.Equal(t, tt.allow, resp.Headers["Allow"])
+		})
+	}
+}
+
+func TestPreflightIsAnsweredAutomatically(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.pennsieve.io,https://app.pennsieve.net")
+	router := newTestRouter()
+
+	request := newRequest("OPTIONS", "OPTIONS /{id}", "/123", nil)
+	request.Headers = map[string]string{
+		"origin":                         "https://app.pennsieve.net",
+		"access-control-request-method":  "PUT",
+		"access-control-request-headers": "authorization,content-type",
+	}
+	resp, err := router.Start(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, PUT", resp.Headers["Access-Control-Allow-Methods"])
+	assert.Equal(t, "authorization,content-type", resp.Headers["Access-Control-Allow-Headers"])
+	assert.Equal(t, "https://app.pennsieve.net", resp.Headers["Access-Control-Allow-Origin"])
+
+	request.Headers["origin"] = "https://evil.example.com"
+	resp, _ = router.Start(context.Background(), request)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.NotContains(t, resp.Headers, "Access-Control-Allow-Origin")
+}
+
+func TestExplicitOptionsRouteTakesPrecedence(t *testing.T) {
+	router := newTestRouter()
+	router.OPTIONS("/deploy", func(_ context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, Body: "custom"}, nil
+	})
+
+	resp, _ := router.Start(context.Background(), newRequest("OPTIONS", "OPTIONS /deploy", "/deploy", nil))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "custom", resp.Body)
+}
+
+func TestHeadFallsBackToGet(t *testing.T) {
+	router := newTestRouter()
+
+	resp, err := router.Start(context.Background(), newRequest("HEAD", "HEAD /store", "/store", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Body)
+}
+
+func TestDefaultRouteMatchesRawPath(t *testing.T) {
+	router := NewLambdaRouter()
+	var got events.APIGatewayV2HTTPRequest
+	capture := func(_ context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		got = req
+		return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil
+	}
+	router.GET("/store/{id}", capture)
+	router.GET("/store/registry", stubHandler)
+	router.PATCH("/{id}/deployments/{deploymentId}", capture)
+
+	resp, _ := router.Start(context.Background(), newRequest("GET", "$default", "/store/registry", nil))
+	assert.Equal(t, "ok", resp.Body, "literal segments should win over path parameters")
+
+	resp, _ = router.Start(context.Background(), newRequest("GET", "$default", "/store/abc", nil))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]string{"id": "abc"}, got.PathParameters)
+
+	resp, _ = router.Start(context.Background(), newRequest("PATCH", "$default", "/123/deployments/456", nil))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]string{"id": "123", "deploymentId": "456"}, got.PathParameters)
+}
+
+func TestRouteMiddlewareOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next RouterHandlerFunc) RouterHandlerFunc {
+			return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				calls = append(calls, name)
+				return next(ctx, req)
+			}
+		}
+	}
+	router := NewLambdaRouter()
+	router.GET("/v1", stubHandler, tag("outer"), tag("inner"))
+	router.POST("/v1", stubHandler)
+
+	resp, _ := router.Start(context.Background(), newRequest("GET", "GET /v1", "/v1", nil))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+
+	calls = nil
+	router.Start(context.Background(), newRequest("POST", "POST /v1", "/v1", nil))
+	assert.Empty(t, calls, "middleware is attached per route")
 }
 
 func TestRouteMatching(t *testing.T) {
@@ -133,7 +258,7 @@ func TestUnknownRoutePerMethod(t *testing.T) {
 			request := newRequest(tt.method, tt.routeKey, "/nonexistent", nil)
 			resp, _ := router.Start(context.Background(), request)
 			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
-			assert.Equal(t, ErrUnsupportedRoute.Error(), resp.Body)
+			assertErrorCode(t, resp, CodeRouteNotFound)
 		})
 	}
 }
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/service/validation"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencyTTL           = 24 * time.Hour
+	// idempotencyLockDuration is how long an unfinished request holds its key. It exceeds the Lambda timeout, so
+	// a lapsed lock means the request that claimed it is no longer running.
+	idempotencyLockDuration = 10 * time.Minute
+)
+
+// Idempotent lets clients retry a request safely by sending an Idempotency-Key header. The first request with a
+// key runs the handler and, if it succeeds, stores the response for idempotencyTTL; later requests with the same
+// key and body get that response back instead of running the handler again. Failed requests release the key so
+// they can be retried. Requests without the header are passed through unchanged.
+//
+// Keys are scoped to the handler and caller, so two users cannot collide on the same key.
+func Idempotent() Middleware {
+	return func(next RouterHandlerFunc) RouterHandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			key := headerValue(request.Headers, idempotencyKeyHeader)
+			if key == "" {
+				return next(ctx, request)
+			}
+			deps, err := dependencies(ctx)
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, err
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return events.APIGatewayV2HTTPResponse{}, NewValidationError(models.FieldError{
+					Field: idempotencyKeyHeader, Code: validation.CodeInvalid,
+					Message: fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLength),
+				})
+			}
+			if deps.Idempotency == nil {
+				return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: no idempotency store", ErrConfig)
+			}
+
+			scopedKey := fmt.Sprintf("%s#%s#%s", deps.HandlerName, idempotencyCaller(deps), key)
+			hash := requestHash(request)
+			now := time.Now()
+			claimed, existing, err := deps.Idempotency.Claim(ctx, store_dynamodb.IdempotencyRecord{
+				Key:         scopedKey,
+				RequestHash: hash,
+				LockedUntil: now.Add(idempotencyLockDuration).Unix(),
+				ExpiresAt:   now.Add(idempotencyTTL).Unix(),
+				CreatedAt:   now.UTC().String(),
+			}, now)
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+			}
+			if !claimed {
+				return replayIdempotent(deps, key, hash, existing)
+			}
+
+			response, err := next(ctx, request)
+			if err != nil || response.StatusCode < 200 || response.StatusCode >= 300 {
+				if releaseErr := deps.Idempotency.Release(ctx, scopedKey); releaseErr != nil {
+					deps.Logger.Error("error releasing idempotency key", slog.String("key", key), slog.Any("error", releaseErr))
+				}
+				return response, err
+			}
+			if err := deps.Idempotency.Complete(ctx, scopedKey, response.StatusCode, response.Body, response.Headers); err != nil {
+				// the request has taken effect, so report it; a retry will wait for the lock to lapse rather than
+				// run twice
+				deps.Logger.Error("error storing idempotent response", slog.String("key", key), slog.Any("error", err))
+			}
+			return response, nil
+		}
+	}
+}
+
+func replayIdempotent(deps *Dependencies, key string, hash string, existing *store_dynamodb.IdempotencyRecord) (events.APIGatewayV2HTTPResponse, error) {
+	if existing.RequestHash != hash {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%s %s: %w", idempotencyKeyHeader, key, ErrIdempotencyKeyReused)
+	}
+	if existing.Status != store_dynamodb.IdempotencyCompleted {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%s %s: %w", idempotencyKeyHeader, key, ErrIdempotentRequestInProgress)
+	}
+	deps.Logger.Info("replaying idempotent response", slog.String("key", key), slog.String("originalRequestAt", existing.CreatedAt))
+
+	headers := maps.Clone(existing.ResponseHeaders)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers[idempotentReplayedHeader] = "true"
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: existing.ResponseStatus,
+		Headers:    headers,
+		Body:       existing.ResponseBody,
+	}, nil
+}
+
+// idempotencyCaller identifies who sent the request. Direct invocations have no claims and share one scope.
+func idempotencyCaller(deps *Dependencies) string {
+	if deps.Claims != nil && deps.Claims.UserClaim != nil {
+		return deps.Claims.UserClaim.NodeId
+	}
+	return "direct"
+}
+
+// requestHash fingerprints what a retry must repeat exactly for its key to be reused.
+func requestHash(request events.APIGatewayV2HTTPRequest) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", request.RequestContext.HTTP.Method, request.RawPath, request.RawQueryString)
+	h.Write([]byte(request.Body))
+	return hex.EncodeToString(h.Sum(nil))
+}
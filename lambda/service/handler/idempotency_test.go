@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryIdempotencyTable keeps idempotency records in memory. A claim fails while any record holds the key,
+// which is enough for tests that do not depend on expiry or lapsed locks.
+type memoryIdempotencyTable struct {
+	records map[string]store_dynamodb.IdempotencyRecord
+}
+
+var setAssignment = regexp.MustCompile(`(#\w+) = (:\w+)`)
+
+func newMemoryIdempotencyTable() *memoryIdempotencyTable {
+	return &memoryIdempotencyTable{records: map[string]store_dynamodb.IdempotencyRecord{}}
+}
+
+func (m *memoryIdempotencyTable) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	var record store_dynamodb.IdempotencyRecord
+	if err := attributevalue.UnmarshalMap(params.Item, &record); err != nil {
+		return nil, err
+	}
+	if held, ok := m.records[record.Key]; ok {
+		item, err := attributevalue.MarshalMap(held)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("held"), Item: item}
+	}
+	m.records[record.Key] = record
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *memoryIdempotencyTable) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	key := params.Key["idempotencyKey"].(*types.AttributeValueMemberS).Value
+	item, err := attributevalue.MarshalMap(m.records[key])
+	if err != nil {
+		return nil, err
+	}
+	for _, assignment := range setAssignment.FindAllStringSubmatch(*params.UpdateExpression, -1) {
+		item[params.ExpressionAttributeNames[assignment[1]]] = params.ExpressionAttributeValues[assignment[2]]
+	}
+	var record store_dynamodb.IdempotencyRecord
+	if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+		return nil, err
+	}
+	m.records[key] = record
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *memoryIdempotencyTable) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(m.records, params.Key["idempotencyKey"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func idempotentTestHandler(table *memoryIdempotencyTable, calls *int, response events.APIGatewayV2HTTPResponse, err error) RouterHandlerFunc {
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Idempotency = store_dynamodb.NewIdempotencyStore(table, "idempotency")
+	handler := Chain(func(_ context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		*calls++
+		return response, err
+	}, HandleErrors("TestHandler"), Idempotent())
+	return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		return handler(WithDependencies(ctx, deps), request)
+	}
+}
+
+func idempotentRequest(key string, body string) events.APIGatewayV2HTTPRequest {
+	request := events.APIGatewayV2HTTPRequest{
+		RawPath: "/v1",
+		Headers: map[string]string{"idempotency-key": key},
+		Body:    body,
+	}
+	request.RequestContext.HTTP.Method = http.MethodPost
+	return request
+}
+
+func TestIdempotentReplaysCompletedResponse(t *testing.T) {
+	table := newMemoryIdempotencyTable()
+	calls := 0
+	handler := idempotentTestHandler(table, &calls, events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusAccepted,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       `{"uuid":"app-1"}`,
+	}, nil)
+
+	first, err := handler(context.Background(), idempotentRequest("key-1", `{"name":"a"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, first.StatusCode)
+
+	second, err := handler(context.Background(), idempotentRequest("key-1", `{"name":"a"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusAccepted, second.StatusCode)
+	assert.Equal(t, first.Body, second.Body)
+	assert.Equal(t, "application/json", second.Headers["Content-Type"])
+	assert.Equal(t, "true", second.Headers[idempotentReplayedHeader])
+}
+
+func TestIdempotentRejectsReusedKey(t *testing.T) {
+	table := newMemoryIdempotencyTable()
+	calls := 0
+	handler := idempotentTestHandler(table, &calls, events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil)
+
+	_, err := handler(context.Background(), idempotentRequest("key-1", `{"name":"a"}`))
+	require.NoError(t, err)
+	response, err := handler(context.Background(), idempotentRequest("key-1", `{"name":"b"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assertErrorCode(t, response, CodeIdempotencyKeyReused)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotentRejectsRequestInProgress(t *testing.T) {
+	table := newMemoryIdempotencyTable()
+	calls := 0
+	handler := idempotentTestHandler(table, &calls, events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil)
+	request := idempotentRequest("key-1", `{}`)
+	table.records["TestHandler#N:user:1#key-1"] = store_dynamodb.IdempotencyRecord{
+		Key: "TestHandler#N:user:1#key-1", RequestHash: requestHash(request), Status: store_dynamodb.IdempotencyInProgress,
+	}
+
+	response, err := handler(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	assertErrorCode(t, response, CodeRequestInProgress)
+	assert.Equal(t, 0, calls)
+}
+
+func TestIdempotentReleasesKeyOnFailure(t *testing.T) {
+	table := newMemoryIdempotencyTable()
+	calls := 0
+	handler := idempotentTestHandler(table, &calls, events.APIGatewayV2HTTPResponse{}, errors.New("boom"))
+
+	response, err := handler(context.Background(), idempotentRequest("key-1", `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Empty(t, table.records)
+
+	_, err = handler(context.Background(), idempotentRequest("key-1", `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls, "a failed request can be retried with the same key")
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	table := newMemoryIdempotencyTable()
+	calls := 0
+	handler := idempotentTestHandler(table, &calls, events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil)
+
+	for range 2 {
+		response, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{Body: `{}`})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, table.records)
+}
@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pennsieve/app-deploy-service/service/runner"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/service/tasklogs"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+	"github.com/pusher/pusher-http-go/v5"
+)
+
+// Dependencies holds the request-scoped AWS config, stores, caller identity and logger shared by handlers.
+// It is built once per request by InjectDependencies and read back with DependenciesFromContext.
+type Dependencies struct {
+	HandlerName string
+	RequestId   string
+	Config      aws.Config
+	DynamoDB    *dynamodb.Client
+	// Claims is nil when the request did not pass through the API Gateway authorizer (direct invocation)
+	Claims *authorizer.Claims
+	Logger *slog.Logger
+
+	Applications     store_dynamodb.DynamoDBStore
+	Deployments      *store_dynamodb.DeploymentsStore
+	AppStore         *store_dynamodb.AppStoreDatabaseStore
+	AppStoreVersions *store_dynamodb.AppStoreVersionDatabaseStore
+	AppAccess        *store_dynamodb.AppAccessDatabaseStore
+	Idempotency      *store_dynamodb.IdempotencyStore
+	Leases           *store_dynamodb.DeploymentLeaseStore
+	Jobs             *store_dynamodb.DeploymentJobsStore
+	SourceTokens     SourceTokensAPI
+	ECSTasks         runner.ECSTasksAPI
+	ECSRunner        runner.ECSRunTaskAPI
+	Logs             tasklogs.LogsAPI
+}
+
+// PusherClient returns a Pusher client configured from SSM, or nil if the config cannot be loaded.
+// Pusher is best-effort, so callers should carry on without it.
+func (d *Dependencies) PusherClient(ctx context.Context) *pusher.Client {
+	pusherConfig, err := GetPusherConfig(ctx, ssm.NewFromConfig(d.Config))
+	if err != nil {
+		d.Logger.Warn("pusher not configured", slog.Any("error", err))
+		return nil
+	}
+	return &pusher.Client{
+		AppID:   pusherConfig.AppId,
+		Key:     pusherConfig.Key,
+		Secret:  pusherConfig.Secret,
+		Cluster: pusherConfig.Cluster,
+		Secure:  true,
+	}
+}
+
+type dependenciesKey struct{}
+
+// loadAWSConfig is a variable so tests can avoid the default credential chain
+var loadAWSConfig = func(ctx context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx)
+}
+
+// Chain wraps handler in middleware. The first middleware listed is the outermost.
+func Chain(handler RouterHandlerFunc, middleware ...Middleware) RouterHandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// newHandler wraps handler in the middleware every endpoint needs: typed errors are turned into responses and
+// Dependencies are injected. Any additional middleware runs inside these, so it can rely on both.
+func newHandler(handlerName string, handler RouterHandlerFunc, middleware ...Middleware) RouterHandlerFunc {
+	stack := append([]Middleware{HandleErrors(handlerName), InjectDependencies(handlerName)}, middleware...)
+	return Chain(handler, stack...)
+}
+
+// DependenciesFromContext returns the Dependencies injected by InjectDependencies.
+func DependenciesFromContext(ctx context.Context) (*Dependencies, bool) {
+	deps, ok := ctx.Value(dependenciesKey{}).(*Dependencies)
+	return deps, ok && deps != nil
+}
+
+// WithDependencies returns a copy of ctx carrying deps.
+func WithDependencies(ctx context.Context, deps *Dependencies) context.Context {
+	return context.WithValue(ctx, dependenciesKey{}, deps)
+}
+
+// dependencies is the handler-side accessor. A missing container is a wiring error, so it is reported as ErrConfig.
+func dependencies(ctx context.Context) (*Dependencies, error) {
+	if deps, ok := DependenciesFromContext(ctx); ok {
+		return deps, nil
+	}
+	return nil, ErrConfig
+}
+
+// InjectDependencies loads the AWS config, builds the DynamoDB stores from the table name env vars, parses the
+// authorizer claims and tags a logger with the request ID. If Dependencies are already present in the context they
+// are reused, which lets tests supply their own.
+func InjectDependencies(handlerName string) Middleware {
+	return func(next RouterHandlerFunc) RouterHandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			if _, ok := DependenciesFromContext(ctx); ok {
+				return next(ctx, request)
+			}
+			cfg, err := loadAWSConfig(ctx)
+			if err != nil {
+				logger.Error("error loading AWS config", slog.String("handler", handlerName), slog.Any("error", err))
+				return events.APIGatewayV2HTTPResponse{}, ErrConfig
+			}
+			deps := NewDependencies(ctx, handlerName, cfg, request)
+			return next(WithDependencies(ctx, deps), request)
+		}
+	}
+}
+
+// NewDependencies builds the request-scoped Dependencies for request from an already loaded AWS config.
+func NewDependencies(ctx context.Context, handlerName string, cfg aws.Config, request events.APIGatewayV2HTTPRequest) *Dependencies {
+	requestId := requestID(ctx, request)
+
+	var claims *authorizer.Claims
+	if request.RequestContext.Authorizer != nil && request.RequestContext.Authorizer.Lambda != nil {
+		claims = authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
+	}
+
+	dynamoDBClient := dynamodb.NewFromConfig(cfg)
+	return &Dependencies{
+		HandlerName:      handlerName,
+		RequestId:        requestId,
+		Config:           cfg,
+		DynamoDB:         dynamoDBClient,
+		Claims:           claims,
+		Logger:           logger.With(slog.String("requestID", requestId), slog.String("handler", handlerName)),
+		Applications:     store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, os.Getenv(applicationsTableNameKey)),
+		Deployments:      store_dynamodb.NewDeploymentsStore(dynamoDBClient, os.Getenv(deploymentsTableNameKey)),
+		AppStore:         store_dynamodb.NewAppStoreDatabaseStore(dynamoDBClient, os.Getenv(appstoreApplicationsTableNameKey)),
+		AppStoreVersions: store_dynamodb.NewAppStoreVersionDatabaseStore(dynamoDBClient, os.Getenv(appstoreVersionsTableNameKey)),
+		AppAccess:        store_dynamodb.NewAppAccessDatabaseStore(dynamoDBClient, os.Getenv(appAccessTableNameKey)),
+		Idempotency:      store_dynamodb.NewIdempotencyStore(dynamoDBClient, os.Getenv(idempotencyTableNameKey)),
+		Leases:           store_dynamodb.NewDeploymentLeaseStore(dynamoDBClient, os.Getenv(deploymentLeasesTableNameKey)),
+		Jobs:             store_dynamodb.NewDeploymentJobsStore(dynamoDBClient, os.Getenv(deploymentJobsTableNameKey)),
+		SourceTokens:     ssm.NewFromConfig(cfg),
+		ECSTasks:         ecs.NewFromConfig(cfg),
+		ECSRunner:        ecs.NewFromConfig(cfg),
+		Logs:             cloudwatchlogs.NewFromConfig(cfg),
+	}
+}
+
+// requestID returns the API Gateway request ID, falling back to the Lambda request ID on direct invocation.
+func requestID(ctx context.Context, request events.APIGatewayV2HTTPRequest) string {
+	if request.RequestContext.RequestID != "" {
+		return request.RequestContext.RequestID
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
+
+// RequireClaims rejects requests that did not come through the API Gateway authorizer with ErrUnauthorized.
+func RequireClaims() Middleware {
+	return func(next RouterHandlerFunc) RouterHandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			deps, err := dependencies(ctx)
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, err
+			}
+			if deps.Claims == nil || deps.Claims.OrgClaim == nil || deps.Claims.UserClaim == nil {
+				deps.Logger.Warn("request has no authorizer claims")
+				return events.APIGatewayV2HTTPResponse{}, ErrUnauthorized
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// RequireOrgRole rejects callers without at least the given role in the workspace from their claims.
+func RequireOrgRole(required role.Role) Middleware {
+	return func(next RouterHandlerFunc) RouterHandlerFunc {
+		return Chain(func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			deps, err := dependencies(ctx)
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, err
+			}
+			if !authorizer.HasOrgRole(deps.Claims, required) {
+				deps.Logger.Warn("caller does not have required org role",
+					slog.String("requiredRole", required.String()),
+					slog.String("claims", deps.Claims.String()))
+				return events.APIGatewayV2HTTPResponse{}, ErrNotPermitted
+			}
+			return next(ctx, request)
+		}, RequireClaims())
+	}
+}
+
+// HandleErrors turns an error returned by the wrapped handler into a models.ErrorResponse, with the status and
+// error code taken from errorCodes. The error is never returned to the Lambda runtime, which would surface as a bare 500.
+// It is the one place a failed request is logged, at error level for 5xx and warn level otherwise.
+func HandleErrors(handlerName string) Middleware {
+	return func(next RouterHandlerFunc) RouterHandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+			response, err := next(ctx, request)
+			if err == nil {
+				return response, nil
+			}
+			requestId := requestID(ctx, request)
+			status, _, code := classifyError(err)
+			level := slog.LevelWarn
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			logger.Log(ctx, level, "request failed",
+				slog.String("requestID", requestId),
+				slog.String("handler", handlerName),
+				slog.Int("status", status),
+				slog.String("code", code),
+				slog.Any("error", err))
+			return errorResponse(handlerName, requestId, err), nil
+		}
+	}
+}
+
+// jsonResponse marshals body as the response body with the given status code.
+func jsonResponse(statusCode int, body any) (events.APIGatewayV2HTTPResponse, error) {
+	m, err := json.Marshal(body)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrMarshaling, err)
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Body:       string(m),
+	}, nil
+}
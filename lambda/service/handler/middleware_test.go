@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDependencies() *Dependencies {
+	return &Dependencies{
+		HandlerName: "TestHandler",
+		RequestId:   "test-request",
+		Logger:      logger,
+	}
+}
+
+func okHandler(_ context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil
+}
+
+func errorHandler(err error) RouterHandlerFunc {
+	return func(_ context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+}
+
+func decodeErrorResponse(t *testing.T, response events.APIGatewayV2HTTPResponse) models.ErrorResponse {
+	var body models.ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	return body
+}
+
+func responseMessage(t *testing.T, response events.APIGatewayV2HTTPResponse) string {
+	return decodeErrorResponse(t, response).Message
+}
+
+func assertErrorCode(t *testing.T, response events.APIGatewayV2HTTPResponse, code string) {
+	body := decodeErrorResponse(t, response)
+	assert.Equal(t, code, body.Code)
+	assert.Equal(t, response.StatusCode, body.Status)
+}
+
+func TestChainRunsMiddlewareInOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next RouterHandlerFunc) RouterHandlerFunc {
+			return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				calls = append(calls, name)
+				return next(ctx, request)
+			}
+		}
+	}
+
+	handler := Chain(func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		calls = append(calls, "handler")
+		return okHandler(ctx, request)
+	}, record("outer"), record("inner"))
+
+	_, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		sentinel error
+	}{
+		{"sentinel", ErrUnmarshaling, http.StatusBadRequest, ErrUnmarshaling},
+		{"wrapped sentinel", fmt.Errorf("application abc: %w", ErrNoRecordsFound), http.StatusNotFound, ErrNoRecordsFound},
+		{"conflict", fmt.Errorf("%w: exists", ErrRecordExists), http.StatusConflict, ErrRecordExists},
+		{"unknown error", errors.New("boom"), http.StatusInternalServerError, ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, sentinel := StatusCode(tt.err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.sentinel, sentinel)
+		})
+	}
+}
+
+func TestHandleErrorsKeepsClientErrorContext(t *testing.T) {
+	handler := HandleErrors("TestHandler")(errorHandler(fmt.Errorf("application abc: %w", ErrNoRecordsFound)))
+
+	response, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	assert.Contains(t, responseMessage(t, response), "application abc")
+}
+
+func TestHandleErrorsHidesServerErrorDetails(t *testing.T) {
+	handler := HandleErrors("TestHandler")(errorHandler(fmt.Errorf("%w: secret table detail", ErrDynamoDB)))
+
+	response, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.NotContains(t, responseMessage(t, response), "secret table detail")
+	assert.Contains(t, responseMessage(t, response), ErrDynamoDB.Error())
+}
+
+func TestInjectDependenciesReusesExistingDependencies(t *testing.T) {
+	deps := newTestDependencies()
+	ctx := WithDependencies(context.Background(), deps)
+
+	var got *Dependencies
+	handler := InjectDependencies("TestHandler")(func(ctx context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		got, _ = DependenciesFromContext(ctx)
+		return okHandler(ctx, events.APIGatewayV2HTTPRequest{})
+	})
+
+	_, err := handler(ctx, events.APIGatewayV2HTTPRequest{})
+	assert.NoError(t, err)
+	assert.Same(t, deps, got)
+}
+
+func TestInjectDependenciesConfigError(t *testing.T) {
+	original := loadAWSConfig
+	loadAWSConfig = func(_ context.Context) (aws.Config, error) {
+		return aws.Config{}, errors.New("no credentials")
+	}
+	t.Cleanup(func() { loadAWSConfig = original })
+
+	response, err := newHandler("TestHandler", okHandler)(context.Background(), events.APIGatewayV2HTTPRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+}
+
+func TestNewDependenciesWithoutAuthorizer(t *testing.T) {
+	request := events.APIGatewayV2HTTPRequest{
+		RequestContext: events.APIGatewayV2HTTPRequestContext{RequestID: "abc-123"},
+	}
+
+	deps := NewDependencies(context.Background(), "TestHandler", aws.Config{Region: "us-east-1"}, request)
+	assert.Nil(t, deps.Claims)
+	assert.Equal(t, "abc-123", deps.RequestId)
+	assert.Equal(t, "TestHandler", deps.HandlerName)
+	assert.NotNil(t, deps.Applications)
+	assert.NotNil(t, deps.Deployments)
+}
+
+func TestRequireClaimsWithoutClaims(t *testing.T) {
+	ctx := WithDependencies(context.Background(), newTestDependencies())
+	handler := HandleErrors("TestHandler")(RequireClaims()(okHandler))
+
+	response, err := handler(ctx, events.APIGatewayV2HTTPRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+func TestRequireOrgRole(t *testing.T) {
+	withRole := newTestDependencies()
+	withRole.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	withRole.Claims.OrgClaim.Role = pgdb.Administer
+
+	withoutRole := newTestDependencies()
+	withoutRole.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	withoutRole.Claims.OrgClaim.Role = pgdb.Guest
+
+	tests := []struct {
+		name   string
+		deps   *Dependencies
+		status int
+	}{
+		{"no claims", newTestDependencies(), http.StatusUnauthorized},
+		{"missing role", withoutRole, http.StatusForbidden},
+		{"has role", withRole, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithDependencies(context.Background(), tt.deps)
+			handler := HandleErrors("TestHandler")(RequireOrgRole(role.Viewer)(okHandler))
+
+			response, err := handler(ctx, events.APIGatewayV2HTTPRequest{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, response.StatusCode)
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, CodeMalformedBody, ErrorCode(fmt.Errorf("%w: unexpected EOF", ErrUnmarshaling)))
+	assert.Equal(t, CodeAppNotFound, ErrorCode(ErrAppNotFound))
+	assert.Equal(t, CodeValidationFailed, ErrorCode(NewValidationError(models.FieldError{Field: "name"})))
+	assert.Equal(t, CodeInternal, ErrorCode(errors.New("boom")))
+}
+
+func TestHandleErrorsIncludesCodeAndRequestId(t *testing.T) {
+	handler := HandleErrors("TestHandler")(errorHandler(fmt.Errorf("application abc: %w", ErrNoRecordsFound)))
+	request := events.APIGatewayV2HTTPRequest{
+		RequestContext: events.APIGatewayV2HTTPRequestContext{RequestID: "abc-123"},
+	}
+
+	response, err := handler(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", response.Headers["Content-Type"])
+	body := decodeErrorResponse(t, response)
+	assert.Equal(t, CodeNotFound, body.Code)
+	assert.Equal(t, http.StatusNotFound, body.Status)
+	assert.Equal(t, "abc-123", body.RequestId)
+	assert.Empty(t, body.Details)
+}
+
+func TestHandleErrorsIncludesValidationDetails(t *testing.T) {
+	fields := []models.FieldError{
+		{Field: "computeNodeUuid", Code: "required", Message: "is required"},
+		{Field: "source.url", Code: "invalid", Message: "must be a git URL"},
+	}
+	handler := HandleErrors("TestHandler")(errorHandler(NewValidationError(fields...)))
+
+	response, err := handler(context.Background(), events.APIGatewayV2HTTPRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	body := decodeErrorResponse(t, response)
+	assert.Equal(t, CodeValidationFailed, body.Code)
+	assert.Equal(t, fields, body.Details)
+}
+
+func TestMalformedBodyReturnsBadRequest(t *testing.T) {
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	ctx := WithDependencies(context.Background(), deps)
+
+	handlers := map[string]RouterHandlerFunc{
+		"PostApplicationsHandler":      PostApplicationsHandler,
+		"PostApplicationDeployHandler": PostApplicationDeployHandler,
+		"PutApplicationsHandler":       PutApplicationsHandler,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			response, err := handler(ctx, events.APIGatewayV2HTTPRequest{Body: "{not json"})
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			assertErrorCode(t, response, CodeMalformedBody)
+		})
+	}
+}
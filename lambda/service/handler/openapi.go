@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/openapi"
+)
+
+const (
+	securityToken          = "token_auth"
+	securityTokenWorkspace = "token_workspace_auth"
+)
+
+// apiOperation documents a registered route. Path parameters come from the route template; everything
+// else an API client needs is described here.
+type apiOperation struct {
+	id          string
+	summary     string
+	tag         string
+	deprecated  bool
+	security    string // empty for public routes
+	query       []openapi.Parameter
+	headers     []openapi.Parameter
+	request     any
+	status      int
+	response    any
+	contentType string // defaults to application/json
+	etag        bool   // the response carries an ETag header
+}
+
+func queryParam(name string, required bool, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Required: required, Description: description, Schema: openapi.String()}
+}
+
+var organizationIdParam = queryParam("organization_id", true, "The organization ID.")
+var deploymentQueueQueryParam = queryParam("queue", false, "true to wait for a deployment of the application already in progress, instead of failing with 409 DEPLOYMENT_IN_PROGRESS.")
+
+var ifMatchParam = openapi.Parameter{
+	Name: "If-Match", In: "header", Schema: openapi.String(),
+	Description: "ETag from a previous response. The request fails with 412 if the record has changed since.",
+}
+
+var idempotencyKeyParam = openapi.Parameter{
+	Name: "Idempotency-Key", In: "header", Schema: openapi.String(),
+	Description: "Unique key for this request. Retrying with the same key and body returns the original response " +
+		"for 24 hours instead of repeating the request.",
+}
+
+// apiOperations is keyed by "METHOD /template" and must cover every route registered in newRouter.
+var apiOperations = map[string]apiOperation{
+	"POST /v1": {
+		id: "postApplications", summary: "Create application", tag: "Applications", deprecated: true,
+		security: securityToken, headers: []openapi.Parameter{idempotencyKeyParam}, request: models.Application{},
+		status: http.StatusAccepted, response: models.RegisterApplicationResponse{},
+	},
+	"GET /v1": {
+		id: "getApplications", summary: "List applications", tag: "Applications", deprecated: true,
+		security: securityTokenWorkspace,
+		query: []openapi.Parameter{
+			organizationIdParam,
+			queryParam("limit", false, "Maximum number of applications to return, from 1 to 100. Defaults to 50."),
+			queryParam("nextToken", false, "The nextToken of the previous page."),
+			queryParam("sort", false, "createdAt (default) or name."),
+			queryParam("order", false, "asc or desc. Defaults to desc when sorting by createdAt and asc when sorting by name."),
+			queryParam("registrationStatus", false, "Only return applications with this registration status."),
+			queryParam("computeNodeUuid", false, "Only return applications on this compute node."),
+			queryParam("applicationType", false, "Only return applications of this type."),
+			queryParam("sourceType", false, "Only return applications with this source type."),
+			queryParam("sourceUrl", false, "Only return applications built from this source URL."),
+		},
+		status: http.StatusOK, response: models.ApplicationsPage{},
+	},
+	"GET /{id}": {
+		id: "getApplication", summary: "Get application", tag: "Applications", deprecated: true,
+		security: securityToken, status: http.StatusOK, response: models.Application{}, etag: true,
+	},
+	"PUT /{id}": {
+		id: "putApplication", summary: "Update application", tag: "Applications", deprecated: true,
+		security: securityToken, headers: []openapi.Parameter{ifMatchParam}, request: models.Application{},
+		status: http.StatusOK, response: models.Application{}, etag: true,
+	},
+	"PATCH /{id}": {
+		id: "patchApplication", summary: "Patch application", tag: "Applications",
+		security: securityTokenWorkspace, query: []openapi.Parameter{organizationIdParam},
+		headers: []openapi.Parameter{ifMatchParam}, request: models.ApplicationPatch{},
+		status: http.StatusOK, response: models.PatchApplicationResponse{}, etag: true,
+	},
+	"DELETE /{id}": {
+		id: "deleteApplication", summary: "Delete application", tag: "Applications", deprecated: true,
+		security: securityToken, headers: []openapi.Parameter{ifMatchParam},
+		status: http.StatusAccepted, response: models.ApplicationResponse{},
+	},
+	"GET /{id}/deployments": {
+		id: "getDeployments", summary: "List deployments", tag: "Deployments",
+		security: securityTokenWorkspace,
+		query: []openapi.Parameter{
+			organizationIdParam,
+			queryParam("limit", false, "Maximum number of deployments to return, from 1 to 100. Without a limit every deployment is returned."),
+			queryParam("nextToken", false, "The nextToken of the previous page."),
+			queryParam("order", false, "asc (default) or desc by initiatedAt."),
+			queryParam("since", false, "Only return deployments initiated at or after this RFC 3339 time."),
+			queryParam("until", false, "Only return deployments initiated at or before this RFC 3339 time."),
+			queryParam("action", false, "Only return deployments with this action, e.g. DEPLOY."),
+			queryParam("errored", false, "true or false."),
+		},
+		status: http.StatusOK, response: models.Deployments{},
+	},
+	"GET /{id}/deployments/{deploymentId}": {
+		id: "getDeployment", summary: "Get deployment", tag: "Deployments",
+		security: securityTokenWorkspace, query: []openapi.Parameter{organizationIdParam},
+		status: http.StatusOK, response: models.Deployment{},
+	},
+	"GET /{id}/deployments/{deploymentId}/logs": {
+		id: "getDeploymentLogs", summary: "Get deployment logs", tag: "Deployments",
+		security: securityTokenWorkspace,
+		query: []openapi.Parameter{
+			organizationIdParam,
+			queryParam("limit", false, "Maximum number of events to return from each stream, from 1 to 1000. Defaults to 100."),
+			queryParam("nextToken", false, "The nextToken or followToken of a previous response."),
+		},
+		status: http.StatusOK, response: models.DeploymentLogs{},
+	},
+	"POST /{id}/deployments/{deploymentId}/cancel": {
+		id: "postDeploymentCancel", summary: "Cancel deployment", tag: "Deployments",
+		security: securityTokenWorkspace, query: []openapi.Parameter{organizationIdParam},
+		status: http.StatusAccepted, response: models.Deployment{},
+	},
+	"POST /{id}/rollback": {
+		id: "postApplicationRollback", summary: "Roll back application", tag: "Deployments",
+		security: securityTokenWorkspace, query: []openapi.Parameter{organizationIdParam, deploymentQueueQueryParam},
+		headers: []openapi.Parameter{idempotencyKeyParam}, request: models.RollbackRequest{},
+		status: http.StatusAccepted, response: models.RollbackResponse{},
+	},
+	"POST /deploy": {
+		id: "postApplicationDeploy", summary: "Deploy application", tag: "Deployments", deprecated: true,
+		security: securityToken,
+		query: []openapi.Parameter{
+			deploymentQueueQueryParam,
+			queryParam("ref", false, "A tag or branch name, or a full commit SHA, to build instead of the source's default branch."),
+			queryParam("refType", false, "tag (default), branch or commit."),
+		},
+		headers: []openapi.Parameter{idempotencyKeyParam}, request: models.Application{},
+		status: http.StatusAccepted, response: models.DeployApplicationResponse{},
+	},
+	"POST /store": {
+		id: "postAppStore", summary: "Create a new app store application", tag: "App Store",
+		security: securityToken, headers: []openapi.Parameter{idempotencyKeyParam}, request: models.AppStoreDeployment{},
+		status: http.StatusAccepted, response: models.DeployApplicationResponse{},
+	},
+	"GET /store": {
+		id: "getAppStoreApplications", summary: "List app store applications", tag: "App Store",
+		security: securityToken,
+		query: []openapi.Parameter{
+			queryParam("sourceUrl", false, "Only return the application built from this source URL."),
+			queryParam("contextDir", false, "Only return applications built from this directory of their repository."),
+		},
+		status: http.StatusOK, response: []models.AppStoreApplication{},
+	},
+	"GET /store/registry": {
+		id: "getAppStoreRegistry", summary: "App store registry lookup", tag: "App Store",
+		security: securityToken,
+		query: []openapi.Parameter{
+			queryParam("sourceUrl", true, "The git repository URL identifying the application."),
+			queryParam("version", true, "The specific version tag (e.g. v1.0.7)."),
+			queryParam("contextDir", false, "The build context directory of an application in a monorepo."),
+		},
+		status: http.StatusOK, response: models.RegistryImageResponse{}, etag: true,
+	},
+	"GET /store/{id}": {
+		id: "getAppStoreApplication", summary: "Get app store application", tag: "App Store",
+		security: securityToken,
+		query: []openapi.Parameter{
+			queryParam("tag", false, "Version tag to load assets for. Defaults to the latest version."),
+		},
+		status: http.StatusOK, response: models.AppStoreApplicationDetail{}, etag: true,
+	},
+	"GET /store/{id}/asset": {
+		id: "getAppStoreAsset", summary: "Get app store application asset", tag: "App Store",
+		security: securityToken,
+		query: []openapi.Parameter{
+			queryParam("file", true, "Path of the synced file, e.g. README.md."),
+			queryParam("tag", false, "Version tag. Defaults to main."),
+		},
+		status: http.StatusOK, contentType: "application/octet-stream",
+	},
+	"GET /store/{id}/permissions": {
+		id: "getAppPermissions", summary: "Get app permissions", tag: "App Store",
+		security: securityToken, status: http.StatusOK, response: models.AppPermissions{}, etag: true,
+	},
+	"PUT /store/{id}/permissions": {
+		id: "putAppPermissions", summary: "Update app permissions", tag: "App Store",
+		security: securityToken, headers: []openapi.Parameter{ifMatchParam}, request: models.SetPermissionsRequest{},
+		status: http.StatusOK, response: models.AppPermissions{}, etag: true,
+	},
+	"GET /openapi.json": {
+		id: "getOpenAPI", summary: "OpenAPI description of this API", tag: "API",
+		status: http.StatusOK, response: map[string]any{},
+	},
+}
+
+// BuildOpenAPI describes routes using apiOperations. It fails if a route is undocumented or an operation
+// documents a route that is not registered, so the document cannot drift from the route table.
+func BuildOpenAPI(routes []RouteInfo) (*openapi.Document, error) {
+	schemas := openapi.NewSchemas()
+	errorSchema := schemas.For(models.ErrorResponse{})
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Applications API",
+			Description: "This is the serverless Applications API",
+			Version:     "1.0",
+		},
+		Servers: []openapi.Server{
+			{Url: "https://api2.pennsieve.io/applications", Description: "Production server"},
+			{Url: "https://api2.pennsieve.net/applications", Description: "Development server"},
+		},
+		Paths: map[string]openapi.PathItem{},
+		Components: openapi.Components{
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				securityToken:          {Type: "apiKey", Name: "Authorization", In: "header"},
+				securityTokenWorkspace: {Type: "apiKey", Name: "Authorization", In: "header"},
+			},
+		},
+	}
+
+	documented := map[string]bool{}
+	for _, r := range routes {
+		key := r.Method + " " + r.Pattern
+		op, ok := apiOperations[key]
+		if !ok {
+			return nil, fmt.Errorf("route %s has no entry in apiOperations", key)
+		}
+		documented[key] = true
+
+		operation := &openapi.Operation{
+			OperationId: op.id,
+			Summary:     op.summary,
+			Tags:        []string{op.tag},
+			Deprecated:  op.deprecated,
+			Parameters:  slices.Concat(pathParams(r.Pattern), op.query, op.headers),
+			Responses: map[string]openapi.Response{
+				strconv.Itoa(op.status): successResponse(schemas, op),
+				"default": {
+					Description: "Error",
+					Content:     map[string]openapi.MediaType{"application/json": {Schema: errorSchema}},
+				},
+			},
+		}
+		if op.security != "" {
+			operation.Security = []map[string][]string{{op.security: {}}}
+		}
+		if op.request != nil {
+			operation.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{"application/json": {Schema: schemas.For(op.request)}},
+			}
+		}
+
+		item, ok := doc.Paths[r.Pattern]
+		if !ok {
+			item = openapi.PathItem{}
+			doc.Paths[r.Pattern] = item
+		}
+		item[strings.ToLower(r.Method)] = operation
+	}
+
+	var undocumented []string
+	for key := range apiOperations {
+		if !documented[key] {
+			undocumented = append(undocumented, key)
+		}
+	}
+	if len(undocumented) > 0 {
+		sort.Strings(undocumented)
+		return nil, fmt.Errorf("apiOperations documents unregistered routes: %s", strings.Join(undocumented, ", "))
+	}
+
+	doc.Components.Schemas = schemas.Components()
+	return doc, nil
+}
+
+func pathParams(pattern string) []openapi.Parameter {
+	var params []openapi.Parameter
+	for _, segment := range splitPath(pattern) {
+		if isParamSegment(segment) {
+			params = append(params, openapi.Parameter{
+				Name:     segment[1 : len(segment)-1],
+				In:       "path",
+				Required: true,
+				Schema:   openapi.String(),
+			})
+		}
+	}
+	return params
+}
+
+func successResponse(schemas *openapi.Schemas, op apiOperation) openapi.Response {
+	response := openapi.Response{Description: http.StatusText(op.status)}
+	if op.etag {
+		response.Headers = map[string]openapi.Header{
+			"ETag": {Description: "Version of the record, for use in If-Match.", Schema: openapi.String()},
+		}
+	}
+	switch {
+	case op.contentType != "":
+		response.Content = map[string]openapi.MediaType{op.contentType: {Schema: openapi.Binary()}}
+	case op.response != nil:
+		response.Content = map[string]openapi.MediaType{"application/json": {Schema: schemas.For(op.response)}}
+	}
+	return response
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  *openapi.Document
+	openAPIErr  error
+)
+
+// openAPIDocument builds the document once per container. It cannot be a sync.OnceValues initializer because
+// newRouter refers back to GetOpenAPIHandler.
+func openAPIDocument() (*openapi.Document, error) {
+	openAPIOnce.Do(func() {
+		openAPIDoc, openAPIErr = BuildOpenAPI(newRouter().Routes())
+	})
+	return openAPIDoc, openAPIErr
+}
+
+// GetOpenAPIHandler serves the OpenAPI document for the routes registered in newRouter. It needs no AWS
+// dependencies, so only errors are handled.
+func GetOpenAPIHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return Chain(getOpenAPI, HandleErrors("GetOpenAPIHandler"))(ctx, request)
+}
+
+func getOpenAPI(_ context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	doc, err := openAPIDocument()
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	response, err := jsonResponse(http.StatusOK, doc)
+	if err != nil {
+		return response, err
+	}
+	response.Headers = map[string]string{"Content-Type": "application/json"}
+	return response, nil
+}
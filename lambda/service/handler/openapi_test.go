@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateOpenAPI = flag.Bool("update-openapi", false, "rewrite testdata/openapi.json from the route table and models")
+
+var openAPIGolden = filepath.Join("testdata", "openapi.json")
+
+// TestOpenAPIMatchesGolden fails when a route or model changes without the checked in document being
+// regenerated with: go test ./handler -run TestOpenAPIMatchesGolden -update-openapi
+func TestOpenAPIMatchesGolden(t *testing.T) {
+	doc, err := BuildOpenAPI(newRouter().Routes())
+	require.NoError(t, err)
+	generated, err := json.MarshalIndent(doc, "", "  ")
+	require.NoError(t, err)
+	generated = append(generated, '\n')
+
+	if *updateOpenAPI {
+		require.NoError(t, os.WriteFile(openAPIGolden, generated, 0o644))
+	}
+
+	golden, err := os.ReadFile(openAPIGolden)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(golden), string(generated),
+		"OpenAPI document is out of date; run go test ./handler -run TestOpenAPIMatchesGolden -update-openapi")
+}
+
+func TestOpenAPIRejectsUndocumentedRoutes(t *testing.T) {
+	routes := append(newRouter().Routes(), RouteInfo{Method: http.MethodPost, Pattern: "/undocumented"})
+	_, err := BuildOpenAPI(routes)
+	assert.ErrorContains(t, err, "POST /undocumented")
+}
+
+func TestOpenAPIRejectsUnregisteredOperations(t *testing.T) {
+	routes := newRouter().Routes()
+	_, err := BuildOpenAPI(routes[1:])
+	assert.ErrorContains(t, err, routes[0].Method+" "+routes[0].Pattern)
+}
+
+func TestOpenAPIIsServed(t *testing.T) {
+	request := newRequest("GET", "GET /openapi.json", "/openapi.json", nil)
+	resp, err := AppDeployServiceHandler(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/{id}/deployments/{deploymentId}")
+	assert.Contains(t, doc.Paths, "/store/registry")
+}
+
+func TestOpenAPIPathParameters(t *testing.T) {
+	doc, err := BuildOpenAPI(newRouter().Routes())
+	require.NoError(t, err)
+
+	op := doc.Paths["/{id}/deployments/{deploymentId}"]["get"]
+	require.NotNil(t, op)
+	var names []string
+	for _, p := range op.Parameters {
+		if p.In == "path" {
+			names = append(names, p.Name)
+		}
+	}
+	assert.Equal(t, []string{"id", "deploymentId"}, names)
+	assert.Contains(t, doc.Components.Schemas, "Deployment")
+	assert.Contains(t, doc.Components.Schemas, "ErrorResponse")
+}
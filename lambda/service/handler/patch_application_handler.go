@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/mappers"
+	"github.com/pennsieve/app-deploy-service/service/mergepatch"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/service/validation"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+)
+
+// patchableFields are the top-level members of models.ApplicationPatch. Any other member of a patch is rejected
+// rather than ignored, so a client cannot believe it changed, say, the source URL.
+var patchableFields = []string{"name", "description", "params", "commandArguments", "runtimeConfig", "autoDeploy"}
+
+func PatchApplicationHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return newHandler("PatchApplicationHandler", patchApplication, RequireOrgRole(role.Editor))(ctx, request)
+}
+
+func patchApplication(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	uuid := request.PathParameters["id"]
+	if len(uuid) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: id", ErrMissingPathParams)
+	}
+
+	patch, err := mergepatch.Parse([]byte(request.Body))
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+	}
+	var unsupported []models.FieldError
+	for _, name := range slices.Sorted(maps.Keys(patch)) {
+		if !slices.Contains(patchableFields, name) {
+			unsupported = append(unsupported, models.FieldError{
+				Field: name, Code: validation.CodeUnsupported, Message: "cannot be changed with PATCH",
+			})
+		}
+	}
+	if len(unsupported) > 0 {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(unsupported...)
+	}
+
+	application, err := deps.Applications.GetById(ctx, uuid)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	if application.Uuid == "" {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", uuid, ErrNoRecordsFound)
+	}
+	if application.OrganizationId != deps.Claims.OrgClaim.NodeId {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("user not permitted to update application %s: %w", uuid, ErrNotPermitted)
+	}
+
+	ifMatch, err := checkIfMatch(request, application.Version)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", uuid, err)
+	}
+
+	current := applicationPatchTarget(application)
+	patched, err := applyApplicationPatch(current, []byte(request.Body))
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	if fields := validation.PatchApplication(patched); len(fields) > 0 {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(fields...)
+	}
+
+	update := store_dynamodb.ApplicationUpdate{
+		Name:             patched.Name,
+		Description:      patched.Description,
+		Params:           patched.Params,
+		CommandArguments: patched.CommandArguments,
+		CPU:              patched.RuntimeConfig.CPU,
+		Memory:           patched.RuntimeConfig.Memory,
+		ComputeTypes:     defaultComputeTypes(patched.RuntimeConfig.ComputeTypes),
+		AutoDeploy:       mappers.AutoDeployToStore(patched.AutoDeploy),
+		BuildSecrets:     mappers.BuildSecretsToStore(patched.BuildSecrets),
+	}
+	if update.CPU == 0 {
+		update.CPU = models.DefaultCPU
+	}
+	if update.Memory == 0 {
+		update.Memory = models.DefaultMemory
+	}
+	update.RunOnGPU = containsGPU(update.ComputeTypes)
+
+	// the write only succeeds if nobody else updated the application after we read it
+	updated, err := deps.Applications.Update(ctx, uuid, update, application.Version)
+	if errors.Is(err, store_dynamodb.ErrVersionConflict) {
+		return events.APIGatewayV2HTTPResponse{}, versionConflict("application "+uuid, ifMatch)
+	}
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrStoringApplication, err)
+	}
+
+	reasons := redeployReasons(application, updated)
+	response, err := jsonResponse(http.StatusOK, models.PatchApplicationResponse{
+		Application:      mappers.StoreToModel(updated),
+		RedeployRequired: len(reasons) > 0,
+		RedeployReasons:  reasons,
+	})
+	return withETag(response, err, updated.Version)
+}
+
+func applicationPatchTarget(a store_dynamodb.Application) models.ApplicationPatch {
+	return models.ApplicationPatch{
+		Name:             a.Name,
+		Description:      a.Description,
+		Params:           a.Params,
+		CommandArguments: a.CommandArguments,
+		RuntimeConfig: models.RuntimeConfig{
+			CPU:          a.CPU,
+			Memory:       a.Memory,
+			ComputeTypes: defaultComputeTypes(a.ComputeTypes),
+		},
+		AutoDeploy:   mappers.AutoDeployToModel(a.AutoDeploy),
+		BuildSecrets: mappers.BuildSecretsToModel(a.BuildSecrets),
+	}
+}
+
+// applyApplicationPatch merges patch into current. Members of the wrong type, or unknown members nested in
+// runtimeConfig, are reported as a malformed body.
+func applyApplicationPatch(current models.ApplicationPatch, patch []byte) (models.ApplicationPatch, error) {
+	target, err := json.Marshal(current)
+	if err != nil {
+		return models.ApplicationPatch{}, fmt.Errorf("%w: %w", ErrMarshaling, err)
+	}
+	merged, err := mergepatch.Apply(target, patch)
+	if err != nil {
+		return models.ApplicationPatch{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+	}
+
+	var patched models.ApplicationPatch
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return models.ApplicationPatch{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+	}
+	return patched, nil
+}
+
+// redeployReasons lists the changed fields that are baked into the application's task definition or image, so only
+// take effect after the application is deployed again.
+func redeployReasons(before, after store_dynamodb.Application) []string {
+	var reasons []string
+	if before.CPU != after.CPU {
+		reasons = append(reasons, "runtimeConfig.cpu")
+	}
+	if before.Memory != after.Memory {
+		reasons = append(reasons, "runtimeConfig.memory")
+	}
+	if !slices.Equal(defaultComputeTypes(before.ComputeTypes), defaultComputeTypes(after.ComputeTypes)) {
+		reasons = append(reasons, "runtimeConfig.computeTypes")
+	}
+	if !slices.Equal(before.BuildSecrets, after.BuildSecrets) {
+		reasons = append(reasons, "buildSecrets")
+	}
+	return reasons
+}
@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeApplicationsStore keeps applications in memory and applies Update with the same version check as DynamoDB.
+type fakeApplicationsStore struct {
+	store_dynamodb.DynamoDBStore
+	applications map[string]store_dynamodb.Application
+	updates      int
+	// statuses holds the last status set on each application
+	statuses map[string]string
+}
+
+func (f *fakeApplicationsStore) GetById(_ context.Context, uuid string) (store_dynamodb.Application, error) {
+	return f.applications[uuid], nil
+}
+
+func (f *fakeApplicationsStore) Update(_ context.Context, uuid string, update store_dynamodb.ApplicationUpdate, expectedVersion int64) (store_dynamodb.Application, error) {
+	application, ok := f.applications[uuid]
+	if !ok || application.Version != expectedVersion {
+		return store_dynamodb.Application{}, fmt.Errorf("application %s: %w", uuid, store_dynamodb.ErrVersionConflict)
+	}
+	application.Name = update.Name
+	application.Description = update.Description
+	application.Params = update.Params
+	application.CommandArguments = update.CommandArguments
+	application.CPU = update.CPU
+	application.Memory = update.Memory
+	application.RunOnGPU = update.RunOnGPU
+	application.ComputeTypes = update.ComputeTypes
+	application.AutoDeploy = update.AutoDeploy
+	application.Version++
+	f.applications[uuid] = application
+	f.updates++
+	return application, nil
+}
+
+func (f *fakeApplicationsStore) ListAutoDeploy(_ context.Context) ([]store_dynamodb.Application, error) {
+	var applications []store_dynamodb.Application
+	for _, application := range f.applications {
+		if application.AutoDeploy != nil {
+			applications = append(applications, application)
+		}
+	}
+	return applications, nil
+}
+
+func (f *fakeApplicationsStore) MarkAutoDeployed(_ context.Context, uuid string, previous *time.Time, at time.Time) (bool, error) {
+	application := f.applications[uuid]
+	if (previous == nil) != (application.AutoDeployedAt == nil) || (previous != nil && !previous.Equal(*application.AutoDeployedAt)) {
+		return false, nil
+	}
+	application.AutoDeployedAt = &at
+	f.applications[uuid] = application
+	return true, nil
+}
+
+func (f *fakeApplicationsStore) UpdateStatus(_ context.Context, status string, uuid string) error {
+	if f.statuses == nil {
+		f.statuses = map[string]string{}
+	}
+	f.statuses[uuid] = status
+	return nil
+}
+
+func (f *fakeApplicationsStore) UpdateStatusAtVersion(ctx context.Context, status string, uuid string, expectedVersion int64) error {
+	if application, ok := f.applications[uuid]; !ok || application.Version != expectedVersion {
+		return fmt.Errorf("application %s: %w", uuid, store_dynamodb.ErrVersionConflict)
+	}
+	return f.UpdateStatus(ctx, status, uuid)
+}
+
+func newPatchTestContext(store *fakeApplicationsStore, organizationId string) context.Context {
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", organizationId, nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Applications = store
+	return WithDependencies(context.Background(), deps)
+}
+
+func newPatchTestStore() *fakeApplicationsStore {
+	return &fakeApplicationsStore{applications: map[string]store_dynamodb.Application{
+		"app-1": {
+			Uuid:           "app-1",
+			Name:           "original",
+			Description:    "keep me",
+			OrganizationId: "N:organization:1",
+			SourceUrl:      "https://github.com/org/repo",
+			CPU:            2048,
+			Memory:         4096,
+			ComputeTypes:   []string{models.ComputeTypeStandard},
+			Params:         map[string]any{"a": "1", "b": "2"},
+			Version:        3,
+		},
+	}}
+}
+
+func patchRequest(body string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{PathParameters: map[string]string{"id": "app-1"}, Body: body}
+}
+
+func TestPatchApplicationMergesFields(t *testing.T) {
+	store := newPatchTestStore()
+	ctx := newPatchTestContext(store, "N:organization:1")
+
+	response, err := PatchApplicationHandler(ctx, patchRequest(`{"name":"renamed","params":{"b":null,"c":"3"}}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+
+	var body models.PatchApplicationResponse
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	assert.Equal(t, "renamed", body.Application.Name)
+	assert.Equal(t, "keep me", body.Application.Description)
+	assert.Equal(t, map[string]any{"a": "1", "c": "3"}, body.Application.Params)
+	assert.Equal(t, "https://github.com/org/repo", body.Application.Source.Url)
+	assert.False(t, body.RedeployRequired)
+	assert.Equal(t, int64(4), store.applications["app-1"].Version)
+}
+
+func TestPatchApplicationFlagsRedeploy(t *testing.T) {
+	store := newPatchTestStore()
+	ctx := newPatchTestContext(store, "N:organization:1")
+
+	response, err := PatchApplicationHandler(ctx, patchRequest(`{"runtimeConfig":{"cpu":4096,"memory":8192}}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+
+	var body models.PatchApplicationResponse
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	assert.True(t, body.RedeployRequired)
+	assert.Equal(t, []string{"runtimeConfig.cpu", "runtimeConfig.memory"}, body.RedeployReasons)
+	// computeTypes was left out of the patch, so it is unchanged
+	assert.Equal(t, []string{models.ComputeTypeStandard}, body.Application.RuntimeConfig.ComputeTypes)
+
+	response, err = PatchApplicationHandler(ctx, patchRequest(`{"runtimeConfig":{"computeTypes":["gpu"]}}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	assert.Equal(t, []string{"runtimeConfig.computeTypes"}, body.RedeployReasons)
+	assert.True(t, store.applications["app-1"].RunOnGPU)
+}
+
+func TestPatchApplicationRejectsInvalidPatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		code   string
+		fields []string
+	}{
+		{"not an object", `["name"]`, CodeMalformedBody, nil},
+		{"wrong type", `{"name":42}`, CodeMalformedBody, nil},
+		{"unknown runtime config member", `{"runtimeConfig":{"disk":10}}`, CodeMalformedBody, nil},
+		{"immutable fields", `{"source":{"url":"x"},"uuid":"other","name":"ok"}`, CodeValidationFailed, []string{"source", "uuid"}},
+		{"name removed", `{"name":null}`, CodeValidationFailed, []string{"name"}},
+		{"bad fargate size", `{"runtimeConfig":{"cpu":256}}`, CodeValidationFailed, []string{"runtimeConfig"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newPatchTestStore()
+			response, err := PatchApplicationHandler(newPatchTestContext(store, "N:organization:1"), patchRequest(tt.body))
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			body := decodeErrorResponse(t, response)
+			assert.Equal(t, tt.code, body.Code)
+			var fields []string
+			for _, f := range body.Details {
+				fields = append(fields, f.Field)
+			}
+			assert.Equal(t, tt.fields, fields)
+			assert.Zero(t, store.updates)
+		})
+	}
+}
+
+func TestPatchApplicationOtherOrganization(t *testing.T) {
+	store := newPatchTestStore()
+	response, err := PatchApplicationHandler(newPatchTestContext(store, "N:organization:2"), patchRequest(`{"name":"mine"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Zero(t, store.updates)
+}
+
+// conflictingStore bumps the version between the handler's read and its write, as a concurrent editor would.
+type conflictingStore struct {
+	*fakeApplicationsStore
+}
+
+func (c conflictingStore) GetById(ctx context.Context, uuid string) (store_dynamodb.Application, error) {
+	application, err := c.fakeApplicationsStore.GetById(ctx, uuid)
+	stored := c.applications[uuid]
+	stored.Version++
+	c.applications[uuid] = stored
+	return application, err
+}
+
+func TestPatchApplicationConcurrentUpdate(t *testing.T) {
+	store := newPatchTestStore()
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Applications = conflictingStore{store}
+
+	response, err := PatchApplicationHandler(WithDependencies(context.Background(), deps), patchRequest(`{"name":"late"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	assertErrorCode(t, response, CodeConcurrentUpdate)
+	assert.Equal(t, "original", store.applications["app-1"].Name)
+}
+
+func TestPatchApplicationIfMatch(t *testing.T) {
+	store := newPatchTestStore()
+	ctx := newPatchTestContext(store, "N:organization:1")
+
+	stale := patchRequest(`{"name":"stale"}`)
+	stale.Headers = map[string]string{"if-match": `"2"`}
+	response, err := PatchApplicationHandler(ctx, stale)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode)
+	assertErrorCode(t, response, CodePreconditionFailed)
+	assert.Zero(t, store.updates)
+
+	current := patchRequest(`{"name":"current"}`)
+	current.Headers = map[string]string{"if-match": `"3"`}
+	response, err = PatchApplicationHandler(ctx, current)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, `"4"`, response.Headers["ETag"])
+}
+
+func TestPatchApplicationIfMatchLosesRace(t *testing.T) {
+	store := newPatchTestStore()
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Applications = conflictingStore{store}
+
+	request := patchRequest(`{"name":"late"}`)
+	request.Headers = map[string]string{"if-match": `"3"`}
+	response, err := PatchApplicationHandler(WithDependencies(context.Background(), deps), request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode)
+}
+
+func TestPutApplicationIsConditional(t *testing.T) {
+	store := newPatchTestStore()
+	ctx := newPatchTestContext(store, "N:organization:1")
+
+	request := events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"id": "app-1"},
+		Headers:        map[string]string{"If-Match": `"3"`},
+		Body:           `{"params":{"x":"1"}}`,
+	}
+	response, err := PutApplicationsHandler(ctx, request)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+	assert.Equal(t, `"4"`, response.Headers["ETag"])
+	assert.Equal(t, map[string]any{"x": "1"}, store.applications["app-1"].Params)
+	assert.Equal(t, "original", store.applications["app-1"].Name)
+
+	// the same If-Match is now stale
+	response, err = PutApplicationsHandler(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode)
+}
+
+func TestPatchApplicationAutoDeploy(t *testing.T) {
+	store := newPatchTestStore()
+	ctx := newPatchTestContext(store, "N:organization:1")
+
+	response, err := PatchApplicationHandler(ctx, patchRequest(`{"autoDeploy":{"tagPattern":"v*"}}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+	assert.Equal(t, &store_dynamodb.AutoDeployPolicy{TagPattern: "v*"}, store.applications["app-1"].AutoDeploy)
+
+	// a policy has one trigger, so switching to a schedule clears the tag pattern
+	response, err = PatchApplicationHandler(ctx, patchRequest(`{"autoDeploy":{"schedule":"0 3 * * *"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, response.Body)
+	response, err = PatchApplicationHandler(ctx, patchRequest(`{"autoDeploy":{"schedule":"0 3 * * *","tagPattern":null}}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+	assert.Equal(t, &store_dynamodb.AutoDeployPolicy{Schedule: "0 3 * * *"}, store.applications["app-1"].AutoDeploy)
+
+	response, err = PatchApplicationHandler(ctx, patchRequest(`{"autoDeploy":null}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+	assert.Nil(t, store.applications["app-1"].AutoDeploy)
+}
@@ -3,154 +3,198 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/google/uuid"
 	"github.com/pennsieve/app-deploy-service/service/models"
-	"github.com/pennsieve/app-deploy-service/service/runner"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/app-deploy-service/service/validation"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
-	"github.com/pusher/pusher-http-go/v5"
 )
 
 func PostApplicationDeployHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "PostApplicationDeployHandler"
+	// Maybe we should check for role.Writer instead here, but I'm not
+	// sure if there is a difference for org roles.
+	// So just making sure the user is not a guest
+	return newHandler("PostApplicationDeployHandler", postApplicationDeploy, RequireOrgRole(role.Viewer), Idempotent())(ctx, request)
+}
+
+func postApplicationDeploy(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
 	var application models.Application
 	if err := json.Unmarshal([]byte(request.Body), &application); err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrUnmarshaling),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+	}
+	if fields := validation.DeployApplication(application); len(fields) > 0 {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(fields...)
+	}
+	queue, err := deploymentQueueParam(request.QueryStringParameters)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	refType, ref := request.QueryStringParameters["refType"], request.QueryStringParameters["ref"]
+	if fields := validation.DeploymentRef(refType, ref); len(fields) > 0 {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(fields...)
 	}
 
-	envValue := os.Getenv("ENV")
-	if application.Env != "" {
-		envValue = application.Env
+	response, err := deployApplication(ctx, deps, application, deploymentRequest{
+		OrganizationId: deps.Claims.OrgClaim.NodeId,
+		UserId:         deps.Claims.UserClaim.NodeId,
+		Queue:          queue,
+	}.withRef(refType, ref))
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
 	}
+	return jsonResponse(http.StatusAccepted, response)
+}
 
-	applicationUuid := application.Uuid
+// deploymentRequest is who, or which auto-deploy policy, asked for a deployment, and how
+type deploymentRequest struct {
+	OrganizationId string
+	UserId         string
+	// Queue makes the deployment wait for one already in progress instead of failing
+	Queue bool
+	// Tag, Branch or Commit, when one is set, is the git tag, branch or full commit SHA built instead of the
+	// source's default branch
+	Tag    string
+	Branch string
+	Commit string
+	// Trigger is set when an auto-deploy policy started the deployment
+	Trigger string
+}
 
-	TaskDefinitionArn := os.Getenv("TASK_DEF_ARN")
-	DeployerTaskDefinitionArn := os.Getenv("DEPLOYER_TASK_DEF_ARN")
-	subIdStr := os.Getenv("SUBNET_IDS")
-	SubNetIds := strings.Split(subIdStr, ",")
-	cluster := os.Getenv("CLUSTER_ARN")
-	SecurityGroup := os.Getenv("SECURITY_GROUP")
-	TaskDefContainerName := os.Getenv("TASK_DEF_CONTAINER_NAME")
-	DeployerTaskDefContainerName := os.Getenv("DEPLOYER_TASK_DEF_CONTAINER_NAME")
-	deploymentsTable := os.Getenv(deploymentsTableNameKey)
-	deploymentId := uuid.NewString()
+// withRef returns the request for building ref, a tag or branch name or a full commit SHA by refType, which
+// defaults to tag
+func (r deploymentRequest) withRef(refType string, ref string) deploymentRequest {
+	r.Tag, r.Branch, r.Commit = splitRef(refType, ref)
+	return r
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+// splitRef returns ref as the tag, branch or commit it is by refType, which defaults to tag
+func splitRef(refType string, ref string) (string, string, string) {
+	switch refType {
+	case models.RefTypeBranch:
+		return "", ref, ""
+	case models.RefTypeCommit:
+		return "", "", ref
 	}
+	return ref, "", ""
+}
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	// Maybe we should check for role.Writer instead here, but I'm not
-	// sure if there is a difference for org roles.
-	// So just making sure the user is not a guest
-	if !authorizer.HasOrgRole(claims, role.Viewer) {
-		log.Printf("user not permitted to deploy application with claims: %+v", claims)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusUnauthorized,
-			Body:       handlerError(handlerName, ErrNotPermitted),
-		}, nil
+// sourceRefEnvironment returns the provisioner environment naming the tag, branch or commit to build, for those
+// that are set
+func sourceRefEnvironment(tag string, branch string, commit string) []types.KeyValuePair {
+	var environment []types.KeyValuePair
+	for _, ref := range [][2]string{{sourceTagKey, tag}, {sourceBranchKey, branch}, {sourceCommitKey, commit}} {
+		if ref[1] != "" {
+			environment = append(environment, types.KeyValuePair{Name: aws.String(ref[0]), Value: aws.String(ref[1])})
+		}
 	}
-	organizationId := claims.OrgClaim.NodeId
-	userId := claims.UserClaim.NodeId
-
-	client := ecs.NewFromConfig(cfg)
-	log.Println("Initiating new Provisioning Fargate Task.")
-	envKey := "ENV"
-	accountIdKey := "ACCOUNT_ID"
-	accountIdValue := application.Account.AccountId
-	accountTypeKey := "ACCOUNT_TYPE"
-	accountTypeValue := application.Account.AccountType
-	accountUuidKey := "ACCOUNT_UUID"
-	accountUuidValue := application.Account.Uuid
-	accountsTableKey := "ACCOUNTS_TABLE"
-	accountsTableValue := os.Getenv("ACCOUNTS_TABLE")
-	organizationIdKey := "ORG_ID"
-	organizationIdValue := organizationId
-	userIdKey := "USER_ID"
-	userIdValue := userId
-	actionKey := "ACTION"
-	actionValue := "DEPLOY"
-	tableKey := "APPLICATIONS_TABLE"
-	tableValue := os.Getenv("APPLICATIONS_TABLE")
-	applicationNameKey := "APPLICATION_NAME"
-	applicationDescriptionKey := "APPLICATION_DESCRIPTION"
-	nameValue := application.Name
-	descriptionValue := application.Description
+	return environment
+}
 
-	computeNodeUuidKey := "COMPUTE_NODE_UUID"
-	computeNodeEfsIdKey := "COMPUTE_NODE_EFS_ID"
-	computeNodeUuidValue := application.ComputeNode.Uuid
-	computeNodeEfsIdValue := application.ComputeNode.EfsId
+// sourceAuthEnvironment returns the provisioner environment holding the token of a private source, if there is one
+func sourceAuthEnvironment(token string) []types.KeyValuePair {
+	if token == "" {
+		return nil
+	}
+	return []types.KeyValuePair{{Name: aws.String(sourceAuthTokenKey), Value: aws.String(token)}}
+}
 
-	sourceTypeKey := "SOURCE_TYPE"
-	sourceTypeValue := application.Source.SourceType
-	sourceUrlKey := "SOURCE_URL"
-	sourceUrlValue := application.Source.Url
+// buildEnvironment returns the provisioner environment holding the build options that are set
+func buildEnvironment(options models.BuildOptions) ([]types.KeyValuePair, error) {
+	var buildArgs string
+	if len(options.BuildArgs) > 0 {
+		b, err := json.Marshal(options.BuildArgs)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling build args: %w", err)
+		}
+		buildArgs = string(b)
+	}
+	var environment []types.KeyValuePair
+	for _, option := range [][2]string{
+		{sourceContextDirKey, options.ContextDir},
+		{sourceDockerfileKey, options.Dockerfile},
+		{sourceBuildArgsKey, buildArgs},
+		{sourceTargetKey, options.Target},
+	} {
+		if option[1] != "" {
+			environment = append(environment, types.KeyValuePair{Name: aws.String(option[0]), Value: aws.String(option[1])})
+		}
+	}
+	return environment, nil
+}
 
-	destinationTypeKey := "DESTINATION_TYPE"
-	destinationTypeValue := application.Destination.DestinationType
-	destinationUrlKey := "DESTINATION_URL"
-	destinationUrlValue := application.Destination.Url
+// buildSecretReference is an application's build secret as the provisioner is given it, by its full name in its
+// store
+type buildSecretReference struct {
+	Name  string `json:"name"`
+	Store string `json:"store"`
+	Path  string `json:"path"`
+}
 
-	applicationTypeKey := "APPLICATION_TYPE"
-	applicationTypeValue := application.ApplicationType
+// buildSecretsEnvironment returns the provisioner environment referencing the build secrets of an application of
+// organizationId, below the organization's build secrets path. ECS reads their values when the build starts, so the
+// values are never in a task's overrides.
+func buildSecretsEnvironment(organizationId string, secrets []models.BuildSecret) ([]types.KeyValuePair, error) {
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+	root := strings.Trim(os.Getenv(buildSecretsPathKey), "/")
+	if root == "" {
+		return nil, fmt.Errorf("%s not set: %w", buildSecretsPathKey, ErrConfig)
+	}
+	references := make([]buildSecretReference, len(secrets))
+	for i, secret := range secrets {
+		references[i] = buildSecretReference{
+			Name:  secret.Name,
+			Store: secret.Store,
+			Path:  path.Join(root, organizationId, secret.Secret),
+		}
+	}
+	b, err := json.Marshal(references)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling build secrets: %w", err)
+	}
+	return []types.KeyValuePair{{Name: aws.String(sourceBuildSecretsKey), Value: aws.String(string(b))}}, nil
+}
 
-	deployerTaskDefnKey := "DEPLOYER_TASK_DEF_ARN"
-	deployerTaskDefnValue := DeployerTaskDefinitionArn
-	subetsIdKey := "SUBNET_IDS"
-	subetsIdValue := subIdStr
-	clusterKey := "CLUSTER_ARN"
-	clusterValue := cluster
-	securityGroupKey := "SECURITY_GROUP"
-	securityGroupValue := SecurityGroup
-	deployertaskDefnContainerKey := "DEPLOYER_TASK_DEF_CONTAINER_NAME"
-	deployertaskDefnContainerValue := DeployerTaskDefContainerName
+// deployApplication builds and deploys the application again, queueing its provisioner task for the dispatcher
+func deployApplication(ctx context.Context, deps *Dependencies, application models.Application, req deploymentRequest) (models.DeployApplicationResponse, error) {
+	applicationUuid := application.Uuid
+	organizationId := req.OrganizationId
+	userId := req.UserId
+	actionValue := "DEPLOY"
+	deploymentId := uuid.NewString()
 
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	applicationsStore := store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, tableValue)
-	deploymentsStore := store_dynamodb.NewDeploymentsStore(dynamoDBClient, deploymentsTable)
+	runTaskIn, err := deploymentTaskInput(application, req, actionValue, deploymentId)
+	if err != nil {
+		return models.DeployApplicationResponse{}, err
+	}
 
-	statusManager := NewStatusManager(handlerName, applicationsStore, applicationUuid).
-		WithDeployment(deploymentsStore, deploymentId)
+	deps.Logger.Info("Initiating new Provisioning Fargate Task.")
 
-	// add pusher to statusManager if possible
-	ssmClient := ssm.NewFromConfig(cfg)
-	if pusherConfig, err := GetPusherConfig(ctx, ssmClient); err != nil {
-		log.Printf("warning: %v\n", err)
-	} else {
-		statusManager = statusManager.WithPusher(&pusher.Client{
-			AppID:   pusherConfig.AppId,
-			Key:     pusherConfig.Key,
-			Secret:  pusherConfig.Secret,
-			Cluster: pusherConfig.Cluster,
-			Secure:  true,
-		})
+	leased, err := acquireDeploymentLease(ctx, deps, applicationUuid, deploymentId, req.Queue)
+	if err != nil {
+		return models.DeployApplicationResponse{}, err
 	}
 
+	statusManager := NewStatusManager(deps.HandlerName, deps.Applications, applicationUuid).
+		WithDeployment(deps.Deployments, deploymentId).
+		WithPusher(deps.PusherClient(ctx))
+
 	if err := statusManager.NewDeployment(ctx, store_dynamodb.Deployment{
 		DeploymentKey: store_dynamodb.DeploymentKey{
 			DeploymentId:  deploymentId,
@@ -160,180 +204,36 @@ func PostApplicationDeployHandler(ctx context.Context, request events.APIGateway
 		WorkspaceNodeId: organizationId,
 		UserNodeId:      userId,
 		Action:          actionValue,
-		LastStatus:      "NOT_STARTED",
+		LastStatus:      initialDeploymentStatus(leased),
+		Tag:             req.Tag,
+		Branch:          req.Branch,
+		// the provisioner records the commit it resolves a tag or branch to when it starts the build
+		CommitSha: req.Commit,
+		Trigger:   req.Trigger,
 	}); err != nil {
-		log.Println("error creating deployment record: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrStoringDeployment),
-		}, nil
+		if leased {
+			releaseDeploymentLease(ctx, deps, applicationUuid, deploymentId)
+		}
+		return models.DeployApplicationResponse{}, fmt.Errorf("%w: %w", ErrStoringDeployment, err)
 	}
-	statusManager.UpdateApplicationStatus(ctx, applicationUuid, "pending")
 
-	runTaskIn := &ecs.RunTaskInput{
-		TaskDefinition: aws.String(TaskDefinitionArn),
-		Cluster:        aws.String(cluster),
-		NetworkConfiguration: &types.NetworkConfiguration{
-			AwsvpcConfiguration: &types.AwsVpcConfiguration{
-				Subnets:        SubNetIds,
-				SecurityGroups: []string{SecurityGroup},
-				AssignPublicIp: types.AssignPublicIpEnabled,
-			},
-		},
-		Overrides: &types.TaskOverride{
-			ContainerOverrides: []types.ContainerOverride{
-				{
-					Name: &TaskDefContainerName,
-					Environment: []types.KeyValuePair{
-						{
-							Name:  &envKey,
-							Value: &envValue,
-						},
-						{
-							Name:  aws.String(applicationUuidKey),
-							Value: aws.String(applicationUuid),
-						},
-						{
-							Name:  &applicationNameKey,
-							Value: &nameValue,
-						},
-						{
-							Name:  &applicationDescriptionKey,
-							Value: &descriptionValue,
-						},
-						{
-							Name:  &accountIdKey,
-							Value: &accountIdValue,
-						},
-						{
-							Name:  &accountUuidKey,
-							Value: &accountUuidValue,
-						},
-						{
-							Name:  &accountTypeKey,
-							Value: &accountTypeValue,
-						},
-						{
-							Name:  &actionKey,
-							Value: &actionValue,
-						},
-						{
-							Name:  &tableKey,
-							Value: &tableValue,
-						},
-						{
-							Name:  &organizationIdKey,
-							Value: &organizationIdValue,
-						},
-						{
-							Name:  &userIdKey,
-							Value: &userIdValue,
-						},
-						{
-							Name:  &sourceTypeKey,
-							Value: &sourceTypeValue,
-						},
-						{
-							Name:  &sourceUrlKey,
-							Value: &sourceUrlValue,
-						},
-						{
-							Name:  &destinationTypeKey,
-							Value: &destinationTypeValue,
-						},
-						{
-							Name:  &destinationUrlKey,
-							Value: &destinationUrlValue,
-						},
-						{
-							Name:  &computeNodeUuidKey,
-							Value: &computeNodeUuidValue,
-						},
-						{
-							Name:  &computeNodeEfsIdKey,
-							Value: &computeNodeEfsIdValue,
-						},
-						{
-							Name:  &applicationTypeKey,
-							Value: &applicationTypeValue,
-						},
-						{
-							Name:  &deployerTaskDefnKey,
-							Value: &deployerTaskDefnValue,
-						},
-						{
-							Name:  &subetsIdKey,
-							Value: &subetsIdValue,
-						},
-						{
-							Name:  &clusterKey,
-							Value: &clusterValue,
-						},
-						{
-							Name:  &securityGroupKey,
-							Value: &securityGroupValue,
-						},
-						{
-							Name:  &deployertaskDefnContainerKey,
-							Value: &deployertaskDefnContainerValue,
-						},
-						{
-							Name:  aws.String(deploymentIdKey),
-							Value: aws.String(deploymentId),
-						},
-						{
-							Name:  aws.String(deploymentsTableNameKey),
-							Value: aws.String(deploymentsTable),
-						},
-						{
-							Name:  &accountsTableKey,
-							Value: &accountsTableValue,
-						},
-					},
-				},
-			},
-		},
-		LaunchType: types.LaunchTypeFargate,
-	}
-
-	taskRunner := runner.NewECSTaskRunner(client, runTaskIn)
-	runTaskOut, err := taskRunner.Run(ctx)
+	job := newDeploymentJob(actionValue, applicationUuid, deploymentId, application.ComputeNode.Uuid)
+	queued, err := startDeployment(ctx, deps, statusManager, job, runTaskIn, leased)
 	if err != nil {
-		log.Println("error running task: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
-	}
-	if err := runner.GetRunFailures(runTaskOut); err != nil {
-		log.Println("run failures from task: ", err.Error())
-		// assuming here that if there were failures, then no tasks started.
-		// seems safe since for now we are only starting one task
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
-	}
-	// we expect one task
-	if len(runTaskOut.Tasks) > 0 {
-		log.Printf("started re-deployment %s of application %s from %s in task %s",
-			deploymentId,
-			applicationUuid,
-			sourceUrlValue,
-			aws.ToString(runTaskOut.Tasks[0].TaskArn))
+		return models.DeployApplicationResponse{}, err
 	}
-
-	m, err := json.Marshal(models.DeployApplicationResponse{DeploymentId: deploymentId})
-	if err != nil {
-		log.Println("error marshalling response: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
+	if queued {
+		return models.DeployApplicationResponse{DeploymentId: deploymentId, Queued: true}, nil
 	}
-
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusAccepted,
-		Body:       string(m),
-	}, nil
+	deps.Logger.Info("queued re-deployment of application",
+		slog.String("deploymentId", deploymentId),
+		slog.String("applicationId", applicationUuid),
+		slog.String("sourceUrl", application.Source.Url),
+		slog.String("tag", req.Tag),
+		slog.String("branch", req.Branch),
+		slog.String("commit", req.Commit),
+		slog.String("trigger", req.Trigger),
+		slog.String("jobId", job.JobId))
+
+	return models.DeployApplicationResponse{DeploymentId: deploymentId}, nil
 }
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeploymentRequestWithRef(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	assert.Equal(t, deploymentRequest{Tag: "v1.0.0"}, deploymentRequest{}.withRef("", "v1.0.0"))
+	assert.Equal(t, deploymentRequest{Branch: "feature/x"}, deploymentRequest{}.withRef(models.RefTypeBranch, "feature/x"))
+	assert.Equal(t, deploymentRequest{Commit: sha}, deploymentRequest{}.withRef(models.RefTypeCommit, sha))
+	assert.Equal(t, deploymentRequest{Queue: true}, deploymentRequest{Queue: true}.withRef("", ""))
+}
+
+func TestDeployApplicationBuildsBranch(t *testing.T) {
+	deps := newTestDependencies()
+	deps.Applications = &fakeApplicationsStore{applications: map[string]store_dynamodb.Application{
+		"app-1": {Uuid: "app-1", Status: string(statemachine.Deployed)},
+	}}
+	deps.Deployments = store_dynamodb.NewDeploymentsStore(&historyDeploymentsTable{}, "deployments")
+	deps.Leases = store_dynamodb.NewDeploymentLeaseStore(&fakeLeaseTable{heldBy: "deploy-0"}, "leases")
+	jobs := &fakeJobsTable{}
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+	tokens := &fakeSourceTokens{}
+	deps.SourceTokens = tokens
+	t.Setenv(sourceTokensPathKey, "dev/app-deploy-service/source-tokens")
+
+	application := models.Application{Uuid: "app-1", Source: models.Source{Url: "https://github.com/org/repo", AuthToken: "ghp_secret"}}
+	response, err := deployApplication(t.Context(), deps, application, deploymentRequest{Queue: true}.withRef(models.RefTypeBranch, "feature/x"))
+	require.NoError(t, err)
+	assert.True(t, response.Queued)
+
+	require.Len(t, jobs.inserted, 1)
+	environment := jobEnvironment(t, jobs.inserted[0])
+	assert.Equal(t, "feature/x", environment[sourceBranchKey])
+	assert.NotContains(t, environment, sourceTagKey)
+	assert.NotContains(t, environment, sourceCommitKey)
+	// the provisioner resolves, and kaniko clones, a private source with the token, which is not stored with the job
+	assert.NotContains(t, environment, sourceAuthTokenKey)
+	assert.NotContains(t, jobs.inserted[0].RunTask, "ghp_secret")
+	require.Len(t, tokens.put, 1)
+	assert.Equal(t, aws.ToString(tokens.put[0].Name), environment[sourceTokenParameterKey])
+	assert.Equal(t, "ghp_secret", aws.ToString(tokens.put[0].Value))
+}
+
+// jobEnvironment returns the environment a job's provisioner task is run with
+func jobEnvironment(t *testing.T, job store_dynamodb.DeploymentJob) map[string]string {
+	t.Helper()
+	var runTask ecs.RunTaskInput
+	require.NoError(t, json.Unmarshal([]byte(job.RunTask), &runTask))
+	environment := map[string]string{}
+	for _, pair := range runTask.Overrides.ContainerOverrides[0].Environment {
+		environment[aws.ToString(pair.Name)] = aws.ToString(pair.Value)
+	}
+	return environment
+}
+
+func TestBuildEnvironment(t *testing.T) {
+	environment, err := buildEnvironment(models.BuildOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, environment)
+
+	environment, err = buildEnvironment(models.BuildOptions{
+		ContextDir: "processors/segmentation",
+		BuildArgs:  map[string]string{"VERSION": "1.0"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []types.KeyValuePair{
+		{Name: aws.String(sourceContextDirKey), Value: aws.String("processors/segmentation")},
+		{Name: aws.String(sourceBuildArgsKey), Value: aws.String(`{"VERSION":"1.0"}`)},
+	}, environment)
+}
+
+func TestBuildSecretsEnvironment(t *testing.T) {
+	environment, err := buildSecretsEnvironment("N:organization:1", nil)
+	require.NoError(t, err)
+	assert.Empty(t, environment)
+
+	secrets := []models.BuildSecret{{Name: "PIP_INDEX_URL", Store: models.BuildSecretStoreSSM, Secret: "pypi/index-url"}}
+	t.Setenv(buildSecretsPathKey, "")
+	_, err = buildSecretsEnvironment("N:organization:1", secrets)
+	assert.ErrorIs(t, err, ErrConfig)
+
+	t.Setenv(buildSecretsPathKey, "dev/app-deploy-service/build-secrets")
+	environment, err = buildSecretsEnvironment("N:organization:1", secrets)
+	require.NoError(t, err)
+	assert.Equal(t, []types.KeyValuePair{{
+		Name:  aws.String(sourceBuildSecretsKey),
+		Value: aws.String(`[{"name":"PIP_INDEX_URL","store":"ssm","path":"dev/app-deploy-service/build-secrets/N:organization:1/pypi/index-url"}]`),
+	}}, environment)
+}
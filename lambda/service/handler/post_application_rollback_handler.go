@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/google/uuid"
+	"github.com/pennsieve/app-deploy-service/service/mappers"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/service/validation"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+)
+
+// rollbackAction is the deployment action, and provisioner ACTION, of a rollback
+const rollbackAction = "ROLLBACK"
+
+func PostApplicationRollbackHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	// same role as starting a deployment
+	return newHandler("PostApplicationRollbackHandler", postApplicationRollback, RequireOrgRole(role.Viewer), Idempotent())(ctx, request)
+}
+
+// postApplicationRollback starts a ROLLBACK deployment, which points the application's task definition at the image
+// an earlier deployment built. The provisioner does the work in the application's account; nothing is rebuilt.
+func postApplicationRollback(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	applicationUuid := request.PathParameters["id"]
+	if len(applicationUuid) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: id", ErrMissingPathParams)
+	}
+	queue, err := deploymentQueueParam(request.QueryStringParameters)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	var rollback models.RollbackRequest
+	if strings.TrimSpace(request.Body) != "" {
+		if err := json.Unmarshal([]byte(request.Body), &rollback); err != nil {
+			return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+		}
+	}
+
+	organizationId := deps.Claims.OrgClaim.NodeId
+	userId := deps.Claims.UserClaim.NodeId
+
+	application, err := deps.Applications.GetById(ctx, applicationUuid)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	if application.Uuid == "" {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", applicationUuid, ErrNoRecordsFound)
+	}
+	if application.OrganizationId != organizationId {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("user not permitted to roll back application %s: %w", applicationUuid, ErrNotPermitted)
+	}
+
+	history, err := deps.Deployments.List(ctx, applicationUuid, store_dynamodb.DeploymentQuery{Descending: true})
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+	target, err := rollbackTarget(history.Deployments, rollback.DeploymentId)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	deploymentId := uuid.NewString()
+	runTaskIn, err := deploymentTaskInput(mappers.StoreToModel(application), deploymentRequest{
+		OrganizationId: organizationId,
+		UserId:         userId,
+	}, rollbackAction, deploymentId,
+		types.KeyValuePair{Name: aws.String("ROLLBACK_OF"), Value: aws.String(target.DeploymentId)},
+		types.KeyValuePair{Name: aws.String("IMAGE_TAG"), Value: aws.String(target.ImageTag)},
+		types.KeyValuePair{Name: aws.String("IMAGE_DIGEST"), Value: aws.String(target.ImageDigest)},
+	)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	leased, err := acquireDeploymentLease(ctx, deps, applicationUuid, deploymentId, queue)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	statusManager := NewStatusManager(deps.HandlerName, deps.Applications, applicationUuid).
+		WithDeployment(deps.Deployments, deploymentId).
+		WithPusher(deps.PusherClient(ctx))
+
+	if err := statusManager.NewDeployment(ctx, store_dynamodb.Deployment{
+		DeploymentKey: store_dynamodb.DeploymentKey{
+			DeploymentId:  deploymentId,
+			ApplicationId: applicationUuid,
+		},
+		InitiatedAt:     time.Now().UTC(),
+		WorkspaceNodeId: organizationId,
+		UserNodeId:      userId,
+		Action:          rollbackAction,
+		LastStatus:      initialDeploymentStatus(leased),
+		ImageTag:        target.ImageTag,
+		ImageDigest:     target.ImageDigest,
+		RollbackOf:      target.DeploymentId,
+		// nothing is built, so the rollback runs the commit the target built
+		CommitSha:      target.CommitSha,
+		ImageSizeBytes: target.ImageSizeBytes,
+	}); err != nil {
+		if leased {
+			releaseDeploymentLease(ctx, deps, applicationUuid, deploymentId)
+		}
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrStoringDeployment, err)
+	}
+
+	job := newDeploymentJob(rollbackAction, applicationUuid, deploymentId, application.ComputeNodeUuid)
+	queued, err := startDeployment(ctx, deps, statusManager, job, runTaskIn, leased)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	if queued {
+		return jsonResponse(http.StatusAccepted, models.RollbackResponse{DeploymentId: deploymentId, RollbackOf: target.DeploymentId, Queued: true})
+	}
+	deps.Logger.Info("started rollback of application",
+		slog.String("deploymentId", deploymentId),
+		slog.String("applicationId", applicationUuid),
+		slog.String("rollbackOf", target.DeploymentId),
+		slog.String("imageTag", target.ImageTag),
+		slog.String("jobId", job.JobId))
+
+	return jsonResponse(http.StatusAccepted, models.RollbackResponse{DeploymentId: deploymentId, RollbackOf: target.DeploymentId})
+}
+
+// rollbackTarget picks the deployment to roll back to from history, newest first. A requested deployment must have
+// succeeded; one that was itself a rollback stands for the deployment it restored. Without a request, the target is
+// the newest successful build older than the one whose image is running now.
+func rollbackTarget(history []store_dynamodb.Deployment, requested string) (store_dynamodb.Deployment, error) {
+	byId := func(id string) int {
+		return slices.IndexFunc(history, func(d store_dynamodb.Deployment) bool { return d.DeploymentId == id })
+	}
+
+	if requested != "" {
+		i := byId(requested)
+		if i < 0 {
+			return store_dynamodb.Deployment{}, fmt.Errorf("deployment %s: %w", requested, ErrNoRecordsFound)
+		}
+		if !history[i].Succeeded() {
+			return store_dynamodb.Deployment{}, NewValidationError(models.FieldError{
+				Field: "deploymentId", Code: validation.CodeInvalid, Message: "deployment did not finish successfully with an image",
+			})
+		}
+		if j := byId(history[i].RollbackOf); history[i].RollbackOf != "" && j >= 0 {
+			return history[j], nil
+		}
+		return history[i], nil
+	}
+
+	current := slices.IndexFunc(history, store_dynamodb.Deployment.Succeeded)
+	if current < 0 {
+		return store_dynamodb.Deployment{}, ErrNoRollbackTarget
+	}
+	running := history[current]
+	if j := byId(running.RollbackOf); running.RollbackOf != "" && j >= 0 {
+		running = history[j]
+	}
+	for _, d := range history {
+		if d.Succeeded() && d.RollbackOf == "" && d.InitiatedAt.Before(running.InitiatedAt) && d.ImageTag != running.ImageTag {
+			return d, nil
+		}
+	}
+	return store_dynamodb.Deployment{}, ErrNoRollbackTarget
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// historyDeploymentsTable answers every query with the same deployments.
+type historyDeploymentsTable struct {
+	fakeDeploymentsTable
+	history []store_dynamodb.Deployment
+}
+
+func (f *historyDeploymentsTable) Query(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	out := &dynamodb.QueryOutput{}
+	for _, d := range f.history {
+		item, err := attributevalue.MarshalMap(d)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+// builtDeployment returns a successful deployment initiated daysAgo days ago.
+func builtDeployment(id string, daysAgo int) store_dynamodb.Deployment {
+	return store_dynamodb.Deployment{
+		DeploymentKey: store_dynamodb.DeploymentKey{ApplicationId: "app-1", DeploymentId: id},
+		InitiatedAt:   time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -daysAgo),
+		Action:        "DEPLOY",
+		LastStatus:    store_dynamodb.DeploymentStatusStopped,
+		ImageTag:      "deployment-" + id,
+	}
+}
+
+func TestRollbackTargetDefaultsToPreviousBuild(t *testing.T) {
+	failed := builtDeployment("failed", 1)
+	failed.Errored = true
+	history := []store_dynamodb.Deployment{failed, builtDeployment("current", 2), builtDeployment("previous", 3)}
+
+	target, err := rollbackTarget(history, "")
+	require.NoError(t, err)
+	assert.Equal(t, "previous", target.DeploymentId)
+}
+
+func TestRollbackTargetAfterRollback(t *testing.T) {
+	rollback := builtDeployment("rollback", 0)
+	rollback.Action = rollbackAction
+	rollback.ImageTag = "deployment-previous"
+	rollback.RollbackOf = "previous"
+	history := []store_dynamodb.Deployment{rollback, builtDeployment("current", 2), builtDeployment("previous", 3), builtDeployment("oldest", 4)}
+
+	// rolling back again goes one build further back, not forward to the image that was rolled back from
+	target, err := rollbackTarget(history, "")
+	require.NoError(t, err)
+	assert.Equal(t, "oldest", target.DeploymentId)
+
+	// a rollback deployment stands for the build it restored
+	target, err = rollbackTarget(history, "rollback")
+	require.NoError(t, err)
+	assert.Equal(t, "previous", target.DeploymentId)
+}
+
+func TestRollbackTargetRequested(t *testing.T) {
+	cancelled := builtDeployment("cancelled", 3)
+	cancelled.Cancelled = true
+	history := []store_dynamodb.Deployment{builtDeployment("current", 1), builtDeployment("older", 2), cancelled}
+
+	target, err := rollbackTarget(history, "older")
+	require.NoError(t, err)
+	assert.Equal(t, "older", target.DeploymentId)
+
+	_, err = rollbackTarget(history, "cancelled")
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "deploymentId", validationErr.Fields[0].Field)
+
+	_, err = rollbackTarget(history, "unknown")
+	assert.ErrorIs(t, err, ErrNoRecordsFound)
+}
+
+func TestRollbackTargetNone(t *testing.T) {
+	_, err := rollbackTarget([]store_dynamodb.Deployment{builtDeployment("only", 1)}, "")
+	assert.ErrorIs(t, err, ErrNoRollbackTarget)
+
+	_, err = rollbackTarget(nil, "")
+	assert.ErrorIs(t, err, ErrNoRollbackTarget)
+}
+
+func newRollbackTestContext(history []store_dynamodb.Deployment) context.Context {
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Applications = newPatchTestStore()
+	deps.Deployments = store_dynamodb.NewDeploymentsStore(&historyDeploymentsTable{history: history}, "deployments")
+	return WithDependencies(context.Background(), deps)
+}
+
+func TestPostApplicationRollbackWithoutTarget(t *testing.T) {
+	ctx := newRollbackTestContext([]store_dynamodb.Deployment{builtDeployment("only", 1)})
+
+	response, err := PostApplicationRollbackHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"id": "app-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	assertErrorCode(t, response, CodeNoRollbackTarget)
+}
+
+func TestPostApplicationRollbackInvalidTarget(t *testing.T) {
+	running := builtDeployment("running", 0)
+	running.LastStatus = "RUNNING"
+	ctx := newRollbackTestContext([]store_dynamodb.Deployment{running, builtDeployment("current", 1)})
+
+	response, err := PostApplicationRollbackHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"id": "app-1"},
+		Body:           `{"deploymentId": "running"}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assertErrorCode(t, response, CodeValidationFailed)
+}
+
+func TestPostApplicationRollbackOtherWorkspace(t *testing.T) {
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:2", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Applications = newPatchTestStore()
+	ctx := WithDependencies(context.Background(), deps)
+
+	response, err := PostApplicationRollbackHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"id": "app-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+}
+
+func TestPostApplicationRollbackDeploymentInProgress(t *testing.T) {
+	ctx := newRollbackTestContext([]store_dynamodb.Deployment{builtDeployment("current", 1), builtDeployment("previous", 2)})
+	deps, err := dependencies(ctx)
+	require.NoError(t, err)
+	deps.Leases = store_dynamodb.NewDeploymentLeaseStore(&fakeLeaseTable{heldBy: "deploy-0"}, "leases")
+
+	response, err := PostApplicationRollbackHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"id": "app-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	assertErrorCode(t, response, CodeDeploymentInProgress)
+	assert.Equal(t, "deploy-0", decodeErrorResponse(t, response).DeploymentId)
+}
+
+func TestPostApplicationRollbackQueued(t *testing.T) {
+	ctx := newRollbackTestContext([]store_dynamodb.Deployment{builtDeployment("current", 1), builtDeployment("previous", 2)})
+	deps, err := dependencies(ctx)
+	require.NoError(t, err)
+	leases := &fakeLeaseTable{heldBy: "deploy-0"}
+	deps.Leases = store_dynamodb.NewDeploymentLeaseStore(leases, "leases")
+	jobs := &fakeJobsTable{}
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+
+	response, err := PostApplicationRollbackHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters:        map[string]string{"id": "app-1"},
+		QueryStringParameters: map[string]string{"queue": "true"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	var body models.RollbackResponse
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	assert.True(t, body.Queued)
+	assert.Equal(t, "previous", body.RollbackOf)
+	// the failed acquire, then the enqueue
+	require.Len(t, leases.updates, 2)
+	assert.Contains(t, aws.ToString(leases.updates[1].UpdateExpression), "list_append")
+	// the provisioner task waits for the lease as a job
+	require.Len(t, jobs.inserted, 1)
+	assert.Equal(t, store_dynamodb.JobStatusWaiting, jobs.inserted[0].Status)
+	assert.Equal(t, rollbackAction, jobs.inserted[0].Action)
+	assert.Equal(t, body.DeploymentId, jobs.inserted[0].JobId)
+}
+
+func TestPostApplicationRollbackEnvironment(t *testing.T) {
+	ctx := newRollbackTestContext([]store_dynamodb.Deployment{builtDeployment("current", 1), builtDeployment("previous", 2)})
+	deps, err := dependencies(ctx)
+	require.NoError(t, err)
+	store := deps.Applications.(*fakeApplicationsStore)
+	application := store.applications["app-1"]
+	application.Build = &store_dynamodb.BuildOptions{ContextDir: "processors/segmentation"}
+	store.applications["app-1"] = application
+	deps.Leases = store_dynamodb.NewDeploymentLeaseStore(&fakeLeaseTable{heldBy: "deploy-0"}, "leases")
+	jobs := &fakeJobsTable{}
+	deps.Jobs = store_dynamodb.NewDeploymentJobsStore(jobs, "jobs")
+
+	response, err := PostApplicationRollbackHandler(ctx, events.APIGatewayV2HTTPRequest{
+		PathParameters:        map[string]string{"id": "app-1"},
+		QueryStringParameters: map[string]string{"queue": "true"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, response.StatusCode, response.Body)
+
+	require.Len(t, jobs.inserted, 1)
+	environment := jobEnvironment(t, jobs.inserted[0])
+	assert.Equal(t, rollbackAction, environment["ACTION"])
+	assert.Equal(t, "previous", environment["ROLLBACK_OF"])
+	assert.Equal(t, "deployment-previous", environment["IMAGE_TAG"])
+	assert.Equal(t, "N:organization:1", environment["ORG_ID"])
+	// the provisioner finds a monorepo application's resources by its build context directory
+	assert.Equal(t, "processors/segmentation", environment[sourceContextDirKey])
+}
@@ -3,40 +3,37 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/google/uuid"
 	"github.com/pennsieve/app-deploy-service/service/mappers"
 	"github.com/pennsieve/app-deploy-service/service/models"
-	"github.com/pennsieve/app-deploy-service/service/runner"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
-	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/app-deploy-service/service/validation"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
-	"github.com/pusher/pusher-http-go/v5"
 )
 
 func defaultComputeTypes(ct []string) []string {
 	if len(ct) == 0 {
-		return []string{"standard"}
+		return []string{models.ComputeTypeStandard}
 	}
 	return ct
 }
 
 func containsGPU(ct []string) bool {
 	for _, t := range ct {
-		if t == "gpu" {
+		if t == models.ComputeTypeGPU {
 			return true
 		}
 	}
@@ -44,15 +41,33 @@ func containsGPU(ct []string) bool {
 }
 
 func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "PostApplicationsHandler"
+	// Maybe we should check for role.Writer instead here, but I'm not
+	// sure if there is a difference for org roles.
+	// So just making sure the user is not a guest
+	return newHandler("PostApplicationsHandler", postApplications, RequireOrgRole(role.Viewer), Idempotent())(ctx, request)
+}
+
+func postApplications(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
 	var application models.Application
 	if err := json.Unmarshal([]byte(request.Body), &application); err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrUnmarshaling),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+	}
+	if fields := validation.RegisterApplication(application); len(fields) > 0 {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(fields...)
 	}
+	buildEnv, err := buildEnvironment(application.Source.BuildOptions)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	secretsEnv, err := buildSecretsEnvironment(deps.Claims.OrgClaim.NodeId, application.BuildSecrets)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	buildEnv = append(buildEnv, secretsEnv...)
 
 	envValue := os.Getenv("ENV")
 	if application.Env != "" {
@@ -69,31 +84,10 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 	DeployerTaskDefContainerName := os.Getenv("DEPLOYER_TASK_DEF_CONTAINER_NAME")
 	deploymentsTable := os.Getenv(deploymentsTableNameKey)
 
-	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-	// Maybe we should check for role.Writer instead here, but I'm not
-	// sure if there is a difference for org roles.
-	// So just making sure the user is not a guest
-	if !authorizer.HasOrgRole(claims, role.Viewer) {
-		log.Printf("user not permitted to create application with claims: %+v", claims)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusUnauthorized,
-			Body:       handlerError(handlerName, ErrNotPermitted),
-		}, nil
-	}
-	organizationId := claims.OrgClaim.NodeId
-	userId := claims.UserClaim.NodeId
+	organizationId := deps.Claims.OrgClaim.NodeId
+	userId := deps.Claims.UserClaim.NodeId
 
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
-	}
-
-	client := ecs.NewFromConfig(cfg)
-	log.Println("Initiating new Provisioning Fargate Task.")
+	deps.Logger.Info("Initiating new Provisioning Fargate Task.")
 	envKey := "ENV"
 	accountIdKey := "ACCOUNT_ID"
 	accountIdValue := application.Account.AccountId
@@ -149,15 +143,13 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 	memoryKey := "APP_MEMORY"
 	cpuValue := application.RuntimeConfig.CPU
 	memoryValue := application.RuntimeConfig.Memory
-	defaultCPU := 2048
-	defaultMemory := 4096
 
 	if application.RuntimeConfig.CPU == 0 {
-		cpuValue = defaultCPU
+		cpuValue = models.DefaultCPU
 	}
 
 	if application.RuntimeConfig.Memory == 0 {
-		memoryValue = defaultMemory
+		memoryValue = models.DefaultMemory
 	}
 
 	cpuValueStr := strconv.Itoa(cpuValue)
@@ -171,46 +163,25 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 	deploymentId := uuid.NewString()
 
 	// persist to dynamodb
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	applicationsStore := store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, applicationsTable)
-	deploymentsStore := store_dynamodb.NewDeploymentsStore(dynamoDBClient, deploymentsTable)
-
-	statusManager := NewStatusManager(handlerName, applicationsStore, applicationUuid).
-		WithDeployment(deploymentsStore, deploymentId)
-
-	// add pusher to statusManager if possible
-	ssmClient := ssm.NewFromConfig(cfg)
-	if pusherConfig, err := GetPusherConfig(ctx, ssmClient); err != nil {
-		log.Printf("warning: %v\n", err)
-	} else {
-		statusManager = statusManager.WithPusher(&pusher.Client{
-			AppID:   pusherConfig.AppId,
-			Key:     pusherConfig.Key,
-			Secret:  pusherConfig.Secret,
-			Cluster: pusherConfig.Cluster,
-			Secure:  true,
-		})
-	}
+	statusManager := NewStatusManager(deps.HandlerName, deps.Applications, applicationUuid).
+		WithDeployment(deps.Deployments, deploymentId).
+		WithPusher(deps.PusherClient(ctx))
 
 	params := map[string]string{
 		"computeNodeUuid": computeNodeUuidValue,
 		"sourceUrl":       sourceUrlValue,
 	}
 
-	applications, err := applicationsStore.Get(ctx, organizationId, params)
+	applications, err := deps.Applications.Get(ctx, organizationId, params)
 	if err != nil {
-		log.Println(err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
 	}
-	if len(applications) > 0 {
-		log.Println(err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 409,
-			Body:       handlerError(handlerName, ErrRecordExists),
-		}, nil
+	// a monorepo holds an application per build context directory
+	for _, existing := range applications {
+		if existing.Build.GetContextDir() == application.Source.ContextDir {
+			return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application for compute node %s and source %s: %w",
+				computeNodeUuidValue, path.Join(sourceUrlValue, application.Source.ContextDir), ErrRecordExists)
+		}
 	}
 
 	store_applications := store_dynamodb.Application{
@@ -225,6 +196,7 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 		ComputeNodeEfsId: computeNodeEfsIdValue,
 		SourceType:       sourceTypeValue,
 		SourceUrl:        sourceUrlValue,
+		Build:            mappers.BuildOptionsToStore(application.Source.BuildOptions),
 		DestinationType:  "ecr",
 		DestinationUrl:   destinationUrlValue,
 		CPU:              cpuValue,
@@ -238,14 +210,11 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 		Params:           application.Params,
 		CommandArguments: application.CommandArguments,
 		Status:           "registering",
+		AutoDeploy:       mappers.AutoDeployToStore(application.AutoDeploy),
+		BuildSecrets:     mappers.BuildSecretsToStore(application.BuildSecrets),
 	}
-	err = statusManager.NewApplication(ctx, store_applications)
-	if err != nil {
-		log.Println("error inserting application: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrStoringApplication),
-		}, nil
+	if err := statusManager.NewApplication(ctx, store_applications); err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrStoringApplication, err)
 	}
 
 	if err := statusManager.NewDeployment(ctx, store_dynamodb.Deployment{
@@ -259,11 +228,7 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 		Action:          actionValue,
 		LastStatus:      "NOT_STARTED",
 	}); err != nil {
-		log.Println("error inserting deployment: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrStoringDeployment),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrStoringDeployment, err)
 	}
 
 	environment := []types.KeyValuePair{
@@ -384,6 +349,8 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 			Value: &accountsTableValue,
 		},
 	}
+	environment = append(environment, sourceAuthEnvironment(application.Source.AuthToken)...)
+	environment = append(environment, buildEnv...)
 
 	runTaskIn := &ecs.RunTaskInput{
 		TaskDefinition: aws.String(TaskDefinitionArn),
@@ -404,49 +371,27 @@ func PostApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTT
 			},
 		},
 		LaunchType: types.LaunchTypeFargate,
+		// Lets the deployment be cancelled while the provisioner is still running
+		Tags: []types.Tag{
+			{Key: aws.String(deploymentIdTag), Value: aws.String(deploymentId)},
+			{Key: aws.String(applicationIdTag), Value: aws.String(applicationUuid)},
+		},
 	}
 
-	taskRunner := runner.NewECSTaskRunner(client, runTaskIn)
-	runTaskOut, err := taskRunner.Run(ctx)
-	if err != nil {
-		log.Println(err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
-	}
-	if err := runner.GetRunFailures(runTaskOut); err != nil {
-		log.Println(err)
-		// assuming here that if there were failures, then no tasks started.
-		// seems safe since for now we are only starting one task
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
-	}
-	// we expect one task
-	if len(runTaskOut.Tasks) > 0 {
-		log.Printf("started provisioning and deployment %s of application %s from %s in task %s",
-			deploymentId,
-			applicationUuid,
-			sourceUrlValue,
-			aws.ToString(runTaskOut.Tasks[0].TaskArn))
+	statusManager.StartStep(ctx, store_dynamodb.StepProvisioning)
+	job := newDeploymentJob(actionValue, applicationUuid, deploymentId, computeNodeUuidValue)
+	if err := queueProvisionerTask(ctx, deps, job, runTaskIn); err != nil {
+		deps.Logger.Error("error queueing task", slog.Any("error", err))
+		return events.APIGatewayV2HTTPResponse{}, statusManager.SetErrorStatus(ctx, ErrQueueingTask)
 	}
+	deps.Logger.Info("queued provisioning and deployment of application",
+		slog.String("deploymentId", deploymentId),
+		slog.String("applicationId", applicationUuid),
+		slog.String("sourceUrl", sourceUrlValue),
+		slog.String("jobId", job.JobId))
 
-	m, err := json.Marshal(models.RegisterApplicationResponse{
+	return jsonResponse(http.StatusAccepted, models.RegisterApplicationResponse{
 		Application:  mappers.StoreToModel(store_applications),
 		DeploymentId: deploymentId,
 	})
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       handlerError(handlerName, ErrRunningFargateTask),
-		}, nil
-	}
-
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusAccepted,
-		Body:       string(m),
-	}, nil
 }
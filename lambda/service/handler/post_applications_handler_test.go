@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/stretchr/testify/assert"
+)
+
+// The dependencies below have no stores, so these handlers would panic if validation let the request
+// through to DynamoDB or ECS.
+func TestInvalidApplicationIsRejectedBeforeStoring(t *testing.T) {
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	ctx := WithDependencies(context.Background(), deps)
+
+	body := `{"source":{"url":"github.com/org/repo"},"account":{"accountId":"42"},"runtimeConfig":{"cpu":256,"memory":8192}}`
+	handlers := map[string]RouterHandlerFunc{
+		"PostApplicationsHandler":      PostApplicationsHandler,
+		"PostApplicationDeployHandler": PostApplicationDeployHandler,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			response, err := handler(ctx, events.APIGatewayV2HTTPRequest{Body: body})
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+			errorBody := decodeErrorResponse(t, response)
+			assert.Equal(t, CodeValidationFailed, errorBody.Code)
+			fields := map[string]bool{}
+			for _, f := range errorBody.Details {
+				fields[f.Field] = true
+			}
+			assert.True(t, fields["source.url"])
+			assert.True(t, fields["account.accountId"])
+			assert.True(t, fields["runtimeConfig"])
+		})
+	}
+}
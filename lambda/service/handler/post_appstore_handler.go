@@ -1,10 +1,11 @@
 package handler
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -12,31 +13,56 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/google/uuid"
+	"github.com/pennsieve/app-deploy-service/service/mappers"
 	"github.com/pennsieve/app-deploy-service/service/models"
-	"github.com/pennsieve/app-deploy-service/service/runner"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/service/validation"
 	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
-	"github.com/pusher/pusher-http-go/v5"
 )
 
 func PostAppStoreHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "PostAppStoreHandler"
+	return newHandler("PostAppStoreHandler", postAppStore, Idempotent())(ctx, request)
+}
+
+func postAppStore(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
 	var application models.AppStoreDeployment
 	if err := json.Unmarshal([]byte(request.Body), &application); err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrUnmarshaling),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
+	}
+	if fields := validation.AppStoreDeployment(application); len(fields) > 0 {
+		return events.APIGatewayV2HTTPResponse{}, NewValidationError(fields...)
+	}
+
+	var userId string
+	if deps.Claims != nil {
+		if !authorizer.HasOrgRole(deps.Claims, role.Viewer) {
+			return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("user not permitted to add to appstore: %w", ErrNotPermitted)
+		}
+		userId = deps.Claims.UserClaim.NodeId
+	} else {
+		deps.Logger.Info("direct invocation detected, skipping authorization")
+		userId = application.Source.Owner
 	}
 
+	response, err := publishToAppStore(ctx, deps, application, userId)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	return jsonResponse(http.StatusAccepted, response)
+}
+
+// publishToAppStore adds the release of application.Source.Tag, or of its ref if one is set, to the appstore,
+// creating the appstore application for its source URL, owned by userId, if there is none, and queues the
+// provisioner task that builds it.
+func publishToAppStore(ctx context.Context, deps *Dependencies, application models.AppStoreDeployment, userId string) (models.DeployApplicationResponse, error) {
 	envValue := os.Getenv("ENV")
 
 	TaskDefinitionArn := os.Getenv("TASK_DEF_ARN")
@@ -48,56 +74,33 @@ func PostAppStoreHandler(ctx context.Context, request events.APIGatewayV2HTTPReq
 	TaskDefContainerName := os.Getenv("TASK_DEF_CONTAINER_NAME")
 	DeployerTaskDefContainerName := os.Getenv("DEPLOYER_TASK_DEF_CONTAINER_NAME")
 	deploymentsTable := os.Getenv(deploymentsTableNameKey)
-	applicationsTable := os.Getenv(appstoreApplicationsTableNameKey)
 	versionsTable := os.Getenv(appstoreVersionsTableNameKey)
 	deploymentId := uuid.NewString()
 	actionKey := "ACTION"
 	actionValue := "ADD_TO_APPSTORE"
 
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
-	}
+	appStoreStore := deps.AppStore
+	versionStore := deps.AppStoreVersions
 
-	var userId string
-	if request.RequestContext.Authorizer != nil && request.RequestContext.Authorizer.Lambda != nil {
-		claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
-		if !authorizer.HasOrgRole(claims, role.Viewer) {
-			log.Printf("user not permitted to add to appstore with claims: %+v", claims)
-			return events.APIGatewayV2HTTPResponse{
-				StatusCode: http.StatusUnauthorized,
-				Body:       handlerError(handlerName, ErrNotPermitted),
-			}, nil
-		}
-		userId = claims.UserClaim.NodeId
-	} else {
-		log.Println("direct invocation detected, skipping authorization")
-		userId = application.Source.Owner
+	buildEnv, err := buildEnvironment(application.Source.BuildOptions)
+	if err != nil {
+		return models.DeployApplicationResponse{}, err
 	}
 
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	appStoreStore := store_dynamodb.NewAppStoreDatabaseStore(dynamoDBClient, applicationsTable)
-	versionStore := store_dynamodb.NewAppStoreVersionDatabaseStore(dynamoDBClient, versionsTable)
-	deploymentsStore := store_dynamodb.NewDeploymentsStore(dynamoDBClient, deploymentsTable)
-
-	// Check if app exists by sourceUrl; create if not
+	// Check if app exists by sourceUrl and build context directory; create if not
 	var applicationId string
 	existingApps, err := appStoreStore.GetBySourceUrl(ctx, application.Source.Url)
 	if err != nil {
-		log.Println(err)
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return models.DeployApplicationResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
 	}
+	existingApps = appsInContextDir(existingApps, application.Source.ContextDir)
 
 	if len(existingApps) > 0 {
 		applicationId = existingApps[0].Uuid
-		log.Printf("application %s already exists for sourceUrl %s", applicationId, application.Source.Url)
+		deps.Logger.Info("appstore application already exists",
+			slog.String("applicationId", applicationId),
+			slog.String("sourceUrl", application.Source.Url),
+			slog.String("contextDir", application.Source.ContextDir))
 	} else {
 		applicationId = uuid.NewString()
 		visibility := "public"
@@ -112,17 +115,12 @@ func PostAppStoreHandler(ctx context.Context, request events.APIGatewayV2HTTPReq
 			Visibility: visibility,
 			OwnerId:    userId,
 			CreatedAt:  time.Now().UTC().String(),
+			Build:      mappers.BuildOptionsToStore(application.Source.BuildOptions),
 		}
 		if err := appStoreStore.Insert(ctx, appRecord); err != nil {
-			log.Println("error inserting appstore application: ", err.Error())
-			return events.APIGatewayV2HTTPResponse{
-				StatusCode: http.StatusInternalServerError,
-				Body:       handlerError(handlerName, ErrStoringApplication),
-			}, nil
+			return models.DeployApplicationResponse{}, fmt.Errorf("%w: error inserting appstore application: %w", ErrStoringApplication, err)
 		}
 
-		appAccessTable := os.Getenv(appAccessTableNameKey)
-		appAccessStore := store_dynamodb.NewAppAccessDatabaseStore(dynamoDBClient, appAccessTable)
 		ownerAccess := store_dynamodb.AppAccess{
 			EntityId:    fmt.Sprintf("user#%s", userId),
 			AppId:       fmt.Sprintf("app#%s", applicationId),
@@ -133,50 +131,43 @@ func PostAppStoreHandler(ctx context.Context, request events.APIGatewayV2HTTPReq
 			GrantedAt:   time.Now().UTC().String(),
 			GrantedBy:   userId,
 		}
-		if err := appAccessStore.Insert(ctx, ownerAccess); err != nil {
-			log.Println("error inserting owner access: ", err.Error())
+		if err := deps.AppAccess.Insert(ctx, ownerAccess); err != nil {
+			deps.Logger.Warn("error inserting owner access", slog.Any("error", err))
 		}
 
-		log.Printf("created new appstore application %s for sourceUrl %s", applicationId, application.Source.Url)
+		deps.Logger.Info("created new appstore application",
+			slog.String("applicationId", applicationId),
+			slog.String("sourceUrl", application.Source.Url),
+			slog.String("contextDir", application.Source.ContextDir))
+	}
+
+	// a branch or commit is published as a version named after it
+	refType, ref := models.RefTypeTag, application.Source.Tag
+	if application.Source.Ref != "" {
+		refType, ref = cmp.Or(application.Source.RefType, models.RefTypeTag), application.Source.Ref
 	}
+	tag, branch, commit := splitRef(refType, ref)
 
 	// Always create a new version entry
 	versionUuid := uuid.NewString()
 	versionRecord := store_dynamodb.AppStoreVersion{
 		Uuid:          versionUuid,
 		ApplicationId: applicationId,
-		Version:       application.Source.Tag,
+		Version:       ref,
 		ReleaseId:     application.Release.ID,
 		CreatedAt:     time.Now().UTC().String(),
 		Status:        "registering",
 	}
 	if err := versionStore.Insert(ctx, versionRecord); err != nil {
-		log.Println("error inserting appstore version: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrStoringApplication),
-		}, nil
+		return models.DeployApplicationResponse{}, fmt.Errorf("%w: error inserting appstore version: %w", ErrStoringApplication, err)
 	}
 
-	syncRepoContent(ctx, application.Source.Url, application.Source.Tag, application.Source.AuthToken)
+	syncRepoContent(ctx, application.Source.SourceType, application.Source.Url, application.Source.ContextDir, ref, application.Source.AuthToken)
 
 	// StatusManager uses the version store for status updates (keyed by versionUuid)
-	statusManager := NewAppStoreStatusManager(handlerName, versionStore, versionUuid).
-		WithDeployment(deploymentsStore, deploymentId)
-
-	// Add pusher for real-time updates
-	ssmClient := ssm.NewFromConfig(cfg)
-	if pusherConfig, err := GetPusherConfig(ctx, ssmClient); err != nil {
-		log.Printf("warning: %v\n", err)
-	} else {
-		statusManager = statusManager.WithPusher(&pusher.Client{
-			AppID:   pusherConfig.AppId,
-			Key:     pusherConfig.Key,
-			Secret:  pusherConfig.Secret,
-			Cluster: pusherConfig.Cluster,
-			Secure:  true,
-		})
-	}
+	statusManager := NewAppStoreStatusManager(deps.HandlerName, versionStore, versionUuid).
+		WithDeployment(deps.Deployments, deploymentId).
+		WithPusher(deps.PusherClient(ctx))
 
 	// Create deployment record (applicationId = versionUuid for tracking)
 	if err := statusManager.NewDeployment(ctx, store_dynamodb.Deployment{
@@ -191,23 +182,18 @@ func PostAppStoreHandler(ctx context.Context, request events.APIGatewayV2HTTPReq
 		Action:          actionValue,
 		LastStatus:      "NOT_STARTED",
 		SourceUrl:       application.Source.Url,
-		Tag:             application.Source.Tag,
+		Tag:             tag,
+		Branch:          branch,
+		CommitSha:       commit,
 	}); err != nil {
-		log.Println("error creating deployment record: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrStoringDeployment),
-		}, nil
+		return models.DeployApplicationResponse{}, fmt.Errorf("%w: %w", ErrStoringDeployment, err)
 	}
 
-	log.Println("Initiating new AppStore Fargate Task.")
-	client := ecs.NewFromConfig(cfg)
+	deps.Logger.Info("Initiating new AppStore Fargate Task.")
 	envKey := "ENV"
 
 	sourceTypeKey := "SOURCE_TYPE"
 	sourceTypeValue := application.Source.SourceType
-	sourceTagKey := "SOURCE_TAG"
-	sourceTagValue := application.Source.Tag
 	sourceUrlKey := "SOURCE_URL"
 	sourceUrlValue := application.Source.Url
 
@@ -264,10 +250,6 @@ func PostAppStoreHandler(ctx context.Context, request events.APIGatewayV2HTTPReq
 							Name:  &sourceUrlKey,
 							Value: &sourceUrlValue,
 						},
-						{
-							Name:  &sourceTagKey,
-							Value: &sourceTagValue,
-						},
 						{
 							Name:  &deployerTaskDefnKey,
 							Value: &deployerTaskDefnValue,
@@ -314,42 +296,36 @@ func PostAppStoreHandler(ctx context.Context, request events.APIGatewayV2HTTPReq
 		},
 	}
 
-	taskRunner := runner.NewECSTaskRunner(client, runTaskIn)
-	runTaskOut, err := taskRunner.Run(ctx)
-	if err != nil {
-		log.Println("error running task: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
-	}
-	if err := runner.GetRunFailures(runTaskOut); err != nil {
-		log.Println("run failures from task: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       statusManager.SetErrorStatus(ctx, ErrRunningFargateTask),
-		}, nil
-	}
-	if len(runTaskOut.Tasks) > 0 {
-		log.Printf("started Add to AppStore deployment %s of version %s (tag %s) from %s in task %s",
-			deploymentId,
-			versionUuid,
-			application.Source.Tag,
-			application.Source.Url,
-			aws.ToString(runTaskOut.Tasks[0].TaskArn))
-	}
+	overrides := &runTaskIn.Overrides.ContainerOverrides[0]
+	overrides.Environment = append(overrides.Environment, sourceRefEnvironment(tag, branch, commit)...)
+	overrides.Environment = append(overrides.Environment, buildEnv...)
 
-	m, err := json.Marshal(models.DeployApplicationResponse{DeploymentId: deploymentId})
-	if err != nil {
-		log.Println("error marshalling response: ", err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 500,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
+	statusManager.StartStep(ctx, store_dynamodb.StepProvisioning)
+	job := newDeploymentJob(actionValue, versionUuid, deploymentId, appstoreIdentifier)
+	if err := queueProvisionerTask(ctx, deps, job, runTaskIn); err != nil {
+		deps.Logger.Error("error queueing task", slog.Any("error", err))
+		return models.DeployApplicationResponse{}, statusManager.SetErrorStatus(ctx, ErrQueueingTask)
 	}
+	deps.Logger.Info("queued Add to AppStore deployment",
+		slog.String("deploymentId", deploymentId),
+		slog.String("versionId", versionUuid),
+		slog.String("refType", refType),
+		slog.String("ref", ref),
+		slog.String("sourceUrl", application.Source.Url),
+		slog.String("contextDir", application.Source.ContextDir),
+		slog.String("jobId", job.JobId))
 
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusAccepted,
-		Body:       string(m),
-	}, nil
+	return models.DeployApplicationResponse{DeploymentId: deploymentId}, nil
+}
+
+// appsInContextDir returns the appstore applications built from contextDir of their repository. A monorepo holds
+// an appstore application for each of its build context directories.
+func appsInContextDir(apps []store_dynamodb.AppStoreApplication, contextDir string) []store_dynamodb.AppStoreApplication {
+	var filtered []store_dynamodb.AppStoreApplication
+	for _, app := range apps {
+		if app.Build.GetContextDir() == contextDir {
+			filtered = append(filtered, app)
+		}
+	}
+	return filtered
 }
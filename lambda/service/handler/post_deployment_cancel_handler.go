@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/app-deploy-service/service/mappers"
+	"github.com/pennsieve/app-deploy-service/service/runner"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+)
+
+func PostDeploymentCancelHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	// same role as starting a deployment
+	return newHandler("PostDeploymentCancelHandler", postDeploymentCancel, RequireOrgRole(role.Viewer))(ctx, request)
+}
+
+// postDeploymentCancel records the deployment as cancelled, then stops its provisioner and deployer tasks. The
+// record is written first so that a deployer task that stops in the meantime is not reported as deployed.
+// Cancelling an already cancelled deployment returns it unchanged.
+func postDeploymentCancel(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	expectedOrganizationId := deps.Claims.OrgClaim.NodeId
+
+	if len(os.Getenv(deploymentsTableNameKey)) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("missing deployments table env var value: %w", ErrConfig)
+	}
+	cluster := os.Getenv("CLUSTER_ARN")
+	if len(cluster) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("missing cluster env var value: %w", ErrConfig)
+	}
+
+	applicationId := request.PathParameters["id"]
+	if len(applicationId) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: id", ErrMissingPathParams)
+	}
+	deploymentId := request.PathParameters["deploymentId"]
+	if len(deploymentId) == 0 {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: deploymentId", ErrMissingPathParams)
+	}
+
+	deploymentItem, err := deps.Deployments.Get(ctx, applicationId, deploymentId)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: error getting deployment %s: %w", ErrDynamoDB, deploymentId, err)
+	}
+	if deploymentItem == nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("deployment %s: %w", deploymentId, ErrNoRecordsFound)
+	}
+	// unlike viewing, appstore deployments cannot be cancelled from a workspace
+	if deploymentItem.WorkspaceNodeId != expectedOrganizationId {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("user not permitted to cancel deployment: %w", ErrNotPermitted)
+	}
+	if deploymentItem.Cancelled {
+		return jsonResponse(http.StatusOK, mappers.DeploymentItemToModel(*deploymentItem))
+	}
+
+	cancelled, err := deps.Deployments.Cancel(ctx, applicationId, deploymentId, deps.Claims.UserClaim.NodeId, time.Now())
+	if errors.Is(err, store_dynamodb.ErrDeploymentFinished) {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("cannot cancel deployment %s: %w", deploymentId, ErrDeploymentFinished)
+	}
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+	}
+
+	statusManager := NewStatusManager(deps.HandlerName, deps.Applications, applicationId).
+		WithDeployment(deps.Deployments, deploymentId).
+		WithPusher(deps.PusherClient(ctx))
+
+	// a job the dispatcher has not run yet is stopped from running
+	jobCancelledFrom := ""
+	if deps.Jobs != nil {
+		jobCancelledFrom, err = deps.Jobs.Cancel(ctx, deploymentId, time.Now())
+		if err != nil {
+			return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+		}
+	}
+
+	if deploymentItem.LastStatus == store_dynamodb.DeploymentStatusQueued {
+		// nothing is running yet, and the application's status belongs to the deployment holding the lease
+		if deps.Leases != nil {
+			if _, err := deps.Leases.Dequeue(ctx, applicationId, deploymentId); err != nil {
+				return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
+			}
+		}
+		deps.Logger.Info("cancelled queued deployment",
+			slog.String("deploymentId", deploymentId),
+			slog.String("applicationId", applicationId))
+		statusManager.EndStep(ctx, store_dynamodb.StepDone, store_dynamodb.StepCancelled)
+		return jsonResponse(http.StatusAccepted, mappers.DeploymentItemToModel(cancelled))
+	}
+	if jobCancelledFrom == store_dynamodb.JobStatusPending && deps.Leases != nil {
+		// no provisioner task will stop to release the lease
+		releaseDeploymentLease(ctx, deps, applicationId, deploymentId)
+	}
+
+	taskArns, err := runner.TaggedTasks(ctx, deps.ECSTasks, cluster, deploymentIdTag, deploymentId)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrStoppingFargateTask, err)
+	}
+	if err := runner.StopTasks(ctx, deps.ECSTasks, cluster, taskArns, deploymentCancelledReason); err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrStoppingFargateTask, err)
+	}
+	deps.Logger.Info("cancelled deployment",
+		slog.String("deploymentId", deploymentId),
+		slog.String("applicationId", applicationId),
+		slog.Any("stoppedTasks", taskArns))
+
+	statusManager.UpdateApplicationStatus(ctx, applicationId, deploymentStatusCancelled)
+	// the status listener also records this when the deployer task stops, but there may not be one yet
+	statusManager.EndStep(ctx, store_dynamodb.StepDone, store_dynamodb.StepCancelled)
+
+	return jsonResponse(http.StatusAccepted, mappers.DeploymentItemToModel(cancelled))
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/pgdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeploymentsTable holds a single deployment and applies Cancel's condition to it.
+type fakeDeploymentsTable struct {
+	deployment *store_dynamodb.Deployment
+}
+
+func (f *fakeDeploymentsTable) PutItem(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDeploymentsTable) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if f.deployment == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	item, err := attributevalue.MarshalMap(f.deployment)
+	return &dynamodb.GetItemOutput{Item: item}, err
+}
+
+func (f *fakeDeploymentsTable) UpdateItem(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if f.deployment == nil || f.deployment.Cancelled || f.deployment.LastStatus == store_dynamodb.DeploymentStatusStopped {
+		return nil, &dynamodbTypes.ConditionalCheckFailedException{Message: aws.String("failed")}
+	}
+	now := time.Now().UTC()
+	f.deployment.Cancelled = true
+	f.deployment.CancelledAt = &now
+	f.deployment.CancelledBy = "N:user:1"
+	item, err := attributevalue.MarshalMap(f.deployment)
+	return &dynamodb.UpdateItemOutput{Attributes: item}, err
+}
+
+func (f *fakeDeploymentsTable) Query(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return &dynamodb.QueryOutput{}, nil
+}
+
+// fakeECSTasks runs tasks tagged with the given deployment ids and records which were stopped.
+type fakeECSTasks struct {
+	tasks   map[string]string
+	stopped map[string]string
+}
+
+func (f *fakeECSTasks) ListTasks(_ context.Context, _ *ecs.ListTasksInput, _ ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+	out := &ecs.ListTasksOutput{}
+	for arn := range f.tasks {
+		out.TaskArns = append(out.TaskArns, arn)
+	}
+	return out, nil
+}
+
+func (f *fakeECSTasks) DescribeTasks(_ context.Context, params *ecs.DescribeTasksInput, _ ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	out := &ecs.DescribeTasksOutput{}
+	for _, arn := range params.Tasks {
+		out.Tasks = append(out.Tasks, ecsTypes.Task{
+			TaskArn: aws.String(arn),
+			Tags:    []ecsTypes.Tag{{Key: aws.String(deploymentIdTag), Value: aws.String(f.tasks[arn])}},
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeECSTasks) StopTask(_ context.Context, params *ecs.StopTaskInput, _ ...func(*ecs.Options)) (*ecs.StopTaskOutput, error) {
+	f.stopped[aws.ToString(params.Task)] = aws.ToString(params.Reason)
+	return &ecs.StopTaskOutput{}, nil
+}
+
+func newCancelTestContext(t *testing.T, deployment *store_dynamodb.Deployment, tasks *fakeECSTasks, applications *fakeApplicationsStore) context.Context {
+	t.Setenv(deploymentsTableNameKey, "deployments")
+	t.Setenv("CLUSTER_ARN", "cluster")
+	deps := newTestDependencies()
+	deps.Claims = newTestClaims("N:user:1", "N:organization:1", nil)
+	deps.Claims.OrgClaim.Role = pgdb.Administer
+	deps.Deployments = store_dynamodb.NewDeploymentsStore(&fakeDeploymentsTable{deployment: deployment}, "deployments")
+	deps.ECSTasks = tasks
+	deps.Applications = applications
+	return WithDependencies(context.Background(), deps)
+}
+
+func cancelRequest() events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{PathParameters: map[string]string{"id": "app-1", "deploymentId": "deploy-1"}}
+}
+
+func runningDeployment() *store_dynamodb.Deployment {
+	return &store_dynamodb.Deployment{
+		DeploymentKey:   store_dynamodb.DeploymentKey{ApplicationId: "app-1", DeploymentId: "deploy-1"},
+		WorkspaceNodeId: "N:organization:1",
+		LastStatus:      "RUNNING",
+	}
+}
+
+func TestPostDeploymentCancelStopsTaggedTasks(t *testing.T) {
+	tasks := &fakeECSTasks{
+		tasks:   map[string]string{"provisioner": "deploy-1", "deployer": "deploy-1", "other": "deploy-2"},
+		stopped: map[string]string{},
+	}
+	applications := &fakeApplicationsStore{}
+	ctx := newCancelTestContext(t, runningDeployment(), tasks, applications)
+
+	response, err := PostDeploymentCancelHandler(ctx, cancelRequest())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.Equal(t, map[string]string{
+		"provisioner": deploymentCancelledReason,
+		"deployer":    deploymentCancelledReason,
+	}, tasks.stopped)
+	assert.Equal(t, deploymentStatusCancelled, applications.statuses["app-1"])
+
+	var body models.Deployment
+	require.NoError(t, json.Unmarshal([]byte(response.Body), &body))
+	assert.True(t, body.Cancelled)
+	assert.Equal(t, "N:user:1", body.CancelledBy)
+}
+
+func TestPostDeploymentCancelQueued(t *testing.T) {
+	deployment := runningDeployment()
+	deployment.LastStatus = store_dynamodb.DeploymentStatusQueued
+	tasks := &fakeECSTasks{tasks: map[string]string{"provisioner": "deploy-0"}, stopped: map[string]string{}}
+	applications := &fakeApplicationsStore{}
+	ctx := newCancelTestContext(t, deployment, tasks, applications)
+	deps, err := dependencies(ctx)
+	require.NoError(t, err)
+	deps.Leases = store_dynamodb.NewDeploymentLeaseStore(&fakeLeaseTable{}, "leases")
+
+	response, err := PostDeploymentCancelHandler(ctx, cancelRequest())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	// the running deployment, and the application's status, are left alone
+	assert.Empty(t, tasks.stopped)
+	assert.NotContains(t, applications.statuses, "app-1")
+}
+
+func TestPostDeploymentCancelAlreadyCancelled(t *testing.T) {
+	deployment := runningDeployment()
+	deployment.Cancelled = true
+	tasks := &fakeECSTasks{tasks: map[string]string{"deployer": "deploy-1"}, stopped: map[string]string{}}
+	ctx := newCancelTestContext(t, deployment, tasks, &fakeApplicationsStore{})
+
+	response, err := PostDeploymentCancelHandler(ctx, cancelRequest())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Empty(t, tasks.stopped)
+}
+
+func TestPostDeploymentCancelFinished(t *testing.T) {
+	deployment := runningDeployment()
+	deployment.LastStatus = store_dynamodb.DeploymentStatusStopped
+	tasks := &fakeECSTasks{stopped: map[string]string{}}
+	ctx := newCancelTestContext(t, deployment, tasks, &fakeApplicationsStore{})
+
+	response, err := PostDeploymentCancelHandler(ctx, cancelRequest())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	assertErrorCode(t, response, CodeDeploymentFinished)
+}
+
+func TestPostDeploymentCancelOtherWorkspace(t *testing.T) {
+	deployment := runningDeployment()
+	deployment.WorkspaceNodeId = "N:organization:2"
+	tasks := &fakeECSTasks{stopped: map[string]string{}}
+	ctx := newCancelTestContext(t, deployment, tasks, &fakeApplicationsStore{})
+
+	response, err := PostDeploymentCancelHandler(ctx, cancelRequest())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Empty(t, tasks.stopped)
+}
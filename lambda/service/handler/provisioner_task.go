@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/service/models"
+)
+
+// deploymentTaskInput returns the input for running the provisioner with action on deployment deploymentId of an
+// application that is already registered. Every such action is given the same environment, so the provisioner
+// names and finds the application's resources the same way whichever one it runs; extra is added for action alone.
+func deploymentTaskInput(application models.Application, req deploymentRequest, action string, deploymentId string, extra ...types.KeyValuePair) (*ecs.RunTaskInput, error) {
+	envValue := os.Getenv("ENV")
+	if application.Env != "" {
+		envValue = application.Env
+	}
+	buildEnv, err := buildEnvironment(application.Source.BuildOptions)
+	if err != nil {
+		return nil, err
+	}
+	secretsEnv, err := buildSecretsEnvironment(application.OrganizationId, application.BuildSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	environment := []types.KeyValuePair{
+		{Name: aws.String("ENV"), Value: aws.String(envValue)},
+		{Name: aws.String(applicationUuidKey), Value: aws.String(application.Uuid)},
+		{Name: aws.String("APPLICATION_NAME"), Value: aws.String(application.Name)},
+		{Name: aws.String("APPLICATION_DESCRIPTION"), Value: aws.String(application.Description)},
+		{Name: aws.String("APPLICATION_TYPE"), Value: aws.String(application.ApplicationType)},
+		{Name: aws.String("ACCOUNT_ID"), Value: aws.String(application.Account.AccountId)},
+		{Name: aws.String("ACCOUNT_UUID"), Value: aws.String(application.Account.Uuid)},
+		{Name: aws.String("ACCOUNT_TYPE"), Value: aws.String(application.Account.AccountType)},
+		{Name: aws.String("ACTION"), Value: aws.String(action)},
+		{Name: aws.String(applicationsTableNameKey), Value: aws.String(os.Getenv(applicationsTableNameKey))},
+		{Name: aws.String("ACCOUNTS_TABLE"), Value: aws.String(os.Getenv("ACCOUNTS_TABLE"))},
+		{Name: aws.String("ORG_ID"), Value: aws.String(req.OrganizationId)},
+		{Name: aws.String("USER_ID"), Value: aws.String(req.UserId)},
+		{Name: aws.String("SOURCE_TYPE"), Value: aws.String(application.Source.SourceType)},
+		{Name: aws.String("SOURCE_URL"), Value: aws.String(application.Source.Url)},
+		{Name: aws.String("DESTINATION_TYPE"), Value: aws.String(application.Destination.DestinationType)},
+		{Name: aws.String("DESTINATION_URL"), Value: aws.String(application.Destination.Url)},
+		{Name: aws.String("COMPUTE_NODE_UUID"), Value: aws.String(application.ComputeNode.Uuid)},
+		{Name: aws.String("COMPUTE_NODE_EFS_ID"), Value: aws.String(application.ComputeNode.EfsId)},
+		{Name: aws.String("DEPLOYER_TASK_DEF_ARN"), Value: aws.String(os.Getenv("DEPLOYER_TASK_DEF_ARN"))},
+		{Name: aws.String("DEPLOYER_TASK_DEF_CONTAINER_NAME"), Value: aws.String(os.Getenv("DEPLOYER_TASK_DEF_CONTAINER_NAME"))},
+		{Name: aws.String("SUBNET_IDS"), Value: aws.String(os.Getenv("SUBNET_IDS"))},
+		{Name: aws.String("CLUSTER_ARN"), Value: aws.String(os.Getenv("CLUSTER_ARN"))},
+		{Name: aws.String("SECURITY_GROUP"), Value: aws.String(os.Getenv("SECURITY_GROUP"))},
+		{Name: aws.String(deploymentIdKey), Value: aws.String(deploymentId)},
+		{Name: aws.String(deploymentsTableNameKey), Value: aws.String(os.Getenv(deploymentsTableNameKey))},
+	}
+	environment = append(environment, sourceRefEnvironment(req.Tag, req.Branch, req.Commit)...)
+	environment = append(environment, sourceAuthEnvironment(application.Source.AuthToken)...)
+	environment = append(environment, buildEnv...)
+	environment = append(environment, secretsEnv...)
+	environment = append(environment, extra...)
+
+	return &ecs.RunTaskInput{
+		TaskDefinition: aws.String(os.Getenv("TASK_DEF_ARN")),
+		Cluster:        aws.String(os.Getenv("CLUSTER_ARN")),
+		NetworkConfiguration: &types.NetworkConfiguration{
+			AwsvpcConfiguration: &types.AwsVpcConfiguration{
+				Subnets:        strings.Split(os.Getenv("SUBNET_IDS"), ","),
+				SecurityGroups: []string{os.Getenv("SECURITY_GROUP")},
+				AssignPublicIp: types.AssignPublicIpEnabled,
+			},
+		},
+		Overrides: &types.TaskOverride{
+			ContainerOverrides: []types.ContainerOverride{
+				{
+					Name:        aws.String(os.Getenv("TASK_DEF_CONTAINER_NAME")),
+					Environment: environment,
+				},
+			},
+		},
+		LaunchType: types.LaunchTypeFargate,
+		// Lets the deployment be cancelled while the provisioner is still running
+		Tags: []types.Tag{
+			{Key: aws.String(deploymentIdTag), Value: aws.String(deploymentId)},
+			{Key: aws.String(applicationIdTag), Value: aws.String(application.Uuid)},
+		},
+	}, nil
+}
@@ -3,81 +3,70 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/pennsieve/app-deploy-service/service/mappers"
 	"github.com/pennsieve/app-deploy-service/service/models"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
 )
 
 func PutApplicationsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	handlerName := "PutApplicationHandler"
+	return newHandler("PutApplicationHandler", putApplication)(ctx, request)
+}
+
+func putApplication(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	deps, err := dependencies(ctx)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
 	uuid := request.PathParameters["id"]
 
 	var updateRequest models.Application
 	if err := json.Unmarshal([]byte(request.Body), &updateRequest); err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrUnmarshaling),
-		}, nil
-	}
-
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrConfig),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrUnmarshaling, err)
 	}
-	dynamoDBClient := dynamodb.NewFromConfig(cfg)
-	applicationsTable := os.Getenv("APPLICATIONS_TABLE")
 
-	dynamoStore := store_dynamodb.NewApplicationDatabaseStore(dynamoDBClient, applicationsTable)
-	application, err := dynamoStore.GetById(ctx, uuid)
+	application, err := deps.Applications.GetById(ctx, uuid)
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrDynamoDB),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrDynamoDB, err)
 	}
 	if application.Uuid == "" {
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusNotFound,
-			Body:       handlerError(handlerName, ErrNoRecordsFound),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", uuid, ErrNoRecordsFound)
 	}
 
-	// update properties of the application
-	application.Params = updateRequest.Params
-
-	// store the application
-	err = dynamoStore.Insert(ctx, application)
+	ifMatch, err := checkIfMatch(request, application.Version)
 	if err != nil {
-		log.Fatal(err.Error())
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("application %s: %w", uuid, err)
 	}
 
-	mapped := mappers.StoreToModel(application)
-
-	update, err := json.Marshal(&mapped)
+	// only params can be replaced; everything else is written back unchanged
+	update := applicationUpdate(application)
+	update.Params = updateRequest.Params
+	updated, err := deps.Applications.Update(ctx, uuid, update, application.Version)
+	if errors.Is(err, store_dynamodb.ErrVersionConflict) {
+		return events.APIGatewayV2HTTPResponse{}, versionConflict("application "+uuid, ifMatch)
+	}
 	if err != nil {
-		log.Println(err.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       handlerError(handlerName, ErrMarshaling),
-		}, nil
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("%w: %w", ErrStoringApplication, err)
 	}
 
-	response := events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusOK,
-		Body:       string(update),
+	response, err := jsonResponse(http.StatusOK, mappers.StoreToModel(updated))
+	return withETag(response, err, updated.Version)
+}
+
+// applicationUpdate returns the changeable attributes of a stored application as they are.
+func applicationUpdate(a store_dynamodb.Application) store_dynamodb.ApplicationUpdate {
+	return store_dynamodb.ApplicationUpdate{
+		Name:             a.Name,
+		Description:      a.Description,
+		Params:           a.Params,
+		CommandArguments: a.CommandArguments,
+		CPU:              a.CPU,
+		Memory:           a.Memory,
+		RunOnGPU:         a.RunOnGPU,
+		ComputeTypes:     a.ComputeTypes,
 	}
-	return response, nil
 }
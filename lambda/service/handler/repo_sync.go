@@ -2,14 +2,14 @@ package handler
 
 import (
 	"context"
-	"fmt"
+	"encoding/base64"
 	"log"
 	"os"
+	"path"
 	"strings"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	github "github.com/pennsieve/github-client/pkg/github"
 	ghsync "github.com/pennsieve/github-client/pkg/github/sync"
 )
 
@@ -22,45 +22,43 @@ func getSyncFiles() []string {
 	return defaultSyncFiles
 }
 
-func newGitHubClient(token string) github.GitHubApi {
-	client := github.NewGitHubApiClient(logger, "", "", github.GitHubApiUrl, 0)
-	if token != "" {
-		client = client.WithAccessToken(token)
-	}
-	return client
-}
-
-type gitHubContentFetcher struct {
-	client github.GitHubApi
+// sourceContentFetcher fetches the files synced for the appstore from a source provider, from the build context
+// directory of a monorepo if contextDir is set
+type sourceContentFetcher struct {
+	ctx        context.Context
+	provider   SourceProvider
+	contextDir string
 }
 
-func (f *gitHubContentFetcher) GetContent(url, filePath, tag string) (*ghsync.ContentResponse, error) {
-	resp, err := f.client.GetContent(url, filePath, tag)
+func (f *sourceContentFetcher) GetContent(url, filePath, tag string) (*ghsync.ContentResponse, error) {
+	content, err := f.provider.GetContent(f.ctx, url, path.Join(f.contextDir, filePath), tag)
 	if err != nil {
 		return nil, err
 	}
-	if resp == nil {
+	if content == nil {
 		return nil, nil
 	}
 	return &ghsync.ContentResponse{
-		Content:  resp.Content,
-		Encoding: resp.Encoding,
+		Content:  base64.StdEncoding.EncodeToString(content),
+		Encoding: "base64",
 	}, nil
 }
 
-func buildNamespace(sourceUrl string, tag string) string {
-	sourceUrl = strings.TrimSuffix(sourceUrl, "/")
-	sourceUrl = strings.TrimSuffix(sourceUrl, ".git")
-	parts := strings.Split(sourceUrl, "/")
-	if len(parts) >= 2 {
-		owner := parts[len(parts)-2]
-		repo := parts[len(parts)-1]
-		return fmt.Sprintf("%s/%s/%s", owner, repo, tag)
+// buildNamespace returns the path content synced from the repository at sourceUrl is stored under: its owner and
+// name, or its full path for repositories in nested groups, the build context directory for monorepos, and tag.
+// Repositories on hosts other than github.com are under their host as well.
+func buildNamespace(sourceUrl string, contextDir string, tag string) string {
+	host, repository, err := parseRepositoryUrl(sourceUrl)
+	if err != nil {
+		return tag
+	}
+	if host != "github.com" {
+		repository = host + "/" + repository
 	}
-	return tag
+	return path.Join(repository, contextDir, tag)
 }
 
-func syncRepoContent(ctx context.Context, sourceUrl string, tag string, authToken string) {
+func syncRepoContent(ctx context.Context, sourceType string, sourceUrl string, contextDir string, tag string, authToken string) {
 	if tag == "" {
 		tag = "main"
 	}
@@ -71,8 +69,7 @@ func syncRepoContent(ctx context.Context, sourceUrl string, tag string, authToke
 		return
 	}
 
-	ghClient := newGitHubClient(authToken)
-	fetcher := &gitHubContentFetcher{client: ghClient}
+	fetcher := &sourceContentFetcher{ctx: ctx, provider: newSourceProvider(sourceType, sourceUrl, authToken), contextDir: contextDir}
 
 	cfg, err := awsconfig.LoadDefaultConfig(ctx)
 	if err != nil {
@@ -82,7 +79,7 @@ func syncRepoContent(ctx context.Context, sourceUrl string, tag string, authToke
 	s3Client := s3.NewFromConfig(cfg)
 	dest := ghsync.NewS3Destination(s3Client, bucket)
 
-	namespace := buildNamespace(sourceUrl, tag)
+	namespace := buildNamespace(sourceUrl, contextDir, tag)
 
 	config := ghsync.Config{
 		RepoUrl:   sourceUrl,
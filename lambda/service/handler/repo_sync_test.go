@@ -14,10 +14,11 @@ import (
 
 func TestBuildNamespace(t *testing.T) {
 	tests := []struct {
-		name      string
-		sourceUrl string
-		tag       string
-		expected  string
+		name       string
+		sourceUrl  string
+		contextDir string
+		tag        string
+		expected   string
 	}{
 		{
 			name:      "standard github URL",
@@ -37,6 +38,19 @@ func TestBuildNamespace(t *testing.T) {
 			tag:       "v2.0.0",
 			expected:  "org/repo/v2.0.0",
 		},
+		{
+			name:      "gitlab URL in a subgroup",
+			sourceUrl: "https://gitlab.example.edu/lab/group/repo.git",
+			tag:       "v1.0.0",
+			expected:  "gitlab.example.edu/lab/group/repo/v1.0.0",
+		},
+		{
+			name:       "monorepo build context directory",
+			sourceUrl:  "https://github.com/org/repo",
+			contextDir: "processors/segmentation",
+			tag:        "v1.0.0",
+			expected:   "org/repo/processors/segmentation/v1.0.0",
+		},
 		{
 			name:      "short URL with fewer than 2 parts",
 			sourceUrl: "repo",
@@ -47,7 +61,7 @@ func TestBuildNamespace(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := buildNamespace(tt.sourceUrl, tt.tag)
+			result := buildNamespace(tt.sourceUrl, tt.contextDir, tt.tag)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -55,12 +69,12 @@ func TestBuildNamespace(t *testing.T) {
 
 func TestSyncRepoContent_NoBucket(t *testing.T) {
 	t.Setenv("CONTENT_SYNC_BUCKET", "")
-	syncRepoContent(t.Context(), "https://github.com/org/repo", "main", "token")
+	syncRepoContent(t.Context(), "github", "https://github.com/org/repo", "", "main", "token")
 }
 
 func TestSyncRepoContent_DefaultTag(t *testing.T) {
 	t.Setenv("CONTENT_SYNC_BUCKET", "")
-	syncRepoContent(t.Context(), "https://github.com/org/repo", "", "")
+	syncRepoContent(t.Context(), "github", "https://github.com/org/repo", "", "", "")
 }
 
 type mockGitHubApi struct {
@@ -81,7 +95,7 @@ func (m *mockGitHubApi) GetContent(url string, filePath string, tag string) (*gi
 	return resp, nil
 }
 
-func TestGitHubContentFetcher_GetContent(t *testing.T) {
+func TestSourceContentFetcher_GetContent(t *testing.T) {
 	encoded := base64.StdEncoding.EncodeToString([]byte("hello world"))
 	mock := &mockGitHubApi{
 		contentMap: map[string]*github.GitHubContentResponse{
@@ -91,7 +105,7 @@ func TestGitHubContentFetcher_GetContent(t *testing.T) {
 			},
 		},
 	}
-	fetcher := &gitHubContentFetcher{client: mock}
+	fetcher := &sourceContentFetcher{ctx: t.Context(), provider: &gitHubSource{content: mock}}
 
 	resp, err := fetcher.GetContent("https://github.com/org/repo", "README.md", "main")
 	assert.NoError(t, err)
@@ -100,18 +114,36 @@ func TestGitHubContentFetcher_GetContent(t *testing.T) {
 	assert.Equal(t, "base64", resp.Encoding)
 }
 
-func TestGitHubContentFetcher_GetContent_NotFound(t *testing.T) {
+func TestSourceContentFetcher_GetContent_ContextDir(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("# Segmentation"))
+	mock := &mockGitHubApi{
+		contentMap: map[string]*github.GitHubContentResponse{
+			"https://github.com/org/repo/processors/segmentation/README.md/main": {
+				Content:  encoded,
+				Encoding: "base64",
+			},
+		},
+	}
+	fetcher := &sourceContentFetcher{ctx: t.Context(), provider: &gitHubSource{content: mock}, contextDir: "processors/segmentation"}
+
+	resp, err := fetcher.GetContent("https://github.com/org/repo", "README.md", "main")
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, encoded, resp.Content)
+}
+
+func TestSourceContentFetcher_GetContent_NotFound(t *testing.T) {
 	mock := &mockGitHubApi{contentMap: map[string]*github.GitHubContentResponse{}}
-	fetcher := &gitHubContentFetcher{client: mock}
+	fetcher := &sourceContentFetcher{ctx: t.Context(), provider: &gitHubSource{content: mock}}
 
 	resp, err := fetcher.GetContent("https://github.com/org/repo", "missing.txt", "main")
 	assert.NoError(t, err)
 	assert.Nil(t, resp)
 }
 
-func TestGitHubContentFetcher_GetContent_Error(t *testing.T) {
+func TestSourceContentFetcher_GetContent_Error(t *testing.T) {
 	mock := &mockGitHubApi{err: fmt.Errorf("api error")}
-	fetcher := &gitHubContentFetcher{client: mock}
+	fetcher := &sourceContentFetcher{ctx: t.Context(), provider: &gitHubSource{content: mock}}
 
 	resp, err := fetcher.GetContent("https://github.com/org/repo", "README.md", "main")
 	assert.Error(t, err)
@@ -168,7 +200,7 @@ func TestSyncContent_Integration(t *testing.T) {
 			},
 		},
 	}
-	fetcher := &gitHubContentFetcher{client: mock}
+	fetcher := &sourceContentFetcher{ctx: t.Context(), provider: &gitHubSource{content: mock}}
 	dest := &mockDestination{written: make(map[string][]byte)}
 
 	config := ghsync.Config{
@@ -2,8 +2,12 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/pennsieve/app-deploy-service/service/utils"
@@ -11,92 +15,297 @@ import (
 
 type RouterHandlerFunc func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
 
+// Middleware wraps a RouterHandlerFunc. Middleware passed when registering a route
+// is applied in order, so the first one listed is the outermost.
+type Middleware func(RouterHandlerFunc) RouterHandlerFunc
+
 // Defines the router interface
 type Router interface {
-	POST(string, RouterHandlerFunc)
-	GET(string, RouterHandlerFunc)
-	DELETE(string, RouterHandlerFunc)
-	PUT(string, RouterHandlerFunc)
+	POST(string, RouterHandlerFunc, ...Middleware)
+	GET(string, RouterHandlerFunc, ...Middleware)
+	DELETE(string, RouterHandlerFunc, ...Middleware)
+	PUT(string, RouterHandlerFunc, ...Middleware)
+	PATCH(string, RouterHandlerFunc, ...Middleware)
+	HEAD(string, RouterHandlerFunc, ...Middleware)
+	OPTIONS(string, RouterHandlerFunc, ...Middleware)
+	Handle(method string, routeKey string, handler RouterHandlerFunc, middleware ...Middleware)
+	Routes() []RouteInfo
 	Start(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
 }
 
+// RouteInfo identifies a registered route by method and path template.
+type RouteInfo struct {
+	Method  string
+	Pattern string
+}
+
+// route is a single entry in the route table. segments holds the path template split on "/";
+// a segment of the form {name} matches any single path segment and is captured as a path parameter.
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  RouterHandlerFunc
+}
+
 type LambdaRouter struct {
-	getRoutes    map[string]RouterHandlerFunc
-	postRoutes   map[string]RouterHandlerFunc
-	deleteRoutes map[string]RouterHandlerFunc
-	putRoutes    map[string]RouterHandlerFunc
+	routes             []route
+	corsAllowedOrigins []string
 }
 
 func NewLambdaRouter() Router {
-	return &LambdaRouter{
-		make(map[string]RouterHandlerFunc),
-		make(map[string]RouterHandlerFunc),
-		make(map[string]RouterHandlerFunc),
-		make(map[string]RouterHandlerFunc),
+	var origins []string
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		origins = strings.Split(v, ",")
 	}
+	return &LambdaRouter{corsAllowedOrigins: origins}
+}
+
+func (r *LambdaRouter) POST(routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	r.Handle(http.MethodPost, routeKey, handler, middleware...)
+}
+
+func (r *LambdaRouter) GET(routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	r.Handle(http.MethodGet, routeKey, handler, middleware...)
 }
 
-func (r *LambdaRouter) POST(routeKey string, handler RouterHandlerFunc) {
-	r.postRoutes[routeKey] = handler
+func (r *LambdaRouter) DELETE(routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	r.Handle(http.MethodDelete, routeKey, handler, middleware...)
 }
 
-func (r *LambdaRouter) GET(routeKey string, handler RouterHandlerFunc) {
-	r.getRoutes[routeKey] = handler
+func (r *LambdaRouter) PUT(routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	r.Handle(http.MethodPut, routeKey, handler, middleware...)
 }
 
-func (r *LambdaRouter) DELETE(routeKey string, handler RouterHandlerFunc) {
-	r.deleteRoutes[routeKey] = handler
+func (r *LambdaRouter) PATCH(routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	r.Handle(http.MethodPatch, routeKey, handler, middleware...)
+}
+
+func (r *LambdaRouter) HEAD(routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	r.Handle(http.MethodHead, routeKey, handler, middleware...)
+}
+
+func (r *LambdaRouter) OPTIONS(routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	r.Handle(http.MethodOptions, routeKey, handler, middleware...)
+}
+
+// Handle registers handler for the given method and path template. Registering the same
+// method and template twice replaces the earlier handler.
+func (r *LambdaRouter) Handle(method string, routeKey string, handler RouterHandlerFunc, middleware ...Middleware) {
+	pattern := normalizePath(routeKey)
+	newRoute := route{
+		method:   strings.ToUpper(method),
+		pattern:  pattern,
+		segments: splitPath(pattern),
+		handler:  Chain(handler, middleware...),
+	}
+	for i := range r.routes {
+		if r.routes[i].method == newRoute.method && r.routes[i].pattern == newRoute.pattern {
+			r.routes[i] = newRoute
+			return
+		}
+	}
+	r.routes = append(r.routes, newRoute)
 }
 
-func (r *LambdaRouter) PUT(routeKey string, handler RouterHandlerFunc) {
-	r.putRoutes[routeKey] = handler
+// Routes returns the registered routes in registration order.
+func (r *LambdaRouter) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(r.routes))
+	for _, rt := range r.routes {
+		routes = append(routes, RouteInfo{Method: rt.method, Pattern: rt.pattern})
+	}
+	return routes
 }
 
 func (r *LambdaRouter) Start(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	log.Println(request)
-	routeKey := utils.ExtractRoute(request.RouteKey)
-
-	switch request.RequestContext.HTTP.Method {
-	case http.MethodPost:
-		f, ok := r.postRoutes[routeKey]
-		if ok {
-			return f(ctx, request)
-		} else {
-			return handleError()
+	method := strings.ToUpper(request.RequestContext.HTTP.Method)
+	path, isTemplate := requestPath(request)
+
+	matched, params := r.match(path, isTemplate)
+	if len(matched) == 0 {
+		return errorResponse("LambdaRouter", requestID(ctx, request), fmt.Errorf("%s %s: %w", method, path, ErrUnsupportedRoute)), nil
+	}
+
+	for _, m := range matched {
+		if m.method == method {
+			return m.handler(ctx, withPathParameters(request, params))
 		}
-	case http.MethodGet:
-		f, ok := r.getRoutes[routeKey]
-		if ok {
-			return f(ctx, request)
-		} else {
-			return handleError()
+	}
+
+	allowed := allowedMethods(matched)
+	switch method {
+	case http.MethodHead:
+		// HEAD falls back to GET with the body dropped
+		for _, m := range matched {
+			if m.method == http.MethodGet {
+				resp, err := m.handler(ctx, withPathParameters(request, params))
+				resp.Body = ""
+				return resp, err
+			}
+		}
+	case http.MethodOptions:
+		return r.preflight(request, allowed), nil
+	}
+
+	resp := errorResponse("LambdaRouter", requestID(ctx, request), fmt.Errorf("%s %s: %w", method, path, ErrMethodNotAllowed))
+	resp.Headers["Allow"] = strings.Join(allowed, ", ")
+	return resp, nil
+}
+
+// match returns every route registered for the path. A template (from the route key) must match a
+// registered template exactly; a raw path is matched against each template, and when several match,
+// literal segments take precedence over parameters, so /store/registry wins over /store/{id}.
+func (r *LambdaRouter) match(path string, isTemplate bool) ([]route, map[string]string) {
+	if isTemplate {
+		var matched []route
+		for _, candidate := range r.routes {
+			if candidate.pattern == path {
+				matched = append(matched, candidate)
+			}
 		}
-	case http.MethodDelete:
-		f, ok := r.deleteRoutes[routeKey]
-		if ok {
-			return f(ctx, request)
-		} else {
-			return handleError()
+		return matched, nil
+	}
+
+	requestSegments := splitPath(path)
+	var best []route
+	var bestPattern []string
+	var bestParams map[string]string
+	for _, candidate := range r.routes {
+		params, ok := matchSegments(candidate.segments, requestSegments)
+		if !ok {
+			continue
 		}
-	case http.MethodPut:
-		if f, ok := r.putRoutes[routeKey]; ok {
-			return f(ctx, request)
-		} else {
-			return handleError()
+		switch {
+		case best == nil || moreSpecific(candidate.segments, bestPattern):
+			best = []route{candidate}
+			bestPattern = candidate.segments
+			bestParams = params
+		case slices.Equal(candidate.segments, bestPattern):
+			best = append(best, candidate)
 		}
-	default:
-		log.Println(ErrUnsupportedPath.Error())
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: http.StatusUnprocessableEntity,
-			Body:       ErrUnsupportedPath.Error(),
-		}, nil
 	}
+	return best, bestParams
 }
 
-func handleError() (events.APIGatewayV2HTTPResponse, error) {
-	log.Println(ErrUnsupportedRoute.Error())
+func (r *LambdaRouter) preflight(request events.APIGatewayV2HTTPRequest, allowed []string) events.APIGatewayV2HTTPResponse {
+	headers := map[string]string{
+		"Allow":                        strings.Join(allowed, ", "),
+		"Access-Control-Allow-Methods": strings.Join(allowed, ", "),
+		"Access-Control-Max-Age":       "300",
+	}
+	if requested := headerValue(request.Headers, "Access-Control-Request-Headers"); requested != "" {
+		headers["Access-Control-Allow-Headers"] = requested
+	}
+	if origin := headerValue(request.Headers, "Origin"); origin != "" && slices.Contains(r.corsAllowedOrigins, origin) {
+		headers["Access-Control-Allow-Origin"] = origin
+		headers["Access-Control-Allow-Credentials"] = "true"
+		headers["Vary"] = "Origin"
+	}
 	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusNotFound,
-		Body:       ErrUnsupportedRoute.Error(),
-	}, nil
+		StatusCode: http.StatusNoContent,
+		Headers:    headers,
+	}
+}
+
+// requestPath prefers the route template from the API Gateway route key, and falls back to the
+// raw path for the $default route, where the gateway has not resolved a template for us.
+// The second return value reports whether the path is a template.
+func requestPath(request events.APIGatewayV2HTTPRequest) (string, bool) {
+	if request.RouteKey != "" && request.RouteKey != "$default" {
+		return normalizePath(utils.ExtractRoute(request.RouteKey)), true
+	}
+	return normalizePath(request.RawPath), false
+}
+
+func normalizePath(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func isParamSegment(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func matchSegments(pattern []string, path []string) (map[string]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, segment := range pattern {
+		if isParamSegment(segment) {
+			params[segment[1:len(segment)-1]] = path[i]
+			continue
+		}
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func moreSpecific(a []string, b []string) bool {
+	for i := range a {
+		aParam, bParam := isParamSegment(a[i]), isParamSegment(b[i])
+		if aParam != bParam {
+			return bParam
+		}
+	}
+	return false
+}
+
+func allowedMethods(routes []route) []string {
+	allowed := []string{http.MethodOptions}
+	for _, r := range routes {
+		if !slices.Contains(allowed, r.method) {
+			allowed = append(allowed, r.method)
+		}
+		if r.method == http.MethodGet && !slices.Contains(allowed, http.MethodHead) {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	slices.Sort(allowed)
+	return allowed
+}
+
+// withPathParameters fills in path parameters captured by the router without overriding
+// any the gateway has already supplied.
+func withPathParameters(request events.APIGatewayV2HTTPRequest, params map[string]string) events.APIGatewayV2HTTPRequest {
+	if len(params) == 0 {
+		return request
+	}
+	merged := make(map[string]string, len(params)+len(request.PathParameters))
+	for k, v := range params {
+		merged[k] = v
+	}
+	for k, v := range request.PathParameters {
+		merged[k] = v
+	}
+	request.PathParameters = merged
+	return request
+}
+
+// headerValue does a case-insensitive header lookup. API Gateway lower-cases header names for
+// HTTP APIs, but tests and direct invocations may not.
+func headerValue(headers map[string]string, name string) string {
+	if v, ok := headers[strings.ToLower(name)]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
 }
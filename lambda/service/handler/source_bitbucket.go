@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const bitbucketApiUrl = "https://api.bitbucket.org/2.0"
+
+// bitbucketSource reads repositories on bitbucket.org with its REST API, authenticated with an access token
+type bitbucketSource struct {
+	client  *http.Client
+	baseUrl string
+	token   string
+}
+
+// repository returns the API URL of the repository at sourceUrl
+func (b *bitbucketSource) repository(sourceUrl string) (string, error) {
+	workspace, repo, err := ownerAndRepository(sourceUrl, "bitbucket.org")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/repositories/%s/%s", strings.TrimSuffix(b.baseUrl, "/"), url.PathEscape(workspace), url.PathEscape(repo)), nil
+}
+
+func (b *bitbucketSource) header() http.Header {
+	header := http.Header{}
+	if b.token != "" {
+		header.Set("Authorization", "Bearer "+b.token)
+	}
+	return header
+}
+
+func (b *bitbucketSource) ListTags(ctx context.Context, sourceUrl string) ([]string, error) {
+	repository, err := b.repository(sourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	endpoint := fmt.Sprintf("%s/refs/tags?pagelen=%d", repository, tagsPerPage)
+	// each page links to the next
+	for page := 1; page <= maxTagPages && endpoint != ""; page++ {
+		body, err := getSource(ctx, b.client, endpoint, b.header())
+		if err != nil {
+			return nil, fmt.Errorf("error listing tags of %s: %w", sourceUrl, err)
+		}
+		var tags struct {
+			Values []struct {
+				Name string `json:"name"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		if err := json.Unmarshal(body, &tags); err != nil {
+			return nil, fmt.Errorf("error listing tags of %s: %w", sourceUrl, err)
+		}
+		for _, tag := range tags.Values {
+			names = append(names, tag.Name)
+		}
+		endpoint = tags.Next
+	}
+	return names, nil
+}
+
+func (b *bitbucketSource) GetContent(ctx context.Context, sourceUrl string, filePath string, ref string) ([]byte, error) {
+	repository, err := b.repository(sourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/src/%s/%s", repository, url.PathEscape(ref), strings.TrimPrefix(filePath, "/"))
+	content, err := getSource(ctx, b.client, endpoint, b.header())
+	if errors.Is(err, errSourceNotFound) {
+		return nil, nil
+	}
+	return content, err
+}
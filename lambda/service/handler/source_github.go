@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	github "github.com/pennsieve/github-client/pkg/github"
+)
+
+// gitHubSource reads repositories on github.com. Tags are listed with the GitHub REST API, at the same base URL as
+// the github-client that fetches files, which cannot list them.
+type gitHubSource struct {
+	client  *http.Client
+	baseUrl string
+	token   string
+	content github.GitHubApi
+}
+
+func newGitHubClient(token string) github.GitHubApi {
+	client := github.NewGitHubApiClient(logger, "", "", github.GitHubApiUrl, 0)
+	if token != "" {
+		client = client.WithAccessToken(token)
+	}
+	return client
+}
+
+func (g *gitHubSource) ListTags(ctx context.Context, sourceUrl string) ([]string, error) {
+	owner, repo, err := gitHubRepository(sourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	if g.token != "" {
+		header.Set("Authorization", "Bearer "+g.token)
+	}
+	var names []string
+	for page := 1; page <= maxTagPages; page++ {
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/tags?per_page=%d&page=%d",
+			strings.TrimSuffix(g.baseUrl, "/"), url.PathEscape(owner), url.PathEscape(repo), tagsPerPage, page)
+		body, err := getSource(ctx, g.client, endpoint, header)
+		if err != nil {
+			return nil, fmt.Errorf("error listing tags of %s/%s: %w", owner, repo, err)
+		}
+		var tags []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(body, &tags); err != nil {
+			return nil, fmt.Errorf("error listing tags of %s/%s: %w", owner, repo, err)
+		}
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		if len(tags) < tagsPerPage {
+			break
+		}
+	}
+	return names, nil
+}
+
+func (g *gitHubSource) GetContent(_ context.Context, sourceUrl string, filePath string, ref string) ([]byte, error) {
+	resp, err := g.content.GetContent(sourceUrl, filePath, ref)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, nil
+	}
+	if resp.Encoding != "base64" {
+		return []byte(resp.Content), nil
+	}
+	// the contents API wraps base64 content in lines
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(resp.Content, "\n", ""))
+}
+
+// gitHubRepository returns the owner and name of a repository on github.com from its https, ssh, git or scp-like
+// URL
+func gitHubRepository(sourceUrl string) (string, string, error) {
+	return ownerAndRepository(sourceUrl, "github.com")
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gitLabSource reads repositories on gitlab.com or a self-hosted GitLab, with the REST API of the host in the
+// repository's URL. A repository may be nested in subgroups, so it is named by its full path.
+type gitLabSource struct {
+	client *http.Client
+	// baseUrl overrides the API of the repository's host
+	baseUrl string
+	token   string
+}
+
+// project returns the API URL of the project at sourceUrl
+func (g *gitLabSource) project(sourceUrl string) (string, error) {
+	host, repository, err := parseRepositoryUrl(sourceUrl)
+	if err != nil {
+		return "", err
+	}
+	baseUrl := g.baseUrl
+	if baseUrl == "" {
+		baseUrl = fmt.Sprintf("https://%s/api/v4", host)
+	}
+	return fmt.Sprintf("%s/projects/%s", strings.TrimSuffix(baseUrl, "/"), url.PathEscape(repository)), nil
+}
+
+func (g *gitLabSource) header() http.Header {
+	header := http.Header{}
+	if g.token != "" {
+		header.Set("PRIVATE-TOKEN", g.token)
+	}
+	return header
+}
+
+func (g *gitLabSource) ListTags(ctx context.Context, sourceUrl string) ([]string, error) {
+	project, err := g.project(sourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for page := 1; page <= maxTagPages; page++ {
+		body, err := getSource(ctx, g.client, fmt.Sprintf("%s/repository/tags?per_page=%d&page=%d", project, tagsPerPage, page), g.header())
+		if err != nil {
+			return nil, fmt.Errorf("error listing tags of %s: %w", sourceUrl, err)
+		}
+		var tags []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(body, &tags); err != nil {
+			return nil, fmt.Errorf("error listing tags of %s: %w", sourceUrl, err)
+		}
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		if len(tags) < tagsPerPage {
+			break
+		}
+	}
+	return names, nil
+}
+
+func (g *gitLabSource) GetContent(ctx context.Context, sourceUrl string, filePath string, ref string) ([]byte, error) {
+	project, err := g.project(sourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/repository/files/%s/raw?ref=%s", project, url.PathEscape(filePath), url.QueryEscape(ref))
+	content, err := getSource(ctx, g.client, endpoint, g.header())
+	if errors.Is(err, errSourceNotFound) {
+		return nil, nil
+	}
+	return content, err
+}
@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/pennsieve/app-deploy-service/service/models"
+	github "github.com/pennsieve/github-client/pkg/github"
+)
+
+// maxTagPages bounds how many pages of tags are listed for a repository
+const maxTagPages = 5
+
+const tagsPerPage = 100
+
+// errSourceNotFound is returned by a source provider's API for a repository or file that does not exist, or that
+// the token it was given cannot read
+var errSourceNotFound = errors.New("not found")
+
+// TagLister lists the tags of an application's source repository
+type TagLister interface {
+	ListTags(ctx context.Context, sourceUrl string) ([]string, error)
+}
+
+// SourceProvider is the host of an application's source repository, chosen by its source type. It lists the
+// repository's tags and fetches single files from it, authenticated with a token for private repositories.
+type SourceProvider interface {
+	TagLister
+	// GetContent returns the file at filePath in the repository at ref, or nil if there is no such file
+	GetContent(ctx context.Context, sourceUrl string, filePath string, ref string) ([]byte, error)
+}
+
+// sourceProviders returns the provider of the source at sourceUrl
+type sourceProviders func(sourceType string, sourceUrl string) SourceProvider
+
+// sourceTokenParameterKeys name, for each source type, the env var naming the SSM parameter holding a token for
+// reading its repositories. Without one, public repositories are read anonymously, at a lower rate limit.
+var sourceTokenParameterKeys = map[string]string{
+	models.SourceTypeGitHub:    "GITHUB_TOKEN_PARAMETER",
+	models.SourceTypeGitLab:    "GITLAB_TOKEN_PARAMETER",
+	models.SourceTypeBitbucket: "BITBUCKET_TOKEN_PARAMETER",
+}
+
+// newSourceProviders returns the providers of applications' sources, authenticated with the tokens in the SSM
+// parameters named by sourceTokenParameterKeys that are set.
+func newSourceProviders(ctx context.Context, deps *Dependencies) (sourceProviders, error) {
+	tokens := map[string]string{}
+	for sourceType, key := range sourceTokenParameterKeys {
+		name := strings.TrimSpace(os.Getenv(key))
+		if name == "" {
+			continue
+		}
+		out, err := ssm.NewFromConfig(deps.Config).GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s token from SSM: %w", sourceType, err)
+		}
+		tokens[sourceType] = aws.ToString(out.Parameter.Value)
+	}
+	return func(sourceType string, sourceUrl string) SourceProvider {
+		sourceType = sourceTypeOf(sourceType, sourceUrl)
+		return newSourceProvider(sourceType, sourceUrl, tokens[sourceType])
+	}, nil
+}
+
+// newSourceProvider returns the provider of the source at sourceUrl, authenticated with token if it is set
+func newSourceProvider(sourceType string, sourceUrl string, token string) SourceProvider {
+	switch sourceTypeOf(sourceType, sourceUrl) {
+	case models.SourceTypeGitHub:
+		return &gitHubSource{client: http.DefaultClient, baseUrl: github.GitHubApiUrl, token: token, content: newGitHubClient(token)}
+	case models.SourceTypeGitLab:
+		return &gitLabSource{client: http.DefaultClient, token: token}
+	case models.SourceTypeBitbucket:
+		return &bitbucketSource{client: http.DefaultClient, baseUrl: bitbucketApiUrl, token: token}
+	}
+	return &gitSource{client: http.DefaultClient, token: token}
+}
+
+// sourceTypeOf returns the type of the source at sourceUrl: sourceType, if it is a known type, or else the type of
+// the host in the URL. Self-hosted GitLab is recognised by a host name starting with gitlab.
+func sourceTypeOf(sourceType string, sourceUrl string) string {
+	switch t := strings.ToLower(sourceType); t {
+	case models.SourceTypeGitHub, models.SourceTypeGitLab, models.SourceTypeBitbucket, models.SourceTypeGit:
+		return t
+	}
+	host, _, err := parseRepositoryUrl(sourceUrl)
+	switch {
+	case err != nil:
+		return models.SourceTypeGit
+	case host == "github.com":
+		return models.SourceTypeGitHub
+	case host == "bitbucket.org":
+		return models.SourceTypeBitbucket
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return models.SourceTypeGitLab
+	}
+	return models.SourceTypeGit
+}
+
+// parseRepositoryUrl returns the host of a repository and its path on the host, without a .git suffix, from its
+// https, ssh, git or scp-like URL
+func parseRepositoryUrl(sourceUrl string) (string, string, error) {
+	rest := strings.TrimSuffix(strings.TrimSuffix(sourceUrl, "/"), ".git")
+	var host, repository string
+	if strings.Contains(rest, "://") {
+		u, err := url.Parse(rest)
+		if err != nil {
+			return "", "", fmt.Errorf("%s is not a repository URL: %w", sourceUrl, err)
+		}
+		host, repository = u.Hostname(), u.Path
+	} else {
+		// git@host:owner/repo
+		address, p, ok := strings.Cut(rest, ":")
+		if !ok {
+			return "", "", fmt.Errorf("%s is not a repository URL", sourceUrl)
+		}
+		if _, h, ok := strings.Cut(address, "@"); ok {
+			address = h
+		}
+		host, repository = address, p
+	}
+	repository = strings.Trim(repository, "/")
+	if host == "" || !strings.Contains(repository, "/") || strings.Contains(repository, "//") {
+		return "", "", fmt.Errorf("%s is not a repository URL", sourceUrl)
+	}
+	return strings.ToLower(host), repository, nil
+}
+
+// ownerAndRepository returns the owner and name of a repository on host from its URL, for hosts that have no
+// nested groups
+func ownerAndRepository(sourceUrl string, host string) (string, string, error) {
+	h, repository, err := parseRepositoryUrl(sourceUrl)
+	if err != nil || h != host {
+		return "", "", fmt.Errorf("%s is not a %s repository", sourceUrl, host)
+	}
+	owner, name, _ := strings.Cut(repository, "/")
+	if strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("%s is not a %s repository", sourceUrl, host)
+	}
+	return owner, name, nil
+}
+
+// httpsRepositoryUrl returns the https URL git clones the repository at sourceUrl from
+func httpsRepositoryUrl(sourceUrl string) (string, error) {
+	if strings.HasPrefix(sourceUrl, "https://") {
+		return strings.TrimSuffix(sourceUrl, "/"), nil
+	}
+	host, repository, err := parseRepositoryUrl(sourceUrl)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://%s/%s.git", host, repository), nil
+}
+
+// getSource sends a GET request to a source provider and returns the response body. A missing repository or file
+// is errSourceNotFound.
+func getSource(ctx context.Context, client *http.Client, endpoint string, header http.Header) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for %s: %w", endpoint, err)
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting %s: %w", endpoint, err)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(response.Body)
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", endpoint, errSourceNotFound)
+	}
+	return nil, fmt.Errorf("error requesting %s: %s", endpoint, response.Status)
+}
+
+// basicAuth returns the value of an Authorization header with username and password
+func basicAuth(username string, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// gitSource reads any git remote over https, with the token as a password if it is set. Git's protocol lists
+// refs, but cannot fetch single files, so a plain git source has no content to sync.
+type gitSource struct {
+	client *http.Client
+	token  string
+}
+
+func (g *gitSource) ListTags(ctx context.Context, sourceUrl string) ([]string, error) {
+	repositoryUrl, err := httpsRepositoryUrl(sourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if g.token != "" {
+		header.Set("Authorization", basicAuth("git", g.token))
+	}
+	body, err := getSource(ctx, g.client, repositoryUrl+"/info/refs?service=git-upload-pack", header)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tags of %s: %w", sourceUrl, err)
+	}
+	return parseTagRefs(string(body))
+}
+
+func (g *gitSource) GetContent(context.Context, string, string, string) ([]byte, error) {
+	return nil, nil
+}
+
+// parseTagRefs returns the tags in a git-upload-pack ref advertisement, a sequence of pkt-lines each holding
+// "{commit} {ref}", with the capabilities after a NUL on the first
+func parseTagRefs(advertisement string) ([]string, error) {
+	var tags []string
+	r := strings.NewReader(advertisement)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err == io.EOF {
+			return tags, nil
+		} else if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseUint(string(size[:]), 16, 16)
+		if err != nil || (n > 0 && n < 4) {
+			return nil, fmt.Errorf("malformed pkt-line length %q", size)
+		}
+		if n == 0 {
+			continue
+		}
+		line := make([]byte, n-4)
+		if _, err := io.ReadFull(r, line); err != nil {
+			return nil, err
+		}
+		ref, _, _ := strings.Cut(strings.TrimSuffix(string(line), "\n"), "\x00")
+		_, name, _ := strings.Cut(ref, " ")
+		// annotated tags are advertised a second time, peeled to their commit
+		if tag, ok := strings.CutPrefix(name, "refs/tags/"); ok && !strings.HasSuffix(tag, "^{}") {
+			tags = append(tags, tag)
+		}
+	}
+}
+
+// latestTag returns the latest of the tags matching pattern, by compareVersions, or "" if none match
+func latestTag(tags []string, pattern string) string {
+	var latest string
+	for _, tag := range tags {
+		if ok, _ := path.Match(pattern, tag); ok && (latest == "" || compareVersions(tag, latest) > 0) {
+			latest = tag
+		}
+	}
+	return latest
+}
+
+// compareVersions orders tag names as versions, so that v1.10.0 follows v1.9.0: runs of digits compare as numbers
+// and anything else as text. A pre-release such as v2.0.0-rc1 comes before v2.0.0.
+func compareVersions(a, b string) int {
+	as, bs := versionParts(a), versionParts(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareVersionPart(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) == len(bs):
+		return 0
+	case len(as) > len(bs):
+		if strings.HasPrefix(as[len(bs)], "-") {
+			return -1
+		}
+		return 1
+	default:
+		if strings.HasPrefix(bs[len(as)], "-") {
+			return 1
+		}
+		return -1
+	}
+}
+
+func compareVersionPart(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return cmp.Compare(an, bn)
+	case aErr == nil:
+		// a number follows text, so v2 follows v
+		return 1
+	case bErr == nil:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// versionParts splits s into runs of digits and runs of anything else
+func versionParts(s string) []string {
+	var parts []string
+	start := 0
+	for i, r := range s {
+		if i > start && unicode.IsDigit(r) != unicode.IsDigit(rune(s[start])) {
+			parts = append(parts, s[start:i])
+			start = i
+		}
+	}
+	if start < len(s) {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
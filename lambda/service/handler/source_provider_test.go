@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceTypeOf(t *testing.T) {
+	tests := []struct {
+		sourceType string
+		sourceUrl  string
+		expected   string
+	}{
+		{"github", "https://github.com/org/repo", models.SourceTypeGitHub},
+		{"GitLab", "https://code.example.edu/lab/repo", models.SourceTypeGitLab},
+		{"", "https://github.com/org/repo", models.SourceTypeGitHub},
+		{"", "git@gitlab.com:group/subgroup/repo.git", models.SourceTypeGitLab},
+		{"", "https://gitlab.example.edu/lab/repo", models.SourceTypeGitLab},
+		{"", "https://bitbucket.org/workspace/repo", models.SourceTypeBitbucket},
+		{"unknown", "https://git.example.edu/lab/repo", models.SourceTypeGit},
+		{"", "not a url", models.SourceTypeGit},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, sourceTypeOf(tt.sourceType, tt.sourceUrl), tt.sourceUrl)
+	}
+}
+
+func TestParseRepositoryUrl(t *testing.T) {
+	for sourceUrl, expected := range map[string][2]string{
+		"https://github.com/org/repo":                    {"github.com", "org/repo"},
+		"https://GitLab.example.edu/lab/group/repo.git/": {"gitlab.example.edu", "lab/group/repo"},
+		"ssh://git@bitbucket.org/workspace/repo.git":     {"bitbucket.org", "workspace/repo"},
+		"git@gitlab.com:group/repo.git":                  {"gitlab.com", "group/repo"},
+	} {
+		host, repository, err := parseRepositoryUrl(sourceUrl)
+		require.NoError(t, err, sourceUrl)
+		assert.Equal(t, expected, [2]string{host, repository}, sourceUrl)
+	}
+	for _, sourceUrl := range []string{"repo", "https://github.com/org", "https://github.com//repo"} {
+		_, _, err := parseRepositoryUrl(sourceUrl)
+		assert.Error(t, err, sourceUrl)
+	}
+}
+
+func TestGitHubRepository(t *testing.T) {
+	for _, sourceUrl := range []string{
+		"https://github.com/org/repo",
+		"https://github.com/org/repo.git",
+		"git://github.com/org/repo",
+		"git@github.com:org/repo.git",
+	} {
+		owner, repo, err := gitHubRepository(sourceUrl)
+		require.NoError(t, err, sourceUrl)
+		assert.Equal(t, []string{"org", "repo"}, []string{owner, repo}, sourceUrl)
+	}
+	for _, sourceUrl := range []string{"https://gitlab.com/org/repo", "https://github.com/org", "https://github.com/org/repo/tree/main"} {
+		_, _, err := gitHubRepository(sourceUrl)
+		assert.Error(t, err, sourceUrl)
+	}
+}
+
+func TestGitHubSourceListTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/org/repo/tags", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`[{"name":"v1.0.0"},{"name":"v1.1.0"}]`))
+	}))
+	defer server.Close()
+
+	source := &gitHubSource{client: server.Client(), baseUrl: server.URL, token: "token"}
+	names, err := source.ListTags(context.Background(), "https://github.com/org/repo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, names)
+}
+
+func TestGitLabSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("PRIVATE-TOKEN"))
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/lab%2Fgroup%2Frepo/repository/tags":
+			_, _ = w.Write([]byte(`[{"name":"v1.0.0"},{"name":"v1.1.0"}]`))
+		case "/api/v4/projects/lab%2Fgroup%2Frepo/repository/files/application.json/raw":
+			assert.Equal(t, "v1.1.0", r.URL.Query().Get("ref"))
+			_, _ = w.Write([]byte(`{"name":"app"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := &gitLabSource{client: server.Client(), baseUrl: server.URL + "/api/v4", token: "token"}
+	sourceUrl := "https://gitlab.example.edu/lab/group/repo.git"
+	names, err := source.ListTags(context.Background(), sourceUrl)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, names)
+
+	content, err := source.GetContent(context.Background(), sourceUrl, "application.json", "v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"app"}`, string(content))
+
+	content, err = source.GetContent(context.Background(), sourceUrl, "README.md", "v1.1.0")
+	require.NoError(t, err)
+	assert.Nil(t, content)
+}
+
+func TestBitbucketSource(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/repositories/workspace/repo/refs/tags":
+			if r.URL.Query().Get("page") == "" {
+				_, _ = fmt.Fprintf(w, `{"values":[{"name":"v1.0.0"}],"next":"%s/repositories/workspace/repo/refs/tags?page=2"}`, server.URL)
+				return
+			}
+			_, _ = w.Write([]byte(`{"values":[{"name":"v1.1.0"}]}`))
+		case "/repositories/workspace/repo/src/v1.1.0/README.md":
+			_, _ = w.Write([]byte("# App"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := &bitbucketSource{client: server.Client(), baseUrl: server.URL, token: "token"}
+	sourceUrl := "git@bitbucket.org:workspace/repo.git"
+	names, err := source.ListTags(context.Background(), sourceUrl)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, names)
+
+	content, err := source.GetContent(context.Background(), sourceUrl, "README.md", "v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "# App", string(content))
+
+	content, err = source.GetContent(context.Background(), sourceUrl, "application.json", "v1.1.0")
+	require.NoError(t, err)
+	assert.Nil(t, content)
+}
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+func TestGitSourceListTags(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/lab/repo.git/info/refs", r.URL.Path)
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, []string{"git", "token"}, []string{username, password})
+		_, _ = w.Write([]byte(pktLine("# service=git-upload-pack\n") + "0000" +
+			pktLine("aaa HEAD\x00symref=HEAD:refs/heads/main\n") +
+			pktLine("aaa refs/heads/main\n") +
+			pktLine("bbb refs/tags/v1.0.0\n") +
+			pktLine("ccc refs/tags/v1.0.0^{}\n") +
+			pktLine("ddd refs/tags/v1.1.0\n") + "0000"))
+	}))
+	defer server.Close()
+
+	source := &gitSource{client: server.Client(), token: "token"}
+	names, err := source.ListTags(context.Background(), server.URL+"/lab/repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, names)
+
+	content, err := source.GetContent(context.Background(), server.URL+"/lab/repo.git", "README.md", "v1.1.0")
+	require.NoError(t, err)
+	assert.Nil(t, content)
+}
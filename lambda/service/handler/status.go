@@ -2,9 +2,11 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/pennsieve/app-deploy-service/service/events"
 	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 	"github.com/pusher/pusher-http-go/v5"
 	"log"
 	"time"
@@ -50,8 +52,19 @@ func (m *StatusManager) WithPusher(pusher *pusher.Client) *StatusManager {
 	return m
 }
 
-func (m *StatusManager) SetErrorStatus(ctx context.Context, err error) string {
-	msg := fmt.Sprintf("error: %s", err.Error())
+// SetErrorStatus records err on the application (or version) and deployment, notifies Pusher, and returns err
+// so handlers can return it directly.
+func (m *StatusManager) SetErrorStatus(ctx context.Context, err error) error {
+	return m.setFailedStatus(ctx, statemachine.ErrorStatus(err.Error()), err)
+}
+
+// SetDeleteErrorStatus records that deleting the application failed with err, and returns err. Only the delete
+// itself records this status, as an application being deleted takes no other error.
+func (m *StatusManager) SetDeleteErrorStatus(ctx context.Context, err error) error {
+	return m.setFailedStatus(ctx, statemachine.DeleteErrorStatus(err.Error()), err)
+}
+
+func (m *StatusManager) setFailedStatus(ctx context.Context, msg string, err error) error {
 	if appStoreErr := m.StatusStore.UpdateStatus(ctx, msg, m.ApplicationId); appStoreErr != nil {
 		log.Printf("warning: error updating applications table with error: %s: %s\n", msg, appStoreErr.Error())
 	}
@@ -61,16 +74,64 @@ func (m *StatusManager) SetErrorStatus(ctx context.Context, err error) string {
 		}
 	}
 	m.sendApplicationStatusEvent(msg, true)
-	return handlerError(m.HandlerName, err)
+	m.EndStep(ctx, store_dynamodb.StepDone, store_dynamodb.StepFailed)
+	return err
+}
+
+// StartStep appends the start of step to the deployment's timeline.
+func (m *StatusManager) StartStep(ctx context.Context, step string) {
+	m.appendStep(ctx, step, "")
+}
+
+// EndStep appends the end of step, with its outcome, to the deployment's timeline.
+func (m *StatusManager) EndStep(ctx context.Context, step string, outcome string) {
+	m.appendStep(ctx, step, outcome)
+}
+
+func (m *StatusManager) appendStep(ctx context.Context, step string, outcome string) {
+	if m.DeploymentsStore == nil {
+		return
+	}
+	event := store_dynamodb.StepEvent{Step: step, Outcome: outcome, Time: time.Now().UTC()}
+	if err := m.DeploymentsStore.AppendStep(ctx, m.ApplicationId, m.DeploymentId, event); err != nil {
+		log.Printf("warning: error appending %s step to deployment %s: %s\n", step, m.DeploymentId, err.Error())
+	}
+	m.sendDeploymentStepEvent(event)
 }
 
 func (m *StatusManager) UpdateApplicationStatus(ctx context.Context, applicationUuid string, newStatus string) {
-	if err := m.StatusStore.UpdateStatus(ctx, newStatus, applicationUuid); err != nil {
+	err := m.StatusStore.UpdateStatus(ctx, newStatus, applicationUuid)
+	if errors.Is(err, statemachine.ErrIllegalTransition) {
+		// the record has moved on, so the update is not applied, and not announced
+		log.Printf("warning: rejected illegal status transition of application %s: %s\n", applicationUuid, err.Error())
+		return
+	}
+	if err != nil {
 		log.Printf("warning: error updating status of application %s to %q: %s\n", applicationUuid, newStatus, err.Error())
 	}
 	// In this module, this is never called for an error
 	m.sendApplicationStatusEvent(newStatus, false)
 }
+
+// UpdateApplicationStatusAtVersion is UpdateApplicationStatus for a request guarded by the application's version.
+// It returns store_dynamodb.ErrVersionConflict, without updating the status, if the application has changed since
+// it was read; other failures are logged as they are by UpdateApplicationStatus.
+func (m *StatusManager) UpdateApplicationStatusAtVersion(ctx context.Context, applicationUuid string, newStatus string, expectedVersion int64) error {
+	err := m.ApplicationsStore.UpdateStatusAtVersion(ctx, newStatus, applicationUuid, expectedVersion)
+	if errors.Is(err, store_dynamodb.ErrVersionConflict) {
+		return err
+	}
+	if errors.Is(err, statemachine.ErrIllegalTransition) {
+		log.Printf("warning: rejected illegal status transition of application %s: %s\n", applicationUuid, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.Printf("warning: error updating status of application %s to %q: %s\n", applicationUuid, newStatus, err.Error())
+	}
+	m.sendApplicationStatusEvent(newStatus, false)
+	return nil
+}
+
 func (m *StatusManager) NewApplication(ctx context.Context, application store_dynamodb.Application) error {
 	m.sendApplicationStatusEvent(application.Status, false)
 	return m.ApplicationsStore.Insert(ctx, application)
@@ -83,6 +144,16 @@ func (m *StatusManager) NewDeployment(ctx context.Context, deployment store_dyna
 	return m.DeploymentsStore.Insert(ctx, deployment)
 }
 
+// SetProvisionerTask records the provisioner task running the deployment, so its logs can be found later.
+func (m *StatusManager) SetProvisionerTask(ctx context.Context, taskArn string) {
+	if m.DeploymentsStore == nil {
+		return
+	}
+	if err := m.DeploymentsStore.SetProvisionerTaskArn(ctx, m.ApplicationId, m.DeploymentId, taskArn); err != nil {
+		log.Printf("warning: error recording provisioner task %s on deployment %s: %s\n", taskArn, m.DeploymentId, err.Error())
+	}
+}
+
 func (m *StatusManager) sendApplicationStatusEvent(status string, isErrorStatus bool) {
 	if m.Pusher == nil {
 		log.Printf("warning: no Pusher client configured")
@@ -101,3 +172,22 @@ func (m *StatusManager) sendApplicationStatusEvent(status string, isErrorStatus
 		log.Printf("warning: error updating pusher application channel %s with status: %s: %s\n", channel, status, err.Error())
 	}
 }
+
+func (m *StatusManager) sendDeploymentStepEvent(step store_dynamodb.StepEvent) {
+	if m.Pusher == nil {
+		log.Printf("warning: no Pusher client configured")
+		return
+	}
+	channel := events.ApplicationStatusChannel(m.ApplicationId)
+	event := events.DeploymentStepEvent{
+		ApplicationId: m.ApplicationId,
+		DeploymentId:  m.DeploymentId,
+		Step:          step.Step,
+		Outcome:       step.Outcome,
+		Time:          step.Time,
+		Source:        m.HandlerName,
+	}
+	if err := m.Pusher.Trigger(channel, events.DeploymentStepEventName, event); err != nil {
+		log.Printf("warning: error updating pusher application channel %s with step: %s: %s\n", channel, step.Step, err.Error())
+	}
+}
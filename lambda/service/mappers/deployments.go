@@ -21,8 +21,78 @@ func DeploymentItemToModel(item store_dynamodb.Deployment) models.Deployment {
 		StoppedReason: item.StoppedReason,
 		SourceUrl:     item.SourceUrl,
 		Tag:           item.Tag,
+		Branch:        item.Branch,
+		Trigger:       item.Trigger,
 		Errored:       item.Errored,
+		Cancelled:     item.Cancelled,
+		CancelledAt:   item.CancelledAt,
+		CancelledBy:   item.CancelledBy,
+		ImageTag:      item.ImageTag,
+		ImageDigest:   item.ImageDigest,
+		RollbackOf:    item.RollbackOf,
+
+		CommitSha:              item.CommitSha,
+		ProvisionerTaskArn:     item.ProvisionerTaskArn,
+		DeployerTaskDefinition: item.DeployerTaskDefinition,
+		ImageSizeBytes:         item.ImageSizeBytes,
+		BuildDurationSeconds:   item.BuildDurationSeconds,
+
+		// deployments are on their first attempt until they are retried
+		Attempt:   max(item.Attempt, 1),
+		LastError: item.LastError,
+
+		Steps: TimelineToSteps(item.Timeline),
+	}
+}
+
+// TimelineToSteps folds a deployment's timeline into one entry per step, in step order rather than the order
+// events were appended: the service, provisioner and status listener append concurrently. A step takes its first
+// start and first end. A step left running when the deployment is done, because whatever was running it failed
+// or was stopped, ends with the deployment. Only the steps of the latest attempt are kept: a retry starts them
+// over.
+func TimelineToSteps(timeline []store_dynamodb.StepEvent) []models.DeploymentStep {
+	byName := map[string]*models.DeploymentStep{}
+	for _, event := range timeline {
+		if event.Step == store_dynamodb.StepRetry {
+			byName = map[string]*models.DeploymentStep{}
+			continue
+		}
+		step, ok := byName[event.Step]
+		if !ok {
+			step = &models.DeploymentStep{Name: event.Step, Outcome: models.StepRunning}
+			byName[event.Step] = step
+		}
+		if event.Outcome == "" {
+			if step.StartedAt.IsZero() {
+				step.StartedAt = event.Time
+			}
+			continue
+		}
+		if step.EndedAt == nil {
+			endedAt := event.Time
+			step.EndedAt = &endedAt
+			step.Outcome = event.Outcome
+			// a step seen only ending happened at that moment
+			if step.StartedAt.IsZero() {
+				step.StartedAt = event.Time
+			}
+		}
+	}
+
+	done := byName[store_dynamodb.StepDone]
+	var steps []models.DeploymentStep
+	for _, name := range store_dynamodb.Steps {
+		step, ok := byName[name]
+		if !ok {
+			continue
+		}
+		if step.EndedAt == nil && done != nil && done.EndedAt != nil {
+			step.EndedAt = done.EndedAt
+			step.Outcome = done.Outcome
+		}
+		steps = append(steps, *step)
 	}
+	return steps
 }
 
 func DeploymentItemsToModels(items []store_dynamodb.Deployment) []models.Deployment {
@@ -0,0 +1,89 @@
+package mappers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/store_dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelineToSteps(t *testing.T) {
+	start := time.Date(2024, 5, 30, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	steps := TimelineToSteps([]store_dynamodb.StepEvent{
+		{Step: store_dynamodb.StepProvisioning, Time: at(0)},
+		{Step: store_dynamodb.StepProvisioning, Outcome: store_dynamodb.StepSucceeded, Time: at(1)},
+		{Step: store_dynamodb.StepImageBuild, Time: at(2)},
+		{Step: store_dynamodb.StepImageBuild, Outcome: store_dynamodb.StepSucceeded, Time: at(5)},
+		// the status listener can record the deployment done before the provisioner checks the push
+		{Step: store_dynamodb.StepDone, Outcome: store_dynamodb.StepSucceeded, Time: at(5)},
+		{Step: store_dynamodb.StepImagePush, Time: at(6)},
+		{Step: store_dynamodb.StepImagePush, Outcome: store_dynamodb.StepSucceeded, Time: at(6)},
+	})
+
+	require.Len(t, steps, 4)
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	assert.Equal(t, []string{"provisioning", "image_build", "image_push", "done"}, names)
+	assert.Equal(t, at(2), steps[1].StartedAt)
+	assert.Equal(t, at(5), *steps[1].EndedAt)
+	assert.Equal(t, store_dynamodb.StepSucceeded, steps[2].Outcome)
+	assert.Equal(t, at(5), steps[3].StartedAt)
+}
+
+func TestTimelineToStepsRunningAndFailed(t *testing.T) {
+	start := time.Date(2024, 5, 30, 12, 0, 0, 0, time.UTC)
+
+	running := TimelineToSteps([]store_dynamodb.StepEvent{
+		{Step: store_dynamodb.StepTerraformApply, Time: start},
+	})
+	require.Len(t, running, 1)
+	assert.Equal(t, models.StepRunning, running[0].Outcome)
+	assert.Nil(t, running[0].EndedAt)
+
+	// a step that never ended fails with the deployment
+	failed := TimelineToSteps([]store_dynamodb.StepEvent{
+		{Step: store_dynamodb.StepTerraformApply, Time: start},
+		{Step: store_dynamodb.StepDone, Outcome: store_dynamodb.StepFailed, Time: start.Add(time.Minute)},
+		{Step: store_dynamodb.StepDone, Outcome: store_dynamodb.StepCancelled, Time: start.Add(2 * time.Minute)},
+	})
+	require.Len(t, failed, 2)
+	assert.Equal(t, store_dynamodb.StepFailed, failed[0].Outcome)
+	assert.Equal(t, start.Add(time.Minute), *failed[0].EndedAt)
+	assert.Equal(t, store_dynamodb.StepFailed, failed[1].Outcome)
+
+	assert.Empty(t, TimelineToSteps(nil))
+}
+
+func TestTimelineToStepsRetried(t *testing.T) {
+	start := time.Date(2024, 5, 30, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	steps := TimelineToSteps([]store_dynamodb.StepEvent{
+		{Step: store_dynamodb.StepProvisioning, Time: at(0)},
+		{Step: store_dynamodb.StepProvisioning, Outcome: store_dynamodb.StepSucceeded, Time: at(1)},
+		{Step: store_dynamodb.StepImageBuild, Time: at(2)},
+		{Step: store_dynamodb.StepImageBuild, Outcome: store_dynamodb.StepFailed, Time: at(3)},
+		// the first attempt failed transiently
+		{Step: store_dynamodb.StepRetry, Time: at(4)},
+		{Step: store_dynamodb.StepProvisioning, Time: at(4)},
+		{Step: store_dynamodb.StepProvisioning, Outcome: store_dynamodb.StepSucceeded, Time: at(6)},
+		{Step: store_dynamodb.StepImageBuild, Time: at(7)},
+	})
+
+	require.Len(t, steps, 2)
+	assert.Equal(t, at(4), steps[0].StartedAt)
+	assert.Equal(t, at(7), steps[1].StartedAt)
+	assert.Equal(t, models.StepRunning, steps[1].Outcome)
+}
+
+func TestDeploymentItemToModelAttempt(t *testing.T) {
+	assert.Equal(t, 1, DeploymentItemToModel(store_dynamodb.Deployment{}).Attempt)
+	assert.Equal(t, 2, DeploymentItemToModel(store_dynamodb.Deployment{Attempt: 2, LastError: "throttled"}).Attempt)
+}
@@ -7,7 +7,7 @@ import (
 
 func defaultComputeTypes(ct []string) []string {
 	if len(ct) == 0 {
-		return []string{"standard"}
+		return []string{models.ComputeTypeStandard}
 	}
 	return ct
 }
@@ -35,8 +35,9 @@ func StoreToModel(a store_dynamodb.Application) models.Application {
 			EfsId: a.ComputeNodeEfsId,
 		},
 		Source: models.Source{
-			SourceType: a.SourceType,
-			Url:        a.SourceUrl,
+			SourceType:   a.SourceType,
+			Url:          a.SourceUrl,
+			BuildOptions: BuildOptionsToModel(a.Build),
 		},
 		Destination: models.Destination{
 			DestinationType: a.DestinationType,
@@ -49,9 +50,56 @@ func StoreToModel(a store_dynamodb.Application) models.Application {
 		OrganizationId:   a.OrganizationId,
 		UserId:           a.UserId,
 		Status:           a.Status,
+		AutoDeploy:       AutoDeployToModel(a.AutoDeploy),
+		BuildSecrets:     BuildSecretsToModel(a.BuildSecrets),
 	}
 }
 
+func AutoDeployToModel(p *store_dynamodb.AutoDeployPolicy) *models.AutoDeployPolicy {
+	if p == nil {
+		return nil
+	}
+	return &models.AutoDeployPolicy{Schedule: p.Schedule, TagPattern: p.TagPattern}
+}
+
+func AutoDeployToStore(p *models.AutoDeployPolicy) *store_dynamodb.AutoDeployPolicy {
+	if p == nil {
+		return nil
+	}
+	return &store_dynamodb.AutoDeployPolicy{Schedule: p.Schedule, TagPattern: p.TagPattern}
+}
+
+func BuildSecretsToModel(secrets []store_dynamodb.BuildSecret) []models.BuildSecret {
+	var result []models.BuildSecret
+	for _, s := range secrets {
+		result = append(result, models.BuildSecret{Name: s.Name, Store: s.Store, Secret: s.Secret})
+	}
+	return result
+}
+
+func BuildSecretsToStore(secrets []models.BuildSecret) []store_dynamodb.BuildSecret {
+	var stored []store_dynamodb.BuildSecret
+	for _, s := range secrets {
+		stored = append(stored, store_dynamodb.BuildSecret{Name: s.Name, Store: s.Store, Secret: s.Secret})
+	}
+	return stored
+}
+
+func BuildOptionsToModel(o *store_dynamodb.BuildOptions) models.BuildOptions {
+	if o == nil {
+		return models.BuildOptions{}
+	}
+	return models.BuildOptions{ContextDir: o.ContextDir, Dockerfile: o.Dockerfile, BuildArgs: o.BuildArgs, Target: o.Target}
+}
+
+// BuildOptionsToStore returns nil for the default options, so that applications built with them store none
+func BuildOptionsToStore(o models.BuildOptions) *store_dynamodb.BuildOptions {
+	if o.ContextDir == "" && o.Dockerfile == "" && len(o.BuildArgs) == 0 && o.Target == "" {
+		return nil
+	}
+	return &store_dynamodb.BuildOptions{ContextDir: o.ContextDir, Dockerfile: o.Dockerfile, BuildArgs: o.BuildArgs, Target: o.Target}
+}
+
 func DynamoDBApplicationToJsonApplication(dynamoApplications []store_dynamodb.Application) []models.Application {
 	applications := []models.Application{}
 
@@ -67,6 +115,7 @@ func AppStoreAppToModel(a store_dynamodb.AppStoreApplication) models.AppStoreApp
 		Uuid:       a.Uuid,
 		SourceUrl:  a.SourceUrl,
 		SourceType: a.SourceType,
+		ContextDir: a.Build.GetContextDir(),
 		IsPrivate:  a.IsPrivate,
 		Visibility: a.Visibility,
 		OwnerId:    a.OwnerId,
@@ -0,0 +1,60 @@
+// Package mergepatch applies JSON Merge Patch documents as described in RFC 7396.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotObject is returned when a patch document is not a JSON object. RFC 7396 allows any JSON value as a
+// patch, but a non-object replaces the whole target, which is never what an update endpoint wants.
+var ErrNotObject = errors.New("merge patch must be a JSON object")
+
+// Apply merges patch into target and returns the result. Members of patch that are null remove the member
+// from the target, objects are merged recursively and every other value replaces the target member.
+func Apply(target []byte, patch []byte) ([]byte, error) {
+	patchDoc, err := Parse(patch)
+	if err != nil {
+		return nil, err
+	}
+	var targetDoc any
+	if len(target) > 0 {
+		if err := json.Unmarshal(target, &targetDoc); err != nil {
+			return nil, fmt.Errorf("error unmarshaling merge patch target: %w", err)
+		}
+	}
+	return json.Marshal(merge(targetDoc, patchDoc))
+}
+
+// Parse decodes a patch document, failing if it is not a JSON object.
+func Parse(patch []byte) (map[string]any, error) {
+	var doc any
+	if err := json.Unmarshal(patch, &doc); err != nil {
+		return nil, err
+	}
+	object, ok := doc.(map[string]any)
+	if !ok {
+		return nil, ErrNotObject
+	}
+	return object, nil
+}
+
+func merge(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = merge(targetObject[name], value)
+	}
+	return targetObject
+}
@@ -20,6 +20,42 @@ type Application struct {
 	CommandArguments         interface{}   `json:"commandArguments,omitempty"`
 	Deployments              []Deployment  `json:"deployments"`
 	Status                   string        `json:"status"`
+	// AutoDeploy, when set, redeploys the application without anyone calling POST /deploy
+	AutoDeploy *AutoDeployPolicy `json:"autoDeploy,omitempty"`
+	// BuildSecrets are passed to the application's image build without their values being stored
+	BuildSecrets []BuildSecret `json:"buildSecrets,omitempty"`
+}
+
+// BuildSecret references a secret an application's image needs at build time, such as the credentials of a private
+// package index. Only the reference is kept: ECS reads the value when the build starts, and kaniko is given it as the
+// build arg Name, in place of any build arg of that name. A build arg used in a RUN instruction is recorded in the
+// image history of its stage, so it should only be used in a build stage that is not the final image.
+type BuildSecret struct {
+	// Name is the build arg the secret is passed as
+	Name string `json:"name"`
+	// Store is where the secret is kept, an SSM parameter or a Secrets Manager secret
+	Store string `json:"store"`
+	// Secret is the name of the parameter or secret, relative to the organization's build secrets path
+	Secret string `json:"secret"`
+}
+
+// Build secret stores are the services an application's build secrets may be kept in
+const (
+	BuildSecretStoreSSM            = "ssm"
+	BuildSecretStoreSecretsManager = "secretsmanager"
+)
+
+// BuildSecretStores lists the values accepted as a build secret store
+var BuildSecretStores = []string{BuildSecretStoreSSM, BuildSecretStoreSecretsManager}
+
+// AutoDeployPolicy redeploys an application on a cron Schedule, or when a git tag matching TagPattern is pushed
+// to its source repository. Exactly one of them is set.
+type AutoDeployPolicy struct {
+	// Schedule is a five-field cron expression, evaluated in UTC
+	Schedule string `json:"schedule,omitempty"`
+	// TagPattern is a glob such as v*, matched against the repository's tag names. The latest matching tag, by
+	// version order, is deployed when it differs from the tag of the application's last deployment.
+	TagPattern string `json:"tagPattern,omitempty"`
 }
 
 type AppStoreDeployment struct {
@@ -38,18 +74,59 @@ type ComputeNode struct {
 	EfsId string `json:"efsId"`
 }
 
+// Source types name the host of an application's source repository. A source without a known type is typed by the
+// host in its URL, and any other host is a plain git remote.
+const (
+	SourceTypeGitHub    = "github"
+	SourceTypeGitLab    = "gitlab"
+	SourceTypeBitbucket = "bitbucket"
+	SourceTypeGit       = "git"
+)
+
+// Ref types name what a deployment builds: a tag, the head of a branch, or a commit by its full SHA
+const (
+	RefTypeTag    = "tag"
+	RefTypeBranch = "branch"
+	RefTypeCommit = "commit"
+)
+
+// RefTypes lists the values accepted as a ref type
+var RefTypes = []string{RefTypeTag, RefTypeBranch, RefTypeCommit}
+
 type DeploymentSource struct {
 	SourceType string `json:"type"`
 	Url        string `json:"url"`
 	Tag        string `json:"tag"`
-	IsPrivate  bool   `json:"isPrivate,omitempty"`
-	AuthToken  string `json:"authToken,omitempty"`
-	Owner      string `json:"owner,omitempty"`
+	// Ref, when set, is built instead of Tag: a tag or branch name, or a full commit SHA, by RefType, which
+	// defaults to tag
+	RefType   string `json:"refType,omitempty"`
+	Ref       string `json:"ref,omitempty"`
+	IsPrivate bool   `json:"isPrivate,omitempty"`
+	AuthToken string `json:"authToken,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	BuildOptions
 }
 
 type Source struct {
 	SourceType string `json:"type"`
 	Url        string `json:"url"`
+	// AuthToken authenticates the build with a private repository. It is passed on to the build it is sent with
+	// but not kept on the application, so each deployment of a private repository sends it again.
+	AuthToken string `json:"authToken,omitempty"`
+	BuildOptions
+}
+
+// BuildOptions tell the deployer how to build an application's image, for repositories that hold more than one
+// application or that do not keep their Dockerfile at the root. They are passed to kaniko as flags.
+type BuildOptions struct {
+	// ContextDir is the subdirectory of the repository that is the build context. An application is identified by
+	// its repository and context directory together.
+	ContextDir string `json:"contextDir,omitempty"`
+	// Dockerfile is the path of the Dockerfile in the build context. Defaults to Dockerfile.
+	Dockerfile string            `json:"dockerfile,omitempty"`
+	BuildArgs  map[string]string `json:"buildArgs,omitempty"`
+	// Target is the stage of a multi-stage Dockerfile to build. Defaults to the last stage.
+	Target string `json:"target,omitempty"`
 }
 
 type Destination struct {
@@ -61,12 +138,52 @@ type Release struct {
 	ID int `json:"id"`
 }
 
+// Defaults applied when a RuntimeConfig leaves CPU or memory unset.
+const (
+	DefaultCPU    = 2048
+	DefaultMemory = 4096
+)
+
+const (
+	ComputeTypeStandard = "standard"
+	ComputeTypeGPU      = "gpu"
+)
+
+// ComputeTypes lists the values accepted in RuntimeConfig.ComputeTypes.
+var ComputeTypes = []string{ComputeTypeStandard, ComputeTypeGPU}
+
 type RuntimeConfig struct {
 	CPU          int      `json:"cpu"`
 	Memory       int      `json:"memory"`
 	ComputeTypes []string `json:"computeTypes,omitempty"`
 }
 
+// ApplicationPatch lists the application fields PATCH /{id} can change. The request body is a JSON Merge Patch
+// (RFC 7396) applied to this document: members left out are unchanged and null resets a member to its default.
+type ApplicationPatch struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	Params           interface{}       `json:"params,omitempty"`
+	CommandArguments interface{}       `json:"commandArguments,omitempty"`
+	RuntimeConfig    RuntimeConfig     `json:"runtimeConfig"`
+	AutoDeploy       *AutoDeployPolicy `json:"autoDeploy,omitempty"`
+	BuildSecrets     []BuildSecret     `json:"buildSecrets,omitempty"`
+}
+
+// PatchApplicationResponse reports the updated application. RedeployRequired is set when a changed field only
+// takes effect once the application is deployed again; RedeployReasons names those fields.
+type PatchApplicationResponse struct {
+	Application      Application `json:"application"`
+	RedeployRequired bool        `json:"redeployRequired"`
+	RedeployReasons  []string    `json:"redeployReasons,omitempty"`
+}
+
+// ApplicationsPage is one page of GET /v1. NextToken is omitted on the last page.
+type ApplicationsPage struct {
+	Applications []Application `json:"applications"`
+	NextToken    string        `json:"nextToken,omitempty"`
+}
+
 type ApplicationResponse struct {
 	Message string `json:"message"`
 }
@@ -78,6 +195,13 @@ type RegisterApplicationResponse struct {
 
 type DeployApplicationResponse struct {
 	DeploymentId string `json:"deploymentId"`
+	// Queued is set when the deployment waits for another deployment of the application to finish
+	Queued bool `json:"queued,omitempty"`
+}
+
+// WebhookResponse lists the deployments and appstore releases a GitHub webhook delivery started
+type WebhookResponse struct {
+	Deployments []DeployApplicationResponse `json:"deployments"`
 }
 
 type AppStoreRegistrationResponse struct {
@@ -90,6 +214,7 @@ type AppStoreApplication struct {
 	Uuid             string            `json:"uuid"`
 	SourceUrl        string            `json:"sourceUrl"`
 	SourceType       string            `json:"sourceType"`
+	ContextDir       string            `json:"contextDir,omitempty"`
 	IsPrivate        bool              `json:"isPrivate"`
 	Visibility       string            `json:"visibility"`
 	OwnerId          string            `json:"ownerId"`
@@ -138,12 +263,15 @@ type AppStoreVersion struct {
 	CreatedAt     string       `json:"createdAt"`
 	Status        string       `json:"status"`
 	Deployments   []Deployment `json:"deployments"`
+	// ETag changes whenever the version's record does, including its status
+	ETag string `json:"etag"`
 }
 
 type AppStoreApplicationDetail struct {
 	Uuid             string            `json:"uuid"`
 	SourceUrl        string            `json:"sourceUrl"`
 	SourceType       string            `json:"sourceType"`
+	ContextDir       string            `json:"contextDir,omitempty"`
 	IsPrivate        bool              `json:"isPrivate"`
 	Visibility       string            `json:"visibility"`
 	OwnerId          string            `json:"ownerId"`
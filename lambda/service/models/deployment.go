@@ -12,6 +12,10 @@ type Deployment struct {
 	TaskArn       string    `json:"taskArn"`
 	SourceUrl     string    `json:"sourceUrl,omitempty"`
 	Tag           string    `json:"tag,omitempty"`
+	// Branch is set on a deployment of the head of a branch. A deployment of a commit names it in CommitSha.
+	Branch string `json:"branch,omitempty"`
+	// Trigger is set on a deployment started by the application's auto-deploy policy, to schedule, tag or webhook
+	Trigger string `json:"trigger,omitempty"`
 
 	// UpdatedAt is not in the reference. Assume it is the time this state change happened.
 	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
@@ -31,10 +35,80 @@ type Deployment struct {
 	StopCode      string `json:"stopCode,omitempty"`
 	StoppedReason string `json:"stoppedReason,omitempty"`
 	Errored       bool   `json:"errored,omitempty"`
+
+	Cancelled   bool       `json:"cancelled,omitempty"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+	CancelledBy string     `json:"cancelledBy,omitempty"`
+
+	ImageTag    string `json:"imageTag,omitempty"`
+	ImageDigest string `json:"imageDigest,omitempty"`
+	RollbackOf  string `json:"rollbackOf,omitempty"`
+
+	CommitSha              string `json:"commitSha,omitempty"`
+	ProvisionerTaskArn     string `json:"provisionerTaskArn,omitempty"`
+	DeployerTaskDefinition string `json:"deployerTaskDefinition,omitempty"`
+	ImageSizeBytes         int64  `json:"imageSizeBytes,omitempty"`
+	BuildDurationSeconds   int64  `json:"buildDurationSeconds,omitempty"`
+
+	// Attempt counts the runs of a deployment that failed transiently and was retried. LastError is the transient
+	// error of the last attempt that failed.
+	Attempt   int    `json:"attempt"`
+	LastError string `json:"lastError,omitempty"`
+
+	// Steps are those of the deployment's latest attempt
+	Steps []DeploymentStep `json:"steps,omitempty"`
+}
+
+// StepRunning is the outcome of a step that has started but not ended
+const StepRunning = "running"
+
+// DeploymentStep is one step of a deployment: provisioning, terraform_apply, task_definition_registered,
+// image_build, image_push or done. Outcome is running, succeeded, failed or cancelled.
+type DeploymentStep struct {
+	Name      string     `json:"name"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Outcome   string     `json:"outcome"`
+}
+
+// RollbackRequest is the optional body of POST /{id}/rollback. Without a DeploymentId the application is rolled
+// back to the image it ran before the current one.
+type RollbackRequest struct {
+	DeploymentId string `json:"deploymentId,omitempty"`
+}
+
+type RollbackResponse struct {
+	DeploymentId string `json:"deploymentId"`
+	RollbackOf   string `json:"rollbackOf"`
+	// Queued is set when the rollback waits for another deployment of the application to finish
+	Queued bool `json:"queued,omitempty"`
 }
 
 type Deployments struct {
 	Deployments []Deployment `json:"deployments"`
+	// NextToken is set when a limit was requested and more deployments remain
+	NextToken string `json:"nextToken,omitempty"`
+}
+
+// DeploymentLogs is a page of the provisioner and deployer output of a deployment.
+type DeploymentLogs struct {
+	Streams []LogStream `json:"streams"`
+	// NextToken is set when more output is available now
+	NextToken string `json:"nextToken,omitempty"`
+	// FollowToken is set when the output is read to the end but the deployment has not finished. Passing it as
+	// nextToken later returns whatever has been written since.
+	FollowToken string `json:"followToken,omitempty"`
+}
+
+// LogStream is the output of one task of a deployment. Source is provisioner or deployer.
+type LogStream struct {
+	Source string     `json:"source"`
+	Events []LogEvent `json:"events"`
+}
+
+type LogEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
 }
 
 // DeploymentsByInitiatedAtAsc compares two Deployment objects based on their InitiatedAt field in ascending order.
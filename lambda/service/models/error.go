@@ -0,0 +1,20 @@
+package models
+
+// ErrorResponse is the body of every error returned by the API. Code is stable and intended for clients to
+// branch on; Message is human readable and may change.
+type ErrorResponse struct {
+	Code      string       `json:"code"`
+	Status    int          `json:"status"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestId string       `json:"requestId,omitempty"`
+	// DeploymentId is the deployment already in progress, with DEPLOYMENT_IN_PROGRESS
+	DeploymentId string `json:"deploymentId,omitempty"`
+}
+
+// FieldError describes a single invalid field in a request body or query string.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// describeTasksBatchSize is the most tasks DescribeTasks accepts in one call
+const describeTasksBatchSize = 100
+
+// ECSTasksAPI is an interface only containing the ECS client methods used to find and stop tasks
+type ECSTasksAPI interface {
+	ListTasks(ctx context.Context, params *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error)
+	DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
+	StopTask(ctx context.Context, params *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error)
+}
+
+// TaggedTasks returns the ARNs of tasks in cluster that have not been asked to stop and carry the tag key=value.
+// ECS cannot filter ListTasks by tag, so every running task's tags are described.
+func TaggedTasks(ctx context.Context, api ECSTasksAPI, cluster string, key string, value string) ([]string, error) {
+	running, err := RunningTasks(ctx, api, &ecs.ListTasksInput{Cluster: aws.String(cluster)})
+	if err != nil {
+		return nil, err
+	}
+	var tagged []string
+	for _, task := range running {
+		if hasTag(task.Tags, key, value) {
+			tagged = append(tagged, aws.ToString(task.TaskArn))
+		}
+	}
+	return tagged, nil
+}
+
+// RunningTasks describes, with their tags, the tasks listed by in that have not been asked to stop. in must name
+// the cluster; it may also narrow the tasks to a family.
+func RunningTasks(ctx context.Context, api ECSTasksAPI, in *ecs.ListTasksInput) ([]types.Task, error) {
+	cluster := aws.ToString(in.Cluster)
+	listIn := *in
+	listIn.DesiredStatus = types.DesiredStatusRunning
+	var running []string
+	paginator := ecs.NewListTasksPaginator(api, &listIn)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing tasks in cluster %s: %w", cluster, err)
+		}
+		running = append(running, page.TaskArns...)
+	}
+
+	var tasks []types.Task
+	for start := 0; start < len(running); start += describeTasksBatchSize {
+		batch := running[start:min(start+describeTasksBatchSize, len(running))]
+		out, err := api.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   batch,
+			Include: []types.TaskField{types.TaskFieldTags},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing tasks in cluster %s: %w", cluster, err)
+		}
+		tasks = append(tasks, out.Tasks...)
+	}
+	return tasks, nil
+}
+
+// TagValue returns the value of the tag key, or "" if there is none
+func TagValue(tags []types.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// StopTasks asks ECS to stop each task, recording reason as the task's stopped reason. It attempts every task
+// and combines the errors.
+func StopTasks(ctx context.Context, api ECSTasksAPI, cluster string, taskArns []string, reason string) error {
+	var errs []error
+	for _, taskArn := range taskArns {
+		if _, err := api.StopTask(ctx, &ecs.StopTaskInput{
+			Cluster: aws.String(cluster),
+			Task:    aws.String(taskArn),
+			Reason:  aws.String(reason),
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("error stopping task %s: %w", taskArn, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func hasTag(tags []types.Tag, key string, value string) bool {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key && aws.ToString(tag.Value) == value {
+			return true
+		}
+	}
+	return false
+}
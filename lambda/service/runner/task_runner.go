@@ -4,17 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/aws"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go"
 )
 
+// ECSRunTaskAPI is an interface only containing the ECS client method used to run tasks
+type ECSRunTaskAPI interface {
+	RunTask(ctx context.Context, params *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error)
+}
+
 type ECSTaskRunner struct {
-	Client *ecs.Client
+	Client ECSRunTaskAPI
 	Input  *ecs.RunTaskInput
 }
 
-func NewECSTaskRunner(client *ecs.Client, input *ecs.RunTaskInput) ResultRunner[*ecs.RunTaskOutput] {
+func NewECSTaskRunner(client ECSRunTaskAPI, input *ecs.RunTaskInput) ResultRunner[*ecs.RunTaskOutput] {
 	return &ECSTaskRunner{client, input}
 }
 
@@ -22,15 +30,60 @@ func (r *ECSTaskRunner) Run(ctx context.Context) (*ecs.RunTaskOutput, error) {
 	return r.Client.RunTask(ctx, r.Input)
 }
 
-// GetRunFailures returns nil if runTaskOut contains no types.Failure,
-// otherwise it combines all the types.Failure into a single error
-func GetRunFailures(runTaskOut *ecs.RunTaskOutput) error {
-	var errs []error
-	for _, failure := range runTaskOut.Failures {
-		errs = append(errs, fmt.Errorf("run task failure: arn: %s, reason: %s, detail: %s",
+// RunFailuresError holds the failures ECS reported for a RunTask call
+type RunFailuresError struct {
+	Failures []types.Failure
+}
+
+func (e *RunFailuresError) Error() string {
+	var lines []string
+	for _, failure := range e.Failures {
+		lines = append(lines, fmt.Sprintf("run task failure: arn: %s, reason: %s, detail: %s",
 			aws.ToString(failure.Arn),
 			aws.ToString(failure.Reason),
 			aws.ToString(failure.Detail)))
 	}
-	return errors.Join(errs...)
+	return strings.Join(lines, "\n")
+}
+
+// GetRunFailures returns nil if runTaskOut contains no types.Failure,
+// otherwise it combines all the types.Failure into a single *RunFailuresError
+func GetRunFailures(runTaskOut *ecs.RunTaskOutput) error {
+	if len(runTaskOut.Failures) == 0 {
+		return nil
+	}
+	return &RunFailuresError{Failures: runTaskOut.Failures}
+}
+
+// capacityFailureReasons are the RunTask failure reasons, or their prefixes, given when Fargate has no room for
+// the task at the moment
+var capacityFailureReasons = []string{"Capacity is unavailable", "RESOURCE:", "You've reached the limit"}
+
+// throttlingErrorCodes are the ECS API error codes returned when too many tasks are being started
+var throttlingErrorCodes = []string{"ThrottlingException", "LimitExceededException"}
+
+// IsCapacityError reports whether err, from RunTask or GetRunFailures, means ECS could not start the task for now,
+// so that running it again later may succeed.
+func IsCapacityError(err error) bool {
+	var failures *RunFailuresError
+	if errors.As(err, &failures) {
+		for _, failure := range failures.Failures {
+			reason := aws.ToString(failure.Reason)
+			for _, capacityReason := range capacityFailureReasons {
+				if strings.HasPrefix(reason, capacityReason) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		for _, code := range throttlingErrorCodes {
+			if apiErr.ErrorCode() == code {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -0,0 +1,164 @@
+// Package schedule parses the five-field cron expressions of auto-deploy policies, such as "0 3 * * 1-5", and
+// finds the times they name. Times are in UTC.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch bounds Next, so that an expression that can never match, such as "0 0 31 2 *", is not searched forever
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// a day matches either day field when both are restricted, and both fields otherwise, as in cron
+	domRestricted, dowRestricted bool
+}
+
+// Parse parses a cron expression of five space-separated fields: minute, hour, day of month, month and day of
+// week, with Sunday as 0 (or 7). A field is *, or a comma-separated list of values and ranges such as 1-5, each
+// of which may have a step such as */15 or 0-30/10.
+func Parse(expression string) (Schedule, error) {
+	parts := strings.Fields(expression)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("expected %d fields, got %d", len(fields), len(parts))
+	}
+	sets := make([]uint64, len(fields))
+	for i, f := range fields {
+		set, err := parseField(parts[i], f)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("%s: %w", f.name, err)
+		}
+		sets[i] = set
+	}
+	// 7 is Sunday too
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return Schedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: !strings.HasPrefix(parts[2], "*"),
+		dowRestricted: !strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func parseField(expression string, f field) (uint64, error) {
+	var set uint64
+	max := f.max
+	if f.name == "day of week" {
+		max = 7
+	}
+	for _, item := range strings.Split(expression, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		from, to := f.min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			start, end, _ := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = value(start, f.min, max); err != nil {
+				return 0, err
+			}
+			if to, err = value(end, f.min, max); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			n, err := value(rangePart, f.min, max)
+			if err != nil {
+				return 0, err
+			}
+			from = n
+			// a value with a step, such as 5/15, runs to the end of the field's range
+			if !hasStep {
+				to = n
+			}
+		}
+		for n := from; n <= to; n += step {
+			set |= 1 << n
+		}
+	}
+	return set, nil
+}
+
+func value(s string, min, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %d is not from %d to %d", n, min, max)
+	}
+	return n, nil
+}
+
+// Matches reports whether the schedule names the minute t is in
+func (s Schedule) Matches(t time.Time) bool {
+	t = t.UTC()
+	return has(s.minute, t.Minute()) && has(s.hour, t.Hour()) && has(s.month, int(t.Month())) && s.matchesDay(t)
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next returns the first time after t that the schedule names, or the zero time if there is none within five years
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		switch {
+		case !has(s.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !has(s.hour, t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !has(s.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func has(set uint64, n int) bool {
+	return set&(1<<n) != 0
+}
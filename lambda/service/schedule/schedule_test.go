@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, expression := range []string{"* * * * *", "0 3 * * 1-5", "*/15 0-6,18 1,15 */2 7", "5/20 * * * 0"} {
+		_, err := Parse(expression)
+		assert.NoError(t, err, expression)
+	}
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@daily"} {
+		_, err := Parse(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	from := time.Date(2026, 10, 16, 10, 7, 30, 0, time.UTC) // a Friday
+	for expression, want := range map[string]time.Time{
+		"* * * * *":        time.Date(2026, 10, 16, 10, 8, 0, 0, time.UTC),
+		"*/15 * * * *":     time.Date(2026, 10, 16, 10, 15, 0, 0, time.UTC),
+		"0 3 * * *":        time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC),
+		"0 3 * * 1-5":      time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC),
+		"30 9 1 * *":       time.Date(2026, 11, 1, 9, 30, 0, 0, time.UTC),
+		"0 0 1 1 *":        time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		"0 12 1 * 0":       time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), // either day field
+		"0 0 29 2 *":       time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		"7 10 16 10 *":     time.Date(2027, 10, 16, 10, 7, 0, 0, time.UTC), // strictly after
+		"0 0 31 2 *":       {},
+		"0 6 * * 7":        time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC),
+		"45 10-12/2 * * *": time.Date(2026, 10, 16, 10, 45, 0, 0, time.UTC),
+	} {
+		s, err := Parse(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, want, s.Next(from), expression)
+		if !want.IsZero() {
+			assert.True(t, s.Matches(want), expression)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package store_dynamodb
 
 import (
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
@@ -8,6 +10,7 @@ import (
 type Application struct {
 	Uuid                     string `dynamodbav:"uuid"`
 	Name                     string `dynamodbav:"name"`
+	NameSortKey              string `dynamodbav:"nameSortKey,omitempty"`
 	Description              string `dynamodbav:"description"`
 	ApplicationType          string `dynamodbav:"applicationType"`
 	ApplicationId            string `dynamodbav:"applicationId"`
@@ -22,6 +25,8 @@ type Application struct {
 
 	SourceType string `dynamodbav:"sourceType"`
 	SourceUrl  string `dynamodbav:"sourceUrl"`
+	// Build is set when the application is not built from the root of its repository with the defaults
+	Build *BuildOptions `dynamodbav:"build,omitempty"`
 
 	DestinationType string `dynamodbav:"destinationType"`
 	DestinationUrl  string `dynamodbav:"destinationUrl"`
@@ -41,6 +46,61 @@ type Application struct {
 	CommandArguments interface{} `dynamodbav:"commandArguments"`
 
 	Status string `dynamodbav:"registrationStatus"`
+
+	// AutoDeploy is the application's auto-deploy policy, if it has one. AutoDeployedAt is when the poller last
+	// considered a scheduled deployment due, so that each scheduled time deploys once.
+	AutoDeploy     *AutoDeployPolicy `dynamodbav:"autoDeploy,omitempty"`
+	AutoDeployedAt *time.Time        `dynamodbav:"autoDeployedAt,omitempty"`
+	// BuildSecrets reference the secrets the application's image is built with. Their values are never stored.
+	BuildSecrets []BuildSecret `dynamodbav:"buildSecrets,omitempty"`
+
+	// Version is incremented by Update; items written before versioning read as 0
+	Version int64 `dynamodbav:"version"`
+}
+
+// AutoDeployPolicy redeploys an application on a cron Schedule, or when a tag matching TagPattern is pushed.
+type AutoDeployPolicy struct {
+	Schedule   string `dynamodbav:"schedule,omitempty"`
+	TagPattern string `dynamodbav:"tagPattern,omitempty"`
+}
+
+// BuildSecret references an SSM parameter or Secrets Manager secret passed to a build as the build arg Name
+type BuildSecret struct {
+	Name   string `dynamodbav:"name"`
+	Store  string `dynamodbav:"store"`
+	Secret string `dynamodbav:"secret"`
+}
+
+// BuildOptions are the kaniko options an application's image is built with
+type BuildOptions struct {
+	ContextDir string            `dynamodbav:"contextDir,omitempty"`
+	Dockerfile string            `dynamodbav:"dockerfile,omitempty"`
+	BuildArgs  map[string]string `dynamodbav:"buildArgs,omitempty"`
+	Target     string            `dynamodbav:"target,omitempty"`
+}
+
+// GetContextDir returns the context directory of options, which may be nil
+func (o *BuildOptions) GetContextDir() string {
+	if o == nil {
+		return ""
+	}
+	return o.ContextDir
+}
+
+// ApplicationUpdate holds the attributes of an application that can be changed after registration.
+type ApplicationUpdate struct {
+	Name             string
+	Description      string
+	Params           interface{}
+	CommandArguments interface{}
+	CPU              int
+	Memory           int
+	RunOnGPU         bool
+	ComputeTypes     []string
+	// AutoDeploy is removed when nil
+	AutoDeploy *AutoDeployPolicy
+	// BuildSecrets are removed when empty
+	BuildSecrets []BuildSecret
 }
 
 type ApplicationKey struct {
@@ -57,7 +117,7 @@ func (i Application) GetKey() map[string]types.AttributeValue {
 }
 
 // AppStoreApplication represents an application in the appstore.
-// One record per unique sourceUrl (the git repository).
+// One record per unique sourceUrl (the git repository) and build context directory in it.
 type AppStoreApplication struct {
 	Uuid       string `dynamodbav:"uuid"`
 	SourceUrl  string `dynamodbav:"sourceUrl"`
@@ -66,6 +126,10 @@ type AppStoreApplication struct {
 	Visibility string `dynamodbav:"visibility"`
 	OwnerId    string `dynamodbav:"ownerId"`
 	CreatedAt  string `dynamodbav:"createdAt"`
+	// Build holds the options the application is built with, its context directory among them
+	Build *BuildOptions `dynamodbav:"build,omitempty"`
+	// Version is incremented by UpdateVisibility
+	Version int64 `dynamodbav:"version"`
 }
 
 type AppAccess struct {
@@ -99,6 +163,8 @@ type AppStoreVersion struct {
 	DestinationUrl string `dynamodbav:"destinationUrl"`
 	CreatedAt      string `dynamodbav:"createdAt"`
 	Status         string `dynamodbav:"registrationStatus"`
+	// RecordVersion is incremented by UpdateStatus. Version is the release tag.
+	RecordVersion int64 `dynamodbav:"recordVersion"`
 }
 
 func (i AppStoreVersion) GetKey() map[string]types.AttributeValue {
@@ -26,7 +26,7 @@ type AppStoreDBStore interface {
 	GetAll(context.Context) ([]AppStoreApplication, error)
 	GetById(context.Context, string) (*AppStoreApplication, error)
 	Insert(context.Context, AppStoreApplication) error
-	UpdateVisibility(context.Context, string, string) error
+	UpdateVisibility(ctx context.Context, uuid string, visibility string, expectedVersion int64) error
 }
 
 type AppStoreDatabaseStore struct {
@@ -109,14 +109,20 @@ func (r *AppStoreDatabaseStore) GetById(ctx context.Context, uuid string) (*AppS
 	return &app, nil
 }
 
-func (r *AppStoreDatabaseStore) UpdateVisibility(ctx context.Context, uuid string, visibility string) error {
+// UpdateVisibility sets the visibility and increments the version, provided the stored version still equals
+// expectedVersion. Otherwise it returns ErrVersionConflict.
+func (r *AppStoreDatabaseStore) UpdateVisibility(ctx context.Context, uuid string, visibility string, expectedVersion int64) error {
 	uuidAv, err := attributevalue.Marshal(uuid)
 	if err != nil {
 		return fmt.Errorf("error marshaling uuid: %w", err)
 	}
 
-	update := expression.Set(expression.Name("visibility"), expression.Value(visibility))
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	update := expression.Set(expression.Name("visibility"), expression.Value(visibility)).
+		Set(expression.Name("version"), expression.Value(expectedVersion+1))
+	expr, err := expression.NewBuilder().
+		WithCondition(versionCondition("version", expectedVersion)).
+		WithUpdate(update).
+		Build()
 	if err != nil {
 		return fmt.Errorf("error building update expression: %w", err)
 	}
@@ -126,8 +132,12 @@ func (r *AppStoreDatabaseStore) UpdateVisibility(ctx context.Context, uuid strin
 		Key:                       map[string]dynamodbTypes.AttributeValue{"uuid": uuidAv},
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
+		ConditionExpression:       expr.Condition(),
 		UpdateExpression:          expr.Update(),
 	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("appstore application %s version %d: %w", uuid, expectedVersion, ErrVersionConflict)
+	}
 	if err != nil {
 		return fmt.Errorf("error updating visibility: %w", err)
 	}
@@ -141,7 +151,11 @@ func (r *AppStoreDatabaseStore) Insert(ctx context.Context, application AppStore
 	}
 	_, err = r.api.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(r.TableName), Item: item,
+		ConditionExpression: insertCondition, ExpressionAttributeNames: insertConditionNames,
 	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("appstore application %s: %w", application.Uuid, ErrAlreadyExists)
+	}
 	if err != nil {
 		return fmt.Errorf("error inserting appstore application: %w", err)
 	}
@@ -23,6 +23,7 @@ type ArgCaptureAppStoreTableAPI struct {
 	QueryOutput   *dynamodb.QueryOutput
 	ScanOutput    *dynamodb.ScanOutput
 	GetItemOutput *dynamodb.GetItemOutput
+	UpdateItemErr error
 }
 
 func (m *ArgCaptureAppStoreTableAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
@@ -56,6 +57,9 @@ func (m *ArgCaptureAppStoreTableAPI) GetItem(_ context.Context, params *dynamodb
 
 func (m *ArgCaptureAppStoreTableAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 	m.UpdateItemInput = params
+	if m.UpdateItemErr != nil {
+		return nil, m.UpdateItemErr
+	}
 	return &dynamodb.UpdateItemOutput{}, nil
 }
 
@@ -77,6 +81,8 @@ func TestAppStoreDatabaseStore_Insert(t *testing.T) {
 
 	require.NotNil(t, mock.PutItemInput)
 	assert.Equal(t, tableName, aws.ToString(mock.PutItemInput.TableName))
+	// inserts never replace an existing record
+	assert.Equal(t, "attribute_not_exists(#uuid)", aws.ToString(mock.PutItemInput.ConditionExpression))
 
 	// Verify the item was marshaled correctly
 	var roundTripped AppStoreApplication
@@ -267,10 +273,28 @@ func TestAppStoreDatabaseStore_UpdateVisibility(t *testing.T) {
 	tableName := "test-table"
 	store := NewAppStoreDatabaseStore(mock, tableName)
 
-	err := store.UpdateVisibility(context.Background(), "test-uuid", "private")
+	err := store.UpdateVisibility(context.Background(), "test-uuid", "private", 2)
 	require.NoError(t, err)
 	require.NotNil(t, mock.UpdateItemInput)
 	assert.Equal(t, tableName, aws.ToString(mock.UpdateItemInput.TableName))
+	assert.NotEmpty(t, aws.ToString(mock.UpdateItemInput.ConditionExpression))
+	numbers := map[string]bool{}
+	for _, v := range mock.UpdateItemInput.ExpressionAttributeValues {
+		if n, ok := v.(*types.AttributeValueMemberN); ok {
+			numbers[n.Value] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"2": true, "3": true}, numbers)
+}
+
+func TestAppStoreDatabaseStore_UpdateVisibilityVersionConflict(t *testing.T) {
+	mock := &ArgCaptureAppStoreTableAPI{
+		UpdateItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed")},
+	}
+	store := NewAppStoreDatabaseStore(mock, "test-table")
+
+	err := store.UpdateVisibility(context.Background(), "test-uuid", "private", 2)
+	assert.ErrorIs(t, err, ErrVersionConflict)
 }
 
 func TestAppStoreApplication_VisibilityAndOwnerFields(t *testing.T) {
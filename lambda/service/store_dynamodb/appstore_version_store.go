@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 )
 
 // AppStoreVersionTableAPI is a narrow interface containing only the DynamoDB client methods used by AppStoreVersionDatabaseStore.
@@ -101,7 +102,11 @@ func (r *AppStoreVersionDatabaseStore) Insert(ctx context.Context, version AppSt
 	}
 	_, err = r.api.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(r.TableName), Item: item,
+		ConditionExpression: insertCondition, ExpressionAttributeNames: insertConditionNames,
 	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("appstore version %s: %w", version.Uuid, ErrAlreadyExists)
+	}
 	if err != nil {
 		return fmt.Errorf("error inserting appstore version: %w", err)
 	}
@@ -115,16 +120,20 @@ func (r *AppStoreVersionDatabaseStore) UpdateStatus(ctx context.Context, newStat
 		return fmt.Errorf("error marshaling key for appstore version status update: %w", err)
 	}
 
-	_, err = r.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	in := &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.TableName),
 		Key:       key,
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":s": &types.AttributeValueMemberS{Value: newStatus},
+			":s":   &types.AttributeValueMemberS{Value: newStatus},
+			":one": &types.AttributeValueMemberN{Value: "1"},
 		},
-		UpdateExpression: aws.String("set registrationStatus = :s"),
-	})
-	if err != nil {
-		return fmt.Errorf("error updating appstore version status: %w", err)
+		UpdateExpression: aws.String("set registrationStatus = :s add recordVersion :one"),
+	}
+	if err := withTransition(in, statemachine.Version, newStatus); err != nil {
+		return err
+	}
+	if _, err = r.api.UpdateItem(ctx, in); err != nil {
+		return fmt.Errorf("error updating appstore version status: %w", transitionError(err, statemachine.Version, newStatus))
 	}
 
 	return nil
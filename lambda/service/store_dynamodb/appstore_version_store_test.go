@@ -213,9 +213,16 @@ func TestAppStoreVersionDatabaseStore_UpdateStatus(t *testing.T) {
 	// Verify the key contains the uuid
 	assert.Equal(t, &types.AttributeValueMemberS{Value: versionUuid}, mock.UpdateItemInput.Key["uuid"])
 
-	// Verify update expression sets registrationStatus
-	assert.Equal(t, "set registrationStatus = :s", aws.ToString(mock.UpdateItemInput.UpdateExpression))
+	// Verify update expression sets registrationStatus and bumps the record version
+	assert.Equal(t, "set registrationStatus = :s add recordVersion :one", aws.ToString(mock.UpdateItemInput.UpdateExpression))
 	assert.Equal(t, &types.AttributeValueMemberS{Value: newStatus}, mock.UpdateItemInput.ExpressionAttributeValues[":s"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1"}, mock.UpdateItemInput.ExpressionAttributeValues[":one"])
+
+	// only a version being built can be deployed
+	assert.Equal(t, "attribute_exists(uuid) AND (#registrationStatus IN (:from0, :from1))", aws.ToString(mock.UpdateItemInput.ConditionExpression))
+	assert.Equal(t, "registrationStatus", mock.UpdateItemInput.ExpressionAttributeNames["#registrationStatus"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "deploying"}, mock.UpdateItemInput.ExpressionAttributeValues[":from0"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "deployed"}, mock.UpdateItemInput.ExpressionAttributeValues[":from1"])
 }
 
 func TestAppStoreVersion_MarshalRoundTrip(t *testing.T) {
@@ -6,6 +6,35 @@ import "time"
 
 const DeploymentIdField = "deploymentId"
 const DeploymentApplicationIdField = "applicationId"
+const DeploymentInitiatedAtField = "initiatedAt"
+const DeploymentActionField = "action"
+const DeploymentErroredField = "errored"
+const DeploymentLastStatusField = "lastStatus"
+const DeploymentCancelledField = "cancelled"
+const DeploymentCancelledAtField = "cancelledAt"
+const DeploymentCancelledByField = "cancelledBy"
+const DeploymentProvisionerTaskArnField = "provisionerTaskArn"
+const DeploymentTimelineField = "timeline"
+
+// DeploymentStatusStopped is the ECS lastStatus of a deployment whose deployer task has finished
+const DeploymentStatusStopped = "STOPPED"
+
+// DeploymentStatusNotStarted is the lastStatus of a deployment until its deployer task reports its status
+const DeploymentStatusNotStarted = "NOT_STARTED"
+
+// DeploymentStatusQueued is the lastStatus of a deployment waiting for its application's deployment lease
+const DeploymentStatusQueued = "QUEUED"
+
+// Triggers of deployments started by an application's auto-deploy policy, when it is polled or when GitHub reports
+// a new tag
+const (
+	DeploymentTriggerSchedule = "schedule"
+	DeploymentTriggerTag      = "tag"
+	DeploymentTriggerWebhook  = "webhook"
+)
+
+// DeploymentsInitiatedAtIndex is the GSI used to list an application's deployments in initiatedAt order
+const DeploymentsInitiatedAtIndex = "applicationId-initiatedAt-index"
 
 type DeploymentKey struct {
 	ApplicationId string `dynamodbav:"applicationId"`
@@ -23,8 +52,15 @@ type Deployment struct {
 	LastStatus      string    `dynamodbav:"lastStatus"`
 	DesiredStatus   string    `dynamodbav:"desiredStatus"`
 	TaskArn         string    `dynamodbav:"taskArn"`
-	SourceUrl       string    `dynamodbav:"sourceUrl,omitempty"`
-	Tag             string    `dynamodbav:"tag,omitempty"`
+	// ProvisionerTaskArn is the provisioner task that started the deployment. TaskArn is its deployer task.
+	ProvisionerTaskArn string `dynamodbav:"provisionerTaskArn,omitempty"`
+	SourceUrl          string `dynamodbav:"sourceUrl,omitempty"`
+	Tag                string `dynamodbav:"tag,omitempty"`
+	// Branch is the branch built, if a branch rather than a tag was requested. A requested commit is recorded
+	// as CommitSha when the deployment is created.
+	Branch string `dynamodbav:"branch,omitempty"`
+	// Trigger is the auto-deploy policy that started the deployment, if it was not requested through the API
+	Trigger string `dynamodbav:"trigger,omitempty"`
 
 	// UpdatedAt is not in the reference. Assume it is the time this state change happened.
 	UpdatedAt *time.Time `dynamodbav:"updatedAt,omitempty"`
@@ -44,4 +80,74 @@ type Deployment struct {
 	StopCode      string `dynamodbav:"stopCode,omitempty"`
 	StoppedReason string `dynamodbav:"stoppedReason,omitempty"`
 	Errored       bool   `dynamodbav:"errored,omitempty"`
+
+	// Cancelled is set when a user cancels the deployment before it finishes
+	Cancelled   bool       `dynamodbav:"cancelled,omitempty"`
+	CancelledAt *time.Time `dynamodbav:"cancelledAt,omitempty"`
+	CancelledBy string     `dynamodbav:"cancelledBy,omitempty"`
+
+	// ImageTag is the per-deployment tag the deployer pushed the image with. ImageDigest is recorded once the
+	// image has been resolved, at the latest when a rollback uses it.
+	ImageTag    string `dynamodbav:"imageTag,omitempty"`
+	ImageDigest string `dynamodbav:"imageDigest,omitempty"`
+	// RollbackOf is set on a ROLLBACK deployment to the deployment whose image it restored
+	RollbackOf string `dynamodbav:"rollbackOf,omitempty"`
+
+	// Build metadata recorded by the provisioner. CommitSha and DeployerTaskDefinition (an ARN, so including its
+	// revision) are known when the build starts; ImageSizeBytes and BuildDurationSeconds once the image is pushed.
+	CommitSha              string `dynamodbav:"commitSha,omitempty"`
+	DeployerTaskDefinition string `dynamodbav:"deployerTaskDefinition,omitempty"`
+	ImageSizeBytes         int64  `dynamodbav:"imageSizeBytes,omitempty"`
+	BuildDurationSeconds   int64  `dynamodbav:"buildDurationSeconds,omitempty"`
+
+	// Attempt is set by the status listener when a deployment that failed transiently is retried, from 2.
+	// LastError is the transient error the provisioner recorded, if it failed rather than ECS.
+	Attempt   int    `dynamodbav:"attempt,omitempty"`
+	LastError string `dynamodbav:"lastError,omitempty"`
+
+	// Timeline is appended to by the service, the provisioner and the status listener as the deployment runs
+	Timeline []StepEvent `dynamodbav:"timeline,omitempty"`
+}
+
+// Deployment steps, in the order they happen. Not every deployment has every step: only a new application runs
+// terraform, a redeploy only registers a task definition when it has to unpin a rolled back image, and a rollback
+// builds nothing. Provisioning is the provisioner task starting.
+const (
+	StepProvisioning             = "provisioning"
+	StepTerraformApply           = "terraform_apply"
+	StepTaskDefinitionRegistered = "task_definition_registered"
+	StepImageBuild               = "image_build"
+	StepImagePush                = "image_push"
+	StepDone                     = "done"
+)
+
+// Steps lists the deployment steps in order
+var Steps = []string{StepProvisioning, StepTerraformApply, StepTaskDefinitionRegistered, StepImageBuild, StepImagePush, StepDone}
+
+// StepRetry marks the start of a deployment's next attempt in its timeline. It is not a step of its own: the steps
+// before it are those of earlier attempts.
+const StepRetry = "retry"
+
+// Outcomes of a step. A step that has started but not ended has no outcome.
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepCancelled = "cancelled"
+)
+
+// StepEvent is an entry in a deployment's append-only timeline: a step starting, or ending with an outcome.
+type StepEvent struct {
+	Step    string    `dynamodbav:"step"`
+	Outcome string    `dynamodbav:"outcome,omitempty"`
+	Time    time.Time `dynamodbav:"time"`
+}
+
+// Succeeded reports whether the deployment finished and left an image that can be rolled back to.
+func (d Deployment) Succeeded() bool {
+	return d.LastStatus == DeploymentStatusStopped && !d.Errored && !d.Cancelled && d.ImageTag != ""
+}
+
+// Finished reports whether the deployment has stopped, failed or been cancelled, so nothing more will be logged.
+func (d Deployment) Finished() bool {
+	return d.LastStatus == DeploymentStatusStopped || d.Errored || d.Cancelled
 }
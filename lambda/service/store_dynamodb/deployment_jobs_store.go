@@ -0,0 +1,238 @@
+package store_dynamodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Statuses of a DeploymentJob
+const (
+	// JobStatusWaiting is a job whose deployment is queued behind another holding the application's lease
+	JobStatusWaiting = "WAITING"
+	// JobStatusPending is a job ready to be dispatched once there is capacity for it
+	JobStatusPending = "PENDING"
+	// JobStatusDispatching is a job claimed by a dispatcher, which is running its provisioner task
+	JobStatusDispatching = "DISPATCHING"
+	JobStatusDispatched  = "DISPATCHED"
+	JobStatusFailed      = "FAILED"
+	JobStatusCancelled   = "CANCELLED"
+)
+
+// *Field consts should match the dynamodbav struct tag for the field
+
+const DeploymentJobIdField = "jobId"
+const DeploymentJobStatusField = "status"
+const DeploymentJobCreatedAtField = "createdAt"
+const DeploymentJobAttemptsField = "attempts"
+
+// DeploymentJobStatusIndex lists jobs with a status, oldest first
+const DeploymentJobStatusIndex = "status-createdAt-index"
+
+// DeploymentJobRetention is how long a finished job is kept, through the table's TTL
+const DeploymentJobRetention = 7 * 24 * time.Hour
+
+// DeploymentJobsTableAPI is an interface only containing the
+// DynamoDB client methods used by DeploymentJobsStore
+type DeploymentJobsTableAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// DeploymentJob is a provisioner task waiting to be run by the dispatcher, which starts jobs in the order they were
+// queued as concurrency limits allow.
+type DeploymentJob struct {
+	// JobId is the deployment id for jobs that have a deployment
+	JobId         string    `dynamodbav:"jobId"`
+	Status        string    `dynamodbav:"status"`
+	Action        string    `dynamodbav:"action"`
+	ApplicationId string    `dynamodbav:"applicationId"`
+	DeploymentId  string    `dynamodbav:"deploymentId,omitempty"`
+	CreatedAt     time.Time `dynamodbav:"createdAt"`
+	// ComputeNodeUuid is the compute node the job deploys to, which limits how many of its jobs run at once
+	ComputeNodeUuid string `dynamodbav:"computeNodeUuid,omitempty"`
+	// RunTask is the JSON encoded ecs.RunTaskInput of the provisioner task
+	RunTask string `dynamodbav:"runTask"`
+
+	// Attempt is the attempt at the deployment the job runs, from 1, set by the status listener when it requeues a
+	// job whose provisioner task failed transiently. Attempts counts the runs of the current attempt ECS turned
+	// away for lack of capacity.
+	Attempt       int       `dynamodbav:"attempt,omitempty"`
+	Attempts      int       `dynamodbav:"attempts"`
+	NextAttemptAt time.Time `dynamodbav:"nextAttemptAt"`
+	LastError     string    `dynamodbav:"lastError,omitempty"`
+	TaskArn       string    `dynamodbav:"taskArn,omitempty"`
+	// ExpiresAt is the table TTL attribute, in epoch seconds, set once the job is finished
+	ExpiresAt int64 `dynamodbav:"expiresAt,omitempty"`
+}
+
+type DeploymentJobsStore struct {
+	api       DeploymentJobsTableAPI
+	tableName string
+}
+
+func NewDeploymentJobsStore(api DeploymentJobsTableAPI, tableName string) *DeploymentJobsStore {
+	return &DeploymentJobsStore{
+		api:       api,
+		tableName: tableName,
+	}
+}
+
+// Insert stores a new job
+func (s *DeploymentJobsStore) Insert(ctx context.Context, job DeploymentJob) error {
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return fmt.Errorf("error marshaling deployment job %s: %w", job.JobId, err)
+	}
+	expressions, err := expression.NewBuilder().
+		WithCondition(expression.AttributeNotExists(expression.Name(DeploymentJobIdField))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building condition for deployment job %s: %w", job.JobId, err)
+	}
+	if _, err := s.api.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(s.tableName),
+		Item:                     item,
+		ConditionExpression:      expressions.Condition(),
+		ExpressionAttributeNames: expressions.Names(),
+	}); err != nil {
+		return fmt.Errorf("error inserting deployment job %s: %w", job.JobId, err)
+	}
+	return nil
+}
+
+// Pending returns the jobs waiting to be dispatched, oldest first
+func (s *DeploymentJobsStore) Pending(ctx context.Context) ([]DeploymentJob, error) {
+	expressions, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(DeploymentJobStatusField).Equal(expression.Value(JobStatusPending))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building pending deployment jobs query: %w", err)
+	}
+	var jobs []DeploymentJob
+	paginator := dynamodb.NewQueryPaginator(s.api, &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		IndexName:                 aws.String(DeploymentJobStatusIndex),
+		KeyConditionExpression:    expressions.KeyCondition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error querying pending deployment jobs: %w", err)
+		}
+		var pageJobs []DeploymentJob
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageJobs); err != nil {
+			return nil, fmt.Errorf("error unmarshaling pending deployment jobs: %w", err)
+		}
+		jobs = append(jobs, pageJobs...)
+	}
+	return jobs, nil
+}
+
+// Release makes a waiting job pending, once its deployment has been handed the application's lease. It returns
+// false if the job is not waiting.
+func (s *DeploymentJobsStore) Release(ctx context.Context, jobId string, now time.Time) (bool, error) {
+	update := expression.Set(expression.Name(DeploymentJobStatusField), expression.Value(JobStatusPending)).
+		Set(expression.Name("nextAttemptAt"), expression.Value(now.UTC()))
+	return s.transition(ctx, jobId, JobStatusWaiting, update)
+}
+
+// Claim makes a pending job dispatching, so that only one dispatcher runs it. Pending reads an index that may be
+// behind the table, so the job must still have the attempts it was read with. It returns false if the job has
+// been claimed or changed since.
+func (s *DeploymentJobsStore) Claim(ctx context.Context, jobId string, attempts int) (bool, error) {
+	condition := expression.Name(DeploymentJobStatusField).Equal(expression.Value(JobStatusPending)).
+		And(expression.Name(DeploymentJobAttemptsField).Equal(expression.Value(attempts)))
+	update := expression.Set(expression.Name(DeploymentJobStatusField), expression.Value(JobStatusDispatching))
+	return s.update(ctx, jobId, condition, update)
+}
+
+// Retry makes a dispatching job pending again, for a later attempt, after ECS turned it away with err
+func (s *DeploymentJobsStore) Retry(ctx context.Context, jobId string, attempts int, nextAttemptAt time.Time, err error) error {
+	update := expression.Set(expression.Name(DeploymentJobStatusField), expression.Value(JobStatusPending)).
+		Set(expression.Name(DeploymentJobAttemptsField), expression.Value(attempts)).
+		Set(expression.Name("nextAttemptAt"), expression.Value(nextAttemptAt.UTC())).
+		Set(expression.Name("lastError"), expression.Value(err.Error()))
+	_, updateErr := s.transition(ctx, jobId, JobStatusDispatching, update)
+	return updateErr
+}
+
+// SetDispatched records the task a dispatching job was run as
+func (s *DeploymentJobsStore) SetDispatched(ctx context.Context, jobId string, taskArn string, now time.Time) error {
+	update := finish(JobStatusDispatched, now).Set(expression.Name("taskArn"), expression.Value(taskArn))
+	dispatched, err := s.transition(ctx, jobId, JobStatusDispatching, update)
+	if err == nil && !dispatched {
+		return fmt.Errorf("error recording dispatch of deployment job %s: job is no longer %s", jobId, JobStatusDispatching)
+	}
+	return err
+}
+
+// SetFailed records that a dispatching job could not be run
+func (s *DeploymentJobsStore) SetFailed(ctx context.Context, jobId string, attempts int, err error, now time.Time) error {
+	update := finish(JobStatusFailed, now).
+		Set(expression.Name(DeploymentJobAttemptsField), expression.Value(attempts)).
+		Set(expression.Name("lastError"), expression.Value(err.Error()))
+	_, updateErr := s.transition(ctx, jobId, JobStatusDispatching, update)
+	return updateErr
+}
+
+// Cancel stops a job that has not been dispatched from running. It returns the status the job was cancelled
+// from, or "" if there was no job to cancel.
+func (s *DeploymentJobsStore) Cancel(ctx context.Context, jobId string, now time.Time) (string, error) {
+	for _, from := range []string{JobStatusWaiting, JobStatusPending} {
+		cancelled, err := s.transition(ctx, jobId, from, finish(JobStatusCancelled, now))
+		if err != nil {
+			return "", err
+		}
+		if cancelled {
+			return from, nil
+		}
+	}
+	return "", nil
+}
+
+// finish is the update ending a job with status, after which the job expires
+func finish(status string, now time.Time) expression.UpdateBuilder {
+	return expression.Set(expression.Name(DeploymentJobStatusField), expression.Value(status)).
+		Set(expression.Name("expiresAt"), expression.Value(now.Add(DeploymentJobRetention).Unix()))
+}
+
+// transition applies update to the job if its status is from. It returns false if the job is not in that status.
+func (s *DeploymentJobsStore) transition(ctx context.Context, jobId string, from string, update expression.UpdateBuilder) (bool, error) {
+	return s.update(ctx, jobId, expression.Name(DeploymentJobStatusField).Equal(expression.Value(from)), update)
+}
+
+// update applies update to the job if condition holds. It returns false if it does not.
+func (s *DeploymentJobsStore) update(ctx context.Context, jobId string, condition expression.ConditionBuilder, update expression.UpdateBuilder) (bool, error) {
+	expressions, err := expression.NewBuilder().
+		WithCondition(condition).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("error building update for deployment job %s: %w", jobId, err)
+	}
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       map[string]types.AttributeValue{DeploymentJobIdField: &types.AttributeValueMemberS{Value: jobId}},
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	if isConditionFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error updating deployment job %s: %w", jobId, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,187 @@
+package store_dynamodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ArgCaptureDeploymentJobsTableAPI struct {
+	PutItemInput     *dynamodb.PutItemInput
+	UpdateItemInputs []*dynamodb.UpdateItemInput
+	QueryInput       *dynamodb.QueryInput
+	QueryOutput      *dynamodb.QueryOutput
+
+	// UpdateItemErrs are returned from UpdateItem calls in turn
+	UpdateItemErrs []error
+}
+
+func (m *ArgCaptureDeploymentJobsTableAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.PutItemInput = params
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *ArgCaptureDeploymentJobsTableAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.UpdateItemInputs = append(m.UpdateItemInputs, params)
+	if len(m.UpdateItemErrs) > 0 {
+		err := m.UpdateItemErrs[0]
+		m.UpdateItemErrs = m.UpdateItemErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *ArgCaptureDeploymentJobsTableAPI) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.QueryInput = params
+	if m.QueryOutput == nil {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	return m.QueryOutput, nil
+}
+
+func conditionFailed() error {
+	return &types.ConditionalCheckFailedException{Message: aws.String("failed")}
+}
+
+// statusValues returns the string values of an update, which include the status it is conditioned on and the one
+// it sets
+func statusValues(in *dynamodb.UpdateItemInput) []string {
+	var values []string
+	for _, v := range in.ExpressionAttributeValues {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			values = append(values, s.Value)
+		}
+	}
+	return values
+}
+
+func TestDeploymentJobsStore_InsertIsConditional(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	err := store.Insert(context.Background(), DeploymentJob{JobId: "deploy-1", Status: JobStatusPending, Action: "DEPLOY"})
+	require.NoError(t, err)
+
+	require.NotNil(t, mock.PutItemInput)
+	assert.Contains(t, aws.ToString(mock.PutItemInput.ConditionExpression), "attribute_not_exists")
+	var job DeploymentJob
+	require.NoError(t, attributevalue.UnmarshalMap(mock.PutItemInput.Item, &job))
+	assert.Equal(t, JobStatusPending, job.Status)
+	// a job is only given an expiry once it is finished
+	assert.NotContains(t, mock.PutItemInput.Item, "expiresAt")
+}
+
+func TestDeploymentJobsStore_PendingQueriesStatusIndex(t *testing.T) {
+	item, err := attributevalue.MarshalMap(DeploymentJob{JobId: "deploy-1", Status: JobStatusPending})
+	require.NoError(t, err)
+	mock := &ArgCaptureDeploymentJobsTableAPI{
+		QueryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{item}},
+	}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	jobs, err := store.Pending(context.Background())
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "deploy-1", jobs[0].JobId)
+	assert.Equal(t, DeploymentJobStatusIndex, aws.ToString(mock.QueryInput.IndexName))
+	assert.Contains(t, mock.QueryInput.ExpressionAttributeValues, ":0")
+}
+
+func TestDeploymentJobsStore_ReleaseOnlyWaitingJobs(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{UpdateItemErrs: []error{conditionFailed()}}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	released, err := store.Release(context.Background(), "deploy-1", time.Now())
+	require.NoError(t, err)
+	assert.False(t, released)
+	require.Len(t, mock.UpdateItemInputs, 1)
+	values := statusValues(mock.UpdateItemInputs[0])
+	assert.Contains(t, values, JobStatusWaiting)
+	assert.Contains(t, values, JobStatusPending)
+}
+
+func TestDeploymentJobsStore_SetDispatchedExpiresJob(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	err := store.SetDispatched(context.Background(), "deploy-1", "task-1", time.Unix(1000, 0))
+	require.NoError(t, err)
+	require.Len(t, mock.UpdateItemInputs, 1)
+	in := mock.UpdateItemInputs[0]
+	assert.ElementsMatch(t, []string{JobStatusDispatching, JobStatusDispatched, "task-1"}, statusValues(in))
+	assert.Contains(t, in.ExpressionAttributeValues, ":2")
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "605800"}, in.ExpressionAttributeValues[":2"])
+}
+
+func TestDeploymentJobsStore_SetDispatchedRequiresClaim(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{UpdateItemErrs: []error{conditionFailed()}}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	err := store.SetDispatched(context.Background(), "deploy-1", "task-1", time.Now())
+	assert.Error(t, err)
+}
+
+func TestDeploymentJobsStore_ClaimIsConditionalOnAttempts(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	claimed, err := store.Claim(context.Background(), "deploy-1", 2)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	require.Len(t, mock.UpdateItemInputs, 1)
+	in := mock.UpdateItemInputs[0]
+	assert.ElementsMatch(t, []string{JobStatusPending, JobStatusDispatching}, statusValues(in))
+	assert.Contains(t, aws.ToString(in.ConditionExpression), "AND")
+	assert.Contains(t, in.ExpressionAttributeValues, ":1")
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "2"}, in.ExpressionAttributeValues[":1"])
+}
+
+func TestDeploymentJobsStore_ClaimAlreadyClaimed(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{UpdateItemErrs: []error{conditionFailed()}}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	claimed, err := store.Claim(context.Background(), "deploy-1", 0)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func TestDeploymentJobsStore_RetryMakesJobPending(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	err := store.Retry(context.Background(), "deploy-1", 1, time.Now(), errors.New("no capacity"))
+	require.NoError(t, err)
+	require.Len(t, mock.UpdateItemInputs, 1)
+	assert.Subset(t, statusValues(mock.UpdateItemInputs[0]), []string{JobStatusDispatching, JobStatusPending})
+}
+
+func TestDeploymentJobsStore_CancelTriesWaitingThenPending(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{UpdateItemErrs: []error{conditionFailed(), nil}}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	from, err := store.Cancel(context.Background(), "deploy-1", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusPending, from)
+	require.Len(t, mock.UpdateItemInputs, 2)
+	assert.Contains(t, statusValues(mock.UpdateItemInputs[0]), JobStatusWaiting)
+	assert.Contains(t, statusValues(mock.UpdateItemInputs[1]), JobStatusPending)
+}
+
+func TestDeploymentJobsStore_CancelWithoutJob(t *testing.T) {
+	mock := &ArgCaptureDeploymentJobsTableAPI{UpdateItemErrs: []error{conditionFailed(), conditionFailed()}}
+	store := NewDeploymentJobsStore(mock, "jobs")
+
+	from, err := store.Cancel(context.Background(), "deploy-1", time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, from)
+}
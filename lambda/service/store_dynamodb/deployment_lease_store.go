@@ -0,0 +1,246 @@
+package store_dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DeploymentLeaseDuration bounds how long a deployment holds its application's lease, in case the status listener
+// never sees its provisioner task stop. It exceeds the provisioner's two hour wait for a build.
+const DeploymentLeaseDuration = 3 * time.Hour
+
+// leaseUpdateAttempts is how many times a lease update is retried when the lease changes between reading and
+// writing it
+const leaseUpdateAttempts = 3
+
+// DeploymentLeaseTableAPI is an interface only containing the
+// DynamoDB client methods used by DeploymentLeaseStore
+type DeploymentLeaseTableAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DeploymentLease lets one deployment of an application run at a time, so that two builds never push to the
+// application's repository at once. It is held from when a deployment starts until the status listener sees its
+// provisioner task stop. Deployments requested meanwhile can wait in Queue to be handed the lease in turn.
+type DeploymentLease struct {
+	ApplicationId string    `dynamodbav:"applicationId"`
+	DeploymentId  string    `dynamodbav:"deploymentId"`
+	AcquiredAt    time.Time `dynamodbav:"acquiredAt"`
+	// ExpiresAt is the table TTL attribute, in epoch seconds. A lease past it can be taken by another deployment.
+	ExpiresAt int64              `dynamodbav:"expiresAt"`
+	Queue     []QueuedDeployment `dynamodbav:"queue,omitempty"`
+}
+
+// QueuedDeployment is a deployment waiting for the lease. Its provisioner task waits as a JobStatusWaiting
+// DeploymentJob with the deployment's id.
+type QueuedDeployment struct {
+	DeploymentId string `dynamodbav:"deploymentId"`
+}
+
+type DeploymentLeaseStore struct {
+	api       DeploymentLeaseTableAPI
+	tableName string
+}
+
+func NewDeploymentLeaseStore(api DeploymentLeaseTableAPI, tableName string) *DeploymentLeaseStore {
+	return &DeploymentLeaseStore{
+		api:       api,
+		tableName: tableName,
+	}
+}
+
+// Acquire takes the application's lease for deploymentId unless another deployment holds it, in which case it
+// returns false with the lease. A lease that has expired is taken over, keeping its queue.
+func (s *DeploymentLeaseStore) Acquire(ctx context.Context, applicationId string, deploymentId string, now time.Time) (bool, *DeploymentLease, error) {
+	free := expression.AttributeNotExists(expression.Name("applicationId")).
+		Or(expression.Name("expiresAt").LessThan(expression.Value(now.Unix())))
+	expressions, err := expression.NewBuilder().WithCondition(free).WithUpdate(holdLease(deploymentId, now)).Build()
+	if err != nil {
+		return false, nil, fmt.Errorf("error building lease update for application %s: %w", applicationId, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(s.tableName),
+		Key:                                 leaseKey(applicationId),
+		ConditionExpression:                 expressions.Condition(),
+		ExpressionAttributeNames:            expressions.Names(),
+		ExpressionAttributeValues:           expressions.Values(),
+		UpdateExpression:                    expressions.Update(),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err == nil {
+		return true, nil, nil
+	}
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) {
+		return false, nil, fmt.Errorf("error acquiring deployment lease of application %s: %w", applicationId, err)
+	}
+
+	var held DeploymentLease
+	if err := attributevalue.UnmarshalMap(conditionFailed.Item, &held); err != nil {
+		return false, nil, fmt.Errorf("error unmarshaling deployment lease of application %s: %w", applicationId, err)
+	}
+	return false, &held, nil
+}
+
+// Enqueue adds queued to the end of the lease's queue. It returns false if the lease has been released or has
+// expired, when the deployment should try to acquire the lease instead.
+func (s *DeploymentLeaseStore) Enqueue(ctx context.Context, applicationId string, queued QueuedDeployment, now time.Time) (bool, error) {
+	queue := expression.Name("queue")
+	held := expression.AttributeExists(expression.Name("applicationId")).
+		And(expression.Name("expiresAt").GreaterThanEqual(expression.Value(now.Unix())))
+	update := expression.Set(queue, expression.ListAppend(
+		expression.IfNotExists(queue, expression.Value([]QueuedDeployment{})),
+		expression.Value([]QueuedDeployment{queued})))
+	expressions, err := expression.NewBuilder().WithCondition(held).WithUpdate(update).Build()
+	if err != nil {
+		return false, fmt.Errorf("error building lease queue update for application %s: %w", applicationId, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       leaseKey(applicationId),
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	if isConditionFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error queueing deployment %s of application %s: %w", queued.DeploymentId, applicationId, err)
+	}
+	return true, nil
+}
+
+// Release gives up the lease held by deploymentId. If deployments are queued, the lease passes to the first of
+// them, which is returned for the caller to start. Release does nothing if deploymentId does not hold the lease.
+func (s *DeploymentLeaseStore) Release(ctx context.Context, applicationId string, deploymentId string, now time.Time) (*QueuedDeployment, error) {
+	for attempt := 0; attempt < leaseUpdateAttempts; attempt++ {
+		queue := expression.Name("queue")
+		unqueued := expression.Name("deploymentId").Equal(expression.Value(deploymentId)).
+			And(expression.AttributeNotExists(queue).Or(queue.Size().Equal(expression.Value(0))))
+		deleteExpressions, err := expression.NewBuilder().WithCondition(unqueued).Build()
+		if err != nil {
+			return nil, fmt.Errorf("error building lease release for application %s: %w", applicationId, err)
+		}
+		_, err = s.api.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:                           aws.String(s.tableName),
+			Key:                                 leaseKey(applicationId),
+			ConditionExpression:                 deleteExpressions.Condition(),
+			ExpressionAttributeNames:            deleteExpressions.Names(),
+			ExpressionAttributeValues:           deleteExpressions.Values(),
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		})
+		if err == nil {
+			return nil, nil
+		}
+		var conditionFailed *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionFailed) {
+			return nil, fmt.Errorf("error releasing deployment lease of application %s: %w", applicationId, err)
+		}
+		var lease DeploymentLease
+		if err := attributevalue.UnmarshalMap(conditionFailed.Item, &lease); err != nil {
+			return nil, fmt.Errorf("error unmarshaling deployment lease of application %s: %w", applicationId, err)
+		}
+		if lease.DeploymentId != deploymentId || len(lease.Queue) == 0 {
+			return nil, nil
+		}
+
+		next := lease.Queue[0]
+		handOver := expression.Name("deploymentId").Equal(expression.Value(deploymentId)).
+			And(expression.Name("queue[0].deploymentId").Equal(expression.Value(next.DeploymentId)))
+		updateExpressions, err := expression.NewBuilder().
+			WithCondition(handOver).
+			WithUpdate(holdLease(next.DeploymentId, now).Remove(expression.Name("queue[0]"))).
+			Build()
+		if err != nil {
+			return nil, fmt.Errorf("error building lease hand over for application %s: %w", applicationId, err)
+		}
+		_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(s.tableName),
+			Key:                       leaseKey(applicationId),
+			ConditionExpression:       updateExpressions.Condition(),
+			ExpressionAttributeNames:  updateExpressions.Names(),
+			ExpressionAttributeValues: updateExpressions.Values(),
+			UpdateExpression:          updateExpressions.Update(),
+		})
+		if err == nil {
+			return &next, nil
+		}
+		if !isConditionFailed(err) {
+			return nil, fmt.Errorf("error handing over deployment lease of application %s: %w", applicationId, err)
+		}
+		// the queue changed, so look again
+	}
+	return nil, fmt.Errorf("deployment lease of application %s kept changing while being released", applicationId)
+}
+
+// Dequeue removes deploymentId from the lease's queue. It returns false if the deployment is not queued.
+func (s *DeploymentLeaseStore) Dequeue(ctx context.Context, applicationId string, deploymentId string) (bool, error) {
+	for attempt := 0; attempt < leaseUpdateAttempts; attempt++ {
+		out, err := s.api.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(s.tableName),
+			Key:            leaseKey(applicationId),
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return false, fmt.Errorf("error getting deployment lease of application %s: %w", applicationId, err)
+		}
+		var lease DeploymentLease
+		if err := attributevalue.UnmarshalMap(out.Item, &lease); err != nil {
+			return false, fmt.Errorf("error unmarshaling deployment lease of application %s: %w", applicationId, err)
+		}
+		i := slices.IndexFunc(lease.Queue, func(q QueuedDeployment) bool { return q.DeploymentId == deploymentId })
+		if i < 0 {
+			return false, nil
+		}
+
+		entry := fmt.Sprintf("queue[%d]", i)
+		expressions, err := expression.NewBuilder().
+			WithCondition(expression.Name(entry + ".deploymentId").Equal(expression.Value(deploymentId))).
+			WithUpdate(expression.Remove(expression.Name(entry))).
+			Build()
+		if err != nil {
+			return false, fmt.Errorf("error building lease queue removal for application %s: %w", applicationId, err)
+		}
+		_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(s.tableName),
+			Key:                       leaseKey(applicationId),
+			ConditionExpression:       expressions.Condition(),
+			ExpressionAttributeNames:  expressions.Names(),
+			ExpressionAttributeValues: expressions.Values(),
+			UpdateExpression:          expressions.Update(),
+		})
+		if err == nil {
+			return true, nil
+		}
+		if !isConditionFailed(err) {
+			return false, fmt.Errorf("error removing deployment %s from queue of application %s: %w", deploymentId, applicationId, err)
+		}
+	}
+	return false, fmt.Errorf("deployment lease of application %s kept changing while dequeuing %s", applicationId, deploymentId)
+}
+
+// holdLease is the update giving the lease to deploymentId
+func holdLease(deploymentId string, now time.Time) expression.UpdateBuilder {
+	return expression.Set(expression.Name("deploymentId"), expression.Value(deploymentId)).
+		Set(expression.Name("acquiredAt"), expression.Value(now.UTC())).
+		Set(expression.Name("expiresAt"), expression.Value(now.Add(DeploymentLeaseDuration).Unix()))
+}
+
+func leaseKey(applicationId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"applicationId": &types.AttributeValueMemberS{Value: applicationId}}
+}
@@ -0,0 +1,180 @@
+package store_dynamodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ArgCaptureDeploymentLeaseTableAPI struct {
+	UpdateItemInputs []*dynamodb.UpdateItemInput
+	DeleteItemInput  *dynamodb.DeleteItemInput
+	GetItemOutput    *dynamodb.GetItemOutput
+
+	// UpdateItemErr and DeleteItemErr are returned from their calls when set
+	UpdateItemErr error
+	DeleteItemErr error
+}
+
+func (m *ArgCaptureDeploymentLeaseTableAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.GetItemOutput == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return m.GetItemOutput, nil
+}
+
+func (m *ArgCaptureDeploymentLeaseTableAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.UpdateItemInputs = append(m.UpdateItemInputs, params)
+	if m.UpdateItemErr != nil {
+		return nil, m.UpdateItemErr
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *ArgCaptureDeploymentLeaseTableAPI) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.DeleteItemInput = params
+	if m.DeleteItemErr != nil {
+		return nil, m.DeleteItemErr
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func leaseItem(t *testing.T, lease DeploymentLease) map[string]types.AttributeValue {
+	item, err := attributevalue.MarshalMap(lease)
+	require.NoError(t, err)
+	return item
+}
+
+func TestDeploymentLeaseStore_AcquireIsConditional(t *testing.T) {
+	mock := &ArgCaptureDeploymentLeaseTableAPI{}
+	store := NewDeploymentLeaseStore(mock, "leases")
+
+	acquired, held, err := store.Acquire(context.Background(), "app-1", "deploy-1", time.Unix(1000, 0))
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Nil(t, held)
+
+	require.Len(t, mock.UpdateItemInputs, 1)
+	in := mock.UpdateItemInputs[0]
+	assert.Equal(t, leaseKey("app-1"), in.Key)
+	assert.Contains(t, aws.ToString(in.ConditionExpression), "attribute_not_exists")
+	assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, in.ReturnValuesOnConditionCheckFailure)
+	values := map[string]bool{}
+	for _, v := range in.ExpressionAttributeValues {
+		if n, ok := v.(*types.AttributeValueMemberN); ok {
+			values[n.Value] = true
+		}
+	}
+	// expired before now, and expiring after the lease duration
+	assert.True(t, values["1000"])
+	assert.True(t, values["11800"])
+}
+
+func TestDeploymentLeaseStore_AcquireReturnsHeldLease(t *testing.T) {
+	mock := &ArgCaptureDeploymentLeaseTableAPI{
+		UpdateItemErr: &types.ConditionalCheckFailedException{
+			Message: aws.String("failed"),
+			Item:    leaseItem(t, DeploymentLease{ApplicationId: "app-1", DeploymentId: "deploy-0"}),
+		},
+	}
+	store := NewDeploymentLeaseStore(mock, "leases")
+
+	acquired, held, err := store.Acquire(context.Background(), "app-1", "deploy-1", time.Now())
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	require.NotNil(t, held)
+	assert.Equal(t, "deploy-0", held.DeploymentId)
+}
+
+func TestDeploymentLeaseStore_EnqueueWithoutLease(t *testing.T) {
+	mock := &ArgCaptureDeploymentLeaseTableAPI{
+		UpdateItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed")},
+	}
+	store := NewDeploymentLeaseStore(mock, "leases")
+
+	queued, err := store.Enqueue(context.Background(), "app-1", QueuedDeployment{DeploymentId: "deploy-1"}, time.Now())
+	require.NoError(t, err)
+	assert.False(t, queued)
+	assert.Contains(t, aws.ToString(mock.UpdateItemInputs[0].UpdateExpression), "list_append")
+}
+
+func TestDeploymentLeaseStore_ReleaseDeletesUnqueuedLease(t *testing.T) {
+	mock := &ArgCaptureDeploymentLeaseTableAPI{}
+	store := NewDeploymentLeaseStore(mock, "leases")
+
+	next, err := store.Release(context.Background(), "app-1", "deploy-1", time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, next)
+	require.NotNil(t, mock.DeleteItemInput)
+	assert.Equal(t, leaseKey("app-1"), mock.DeleteItemInput.Key)
+	assert.Empty(t, mock.UpdateItemInputs)
+}
+
+func TestDeploymentLeaseStore_ReleaseHandsOverToQueue(t *testing.T) {
+	mock := &ArgCaptureDeploymentLeaseTableAPI{
+		DeleteItemErr: &types.ConditionalCheckFailedException{
+			Message: aws.String("failed"),
+			Item: leaseItem(t, DeploymentLease{ApplicationId: "app-1", DeploymentId: "deploy-1", Queue: []QueuedDeployment{
+				{DeploymentId: "deploy-2"},
+				{DeploymentId: "deploy-3"},
+			}}),
+		},
+	}
+	store := NewDeploymentLeaseStore(mock, "leases")
+
+	next, err := store.Release(context.Background(), "app-1", "deploy-1", time.Now())
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.Equal(t, "deploy-2", next.DeploymentId)
+
+	require.Len(t, mock.UpdateItemInputs, 1)
+	in := mock.UpdateItemInputs[0]
+	assert.Contains(t, aws.ToString(in.UpdateExpression), "REMOVE")
+	assert.Contains(t, aws.ToString(in.ConditionExpression), "[0]")
+}
+
+func TestDeploymentLeaseStore_ReleaseByOtherDeployment(t *testing.T) {
+	mock := &ArgCaptureDeploymentLeaseTableAPI{
+		DeleteItemErr: &types.ConditionalCheckFailedException{
+			Message: aws.String("failed"),
+			Item: leaseItem(t, DeploymentLease{ApplicationId: "app-1", DeploymentId: "deploy-2", Queue: []QueuedDeployment{
+				{DeploymentId: "deploy-3"},
+			}}),
+		},
+	}
+	store := NewDeploymentLeaseStore(mock, "leases")
+
+	next, err := store.Release(context.Background(), "app-1", "deploy-1", time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, next)
+	assert.Empty(t, mock.UpdateItemInputs)
+}
+
+func TestDeploymentLeaseStore_Dequeue(t *testing.T) {
+	mock := &ArgCaptureDeploymentLeaseTableAPI{
+		GetItemOutput: &dynamodb.GetItemOutput{
+			Item: leaseItem(t, DeploymentLease{ApplicationId: "app-1", DeploymentId: "deploy-1", Queue: []QueuedDeployment{
+				{DeploymentId: "deploy-2"},
+				{DeploymentId: "deploy-3"},
+			}}),
+		},
+	}
+	store := NewDeploymentLeaseStore(mock, "leases")
+
+	dequeued, err := store.Dequeue(context.Background(), "app-1", "deploy-3")
+	require.NoError(t, err)
+	assert.True(t, dequeued)
+	require.Len(t, mock.UpdateItemInputs, 1)
+	assert.Contains(t, aws.ToString(mock.UpdateItemInputs[0].UpdateExpression), "[1]")
+
+	dequeued, err = store.Dequeue(context.Background(), "app-1", "deploy-4")
+	require.NoError(t, err)
+	assert.False(t, dequeued)
+}
@@ -3,6 +3,8 @@ package store_dynamodb
 import (
 	"context"
 	"fmt"
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
@@ -70,6 +72,155 @@ func (s *DeploymentsStore) SetErrored(ctx context.Context, applicationId string,
 	return nil
 }
 
+// AppendStep adds event to the end of the deployment's timeline.
+func (s *DeploymentsStore) AppendStep(ctx context.Context, applicationId string, deploymentId string, event StepEvent) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment timeline update: %w", err)
+	}
+	timeline := expression.Name(DeploymentTimelineField)
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Set(timeline, expression.ListAppend(
+			expression.IfNotExists(timeline, expression.Value([]StepEvent{})),
+			expression.Value([]StepEvent{event})))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building deployment timeline update: %w", err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+	})
+	if err != nil {
+		return fmt.Errorf("error appending %s step to deployment: %w", event.Step, err)
+	}
+
+	return nil
+}
+
+// SetProvisionerTaskArn records the provisioner task of a deployment.
+func (s *DeploymentsStore) SetProvisionerTaskArn(ctx context.Context, applicationId string, deploymentId string, taskArn string) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment provisioner task update: %w", err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       key,
+		ExpressionAttributeNames: map[string]string{
+			"#t": DeploymentProvisionerTaskArnField,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: taskArn},
+		},
+		UpdateExpression: aws.String("set #t = :t"),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating deployment provisioner task: %w", err)
+	}
+
+	return nil
+}
+
+// Dispatch moves a queued deployment to NOT_STARTED once it holds its application's lease. It fails with
+// ErrDeploymentNotQueued if the deployment was cancelled while it waited, or has already been dispatched.
+func (s *DeploymentsStore) Dispatch(ctx context.Context, applicationId string, deploymentId string) error {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling key for deployment dispatch: %w", err)
+	}
+
+	lastStatus := expression.Name(DeploymentLastStatusField)
+	cancelled := expression.Name(DeploymentCancelledField)
+	condition := lastStatus.Equal(expression.Value(DeploymentStatusQueued)).
+		And(expression.AttributeNotExists(cancelled).Or(cancelled.Equal(expression.Value(false))))
+	expressions, err := expression.NewBuilder().
+		WithCondition(condition).
+		WithUpdate(expression.Set(lastStatus, expression.Value(DeploymentStatusNotStarted))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building expressions for dispatch of deployment %s: %w", deploymentId, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("deployment %s: %w", deploymentId, ErrDeploymentNotQueued)
+	}
+	if err != nil {
+		return fmt.Errorf("error dispatching deployment %s: %w", deploymentId, err)
+	}
+	return nil
+}
+
+// Cancel marks an unfinished deployment as cancelled and returns the updated record. It fails with
+// ErrDeploymentFinished if the deployment does not exist, its deployer task has already stopped, or it was
+// already cancelled.
+func (s *DeploymentsStore) Cancel(ctx context.Context, applicationId string, deploymentId string, cancelledBy string, cancelledAt time.Time) (Deployment, error) {
+	key, err := attributevalue.MarshalMap(DeploymentKey{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+	})
+	if err != nil {
+		return Deployment{}, fmt.Errorf("error marshaling key for deployment cancel: %w", err)
+	}
+
+	lastStatus := expression.Name(DeploymentLastStatusField)
+	cancelled := expression.Name(DeploymentCancelledField)
+	condition := expression.AttributeExists(expression.Name(DeploymentIdField)).
+		And(expression.AttributeNotExists(lastStatus).Or(lastStatus.NotEqual(expression.Value(DeploymentStatusStopped)))).
+		And(expression.AttributeNotExists(cancelled).Or(cancelled.Equal(expression.Value(false))))
+	update := expression.Set(cancelled, expression.Value(true)).
+		Set(expression.Name(DeploymentCancelledAtField), expression.Value(cancelledAt.UTC())).
+		Set(expression.Name(DeploymentCancelledByField), expression.Value(cancelledBy))
+	expressions, err := expression.NewBuilder().WithCondition(condition).WithUpdate(update).Build()
+	if err != nil {
+		return Deployment{}, fmt.Errorf("error building expressions for cancel of deployment %s: %w", deploymentId, err)
+	}
+
+	out, err := s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if isConditionFailed(err) {
+		return Deployment{}, fmt.Errorf("deployment %s: %w", deploymentId, ErrDeploymentFinished)
+	}
+	if err != nil {
+		return Deployment{}, fmt.Errorf("error cancelling deployment %s: %w", deploymentId, err)
+	}
+
+	var deployment Deployment
+	if err := attributevalue.UnmarshalMap(out.Attributes, &deployment); err != nil {
+		return Deployment{}, fmt.Errorf("error unmarshaling cancelled deployment %s: %w", deploymentId, err)
+	}
+	return deployment, nil
+}
+
 func (s *DeploymentsStore) Get(ctx context.Context, applicationId, deploymentId string) (*Deployment, error) {
 	deploymentKey, err := attributevalue.MarshalMap(DeploymentKey{
 		ApplicationId: applicationId,
@@ -128,6 +279,89 @@ func (s *DeploymentsStore) GetHistory(ctx context.Context, applicationId string)
 	return deployments, nil
 }
 
+// DeploymentQuery describes one page of an application's deployment history.
+type DeploymentQuery struct {
+	// Limit of zero returns every matching deployment
+	Limit      int32
+	Descending bool
+	// Since and Until bound initiatedAt, inclusive
+	Since *time.Time
+	Until *time.Time
+	// Action, when set, must equal the deployment action
+	Action string
+	// Errored, when set, must match whether the deployment errored
+	Errored *bool
+	// PageToken is the NextPageToken of the previous page, or empty for the first page
+	PageToken string
+}
+
+type DeploymentPage struct {
+	Deployments []Deployment
+	// NextPageToken is empty on the last page
+	NextPageToken string
+}
+
+// List returns a page of the application's deployments in initiatedAt order.
+func (s *DeploymentsStore) List(ctx context.Context, applicationId string, query DeploymentQuery) (DeploymentPage, error) {
+	keyCondition := expression.KeyEqual(expression.Key(DeploymentApplicationIdField), expression.Value(applicationId))
+	initiatedAt := expression.Key(DeploymentInitiatedAtField)
+	// initiatedAt is stored as an RFC 3339 string in UTC, so bounds must be too for the comparison to hold
+	switch {
+	case query.Since != nil && query.Until != nil:
+		keyCondition = keyCondition.And(initiatedAt.Between(expression.Value(query.Since.UTC()), expression.Value(query.Until.UTC())))
+	case query.Since != nil:
+		keyCondition = keyCondition.And(initiatedAt.GreaterThanEqual(expression.Value(query.Since.UTC())))
+	case query.Until != nil:
+		keyCondition = keyCondition.And(initiatedAt.LessThanEqual(expression.Value(query.Until.UTC())))
+	}
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition)
+
+	var filters []expression.ConditionBuilder
+	if query.Action != "" {
+		filters = append(filters, expression.Name(DeploymentActionField).Equal(expression.Value(query.Action)))
+	}
+	if query.Errored != nil {
+		errored := expression.Name(DeploymentErroredField)
+		if *query.Errored {
+			filters = append(filters, errored.Equal(expression.Value(true)))
+		} else {
+			// errored is omitted from the item unless it is true
+			filters = append(filters, expression.AttributeNotExists(errored).Or(errored.Equal(expression.Value(false))))
+		}
+	}
+	switch len(filters) {
+	case 0:
+	case 1:
+		builder = builder.WithFilter(filters[0])
+	default:
+		builder = builder.WithFilter(expression.And(filters[0], filters[1], filters[2:]...))
+	}
+
+	expressions, err := builder.Build()
+	if err != nil {
+		return DeploymentPage{}, fmt.Errorf("error building expressions for deployments of application %s: %w", applicationId, err)
+	}
+	queryIn := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		IndexName:                 aws.String(DeploymentsInitiatedAtIndex),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		KeyConditionExpression:    expressions.KeyCondition(),
+		FilterExpression:          expressions.Filter(),
+		ScanIndexForward:          aws.Bool(!query.Descending),
+	}
+
+	items, nextPageToken, err := queryPage(ctx, s.api, queryIn, query.Limit, applicationId, query.PageToken)
+	if err != nil {
+		return DeploymentPage{}, fmt.Errorf("error listing deployments for application %s: %w", applicationId, err)
+	}
+	deployments, err := appendItems([]Deployment{}, items)
+	if err != nil {
+		return DeploymentPage{}, err
+	}
+	return DeploymentPage{Deployments: deployments, NextPageToken: nextPageToken}, nil
+}
+
 func appendItems(deployments []Deployment, items []map[string]types.AttributeValue) ([]Deployment, error) {
 	for _, item := range items {
 		var deployment Deployment
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 type ArgCaptureDeploymentsTableAPI struct {
@@ -18,6 +19,8 @@ type ArgCaptureDeploymentsTableAPI struct {
 	PutItemInput    dynamodb.PutItemInput
 	UpdateItemInput dynamodb.UpdateItemInput
 	GetItemInput    dynamodb.GetItemInput
+	// UpdateItemErr is returned from UpdateItem when set
+	UpdateItemErr error
 	// Query may be paginated, so one GetHistory call may result in multiple Query calls.
 
 	// Set QueryOutputs before calling GetHistory to control how many times Query is called.
@@ -34,6 +37,9 @@ func (a *ArgCaptureDeploymentsTableAPI) PutItem(_ context.Context, params *dynam
 
 func (a *ArgCaptureDeploymentsTableAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 	a.UpdateItemInput = *params
+	if a.UpdateItemErr != nil {
+		return nil, a.UpdateItemErr
+	}
 	return &dynamodb.UpdateItemOutput{}, nil
 }
 
@@ -145,3 +151,150 @@ func deploymentKeyItem(applicationId, deploymentId string) map[string]types.Attr
 		DeploymentIdField:            &types.AttributeValueMemberS{Value: deploymentId},
 	}
 }
+
+func TestDeploymentsStore_ListQueriesInitiatedAtIndex(t *testing.T) {
+	argCaptureAPI := new(ArgCaptureDeploymentsTableAPI)
+	applicationId := uuid.NewString()
+	argCaptureAPI.QueryOutputs = []*dynamodb.QueryOutput{
+		{Items: []map[string]types.AttributeValue{deploymentKeyItem(applicationId, uuid.NewString())}},
+	}
+	store := NewDeploymentsStore(argCaptureAPI, uuid.NewString())
+
+	since := time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	errored := false
+	page, err := store.List(context.Background(), applicationId, DeploymentQuery{
+		Descending: true,
+		Since:      &since,
+		Action:     "DEPLOY",
+		Errored:    &errored,
+	})
+	require.NoError(t, err)
+	assert.Len(t, page.Deployments, 1)
+	assert.Empty(t, page.NextPageToken)
+
+	require.Len(t, argCaptureAPI.QueryInputs, 1)
+	input := argCaptureAPI.QueryInputs[0]
+	assert.Equal(t, DeploymentsInitiatedAtIndex, aws.ToString(input.IndexName))
+	assert.False(t, aws.ToBool(input.ScanIndexForward))
+	assert.Nil(t, input.Limit)
+	assert.Contains(t, aws.ToString(input.KeyConditionExpression), ">=")
+	assert.Contains(t, aws.ToString(input.FilterExpression), "attribute_not_exists")
+
+	values := map[string]bool{}
+	for _, v := range input.ExpressionAttributeValues {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			values[s.Value] = true
+		}
+	}
+	assert.True(t, values[applicationId])
+	assert.True(t, values["DEPLOY"])
+	// bounds are compared in UTC, as initiatedAt is stored
+	assert.True(t, values["2024-05-01T12:00:00Z"])
+}
+
+func TestDeploymentsStore_ListPages(t *testing.T) {
+	argCaptureAPI := new(ArgCaptureDeploymentsTableAPI)
+	applicationId := uuid.NewString()
+	items := []map[string]types.AttributeValue{
+		deploymentKeyItem(applicationId, uuid.NewString()),
+		deploymentKeyItem(applicationId, uuid.NewString()),
+	}
+	argCaptureAPI.QueryOutputs = []*dynamodb.QueryOutput{
+		{Items: items, LastEvaluatedKey: items[1]},
+	}
+	store := NewDeploymentsStore(argCaptureAPI, uuid.NewString())
+
+	page, err := store.List(context.Background(), applicationId, DeploymentQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, page.Deployments, 2)
+	require.NotEmpty(t, page.NextPageToken)
+	assert.Equal(t, int32(2), aws.ToInt32(argCaptureAPI.QueryInputs[0].Limit))
+
+	next := new(ArgCaptureDeploymentsTableAPI)
+	next.QueryOutputs = []*dynamodb.QueryOutput{{}}
+	_, err = NewDeploymentsStore(next, uuid.NewString()).List(context.Background(), applicationId,
+		DeploymentQuery{Limit: 2, PageToken: page.NextPageToken})
+	require.NoError(t, err)
+	assert.Equal(t, items[1], next.QueryInputs[0].ExclusiveStartKey)
+
+	_, err = store.List(context.Background(), uuid.NewString(), DeploymentQuery{Limit: 2, PageToken: page.NextPageToken})
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+}
+
+func TestDeploymentsStore_CancelIsConditional(t *testing.T) {
+	argCaptureAPI := new(ArgCaptureDeploymentsTableAPI)
+	store := NewDeploymentsStore(argCaptureAPI, "deployments")
+
+	_, err := store.Cancel(context.Background(), "app-1", "deploy-1", "N:user:1", time.Now())
+	require.NoError(t, err)
+
+	in := argCaptureAPI.UpdateItemInput
+	assert.Equal(t, types.ReturnValueAllNew, in.ReturnValues)
+	assert.Contains(t, aws.ToString(in.ConditionExpression), "attribute_exists")
+	names := map[string]bool{}
+	for _, name := range in.ExpressionAttributeNames {
+		names[name] = true
+	}
+	assert.True(t, names[DeploymentLastStatusField])
+	assert.True(t, names[DeploymentCancelledField])
+	assert.True(t, names[DeploymentCancelledByField])
+	values := map[string]bool{}
+	for _, v := range in.ExpressionAttributeValues {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			values[s.Value] = true
+		}
+	}
+	assert.True(t, values[DeploymentStatusStopped])
+	assert.True(t, values["N:user:1"])
+}
+
+func TestDeploymentsStore_CancelFinished(t *testing.T) {
+	argCaptureAPI := &ArgCaptureDeploymentsTableAPI{
+		UpdateItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed")},
+	}
+	store := NewDeploymentsStore(argCaptureAPI, "deployments")
+
+	_, err := store.Cancel(context.Background(), "app-1", "deploy-1", "N:user:1", time.Now())
+	assert.ErrorIs(t, err, ErrDeploymentFinished)
+}
+
+func TestDeploymentsStore_DispatchIsConditional(t *testing.T) {
+	argCaptureAPI := new(ArgCaptureDeploymentsTableAPI)
+	store := NewDeploymentsStore(argCaptureAPI, "deployments")
+
+	require.NoError(t, store.Dispatch(context.Background(), "app-1", "deploy-1"))
+
+	in := argCaptureAPI.UpdateItemInput
+	assert.Contains(t, aws.ToString(in.ConditionExpression), "attribute_not_exists")
+	values := map[string]bool{}
+	for _, v := range in.ExpressionAttributeValues {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			values[s.Value] = true
+		}
+	}
+	assert.True(t, values[DeploymentStatusQueued])
+	assert.True(t, values[DeploymentStatusNotStarted])
+}
+
+func TestDeploymentsStore_DispatchNotQueued(t *testing.T) {
+	argCaptureAPI := &ArgCaptureDeploymentsTableAPI{
+		UpdateItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed")},
+	}
+	store := NewDeploymentsStore(argCaptureAPI, "deployments")
+
+	err := store.Dispatch(context.Background(), "app-1", "deploy-1")
+	assert.ErrorIs(t, err, ErrDeploymentNotQueued)
+}
+
+func TestDeploymentsStore_AppendStep(t *testing.T) {
+	argCaptureAPI := new(ArgCaptureDeploymentsTableAPI)
+	store := NewDeploymentsStore(argCaptureAPI, "deployments")
+
+	err := store.AppendStep(context.Background(), "app-1", "deploy-1", StepEvent{Step: StepImageBuild, Time: time.Now()})
+	require.NoError(t, err)
+
+	in := argCaptureAPI.UpdateItemInput
+	assert.Contains(t, aws.ToString(in.UpdateExpression), "list_append(if_not_exists(")
+	assert.Contains(t, in.ExpressionAttributeNames, "#0")
+	assert.Equal(t, DeploymentTimelineField, in.ExpressionAttributeNames["#0"])
+}
@@ -0,0 +1,149 @@
+package store_dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Idempotency record states.
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyTableAPI is an interface only containing the
+// DynamoDB client methods used by IdempotencyStore
+type IdempotencyTableAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// IdempotencyRecord remembers the response to a request sent with an Idempotency-Key header.
+type IdempotencyRecord struct {
+	Key         string `dynamodbav:"idempotencyKey"`
+	RequestHash string `dynamodbav:"requestHash"`
+	Status      string `dynamodbav:"status"`
+	// LockedUntil bounds how long an in-progress record blocks retries, in case the Lambda died before
+	// completing or releasing it
+	LockedUntil int64 `dynamodbav:"lockedUntil"`
+	// ExpiresAt is the table TTL attribute, in epoch seconds
+	ExpiresAt int64  `dynamodbav:"expiresAt"`
+	CreatedAt string `dynamodbav:"createdAt"`
+
+	ResponseStatus  int               `dynamodbav:"responseStatus,omitempty"`
+	ResponseBody    string            `dynamodbav:"responseBody,omitempty"`
+	ResponseHeaders map[string]string `dynamodbav:"responseHeaders,omitempty"`
+}
+
+type IdempotencyStore struct {
+	api       IdempotencyTableAPI
+	tableName string
+}
+
+func NewIdempotencyStore(api IdempotencyTableAPI, tableName string) *IdempotencyStore {
+	return &IdempotencyStore{
+		api:       api,
+		tableName: tableName,
+	}
+}
+
+// Claim stores record as in progress unless its key is already held. A key is free if it was never used, its
+// record has expired but not yet been removed by the TTL process, or an in-progress record's lock has lapsed.
+// When the key is held, Claim returns false with the stored record.
+func (s *IdempotencyStore) Claim(ctx context.Context, record IdempotencyRecord, now time.Time) (bool, *IdempotencyRecord, error) {
+	record.Status = IdempotencyInProgress
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return false, nil, fmt.Errorf("error marshaling idempotency record: %w", err)
+	}
+
+	nowValue := expression.Value(now.Unix())
+	free := expression.AttributeNotExists(expression.Name("idempotencyKey")).
+		Or(expression.Name("expiresAt").LessThan(nowValue)).
+		Or(expression.Name("status").Equal(expression.Value(IdempotencyInProgress)).
+			And(expression.Name("lockedUntil").LessThan(nowValue)))
+	expressions, err := expression.NewBuilder().WithCondition(free).Build()
+	if err != nil {
+		return false, nil, fmt.Errorf("error building condition for idempotency key %s: %w", record.Key, err)
+	}
+
+	_, err = s.api.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                           aws.String(s.tableName),
+		Item:                                item,
+		ConditionExpression:                 expressions.Condition(),
+		ExpressionAttributeNames:            expressions.Names(),
+		ExpressionAttributeValues:           expressions.Values(),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err == nil {
+		return true, nil, nil
+	}
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) {
+		return false, nil, fmt.Errorf("error claiming idempotency key %s: %w", record.Key, err)
+	}
+
+	var existing IdempotencyRecord
+	if err := attributevalue.UnmarshalMap(conditionFailed.Item, &existing); err != nil {
+		return false, nil, fmt.Errorf("error unmarshaling idempotency record %s: %w", record.Key, err)
+	}
+	return false, &existing, nil
+}
+
+// Complete stores the response for a claimed key, so later requests with the key replay it.
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, status int, body string, headers map[string]string) error {
+	update := expression.Set(expression.Name("status"), expression.Value(IdempotencyCompleted)).
+		Set(expression.Name("responseStatus"), expression.Value(status)).
+		Set(expression.Name("responseBody"), expression.Value(body))
+	if len(headers) > 0 {
+		update = update.Set(expression.Name("responseHeaders"), expression.Value(headers))
+	}
+	expressions, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("error building update for idempotency key %s: %w", key, err)
+	}
+
+	_, err = s.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       idempotencyKey(key),
+		UpdateExpression:          expressions.Update(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+	})
+	if err != nil {
+		return fmt.Errorf("error completing idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Release deletes an in-progress claim so the request can be retried with the same key.
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.api.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.tableName),
+		Key:                 idempotencyKey(key),
+		ConditionExpression: aws.String("#status = :inProgress"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":inProgress": &types.AttributeValueMemberS{Value: IdempotencyInProgress},
+		},
+	})
+	if err != nil && !isConditionFailed(err) {
+		return fmt.Errorf("error releasing idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+func idempotencyKey(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"idempotencyKey": &types.AttributeValueMemberS{Value: key}}
+}
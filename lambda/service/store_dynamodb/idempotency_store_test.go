@@ -0,0 +1,100 @@
+package store_dynamodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ArgCaptureIdempotencyTableAPI struct {
+	PutItemInput    *dynamodb.PutItemInput
+	UpdateItemInput *dynamodb.UpdateItemInput
+	DeleteItemInput *dynamodb.DeleteItemInput
+
+	// PutItemErr and DeleteItemErr are returned from their calls when set
+	PutItemErr    error
+	DeleteItemErr error
+}
+
+func (m *ArgCaptureIdempotencyTableAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.PutItemInput = params
+	if m.PutItemErr != nil {
+		return nil, m.PutItemErr
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *ArgCaptureIdempotencyTableAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.UpdateItemInput = params
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *ArgCaptureIdempotencyTableAPI) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.DeleteItemInput = params
+	if m.DeleteItemErr != nil {
+		return nil, m.DeleteItemErr
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestIdempotencyStore_ClaimIsConditional(t *testing.T) {
+	mock := &ArgCaptureIdempotencyTableAPI{}
+	store := NewIdempotencyStore(mock, "idempotency")
+
+	claimed, existing, err := store.Claim(context.Background(), IdempotencyRecord{Key: "k", RequestHash: "h"}, time.Unix(1000, 0))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Nil(t, existing)
+
+	in := mock.PutItemInput
+	require.NotNil(t, in)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: IdempotencyInProgress}, in.Item["status"])
+	assert.Contains(t, *in.ConditionExpression, "attribute_not_exists")
+	assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, in.ReturnValuesOnConditionCheckFailure)
+	assert.Contains(t, in.ExpressionAttributeValues, ":0")
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1000"}, in.ExpressionAttributeValues[":0"])
+}
+
+func TestIdempotencyStore_ClaimReturnsHeldRecord(t *testing.T) {
+	held, err := attributevalue.MarshalMap(IdempotencyRecord{
+		Key: "k", RequestHash: "h", Status: IdempotencyCompleted, ResponseStatus: 201, ResponseBody: "{}",
+	})
+	require.NoError(t, err)
+	mock := &ArgCaptureIdempotencyTableAPI{
+		PutItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed"), Item: held},
+	}
+	store := NewIdempotencyStore(mock, "idempotency")
+
+	claimed, existing, err := store.Claim(context.Background(), IdempotencyRecord{Key: "k", RequestHash: "h"}, time.Now())
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	require.NotNil(t, existing)
+	assert.Equal(t, IdempotencyCompleted, existing.Status)
+	assert.Equal(t, 201, existing.ResponseStatus)
+}
+
+func TestIdempotencyStore_ClaimError(t *testing.T) {
+	mock := &ArgCaptureIdempotencyTableAPI{PutItemErr: errors.New("throttled")}
+	store := NewIdempotencyStore(mock, "idempotency")
+
+	_, _, err := store.Claim(context.Background(), IdempotencyRecord{Key: "k"}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestIdempotencyStore_ReleaseIgnoresCompletedRecords(t *testing.T) {
+	mock := &ArgCaptureIdempotencyTableAPI{
+		DeleteItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed")},
+	}
+	store := NewIdempotencyStore(mock, "idempotency")
+
+	require.NoError(t, store.Release(context.Background(), "k"))
+	assert.Equal(t, idempotencyKey("k"), mock.DeleteItemInput.Key)
+}
@@ -0,0 +1,102 @@
+package store_dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidPageToken is returned when a page token cannot be decoded or was issued for a different query.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// pageToken is the decoded form of the opaque token handed to API clients. Scope ties the token to the query
+// that produced it, so a token cannot be replayed against another workspace, application or sort order.
+type pageToken struct {
+	Scope string            `json:"s"`
+	Key   map[string]string `json:"k"`
+}
+
+// encodePageToken turns a LastEvaluatedKey into an opaque token. Only string key attributes are supported,
+// which covers every table key in this service.
+func encodePageToken(scope string, key map[string]types.AttributeValue) (string, error) {
+	token := pageToken{Scope: scope, Key: map[string]string{}}
+	for name, value := range key {
+		s, ok := value.(*types.AttributeValueMemberS)
+		if !ok {
+			return "", fmt.Errorf("error encoding page token: key attribute %s is not a string", name)
+		}
+		token.Key[name] = s.Value
+	}
+	b, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("error encoding page token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodePageToken returns the ExclusiveStartKey encoded in token, or ErrInvalidPageToken.
+func decodePageToken(scope string, token string) (map[string]types.AttributeValue, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	var decoded pageToken
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded.Scope != scope || len(decoded.Key) == 0 {
+		return nil, ErrInvalidPageToken
+	}
+	key := make(map[string]types.AttributeValue, len(decoded.Key))
+	for name, value := range decoded.Key {
+		key[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	return key, nil
+}
+
+// maxPageQueries bounds the DynamoDB reads behind one page when filters discard most items. The page is then
+// returned short, with a token to carry on from where reading stopped.
+const maxPageQueries = 10
+
+type queryAPI interface {
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// queryPage runs queryIn from pageToken and returns up to limit items with the token for the next page, which
+// is empty once the query is exhausted. Filter expressions are applied after DynamoDB reads, so it keeps
+// querying until the page is full, the results run out or maxPageQueries is reached. A limit of zero reads
+// every page.
+func queryPage(ctx context.Context, api queryAPI, queryIn *dynamodb.QueryInput, limit int32, scope string, pageToken string) ([]map[string]types.AttributeValue, string, error) {
+	if pageToken != "" {
+		key, err := decodePageToken(scope, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		queryIn.ExclusiveStartKey = key
+	}
+
+	var items []map[string]types.AttributeValue
+	for queries := 1; ; queries++ {
+		if limit > 0 {
+			// never read more items than are still needed, so the last evaluated key is a valid resume point
+			queryIn.Limit = aws.Int32(limit - int32(len(items)))
+		}
+		queryOut, err := api.Query(ctx, queryIn)
+		if err != nil {
+			return nil, "", fmt.Errorf("error getting page %d: %w", queries, err)
+		}
+		items = append(items, queryOut.Items...)
+
+		if len(queryOut.LastEvaluatedKey) == 0 {
+			return items, "", nil
+		}
+		queryIn.ExclusiveStartKey = queryOut.LastEvaluatedKey
+		if limit > 0 && (int32(len(items)) >= limit || queries == maxPageQueries) {
+			token, err := encodePageToken(scope, queryOut.LastEvaluatedKey)
+			return items, token, err
+		}
+	}
+}
@@ -2,28 +2,141 @@ package store_dynamodb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 )
 
+// ErrVersionConflict is returned by a conditional write when the item has changed since it was read.
+var ErrVersionConflict = errors.New("item was modified since it was read")
+
+// ErrAlreadyExists is returned by Insert when an item with the same key is already stored.
+var ErrAlreadyExists = errors.New("item already exists")
+
+// ErrDeploymentFinished is returned by Cancel when the deployment has already stopped or been cancelled.
+var ErrDeploymentFinished = errors.New("deployment has already finished")
+
+// ErrDeploymentNotQueued is returned by Dispatch when the deployment is no longer waiting to start.
+var ErrDeploymentNotQueued = errors.New("deployment is not queued")
+
+// versionCondition requires the item to exist with the given value in its version attribute. Items written
+// before the attribute was introduced have no value and match version 0.
+func versionCondition(attribute string, expectedVersion int64) expression.ConditionBuilder {
+	version := expression.Name(attribute)
+	exists := expression.AttributeExists(expression.Name("uuid"))
+	if expectedVersion == 0 {
+		return exists.And(expression.AttributeNotExists(version).Or(version.Equal(expression.Value(expectedVersion))))
+	}
+	return exists.And(version.Equal(expression.Value(expectedVersion)))
+}
+
+// withVersion adds versionCondition to the condition of a status update made withTransition, so the update also
+// fails if the item has changed since it was read.
+func withVersion(in *dynamodb.UpdateItemInput, attribute string, expectedVersion int64) {
+	in.ExpressionAttributeNames["#version"] = attribute
+	in.ExpressionAttributeValues[":expectedVersion"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion, 10)}
+	condition := "#version = :expectedVersion"
+	if expectedVersion == 0 {
+		condition = "(attribute_not_exists(#version) OR #version = :expectedVersion)"
+	}
+	in.ConditionExpression = aws.String(aws.ToString(in.ConditionExpression) + " AND " + condition)
+}
+
+// versionChanged reports whether an update made withVersion failed because the item's version is no longer
+// expectedVersion, rather than because of its status.
+func versionChanged(err error, attribute string, expectedVersion int64) bool {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) || len(conditionFailed.Item) == 0 {
+		return false
+	}
+	var version int64
+	if value, ok := conditionFailed.Item[attribute]; ok {
+		if err := attributevalue.Unmarshal(value, &version); err != nil {
+			return false
+		}
+	}
+	return version != expectedVersion
+}
+
+// insertCondition makes a PutItem fail rather than replace an existing item.
+var insertCondition = aws.String("attribute_not_exists(#uuid)")
+var insertConditionNames = map[string]string{"#uuid": "uuid"}
+
+func isConditionFailed(err error) bool {
+	var conditionFailed *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionFailed)
+}
+
 type DynamoDBStore interface {
 	GetById(context.Context, string) (Application, error)
 	Get(context.Context, string, map[string]string) ([]Application, error)
+	List(context.Context, string, ApplicationQuery) (ApplicationPage, error)
 	Insert(context.Context, Application) error
+	Update(ctx context.Context, applicationUuid string, update ApplicationUpdate, expectedVersion int64) (Application, error)
 	UpdateStatus(ctx context.Context, newStatus string, applicationUuid string) error
+	UpdateStatusAtVersion(ctx context.Context, newStatus string, applicationUuid string, expectedVersion int64) error
+	ListAutoDeploy(ctx context.Context) ([]Application, error)
+	MarkAutoDeployed(ctx context.Context, applicationUuid string, previous *time.Time, at time.Time) (bool, error)
+}
+
+// ApplicationsTableAPI is an interface only containing the
+// DynamoDB client methods used by ApplicationDatabaseStore
+type ApplicationsTableAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
 }
 
 type ApplicationDatabaseStore struct {
-	DB        *dynamodb.Client
+	DB        ApplicationsTableAPI
 	TableName string
 }
 
-func NewApplicationDatabaseStore(db *dynamodb.Client, tableName string) DynamoDBStore {
+// Sort orders supported by List, each backed by a GSI keyed on organizationId.
+const (
+	ApplicationSortCreatedAt = "createdAt"
+	ApplicationSortName      = "name"
+)
+
+var applicationSortIndexes = map[string]string{
+	ApplicationSortCreatedAt: "organizationId-createdAt-index",
+	ApplicationSortName:      "organizationId-nameSortKey-index",
+}
+
+// ApplicationFilterAttributes lists the attributes List can filter on with an exact match.
+var ApplicationFilterAttributes = []string{"registrationStatus", "computeNodeUuid", "applicationType", "sourceType", "sourceUrl"}
+
+// ApplicationQuery describes one page of a workspace's applications.
+type ApplicationQuery struct {
+	Limit      int32
+	SortBy     string
+	Descending bool
+	// Filters maps attribute names from ApplicationFilterAttributes to the value they must equal
+	Filters map[string]string
+	// PageToken is the NextPageToken of the previous page, or empty for the first page
+	PageToken string
+}
+
+type ApplicationPage struct {
+	Applications []Application
+	// NextPageToken is empty on the last page
+	NextPageToken string
+}
+
+func NewApplicationDatabaseStore(db ApplicationsTableAPI, tableName string) DynamoDBStore {
 	return &ApplicationDatabaseStore{db, tableName}
 }
 
@@ -87,14 +200,81 @@ func (r *ApplicationDatabaseStore) Get(ctx context.Context, organizationId strin
 	return applications, nil
 }
 
+// List returns a page of the organization's applications in the requested order.
+func (r *ApplicationDatabaseStore) List(ctx context.Context, organizationId string, query ApplicationQuery) (ApplicationPage, error) {
+	page := ApplicationPage{Applications: []Application{}}
+	if query.Limit <= 0 {
+		return page, fmt.Errorf("error listing applications: limit must be positive, got %d", query.Limit)
+	}
+	index, ok := applicationSortIndexes[query.SortBy]
+	if !ok {
+		return page, fmt.Errorf("error listing applications: unsupported sort %q", query.SortBy)
+	}
+
+	builder := expression.NewBuilder().
+		WithKeyCondition(expression.Key("organizationId").Equal(expression.Value(organizationId)))
+	if len(query.Filters) > 0 {
+		names := make([]string, 0, len(query.Filters))
+		for name := range query.Filters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var filter expression.ConditionBuilder
+		for i, name := range names {
+			c := expression.Name(name).Equal(expression.Value(query.Filters[name]))
+			if i == 0 {
+				filter = c
+			} else {
+				filter = filter.And(c)
+			}
+		}
+		builder = builder.WithFilter(filter)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return page, fmt.Errorf("error building expression: %w", err)
+	}
+
+	queryIn := &dynamodb.QueryInput{
+		TableName:                 aws.String(r.TableName),
+		IndexName:                 aws.String(index),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(!query.Descending),
+	}
+
+	items, nextPageToken, err := queryPage(ctx, r.DB, queryIn, query.Limit, organizationId+"/"+query.SortBy, query.PageToken)
+	if err != nil {
+		return page, fmt.Errorf("error listing applications: %w", err)
+	}
+	if err := attributevalue.UnmarshalListOfMaps(items, &page.Applications); err != nil {
+		return page, fmt.Errorf("error unmarshaling applications: %w", err)
+	}
+	page.NextPageToken = nextPageToken
+	return page, nil
+}
+
+// NameSortKey is the value indexed for sorting by name. GSI key attributes cannot be empty, so the uuid is
+// appended, which also makes the order stable for applications with the same name.
+func NameSortKey(name string, uuid string) string {
+	return strings.ToLower(name) + "#" + uuid
+}
+
 func (r *ApplicationDatabaseStore) Insert(ctx context.Context, application Application) error {
+	application.NameSortKey = NameSortKey(application.Name, application.Uuid)
 	item, err := attributevalue.MarshalMap(application)
 	if err != nil {
 		return fmt.Errorf("error marshaling application: %w", err)
 	}
 	_, err = r.DB.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(r.TableName), Item: item,
+		ConditionExpression: insertCondition, ExpressionAttributeNames: insertConditionNames,
 	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("application %s: %w", application.Uuid, ErrAlreadyExists)
+	}
 	if err != nil {
 		return fmt.Errorf("error inserting application: %w", err)
 	}
@@ -102,23 +282,173 @@ func (r *ApplicationDatabaseStore) Insert(ctx context.Context, application Appli
 	return nil
 }
 
+// Update writes the changeable attributes of an application and increments its version, provided the stored
+// version still equals expectedVersion. Otherwise, or if the application no longer exists, it returns
+// ErrVersionConflict.
+func (r *ApplicationDatabaseStore) Update(ctx context.Context, applicationUuid string, update ApplicationUpdate, expectedVersion int64) (Application, error) {
+	version := expression.Name("version")
+	changes := expression.
+		Set(expression.Name("name"), expression.Value(update.Name)).
+		Set(expression.Name("nameSortKey"), expression.Value(NameSortKey(update.Name, applicationUuid))).
+		Set(expression.Name("description"), expression.Value(update.Description)).
+		Set(expression.Name("params"), expression.Value(update.Params)).
+		Set(expression.Name("commandArguments"), expression.Value(update.CommandArguments)).
+		Set(expression.Name("cpu"), expression.Value(update.CPU)).
+		Set(expression.Name("memory"), expression.Value(update.Memory)).
+		Set(expression.Name("runOnGpu"), expression.Value(update.RunOnGPU)).
+		Set(expression.Name("computeTypes"), expression.Value(update.ComputeTypes)).
+		Set(version, expression.Value(expectedVersion+1))
+	if update.AutoDeploy != nil {
+		changes = changes.Set(expression.Name("autoDeploy"), expression.Value(update.AutoDeploy))
+	} else {
+		changes = changes.Remove(expression.Name("autoDeploy"))
+	}
+	if len(update.BuildSecrets) > 0 {
+		changes = changes.Set(expression.Name("buildSecrets"), expression.Value(update.BuildSecrets))
+	} else {
+		changes = changes.Remove(expression.Name("buildSecrets"))
+	}
+	expressions, err := expression.NewBuilder().
+		WithCondition(versionCondition("version", expectedVersion)).
+		WithUpdate(changes).
+		Build()
+	if err != nil {
+		return Application{}, fmt.Errorf("error building update expression for application %s: %w", applicationUuid, err)
+	}
+
+	out, err := r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.TableName),
+		Key:                       Application{Uuid: applicationUuid}.GetKey(),
+		ConditionExpression:       expressions.Condition(),
+		UpdateExpression:          expressions.Update(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if isConditionFailed(err) {
+		return Application{}, fmt.Errorf("application %s version %d: %w", applicationUuid, expectedVersion, ErrVersionConflict)
+	}
+	if err != nil {
+		return Application{}, fmt.Errorf("error updating application: %w", err)
+	}
+
+	var application Application
+	if err := attributevalue.UnmarshalMap(out.Attributes, &application); err != nil {
+		return Application{}, fmt.Errorf("error unmarshaling updated application: %w", err)
+	}
+	return application, nil
+}
+
 func (r *ApplicationDatabaseStore) UpdateStatus(ctx context.Context, newStatus string, applicationUuid string) error {
 	key, err := attributevalue.MarshalMap(ApplicationKey{Uuid: applicationUuid})
 	if err != nil {
 		return fmt.Errorf("error marshaling key for status update: %w", err)
 	}
 
-	_, err = r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	in := &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.TableName),
 		Key:       key,
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":s": &types.AttributeValueMemberS{Value: newStatus},
 		},
 		UpdateExpression: aws.String("set registrationStatus = :s"),
-	})
+	}
+	if err := withTransition(in, statemachine.Application, newStatus); err != nil {
+		return err
+	}
+	if _, err = r.DB.UpdateItem(ctx, in); err != nil {
+		return fmt.Errorf("error updating application status: %w", transitionError(err, statemachine.Application, newStatus))
+	}
+
+	return nil
+}
+
+// UpdateStatusAtVersion is UpdateStatus for a client request guarded by the application's version. It returns
+// ErrVersionConflict if the application's version is no longer expectedVersion.
+func (r *ApplicationDatabaseStore) UpdateStatusAtVersion(ctx context.Context, newStatus string, applicationUuid string, expectedVersion int64) error {
+	in := &dynamodb.UpdateItemInput{
+		TableName:                aws.String(r.TableName),
+		Key:                      Application{Uuid: applicationUuid}.GetKey(),
+		ExpressionAttributeNames: map[string]string{},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s": &types.AttributeValueMemberS{Value: newStatus},
+		},
+		UpdateExpression: aws.String("set registrationStatus = :s"),
+	}
+	if err := withTransition(in, statemachine.Application, newStatus); err != nil {
+		return err
+	}
+	withVersion(in, "version", expectedVersion)
+	_, err := r.DB.UpdateItem(ctx, in)
+	if versionChanged(err, "version", expectedVersion) {
+		return fmt.Errorf("application %s version %d: %w", applicationUuid, expectedVersion, ErrVersionConflict)
+	}
 	if err != nil {
-		return fmt.Errorf("error updating application status: %w", err)
+		return fmt.Errorf("error updating application status: %w", transitionError(err, statemachine.Application, newStatus))
 	}
 
 	return nil
 }
+
+// ListAutoDeploy returns every application with an auto-deploy policy, across organizations.
+func (r *ApplicationDatabaseStore) ListAutoDeploy(ctx context.Context) ([]Application, error) {
+	applications := []Application{}
+	expr, err := expression.NewBuilder().WithFilter(expression.AttributeExists(expression.Name("autoDeploy"))).Build()
+	if err != nil {
+		return applications, fmt.Errorf("error building expression: %w", err)
+	}
+	scanIn := &dynamodb.ScanInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		TableName:                 aws.String(r.TableName),
+	}
+	for {
+		response, err := r.DB.Scan(ctx, scanIn)
+		if err != nil {
+			return applications, fmt.Errorf("error scanning applications with an auto-deploy policy: %w", err)
+		}
+		var page []Application
+		if err := attributevalue.UnmarshalListOfMaps(response.Items, &page); err != nil {
+			return applications, fmt.Errorf("error unmarshaling applications: %w", err)
+		}
+		applications = append(applications, page...)
+		if len(response.LastEvaluatedKey) == 0 {
+			return applications, nil
+		}
+		scanIn.ExclusiveStartKey = response.LastEvaluatedKey
+	}
+}
+
+// MarkAutoDeployed records that the application's scheduled deployment at was started, provided its
+// autoDeployedAt still equals previous, or is unset if previous is nil. It returns false otherwise, when another
+// poll has started the deployment already.
+func (r *ApplicationDatabaseStore) MarkAutoDeployed(ctx context.Context, applicationUuid string, previous *time.Time, at time.Time) (bool, error) {
+	autoDeployedAt := expression.Name("autoDeployedAt")
+	condition := expression.AttributeNotExists(autoDeployedAt)
+	if previous != nil {
+		condition = autoDeployedAt.Equal(expression.Value(previous.UTC()))
+	}
+	expressions, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name("uuid")).And(condition)).
+		WithUpdate(expression.Set(autoDeployedAt, expression.Value(at.UTC()))).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("error building auto-deploy expression for application %s: %w", applicationUuid, err)
+	}
+	_, err = r.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.TableName),
+		Key:                       Application{Uuid: applicationUuid}.GetKey(),
+		ConditionExpression:       expressions.Condition(),
+		UpdateExpression:          expressions.Update(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+	})
+	if isConditionFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error marking application %s auto-deployed: %w", applicationUuid, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,304 @@
+package store_dynamodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ArgCaptureApplicationsTableAPI struct {
+	PutItemInput    *dynamodb.PutItemInput
+	UpdateItemInput *dynamodb.UpdateItemInput
+	// UpdateItemOutput and UpdateItemErr are returned from UpdateItem when set
+	UpdateItemOutput *dynamodb.UpdateItemOutput
+	UpdateItemErr    error
+	QueryInputs      []dynamodb.QueryInput
+
+	// QueryOutputs are returned in order, one per Query call
+	QueryOutputs []*dynamodb.QueryOutput
+}
+
+func (m *ArgCaptureApplicationsTableAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (m *ArgCaptureApplicationsTableAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.PutItemInput = params
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *ArgCaptureApplicationsTableAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.UpdateItemInput = params
+	if m.UpdateItemErr != nil {
+		return nil, m.UpdateItemErr
+	}
+	if m.UpdateItemOutput != nil {
+		return m.UpdateItemOutput, nil
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *ArgCaptureApplicationsTableAPI) Scan(_ context.Context, _ *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (m *ArgCaptureApplicationsTableAPI) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.QueryInputs = append(m.QueryInputs, *params)
+	if len(m.QueryOutputs) == 0 {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	out := m.QueryOutputs[0]
+	m.QueryOutputs = m.QueryOutputs[1:]
+	return out, nil
+}
+
+func applicationItems(t *testing.T, uuids ...string) []map[string]types.AttributeValue {
+	var items []map[string]types.AttributeValue
+	for _, uuid := range uuids {
+		item, err := attributevalue.MarshalMap(Application{Uuid: uuid, OrganizationId: "N:organization:1"})
+		require.NoError(t, err)
+		items = append(items, item)
+	}
+	return items
+}
+
+func lastKey(uuid string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"uuid":           &types.AttributeValueMemberS{Value: uuid},
+		"organizationId": &types.AttributeValueMemberS{Value: "N:organization:1"},
+		"createdAt":      &types.AttributeValueMemberS{Value: "2024-01-01"},
+	}
+}
+
+func TestApplicationDatabaseStore_ListQueriesSortIndex(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{
+		QueryOutputs: []*dynamodb.QueryOutput{{Items: applicationItems(t, "a", "b")}},
+	}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	page, err := store.List(context.Background(), "N:organization:1", ApplicationQuery{
+		Limit:      10,
+		SortBy:     ApplicationSortName,
+		Descending: true,
+		Filters:    map[string]string{"sourceType": "github", "registrationStatus": "registered"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, page.Applications, 2)
+	assert.Empty(t, page.NextPageToken)
+
+	require.Len(t, mock.QueryInputs, 1)
+	in := mock.QueryInputs[0]
+	assert.Equal(t, "organizationId-nameSortKey-index", *in.IndexName)
+	assert.False(t, *in.ScanIndexForward)
+	assert.Equal(t, int32(10), *in.Limit)
+	assert.NotNil(t, in.FilterExpression)
+	values := map[string]bool{}
+	for _, v := range in.ExpressionAttributeValues {
+		values[v.(*types.AttributeValueMemberS).Value] = true
+	}
+	assert.True(t, values["N:organization:1"])
+	assert.True(t, values["github"])
+	assert.True(t, values["registered"])
+}
+
+func TestApplicationDatabaseStore_ListFillsPageAcrossQueries(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{
+		QueryOutputs: []*dynamodb.QueryOutput{
+			// filters discarded most of the first read
+			{Items: applicationItems(t, "a"), LastEvaluatedKey: lastKey("c")},
+			{Items: applicationItems(t, "d", "e"), LastEvaluatedKey: lastKey("e")},
+		},
+	}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	page, err := store.List(context.Background(), "N:organization:1", ApplicationQuery{Limit: 3, SortBy: ApplicationSortCreatedAt})
+	require.NoError(t, err)
+	assert.Len(t, page.Applications, 3)
+	assert.NotEmpty(t, page.NextPageToken)
+
+	require.Len(t, mock.QueryInputs, 2)
+	assert.Equal(t, int32(3), *mock.QueryInputs[0].Limit)
+	assert.Equal(t, int32(2), *mock.QueryInputs[1].Limit)
+	assert.Equal(t, lastKey("c"), mock.QueryInputs[1].ExclusiveStartKey)
+
+	// the token resumes after the last item returned
+	next := &ArgCaptureApplicationsTableAPI{}
+	_, err = NewApplicationDatabaseStore(next, "applications").List(context.Background(), "N:organization:1",
+		ApplicationQuery{Limit: 3, SortBy: ApplicationSortCreatedAt, PageToken: page.NextPageToken})
+	require.NoError(t, err)
+	assert.Equal(t, lastKey("e"), next.QueryInputs[0].ExclusiveStartKey)
+}
+
+func TestApplicationDatabaseStore_ListRejectsForeignTokens(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{
+		QueryOutputs: []*dynamodb.QueryOutput{{Items: applicationItems(t, "a"), LastEvaluatedKey: lastKey("a")}},
+	}
+	store := NewApplicationDatabaseStore(mock, "applications")
+	page, err := store.List(context.Background(), "N:organization:1", ApplicationQuery{Limit: 1, SortBy: ApplicationSortCreatedAt})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		organizationId string
+		sortBy         string
+		token          string
+	}{
+		{"other organization", "N:organization:2", ApplicationSortCreatedAt, page.NextPageToken},
+		{"other sort", "N:organization:1", ApplicationSortName, page.NextPageToken},
+		{"garbage", "N:organization:1", ApplicationSortCreatedAt, "not-a-token!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.List(context.Background(), tt.organizationId,
+				ApplicationQuery{Limit: 1, SortBy: tt.sortBy, PageToken: tt.token})
+			assert.ErrorIs(t, err, ErrInvalidPageToken)
+		})
+	}
+}
+
+func TestApplicationDatabaseStore_InsertSetsNameSortKey(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	require.NoError(t, store.Insert(context.Background(), Application{Uuid: "abc", Name: "My App"}))
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "my app#abc"}, mock.PutItemInput.Item["nameSortKey"])
+}
+
+func TestApplicationDatabaseStore_UpdateIsConditionalOnVersion(t *testing.T) {
+	updated, err := attributevalue.MarshalMap(Application{Uuid: "a", Name: "Renamed", Version: 4})
+	require.NoError(t, err)
+	mock := &ArgCaptureApplicationsTableAPI{UpdateItemOutput: &dynamodb.UpdateItemOutput{Attributes: updated}}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	application, err := store.Update(context.Background(), "a", ApplicationUpdate{Name: "Renamed", CPU: 1024, Memory: 2048}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", application.Name)
+	assert.Equal(t, int64(4), application.Version)
+
+	in := mock.UpdateItemInput
+	require.NotNil(t, in)
+	assert.Equal(t, Application{Uuid: "a"}.GetKey(), in.Key)
+	assert.Contains(t, *in.ConditionExpression, "attribute_exists")
+	assert.NotContains(t, *in.ConditionExpression, "attribute_not_exists")
+	assert.Equal(t, types.ReturnValueAllNew, in.ReturnValues)
+	numbers := map[string]bool{}
+	for _, v := range in.ExpressionAttributeValues {
+		if n, ok := v.(*types.AttributeValueMemberN); ok {
+			numbers[n.Value] = true
+		}
+	}
+	assert.True(t, numbers["3"], "condition on the expected version")
+	assert.True(t, numbers["4"], "version incremented")
+}
+
+func TestApplicationDatabaseStore_UpdateAcceptsUnversionedItems(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	_, err := store.Update(context.Background(), "a", ApplicationUpdate{Name: "n"}, 0)
+	require.NoError(t, err)
+	assert.Contains(t, *mock.UpdateItemInput.ConditionExpression, "attribute_not_exists")
+}
+
+func TestApplicationDatabaseStore_UpdateVersionConflict(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{UpdateItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed")}}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	_, err := store.Update(context.Background(), "a", ApplicationUpdate{Name: "n"}, 2)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+}
+
+func TestApplicationDatabaseStore_UpdateStatusAllowsDeletingFromAnyState(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	require.NoError(t, store.UpdateStatus(context.Background(), "deleting", "a"))
+	assert.Equal(t, "attribute_exists(uuid)", aws.ToString(mock.UpdateItemInput.ConditionExpression))
+	assert.Empty(t, mock.UpdateItemInput.ExpressionAttributeNames)
+}
+
+func TestApplicationDatabaseStore_UpdateStatusKeepsErrorsOffDeleting(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	require.NoError(t, store.UpdateStatus(context.Background(), "error: no capacity", "a"))
+	assert.Contains(t, aws.ToString(mock.UpdateItemInput.ConditionExpression), "#registrationStatus IN")
+	for _, v := range mock.UpdateItemInput.ExpressionAttributeValues {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			assert.NotEqual(t, "deleting", s.Value)
+		}
+	}
+}
+
+func TestApplicationDatabaseStore_UpdateStatusRejectsIllegalTransition(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{UpdateItemErr: &types.ConditionalCheckFailedException{
+		Message: aws.String("failed"),
+		Item:    map[string]types.AttributeValue{"uuid": &types.AttributeValueMemberS{Value: "a"}, "registrationStatus": &types.AttributeValueMemberS{Value: "deleting"}},
+	}}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	err := store.UpdateStatus(context.Background(), "deployed", "a")
+	assert.ErrorIs(t, err, statemachine.ErrIllegalTransition)
+	assert.Contains(t, err.Error(), `"deleting"`)
+	assert.Contains(t, aws.ToString(mock.UpdateItemInput.ConditionExpression), "#registrationStatus IN")
+	assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, mock.UpdateItemInput.ReturnValuesOnConditionCheckFailure)
+}
+
+func TestApplicationDatabaseStore_UpdateStatusAtVersion(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	require.NoError(t, store.UpdateStatusAtVersion(context.Background(), "deleting", "a", 3))
+	assert.Equal(t, "attribute_exists(uuid) AND #version = :expectedVersion", aws.ToString(mock.UpdateItemInput.ConditionExpression))
+	assert.Equal(t, "version", mock.UpdateItemInput.ExpressionAttributeNames["#version"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, mock.UpdateItemInput.ExpressionAttributeValues[":expectedVersion"])
+}
+
+func TestApplicationDatabaseStore_UpdateStatusAtVersionConflict(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{UpdateItemErr: &types.ConditionalCheckFailedException{
+		Message: aws.String("failed"),
+		Item: map[string]types.AttributeValue{
+			"uuid":               &types.AttributeValueMemberS{Value: "a"},
+			"registrationStatus": &types.AttributeValueMemberS{Value: "deployed"},
+			"version":            &types.AttributeValueMemberN{Value: "4"},
+		},
+	}}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	err := store.UpdateStatusAtVersion(context.Background(), "deleting", "a", 3)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.NotErrorIs(t, err, statemachine.ErrIllegalTransition)
+}
+
+func TestApplicationDatabaseStore_UpdateStatusAtVersionRejectsIllegalTransition(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{UpdateItemErr: &types.ConditionalCheckFailedException{
+		Message: aws.String("failed"),
+		Item: map[string]types.AttributeValue{
+			"uuid":               &types.AttributeValueMemberS{Value: "a"},
+			"registrationStatus": &types.AttributeValueMemberS{Value: "deleting"},
+		},
+	}}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	// items written before versions were introduced have none, and match version 0
+	err := store.UpdateStatusAtVersion(context.Background(), "deleting", "a", 0)
+	assert.ErrorIs(t, err, statemachine.ErrIllegalTransition)
+	assert.NotErrorIs(t, err, ErrVersionConflict)
+	assert.Contains(t, aws.ToString(mock.UpdateItemInput.ConditionExpression), "attribute_not_exists(#version)")
+}
+
+func TestApplicationDatabaseStore_UpdateStatusMissingApplication(t *testing.T) {
+	mock := &ArgCaptureApplicationsTableAPI{UpdateItemErr: &types.ConditionalCheckFailedException{Message: aws.String("failed")}}
+	store := NewApplicationDatabaseStore(mock, "applications")
+
+	err := store.UpdateStatus(context.Background(), "pending", "a")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, statemachine.ErrIllegalTransition)
+}
@@ -0,0 +1,83 @@
+// Package tasklogs reads the CloudWatch Logs stream of a Fargate task logging with the awslogs driver.
+package tasklogs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// ErrInvalidToken is returned when CloudWatch Logs rejects the token to read from
+var ErrInvalidToken = errors.New("invalid log stream token")
+
+// StreamPrefix is the awslogs-stream-prefix of the provisioner and deployer task definitions
+const StreamPrefix = "fargate"
+
+// LogsAPI is an interface only containing the CloudWatch Logs client methods used to read task logs
+type LogsAPI interface {
+	GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error)
+}
+
+// Event is one line of task output.
+type Event struct {
+	Timestamp time.Time
+	Message   string
+}
+
+// Page is a page of events from a stream. NextToken reads on from the end of the page, and is returned even once
+// the stream is caught up so that later events can be read as the task writes them. More is false when the
+// stream had no further events at the time of reading.
+type Page struct {
+	Events    []Event
+	NextToken string
+	More      bool
+}
+
+// StreamName returns the log stream awslogs writes a task's container output to: {prefix}/{container}/{task id}.
+func StreamName(prefix string, container string, taskArn string) string {
+	taskId := taskArn[strings.LastIndex(taskArn, "/")+1:]
+	return fmt.Sprintf("%s/%s/%s", prefix, container, taskId)
+}
+
+// Read returns up to limit events from the stream, oldest first, starting after token or from the beginning of
+// the stream without one. A stream that does not exist yet, because the task has not started, has no events.
+func Read(ctx context.Context, api LogsAPI, group string, stream string, token string, limit int32) (Page, error) {
+	in := &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+		StartFromHead: aws.Bool(true),
+		Limit:         aws.Int32(limit),
+	}
+	if token != "" {
+		in.NextToken = aws.String(token)
+	}
+	out, err := api.GetLogEvents(ctx, in)
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return Page{NextToken: token}, nil
+	}
+	var invalid *types.InvalidParameterException
+	if token != "" && errors.As(err, &invalid) {
+		return Page{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err != nil {
+		return Page{}, fmt.Errorf("error reading log stream %s: %w", stream, err)
+	}
+
+	page := Page{NextToken: aws.ToString(out.NextForwardToken)}
+	for _, event := range out.Events {
+		page.Events = append(page.Events, Event{
+			Timestamp: time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC(),
+			Message:   aws.ToString(event.Message),
+		})
+	}
+	// GetLogEvents returns the token it was given once the end of the stream is reached
+	page.More = len(page.Events) > 0 && page.NextToken != token
+	return page, nil
+}
@@ -0,0 +1,65 @@
+package tasklogs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/pennsieve/app-deploy-service/service/tasklogs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLogs struct {
+	in  *cloudwatchlogs.GetLogEventsInput
+	out *cloudwatchlogs.GetLogEventsOutput
+	err error
+}
+
+func (f *fakeLogs) GetLogEvents(_ context.Context, params *cloudwatchlogs.GetLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	f.in = params
+	return f.out, f.err
+}
+
+func TestStreamName(t *testing.T) {
+	assert.Equal(t, "fargate/app-provisioner/0123abcd",
+		tasklogs.StreamName(tasklogs.StreamPrefix, "app-provisioner", "arn:aws:ecs:us-east-1:123456789012:task/cluster-name/0123abcd"))
+}
+
+func TestRead(t *testing.T) {
+	api := &fakeLogs{out: &cloudwatchlogs.GetLogEventsOutput{
+		Events: []types.OutputLogEvent{
+			{Timestamp: aws.Int64(1717027200000), Message: aws.String("building")},
+		},
+		NextForwardToken: aws.String("f/2"),
+	}}
+
+	page, err := tasklogs.Read(context.Background(), api, "group", "stream", "f/1", 10)
+	require.NoError(t, err)
+	assert.Equal(t, "group", aws.ToString(api.in.LogGroupName))
+	assert.Equal(t, "f/1", aws.ToString(api.in.NextToken))
+	assert.True(t, aws.ToBool(api.in.StartFromHead))
+	assert.Equal(t, []tasklogs.Event{{Timestamp: time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC), Message: "building"}}, page.Events)
+	assert.Equal(t, "f/2", page.NextToken)
+	assert.True(t, page.More)
+
+	// the end of the stream hands back the same token
+	api.out = &cloudwatchlogs.GetLogEventsOutput{NextForwardToken: aws.String("f/2")}
+	page, err = tasklogs.Read(context.Background(), api, "group", "stream", "f/2", 10)
+	require.NoError(t, err)
+	assert.Empty(t, page.Events)
+	assert.Equal(t, "f/2", page.NextToken)
+	assert.False(t, page.More)
+}
+
+func TestReadMissingStream(t *testing.T) {
+	api := &fakeLogs{err: &types.ResourceNotFoundException{Message: aws.String("The specified log stream does not exist.")}}
+
+	page, err := tasklogs.Read(context.Background(), api, "group", "stream", "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, page.Events)
+	assert.False(t, page.More)
+}
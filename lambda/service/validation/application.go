@@ -0,0 +1,186 @@
+package validation
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/pennsieve/app-deploy-service/service/models"
+)
+
+// fargateMemory lists, for each Fargate CPU value in units, the memory values in MiB it can be paired with.
+// See https://docs.aws.amazon.com/AmazonECS/latest/developerguide/fargate-tasks-services.html#fargate-tasks-size
+var fargateMemory = map[int][]int{
+	256:   {512, 1024, 2048},
+	512:   memoryRange(1024, 4096, 1024),
+	1024:  memoryRange(2048, 8192, 1024),
+	2048:  memoryRange(4096, 16384, 1024),
+	4096:  memoryRange(8192, 30720, 1024),
+	8192:  memoryRange(16384, 61440, 4096),
+	16384: memoryRange(32768, 122880, 8192),
+}
+
+func memoryRange(from, to, step int) []int {
+	var values []int
+	for m := from; m <= to; m += step {
+		values = append(values, m)
+	}
+	return values
+}
+
+// RegisterApplication validates the payload of POST /applications.
+func RegisterApplication(app models.Application) []models.FieldError {
+	v := &Validator{}
+	Field(v, "source.url", app.Source.Url, Required(), GitURL())
+	buildOptions(v, app.Source.BuildOptions)
+	Field(v, "computeNode.uuid", app.ComputeNode.Uuid, Required())
+	Field(v, "account.accountId", app.Account.AccountId, Required(), AccountID())
+	runtimeConfig(v, app.RuntimeConfig)
+	autoDeploy(v, app.AutoDeploy)
+	buildSecrets(v, app.BuildSecrets)
+	return v.Errors()
+}
+
+// DeployApplication validates the payload of POST /applications/deploy.
+func DeployApplication(app models.Application) []models.FieldError {
+	v := &Validator{}
+	Field(v, "uuid", app.Uuid, Required())
+	Field(v, "source.url", app.Source.Url, Required(), GitURL())
+	buildOptions(v, app.Source.BuildOptions)
+	Field(v, "account.accountId", app.Account.AccountId, Required(), AccountID())
+	runtimeConfig(v, app.RuntimeConfig)
+	return v.Errors()
+}
+
+// DeploymentRef validates the ref and refType query parameters of POST /applications/deploy.
+func DeploymentRef(refType string, ref string) []models.FieldError {
+	v := &Validator{}
+	gitRef(v, "", refType, ref)
+	return v.Errors()
+}
+
+// AppStoreDeployment validates the ref and build options of the payload of POST /appstore.
+func AppStoreDeployment(deployment models.AppStoreDeployment) []models.FieldError {
+	v := &Validator{}
+	gitRef(v, "source.", deployment.Source.RefType, deployment.Source.Ref)
+	buildOptions(v, deployment.Source.BuildOptions)
+	return v.Errors()
+}
+
+// buildOptions validates the options an application's image is built with
+func buildOptions(v *Validator, options models.BuildOptions) {
+	if options.ContextDir != "" {
+		Field(v, "source.contextDir", options.ContextDir, RelativePath())
+	}
+	if options.Dockerfile != "" {
+		Field(v, "source.dockerfile", options.Dockerfile, RelativePath())
+	}
+	for _, name := range slices.Sorted(maps.Keys(options.BuildArgs)) {
+		field := fmt.Sprintf("source.buildArgs.%s", name)
+		Field(v, field, name, Matches(buildArgName, "must be a build argument name such as VERSION"))
+		Field(v, field, options.BuildArgs[name], SingleLine())
+	}
+	if options.Target != "" {
+		Field(v, "source.target", options.Target, Matches(buildStage, "must be a build stage name"))
+	}
+}
+
+// gitRef validates a ref to build, a tag or branch name or a full commit SHA by refType, which defaults to tag
+func gitRef(v *Validator, prefix string, refType string, ref string) {
+	if refType != "" {
+		Field(v, prefix+"refType", refType, OneOf(models.RefTypes...))
+		Field(v, prefix+"ref", ref, Required())
+	}
+	if ref == "" {
+		return
+	}
+	if refType == models.RefTypeCommit {
+		Field(v, prefix+"ref", ref, CommitSHA())
+	} else {
+		Field(v, prefix+"ref", ref, GitRefName())
+	}
+}
+
+// PatchApplication validates an application after a PATCH /applications/{id} merge patch is applied.
+func PatchApplication(patch models.ApplicationPatch) []models.FieldError {
+	v := &Validator{}
+	Field(v, "name", patch.Name, Required())
+	runtimeConfig(v, patch.RuntimeConfig)
+	autoDeploy(v, patch.AutoDeploy)
+	buildSecrets(v, patch.BuildSecrets)
+	return v.Errors()
+}
+
+// buildSecrets validates the references to an application's build secrets. Each is passed as a different build arg.
+func buildSecrets(v *Validator, secrets []models.BuildSecret) {
+	seen := map[string]bool{}
+	for i, secret := range secrets {
+		field := fmt.Sprintf("buildSecrets[%d]", i)
+		Field(v, field+".name", secret.Name, Required(), Matches(buildArgName, "must be a build argument name such as PIP_INDEX_URL"))
+		if seen[secret.Name] {
+			v.errors = append(v.errors, models.FieldError{Field: field + ".name", Code: CodeInvalid, Message: "is already the name of another build secret"})
+		}
+		seen[secret.Name] = true
+		Field(v, field+".store", secret.Store, Required(), OneOf(models.BuildSecretStores...))
+		Field(v, field+".secret", secret.Secret, Required(), Matches(buildSecretName, "must be a secret name such as pypi/index-url"))
+	}
+}
+
+// autoDeploy validates an application's auto-deploy policy, if it has one
+func autoDeploy(v *Validator, policy *models.AutoDeployPolicy) {
+	if policy == nil {
+		return
+	}
+	Field(v, "autoDeploy", *policy, OneTrigger())
+	if policy.Schedule != "" {
+		Field(v, "autoDeploy.schedule", policy.Schedule, CronSchedule())
+	}
+	if policy.TagPattern != "" {
+		Field(v, "autoDeploy.tagPattern", policy.TagPattern, GlobPattern())
+	}
+}
+
+// OneTrigger rejects auto-deploy policies that do not set exactly one of a schedule and a tag pattern.
+func OneTrigger() Rule[models.AutoDeployPolicy] {
+	return func(policy models.AutoDeployPolicy) *Failure {
+		switch {
+		case policy.Schedule == "" && policy.TagPattern == "":
+			return &Failure{CodeRequired, "must set one of schedule and tagPattern"}
+		case policy.Schedule != "" && policy.TagPattern != "":
+			return &Failure{CodeInvalid, "cannot set both schedule and tagPattern"}
+		}
+		return nil
+	}
+}
+
+func runtimeConfig(v *Validator, rc models.RuntimeConfig) {
+	Each(v, "runtimeConfig.computeTypes", rc.ComputeTypes, OneOf(models.ComputeTypes...))
+	// GPU applications run on EC2 capacity, so the Fargate task size table does not apply
+	if slices.Contains(rc.ComputeTypes, models.ComputeTypeGPU) {
+		return
+	}
+	Field(v, "runtimeConfig", rc, FargateResources())
+}
+
+// FargateResources rejects CPU and memory values that do not form a valid Fargate task size. Zero values are
+// replaced with the service defaults before checking, as they are when the task is started.
+func FargateResources() Rule[models.RuntimeConfig] {
+	return func(rc models.RuntimeConfig) *Failure {
+		cpu, memory := rc.CPU, rc.Memory
+		if cpu == 0 {
+			cpu = models.DefaultCPU
+		}
+		if memory == 0 {
+			memory = models.DefaultMemory
+		}
+		allowed, ok := fargateMemory[cpu]
+		if !ok {
+			return &Failure{CodeUnsupported, fmt.Sprintf("cpu %d is not a supported Fargate CPU value", cpu)}
+		}
+		if !slices.Contains(allowed, memory) {
+			return &Failure{CodeInvalidRange, fmt.Sprintf("memory %d MiB cannot be used with cpu %d; allowed values are %d to %d MiB",
+				memory, cpu, allowed[0], allowed[len(allowed)-1])}
+		}
+		return nil
+	}
+}
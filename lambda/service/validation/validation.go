@@ -0,0 +1,218 @@
+// Package validation declares the rules request payloads must satisfy before the service writes to DynamoDB or
+// starts a Fargate task. Rules report failures as models.FieldError so handlers can return them to the caller.
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/schedule"
+)
+
+// Failure codes reported in models.FieldError.Code.
+const (
+	CodeRequired     = "required"
+	CodeInvalid      = "invalid"
+	CodeUnsupported  = "unsupported"
+	CodeInvalidRange = "invalid_range"
+)
+
+// Failure describes why a value broke a rule.
+type Failure struct {
+	Code    string
+	Message string
+}
+
+// Rule checks a single value and returns nil when it is valid.
+type Rule[T any] func(T) *Failure
+
+// Validator collects field errors across a payload.
+type Validator struct {
+	errors []models.FieldError
+}
+
+// Field applies rules to value in order and records the first failure against name.
+func Field[T any](v *Validator, name string, value T, rules ...Rule[T]) {
+	for _, rule := range rules {
+		if f := rule(value); f != nil {
+			v.errors = append(v.errors, models.FieldError{Field: name, Code: f.Code, Message: f.Message})
+			return
+		}
+	}
+}
+
+// Each applies rules to every element of values, recording failures as name[i].
+func Each[T any](v *Validator, name string, values []T, rules ...Rule[T]) {
+	for i, value := range values {
+		Field(v, fmt.Sprintf("%s[%d]", name, i), value, rules...)
+	}
+}
+
+// Errors returns the field errors recorded so far, or nil if every rule passed.
+func (v *Validator) Errors() []models.FieldError {
+	return v.errors
+}
+
+// Required rejects empty strings.
+func Required() Rule[string] {
+	return func(value string) *Failure {
+		if strings.TrimSpace(value) == "" {
+			return &Failure{CodeRequired, "is required"}
+		}
+		return nil
+	}
+}
+
+// Matches rejects strings that do not match pattern, using message to describe the expected format.
+func Matches(pattern *regexp.Regexp, message string) Rule[string] {
+	return func(value string) *Failure {
+		if !pattern.MatchString(value) {
+			return &Failure{CodeInvalid, message}
+		}
+		return nil
+	}
+}
+
+// OneOf rejects strings that are not in allowed.
+func OneOf(allowed ...string) Rule[string] {
+	return func(value string) *Failure {
+		if !slices.Contains(allowed, value) {
+			return &Failure{CodeUnsupported, fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))}
+		}
+		return nil
+	}
+}
+
+// IntBetween accepts decimal integers from min to max inclusive.
+func IntBetween(min, max int) Rule[string] {
+	return func(value string) *Failure {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return &Failure{CodeInvalidRange, fmt.Sprintf("must be an integer from %d to %d", min, max)}
+		}
+		return nil
+	}
+}
+
+// RFC3339 accepts timestamps such as 2024-05-01T12:00:00Z.
+func RFC3339() Rule[string] {
+	return func(value string) *Failure {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return &Failure{CodeInvalid, "must be an RFC 3339 timestamp such as 2024-05-01T12:00:00Z"}
+		}
+		return nil
+	}
+}
+
+var scpLikeGitURL = regexp.MustCompile(`^[\w.-]+@[\w.-]+:[\w.-]+(/[\w.-]+)+$`)
+
+// GitURL accepts https and ssh URLs, and scp-like git@host:owner/repo addresses, that name an owner and a repository.
+func GitURL() Rule[string] {
+	invalid := &Failure{CodeInvalid, "must be a git repository URL such as https://github.com/owner/repo"}
+	return func(value string) *Failure {
+		if scpLikeGitURL.MatchString(value) {
+			return nil
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "ssh") {
+			return invalid
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return invalid
+		}
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(segments) < 2 || slices.Contains(segments, "") {
+			return invalid
+		}
+		return nil
+	}
+}
+
+var awsAccountID = regexp.MustCompile(`^\d{12}$`)
+
+// AccountID accepts 12-digit AWS account IDs.
+func AccountID() Rule[string] {
+	return Matches(awsAccountID, "must be a 12-digit AWS account ID")
+}
+
+// CronSchedule accepts five-field cron expressions such as "0 3 * * 1-5".
+func CronSchedule() Rule[string] {
+	return func(value string) *Failure {
+		if _, err := schedule.Parse(value); err != nil {
+			return &Failure{CodeInvalid, fmt.Sprintf("must be a five-field cron expression such as \"0 3 * * 1-5\": %s", err)}
+		}
+		return nil
+	}
+}
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// CommitSHA accepts full 40-character commit SHAs. An abbreviated SHA cannot be checked out without the history.
+func CommitSHA() Rule[string] {
+	return Matches(commitSHA, "must be a full 40-character commit SHA")
+}
+
+// GitRefName accepts branch and tag names that git check-ref-format allows and that can be put in a kaniko build
+// context, which ends the repository URL at a #.
+func GitRefName() Rule[string] {
+	invalid := &Failure{CodeInvalid, "must be a git branch or tag name"}
+	return func(value string) *Failure {
+		if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "/") || strings.HasSuffix(value, "/") ||
+			strings.HasSuffix(value, ".") || strings.HasSuffix(value, ".lock") ||
+			strings.Contains(value, "..") || strings.Contains(value, "//") || strings.Contains(value, "@{") {
+			return invalid
+		}
+		for _, r := range value {
+			if r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\#", r) {
+				return invalid
+			}
+		}
+		return nil
+	}
+}
+
+var buildArgName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// buildSecretName matches the names of build secrets below an organization's path, segments separated by slashes
+var buildSecretName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*(/[A-Za-z0-9][A-Za-z0-9_.-]*)*$`)
+
+var buildStage = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// RelativePath accepts slash-separated paths within a repository, such as processors/segmentation.
+func RelativePath() Rule[string] {
+	return func(value string) *Failure {
+		if path.IsAbs(value) || path.Clean(value) != strings.TrimSuffix(value, "/") || value == "." ||
+			value == ".." || strings.HasPrefix(value, "../") || strings.ContainsAny(value, "\\#") {
+			return &Failure{CodeInvalid, "must be a relative path within the repository such as processors/segmentation"}
+		}
+		return nil
+	}
+}
+
+// SingleLine accepts values without line breaks or other control characters.
+func SingleLine() Rule[string] {
+	return func(value string) *Failure {
+		if strings.ContainsFunc(value, unicode.IsControl) {
+			return &Failure{CodeInvalid, "must not contain control characters"}
+		}
+		return nil
+	}
+}
+
+// GlobPattern accepts patterns path.Match can match names against, such as v*.
+func GlobPattern() Rule[string] {
+	return func(value string) *Failure {
+		if _, err := path.Match(value, ""); err != nil {
+			return &Failure{CodeInvalid, "must be a glob pattern such as v*"}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,236 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/pennsieve/app-deploy-service/service/models"
+	"github.com/pennsieve/app-deploy-service/service/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func validApplication() models.Application {
+	return models.Application{
+		Uuid:        "app-uuid",
+		Source:      models.Source{SourceType: "github", Url: "https://github.com/org/repo"},
+		ComputeNode: models.ComputeNode{Uuid: "node-uuid"},
+		Account:     models.Account{AccountId: "123456789012"},
+	}
+}
+
+func fieldNames(errs []models.FieldError) []string {
+	var names []string
+	for _, e := range errs {
+		names = append(names, e.Field)
+	}
+	return names
+}
+
+func TestGitURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://github.com/org/repo", true},
+		{"https://github.com/org/repo.git", true},
+		{"https://gitlab.com/group/subgroup/repo", true},
+		{"ssh://git@github.com/org/repo.git", true},
+		{"git@github.com:org/repo.git", true},
+		{"github.com/org/repo", false},
+		{"http://github.com/org/repo", false},
+		{"https://github.com/org", false},
+		{"https://github.com//repo", false},
+		{"https://github.com/org/repo?ref=main", false},
+		{"not a url", false},
+	}
+	rule := validation.GitURL()
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, tt.valid, rule(tt.url) == nil)
+		})
+	}
+}
+
+func TestAccountID(t *testing.T) {
+	rule := validation.AccountID()
+	assert.Nil(t, rule("123456789012"))
+	assert.NotNil(t, rule("12345678901"))
+	assert.NotNil(t, rule("1234567890123"))
+	assert.NotNil(t, rule("12345678901a"))
+}
+
+func TestFargateResources(t *testing.T) {
+	tests := []struct {
+		name   string
+		cpu    int
+		memory int
+		valid  bool
+	}{
+		{"defaults", 0, 0, true},
+		{"smallest", 256, 512, true},
+		{"default memory with explicit cpu", 1024, 0, true},
+		{"8 vCPU 4 GiB step", 8192, 20480, true},
+		{"largest", 16384, 122880, true},
+		{"memory too small", 2048, 2048, false},
+		{"memory off step", 8192, 17408, false},
+		{"unknown cpu", 3000, 8192, false},
+		{"default memory too large for cpu", 256, 0, false},
+	}
+	rule := validation.FargateResources()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.valid, rule(models.RuntimeConfig{CPU: tt.cpu, Memory: tt.memory}) == nil)
+		})
+	}
+}
+
+func TestRegisterApplication(t *testing.T) {
+	assert.Empty(t, validation.RegisterApplication(validApplication()))
+
+	app := validApplication()
+	app.Source.Url = "github.com/org/repo"
+	app.ComputeNode.Uuid = ""
+	app.Account.AccountId = "1234"
+	app.RuntimeConfig = models.RuntimeConfig{CPU: 256, Memory: 8192, ComputeTypes: []string{"standard", "tpu"}}
+
+	errs := validation.RegisterApplication(app)
+	assert.Equal(t, []string{
+		"source.url",
+		"computeNode.uuid",
+		"account.accountId",
+		"runtimeConfig.computeTypes[1]",
+		"runtimeConfig",
+	}, fieldNames(errs))
+	assert.Equal(t, validation.CodeRequired, errs[1].Code)
+	assert.Equal(t, validation.CodeUnsupported, errs[3].Code)
+	assert.Equal(t, validation.CodeInvalidRange, errs[4].Code)
+}
+
+func TestGPUApplicationsSkipFargateSizes(t *testing.T) {
+	app := validApplication()
+	app.RuntimeConfig = models.RuntimeConfig{CPU: 3000, Memory: 7000, ComputeTypes: []string{"gpu"}}
+	assert.Empty(t, validation.RegisterApplication(app))
+}
+
+func TestDeployApplication(t *testing.T) {
+	assert.Empty(t, validation.DeployApplication(validApplication()))
+
+	app := validApplication()
+	app.Uuid = ""
+	app.ComputeNode.Uuid = ""
+	assert.Equal(t, []string{"uuid"}, fieldNames(validation.DeployApplication(app)))
+}
+
+func TestPatchApplication(t *testing.T) {
+	patch := models.ApplicationPatch{Name: "app", RuntimeConfig: models.RuntimeConfig{CPU: 1024, Memory: 2048}}
+	assert.Empty(t, validation.PatchApplication(patch))
+
+	patch = models.ApplicationPatch{RuntimeConfig: models.RuntimeConfig{CPU: 1024, Memory: 1024, ComputeTypes: []string{"tpu"}}}
+	assert.Equal(t, []string{"name", "runtimeConfig.computeTypes[0]", "runtimeConfig"}, fieldNames(validation.PatchApplication(patch)))
+}
+
+func TestAutoDeploy(t *testing.T) {
+	for _, policy := range []models.AutoDeployPolicy{{Schedule: "0 3 * * 1-5"}, {TagPattern: "v*"}, {TagPattern: "release-[0-9]*"}} {
+		app := validApplication()
+		app.AutoDeploy = &policy
+		assert.Empty(t, validation.RegisterApplication(app), policy)
+	}
+
+	app := validApplication()
+	app.AutoDeploy = &models.AutoDeployPolicy{}
+	errs := validation.RegisterApplication(app)
+	assert.Equal(t, []string{"autoDeploy"}, fieldNames(errs))
+	assert.Equal(t, validation.CodeRequired, errs[0].Code)
+
+	app.AutoDeploy = &models.AutoDeployPolicy{Schedule: "every day", TagPattern: "v["}
+	assert.Equal(t, []string{"autoDeploy", "autoDeploy.schedule", "autoDeploy.tagPattern"}, fieldNames(validation.RegisterApplication(app)))
+
+	patch := models.ApplicationPatch{Name: "app", AutoDeploy: &models.AutoDeployPolicy{Schedule: "0 25 * * *"}}
+	assert.Equal(t, []string{"autoDeploy.schedule"}, fieldNames(validation.PatchApplication(patch)))
+}
+
+func TestGitRefName(t *testing.T) {
+	rule := validation.GitRefName()
+	for _, name := range []string{"main", "feature/x", "v1.0.0", "release-2024.1"} {
+		assert.Nil(t, rule(name), name)
+	}
+	for _, name := range []string{"-x", "a..b", "a b", "a#b", "a:b", "a/", "/a", "a.lock", "a@{1}", "a//b"} {
+		assert.NotNil(t, rule(name), name)
+	}
+}
+
+func TestDeploymentRef(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	assert.Empty(t, validation.DeploymentRef("", ""))
+	assert.Empty(t, validation.DeploymentRef("", "v1.0.0"))
+	assert.Empty(t, validation.DeploymentRef("branch", "feature/x"))
+	assert.Empty(t, validation.DeploymentRef("commit", sha))
+
+	assert.Equal(t, []string{"ref"}, fieldNames(validation.DeploymentRef("commit", sha[:7])))
+	assert.Equal(t, []string{"ref"}, fieldNames(validation.DeploymentRef("branch", "")))
+	assert.Equal(t, []string{"refType"}, fieldNames(validation.DeploymentRef("sha", "main")))
+
+	deployment := models.AppStoreDeployment{Source: models.DeploymentSource{RefType: "branch", Ref: "a b"}}
+	assert.Equal(t, []string{"source.ref"}, fieldNames(validation.AppStoreDeployment(deployment)))
+}
+
+func TestRelativePath(t *testing.T) {
+	rule := validation.RelativePath()
+	for _, value := range []string{"processors/segmentation", "app", "docker/Dockerfile.gpu", "app/"} {
+		assert.Nil(t, rule(value), value)
+	}
+	for _, value := range []string{"/app", ".", "..", "../app", "app/../../x", "a//b", "./app", "a\\b"} {
+		assert.NotNil(t, rule(value), value)
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	app := validApplication()
+	app.Source.BuildOptions = models.BuildOptions{
+		ContextDir: "processors/segmentation",
+		Dockerfile: "docker/Dockerfile",
+		BuildArgs:  map[string]string{"VERSION": "1.0", "BASE_IMAGE": "python:3.12"},
+		Target:     "runtime",
+	}
+	assert.Empty(t, validation.RegisterApplication(app))
+	assert.Empty(t, validation.DeployApplication(app))
+
+	app.Source.BuildOptions = models.BuildOptions{
+		ContextDir: "../other",
+		Dockerfile: "/Dockerfile",
+		BuildArgs:  map[string]string{"1X": "a", "NOTE": "two\nlines"},
+		Target:     "-stage",
+	}
+	assert.Equal(t, []string{
+		"source.contextDir",
+		"source.dockerfile",
+		"source.buildArgs.1X",
+		"source.buildArgs.NOTE",
+		"source.target",
+	}, fieldNames(validation.RegisterApplication(app)))
+
+	deployment := models.AppStoreDeployment{Source: models.DeploymentSource{BuildOptions: models.BuildOptions{ContextDir: "/"}}}
+	assert.Equal(t, []string{"source.contextDir"}, fieldNames(validation.AppStoreDeployment(deployment)))
+}
+
+func TestBuildSecrets(t *testing.T) {
+	app := validApplication()
+	app.BuildSecrets = []models.BuildSecret{
+		{Name: "PIP_INDEX_URL", Store: "ssm", Secret: "pypi/index-url"},
+		{Name: "CONDA_TOKEN", Store: "secretsmanager", Secret: "conda-token"},
+	}
+	assert.Empty(t, validation.RegisterApplication(app))
+
+	app.BuildSecrets = []models.BuildSecret{
+		{Name: "PIP_INDEX_URL", Store: "vault", Secret: "/ops/github-token"},
+		{Name: "PIP_INDEX_URL", Store: "ssm", Secret: "../other-org/token"},
+	}
+	assert.Equal(t, []string{
+		"buildSecrets[0].store",
+		"buildSecrets[0].secret",
+		"buildSecrets[1].name",
+		"buildSecrets[1].secret",
+	}, fieldNames(validation.RegisterApplication(app)))
+
+	patch := models.ApplicationPatch{Name: "app", BuildSecrets: []models.BuildSecret{{Name: "PIP_INDEX_URL", Store: "ssm"}}}
+	assert.Equal(t, []string{"buildSecrets[0].secret"}, fieldNames(validation.PatchApplication(patch)))
+}
@@ -16,6 +16,19 @@ type ApplicationStatusEvent struct {
 	Source        string     `json:"source"`
 }
 
+const DeploymentStepEventName = "deployment_step_event"
+
+// DeploymentStepEvent is sent on the application channel as each step of a deployment starts and ends. Outcome is
+// empty when the step starts.
+type DeploymentStepEvent struct {
+	ApplicationId string    `json:"application_id"`
+	DeploymentId  string    `json:"deployment_id"`
+	Step          string    `json:"step"`
+	Outcome       string    `json:"outcome,omitempty"`
+	Time          time.Time `json:"time"`
+	Source        string    `json:"source"`
+}
+
 func ApplicationStatusChannel(applicationUuid string) string {
 	return fmt.Sprintf("application-%s", applicationUuid)
 }
@@ -14,6 +14,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ecs v1.53.8
 	github.com/aws/aws-sdk-go-v2/service/ssm v1.56.9
 	github.com/google/uuid v1.6.0
+	github.com/pennsieve/app-deploy-service/statemachine v0.0.0
 	github.com/pennsieve/pennsieve-go-core v1.13.7
 	github.com/pusher/pusher-http-go/v5 v5.1.1
 	github.com/stretchr/testify v1.8.1
@@ -42,3 +43,6 @@ require (
 	golang.org/x/sys v0.21.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// statemachine is shared by the service, status listener and provisioner
+replace github.com/pennsieve/app-deploy-service/statemachine => ../../statemachine
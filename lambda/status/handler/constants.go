@@ -2,6 +2,9 @@ package handler
 
 const ApplicationsTableEnvVar = "APPLICATIONS_TABLE"
 const DeploymentsTableEnvVar = "DEPLOYMENTS_TABLE"
+const DeploymentLeasesTableEnvVar = "DEPLOYMENT_LEASES_TABLE"
+const DeploymentJobsTableEnvVar = "DEPLOYMENT_JOBS_TABLE"
+const ProvisionerTaskFamilyEnvVar = "PROVISIONER_TASK_FAMILY"
 
 // DeploymentIdTag is the tag that we add to the deployment ECS task so that the deployment id can be retrieved by
 // the state change listener
@@ -14,3 +17,7 @@ const ApplicationIdTag = "ApplicationId"
 // ApplicationsTableTag is the tag that overrides the default applications table for the deployment.
 // Used by appstore deployments to point the status handler at the appstore-specific table.
 const ApplicationsTableTag = "ApplicationsTable"
+
+// DeploymentCancelledReason is the stopped reason the service gives ECS when a user cancels a deployment. It must
+// match the value used by the service so that cancelled tasks are not reported as errors.
+const DeploymentCancelledReason = "Deployment cancelled"
@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 	"github.com/pennsieve/app-deploy-service/status/dydbutils"
 	"github.com/pennsieve/app-deploy-service/status/models"
 )
@@ -80,6 +81,9 @@ func DeploymentUpdateBuilder(event models.TaskStateChangeEvent) expression.Updat
 
 	if finalState := IsFinalState(event); finalState != nil {
 		builder.Set(expression.Name(models.DeploymentErroredField), expression.Value(finalState.Errored))
+		if finalState.Cancelled {
+			builder.Set(expression.Name(models.DeploymentCancelledField), expression.Value(true))
+		}
 	}
 	return builder
 }
@@ -96,9 +100,54 @@ func setOptionalString(updateBuilder expression.UpdateBuilder, name string, opti
 	}
 }
 
+// AppendDeploymentStep adds step to the end of the deployment's timeline.
+func (h *DeployTaskStateChangeHandler) AppendDeploymentStep(ctx context.Context, applicationId, deploymentId string, step models.StepEvent) error {
+	timeline := expression.Name(models.DeploymentTimelineField)
+	expressions, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(models.DeploymentIdField))).
+		WithUpdate(expression.Set(timeline, expression.ListAppend(
+			expression.IfNotExists(timeline, expression.Value([]models.StepEvent{})),
+			expression.Value([]models.StepEvent{step})))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building timeline update expression for deployment %s: %w",
+			deploymentId,
+			err)
+	}
+	updateIn := &dynamodb.UpdateItemInput{
+		Key:                       models.DeploymentKeyItem(applicationId, deploymentId),
+		TableName:                 aws.String(h.DeploymentsTable),
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	}
+	if _, err := h.DynamoDBApi.UpdateItem(ctx, updateIn); err != nil {
+		return fmt.Errorf("error appending %s step to deployment %s: %w",
+			step.Step,
+			deploymentId,
+			err)
+	}
+	return nil
+}
+
+// UpdateApplicationsTable sets the final status of the deployment's application, or App Store version when the
+// deployment used its own applications table. The update is only applied if the record's current status allows it;
+// otherwise an error wrapping statemachine.ErrIllegalTransition is returned.
 func (h *DeployTaskStateChangeHandler) UpdateApplicationsTable(ctx context.Context, applicationId string, finalState *FinalState, tableName string) error {
+	return h.updateApplicationStatus(ctx, applicationId, finalState.Status(), tableName)
+}
+
+func (h *DeployTaskStateChangeHandler) updateApplicationStatus(ctx context.Context, applicationId string, status string, tableName string) error {
 	key := models.ApplicationKey(applicationId)
-	status := finalState.Status()
+	machine := statemachine.Application
+	if tableName != h.ApplicationsTable {
+		machine = statemachine.Version
+	}
+	transition, err := machine.Condition(status)
+	if err != nil {
+		return err
+	}
 	expressions, err := expression.NewBuilder().
 		WithCondition(expression.AttributeExists(expression.Name(models.ApplicationKeyField))).
 		WithUpdate(expression.Set(expression.Name(models.ApplicationStatusField), expression.Value(status))).Build()
@@ -107,15 +156,36 @@ func (h *DeployTaskStateChangeHandler) UpdateApplicationsTable(ctx context.Conte
 			applicationId,
 			err)
 	}
+	// the transition condition uses its own placeholders, which the builder's generated ones cannot clash with
+	names := expressions.Names()
+	values := expressions.Values()
+	if transition.Expression != "" {
+		names[statemachine.NamePlaceholder] = statemachine.Attribute
+		for placeholder, value := range transition.Values {
+			values[placeholder] = dydbutils.StringAttributeValue(value)
+		}
+	}
 	updateIn := &dynamodb.UpdateItemInput{
-		Key:                       key,
-		TableName:                 aws.String(tableName),
-		ConditionExpression:       expressions.Condition(),
-		ExpressionAttributeNames:  expressions.Names(),
-		ExpressionAttributeValues: expressions.Values(),
-		UpdateExpression:          expressions.Update(),
+		Key:                                 key,
+		TableName:                           aws.String(tableName),
+		ConditionExpression:                 aws.String(transition.And(aws.ToString(expressions.Condition()))),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		UpdateExpression:                    expressions.Update(),
 	}
 	if _, err := h.DynamoDBApi.UpdateItem(ctx, updateIn); err != nil {
+		var conditionFailedError *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailedError) && len(conditionFailedError.Item) > 0 {
+			var current string
+			if currentStatus, ok := conditionFailedError.Item[models.ApplicationStatusField].(*types.AttributeValueMemberS); ok {
+				current = currentStatus.Value
+			}
+			return fmt.Errorf("error updating application %s in table %s: %w",
+				applicationId,
+				tableName,
+				machine.Rejected(current, status))
+		}
 		return fmt.Errorf("error updating application %s in table %s to status: %s: %w",
 			applicationId,
 			h.ApplicationsTable,
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 	"github.com/pennsieve/app-deploy-service/status/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,6 +21,8 @@ import (
 type ArgCaptureDynamoDBApi struct {
 	UpdateItemIn *dynamodb.UpdateItemInput
 	GetItemIn    *dynamodb.GetItemInput
+	// UpdateItemErr is returned from UpdateItem when set
+	UpdateItemErr error
 }
 
 func (a *ArgCaptureDynamoDBApi) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
@@ -26,8 +30,15 @@ func (a *ArgCaptureDynamoDBApi) GetItem(_ context.Context, params *dynamodb.GetI
 	return &dynamodb.GetItemOutput{}, nil
 }
 
+func (a *ArgCaptureDynamoDBApi) DeleteItem(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
 func (a *ArgCaptureDynamoDBApi) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 	a.UpdateItemIn = params
+	if a.UpdateItemErr != nil {
+		return nil, a.UpdateItemErr
+	}
 	return &dynamodb.UpdateItemOutput{}, nil
 }
 
@@ -49,9 +60,13 @@ func TestDeployTaskStateChangeHandler_UpdateApplicationsTable_Expressions(t *tes
 	assert.Equal(t, applicationsTable, aws.ToString(updateItemIn.TableName))
 
 	actualNames := updateItemIn.ExpressionAttributeNames
-	assert.Len(t, actualNames, 2)
+	assert.Len(t, actualNames, 3)
+	assert.Equal(t, models.ApplicationStatusField, actualNames[statemachine.NamePlaceholder])
 	var uuidName, statusName string
 	for k, v := range actualNames {
+		if k == statemachine.NamePlaceholder {
+			continue
+		}
 		if v == models.ApplicationKeyField {
 			uuidName = k
 		} else if v == models.ApplicationStatusField {
@@ -62,12 +77,16 @@ func TestDeployTaskStateChangeHandler_UpdateApplicationsTable_Expressions(t *tes
 	assert.NotEmpty(t, statusName)
 
 	actualCondition := *updateItemIn.ConditionExpression
-	assert.Equal(t, fmt.Sprintf("attribute_exists (%s)", uuidName), actualCondition)
+	assert.Equal(t, fmt.Sprintf("attribute_exists (%s) AND (#registrationStatus IN (:from0, :from1, :from2, :from3))", uuidName), actualCondition)
 
+	// the status, and the four states a deployed application can be reached from
 	actualValues := updateItemIn.ExpressionAttributeValues
-	assert.Len(t, actualValues, 1)
+	assert.Len(t, actualValues, 5)
 	var statusValueName string
 	for k, v := range actualValues {
+		if strings.HasPrefix(k, ":from") {
+			continue
+		}
 		statusValueName = k
 		statusav, typeCorrect := v.(*types.AttributeValueMemberS)
 		if assert.True(t, typeCorrect) {
@@ -79,6 +98,39 @@ func TestDeployTaskStateChangeHandler_UpdateApplicationsTable_Expressions(t *tes
 	assert.Equal(t, fmt.Sprintf("SET %s = %s\n", statusName, statusValueName), actualUpdate)
 }
 
+func TestDeployTaskStateChangeHandler_UpdateApplicationsTable_VersionTable(t *testing.T) {
+	argCaptureDynamo := new(ArgCaptureDynamoDBApi)
+	handler := NewDeployTaskStateChangeHandler(nil, argCaptureDynamo, "applications", "deployments")
+
+	err := handler.UpdateApplicationsTable(context.Background(), uuid.NewString(), &FinalState{}, "appstore-versions")
+	require.NoError(t, err)
+
+	// versions are never re-deployed or rolled back
+	assert.Equal(t, "appstore-versions", aws.ToString(argCaptureDynamo.UpdateItemIn.TableName))
+	assert.Contains(t, aws.ToString(argCaptureDynamo.UpdateItemIn.ConditionExpression), "#registrationStatus IN (:from0, :from1)")
+}
+
+func TestDeployTaskStateChangeHandler_UpdateApplicationsTable_IllegalTransition(t *testing.T) {
+	argCaptureDynamo := &ArgCaptureDynamoDBApi{UpdateItemErr: &types.ConditionalCheckFailedException{
+		Message: aws.String("The conditional request failed"),
+		Item: map[string]types.AttributeValue{
+			models.ApplicationKeyField:    &types.AttributeValueMemberS{Value: "app"},
+			models.ApplicationStatusField: &types.AttributeValueMemberS{Value: "deleting"},
+		},
+	}}
+	handler := NewDeployTaskStateChangeHandler(nil, argCaptureDynamo, "applications", "deployments")
+
+	err := handler.UpdateApplicationsTable(context.Background(), "app", &FinalState{}, "applications")
+	assert.ErrorIs(t, err, statemachine.ErrIllegalTransition)
+	assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, argCaptureDynamo.UpdateItemIn.ReturnValuesOnConditionCheckFailure)
+
+	// an application that no longer exists is still an error
+	argCaptureDynamo.UpdateItemErr = &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	err = handler.UpdateApplicationsTable(context.Background(), "app", &FinalState{}, "applications")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, statemachine.ErrIllegalTransition)
+}
+
 func TestDeploymentUpdateBuilder_PartialUpdate(t *testing.T) {
 	createdAt := time.Now().UTC()
 	event := models.TaskStateChangeEvent{
@@ -210,3 +262,78 @@ func TestDeploymentUpdateBuilder_FullUpdate(t *testing.T) {
 	}
 
 }
+
+func TestDeploymentUpdateBuilder_Cancelled(t *testing.T) {
+	event := models.TaskStateChangeEvent{
+		Detail: models.Detail{
+			LastStatus:    models.StateStopped,
+			DesiredStatus: models.StateStopped,
+			TaskArn:       uuid.NewString(),
+			Version:       4,
+			StopCode:      models.StopCodeUserInitiated,
+			StoppedReason: DeploymentCancelledReason,
+			// kaniko exits non-zero when it is stopped
+			Containers: []models.Container{{ExitCode: 143}},
+		},
+	}
+
+	finalState := IsFinalState(event)
+	require.NotNil(t, finalState)
+	assert.True(t, finalState.Cancelled)
+	assert.False(t, finalState.Errored)
+	assert.Equal(t, "cancelled", finalState.Status())
+
+	update, err := expression.NewBuilder().WithUpdate(DeploymentUpdateBuilder(event)).Build()
+	require.NoError(t, err)
+	values := map[string]types.AttributeValue{}
+	for alias, name := range update.Names() {
+		values[name] = update.Values()[strings.ReplaceAll(alias, "#", ":")]
+	}
+	assert.Equal(t, &types.AttributeValueMemberBOOL{Value: false}, values[models.DeploymentErroredField])
+	assert.Equal(t, &types.AttributeValueMemberBOOL{Value: true}, values[models.DeploymentCancelledField])
+}
+
+func TestIsFinalState_StoppedByOtherUser(t *testing.T) {
+	// a task stopped from the console is still an error
+	event := models.TaskStateChangeEvent{
+		Detail: models.Detail{
+			LastStatus:    models.StateStopped,
+			StopCode:      models.StopCodeUserInitiated,
+			StoppedReason: "Task stopped by user",
+			Containers:    []models.Container{{ExitCode: 143}},
+		},
+	}
+	finalState := IsFinalState(event)
+	require.NotNil(t, finalState)
+	assert.False(t, finalState.Cancelled)
+	assert.Equal(t, "error", finalState.Status())
+}
+
+func TestDeployTaskStateChangeHandler_AppendDeploymentStep(t *testing.T) {
+	argCaptureDynamo := new(ArgCaptureDynamoDBApi)
+	deploymentsTable := uuid.NewString()
+	handler := NewDeployTaskStateChangeHandler(nil, argCaptureDynamo, uuid.NewString(), deploymentsTable)
+
+	applicationId := uuid.NewString()
+	deploymentId := uuid.NewString()
+	final := &FinalState{Errored: true}
+	step := models.StepEvent{Step: models.StepDone, Outcome: final.Outcome(), Time: time.Now().UTC()}
+
+	err := handler.AppendDeploymentStep(context.Background(), applicationId, deploymentId, step)
+	require.NoError(t, err)
+
+	updateItemIn := argCaptureDynamo.UpdateItemIn
+	assert.Equal(t, models.DeploymentKeyItem(applicationId, deploymentId), updateItemIn.Key)
+	assert.Equal(t, deploymentsTable, aws.ToString(updateItemIn.TableName))
+	assert.Contains(t, aws.ToString(updateItemIn.UpdateExpression), "list_append(if_not_exists(")
+
+	var appended []models.StepEvent
+	for _, value := range updateItemIn.ExpressionAttributeValues {
+		if list, ok := value.(*types.AttributeValueMemberL); ok && len(list.Value) > 0 {
+			require.NoError(t, attributevalue.Unmarshal(list, &appended))
+		}
+	}
+	require.Len(t, appended, 1)
+	assert.Equal(t, models.StepDone, appended[0].Step)
+	assert.Equal(t, models.StepFailed, appended[0].Outcome)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"github.com/pennsieve/app-deploy-service/status/events"
+	"github.com/pennsieve/app-deploy-service/status/models"
 	"log"
 	"log/slog"
 	"time"
@@ -30,3 +31,25 @@ func (h *DeployTaskStateChangeHandler) SendApplicationStatusEvent(applicationId,
 			slog.Any("error", err))
 	}
 }
+
+func (h *DeployTaskStateChangeHandler) SendDeploymentStepEvent(applicationId, deploymentId string, step models.StepEvent) {
+	if h.PusherClient == nil {
+		log.Printf("warning: no Pusher client configured")
+		return
+	}
+	channel := events.ApplicationStatusChannel(applicationId)
+	event := events.DeploymentStepEvent{
+		ApplicationId: applicationId,
+		DeploymentId:  deploymentId,
+		Step:          step.Step,
+		Outcome:       step.Outcome,
+		Time:          step.Time,
+		Source:        "DeployTaskStateChangeHandler",
+	}
+	if err := h.PusherClient.Trigger(channel, events.DeploymentStepEventName, event); err != nil {
+		h.logger.Warn("error updating pusher application channel",
+			slog.String("channel", channel),
+			slog.String("step", step.Step),
+			slog.Any("error", err))
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/pennsieve/app-deploy-service/statemachine"
 	"github.com/pennsieve/app-deploy-service/status/external"
 	"github.com/pennsieve/app-deploy-service/status/logging"
 	"github.com/pennsieve/app-deploy-service/status/models"
 	"github.com/pusher/pusher-http-go/v5"
 	"log/slog"
+	"time"
 )
 
 type DeployTaskStateChangeHandler struct {
@@ -17,7 +19,11 @@ type DeployTaskStateChangeHandler struct {
 	PusherClient      *pusher.Client
 	ApplicationsTable string
 	DeploymentsTable  string
-	logger            *slog.Logger
+	// DeploymentLeasesTable, DeploymentJobsTable and ProvisionerTaskFamily are set WithDeploymentLeases
+	DeploymentLeasesTable string
+	DeploymentJobsTable   string
+	ProvisionerTaskFamily string
+	logger                *slog.Logger
 }
 
 func NewDeployTaskStateChangeHandler(ecsApi external.ECSApi, dynamoDBApi external.DynamoDBApi, applicationsTable string, deploymentsTable string) *DeployTaskStateChangeHandler {
@@ -34,6 +40,10 @@ func (h *DeployTaskStateChangeHandler) Handle(ctx context.Context, event models.
 	h.logger = h.logger.With(slog.String("taskArn", taskArn))
 	h.logger.Info("handling event", slog.Any("event", event))
 
+	if h.IsProvisionerTask(event.Detail) {
+		return h.HandleProvisionerTask(ctx, event)
+	}
+
 	ids, err := h.GetIdsFromTags(ctx, taskArn, event.Detail.ClusterArn)
 	if err != nil {
 		return fmt.Errorf("error getting ids from task tags: %w", err)
@@ -68,8 +78,25 @@ func (h *DeployTaskStateChangeHandler) Handle(ctx context.Context, event models.
 	}
 
 	if final := IsFinalState(event); final != nil {
+		if !final.Cancelled && IsTransientFailure(event.Detail) {
+			// the provisioner waiting on this task exits for a retry, and the deployment is retried or failed
+			// when it stops
+			h.logger.Info("deployer task failed transiently", slog.String("stoppedReason", event.Detail.StoppedReason))
+			return nil
+		}
+		step := models.StepEvent{Step: models.StepDone, Outcome: final.Outcome(), Time: stepTime(event.Detail)}
+		if err := h.AppendDeploymentStep(ctx, applicationId, deploymentId, step); err != nil {
+			h.logger.Warn("error appending step to deployment timeline", slog.Any("error", err))
+		}
+		h.SendDeploymentStepEvent(applicationId, deploymentId, step)
 		h.SendApplicationStatusEvent(applicationId, deploymentId, final, event.Detail.UpdatedAt)
-		if err := h.UpdateApplicationsTable(ctx, applicationId, final, applicationsTable); err != nil {
+		err := h.UpdateApplicationsTable(ctx, applicationId, final, applicationsTable)
+		if errors.Is(err, statemachine.ErrIllegalTransition) {
+			// retrying cannot make the transition legal, so the event is dropped
+			h.logger.Warn("rejected illegal status transition", slog.Any("error", err))
+			return nil
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -79,18 +106,54 @@ func (h *DeployTaskStateChangeHandler) Handle(ctx context.Context, event models.
 
 type FinalState struct {
 	Errored bool
+	// Cancelled is set when the task was stopped because a user cancelled the deployment. A cancelled task
+	// usually exits non-zero, but is not an error.
+	Cancelled bool
 }
 
 func (f *FinalState) Status() string {
+	if f.Cancelled {
+		return "cancelled"
+	}
 	if f.Errored {
 		return "error"
 	}
 	return "deployed"
 }
 
+// Outcome is the outcome of the deployment's done step
+func (f *FinalState) Outcome() string {
+	if f.Cancelled {
+		return models.StepCancelled
+	}
+	if f.Errored {
+		return models.StepFailed
+	}
+	return models.StepSucceeded
+}
+
+// stepTime is when the task stopped, falling back to when the event was sent
+func stepTime(detail models.Detail) time.Time {
+	if detail.StoppedAt != nil {
+		return detail.StoppedAt.UTC()
+	}
+	if detail.UpdatedAt != nil {
+		return detail.UpdatedAt.UTC()
+	}
+	return time.Now().UTC()
+}
+
 func IsFinalState(event models.TaskStateChangeEvent) *FinalState {
 	if event.Detail.LastStatus != models.StateStopped {
 		return nil
 	}
+	if IsCancelled(event.Detail) {
+		return &FinalState{Cancelled: true}
+	}
 	return &FinalState{Errored: event.Detail.Errored()}
 }
+
+// IsCancelled reports whether the task was stopped by the service's deployment cancellation.
+func IsCancelled(detail models.Detail) bool {
+	return detail.StopCode == models.StopCodeUserInitiated && detail.StoppedReason == DeploymentCancelledReason
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+	"github.com/pennsieve/app-deploy-service/status/dydbutils"
+	"github.com/pennsieve/app-deploy-service/status/models"
+	"log/slog"
+	"time"
+)
+
+// leaseUpdateAttempts is how many times a lease update is retried when the lease changes between reading and
+// writing it
+const leaseUpdateAttempts = 3
+
+// WithDeploymentLeases has the handler follow provisioner tasks of the given family, releasing the application's
+// deployment lease when the one holding it stops. The job of the deployment handed the lease is released from
+// jobsTable.
+func (h *DeployTaskStateChangeHandler) WithDeploymentLeases(leasesTable string, jobsTable string, provisionerTaskFamily string) *DeployTaskStateChangeHandler {
+	h.DeploymentLeasesTable = leasesTable
+	h.DeploymentJobsTable = jobsTable
+	h.ProvisionerTaskFamily = provisionerTaskFamily
+	return h
+}
+
+// IsProvisionerTask reports whether the event is for a provisioner task rather than a deployer task
+func (h *DeployTaskStateChangeHandler) IsProvisionerTask(detail models.Detail) bool {
+	return len(h.ProvisionerTaskFamily) > 0 && detail.Group == "family:"+h.ProvisionerTaskFamily
+}
+
+// HandleProvisionerTask retries a deployment whose provisioner task failed transiently, and otherwise releases the
+// deployment lease once a provisioner task stops. The provisioner is the last task of every deployment, so nothing
+// of it is left running by then.
+func (h *DeployTaskStateChangeHandler) HandleProvisionerTask(ctx context.Context, event models.TaskStateChangeEvent) error {
+	if event.Detail.LastStatus != models.StateStopped {
+		return nil
+	}
+	ids, err := h.GetIdsFromTags(ctx, event.Detail.TaskArn, event.Detail.ClusterArn)
+	if err != nil {
+		// only deployments tag their provisioner task
+		h.logger.Info("provisioner task is not a deployment", slog.Any("reason", err))
+		return nil
+	}
+	h.logger = h.logger.With(slog.String("deploymentId", ids.DeploymentId), slog.String("applicationId", ids.ApplicationId))
+
+	if IsTransientFailure(event.Detail) {
+		running, err := h.RetryDeployment(ctx, ids, event.Detail)
+		if err != nil || running {
+			return err
+		}
+	}
+	if len(h.DeploymentLeasesTable) == 0 {
+		return nil
+	}
+	return h.ReleaseDeploymentLease(ctx, ids.ApplicationId, ids.DeploymentId)
+}
+
+// ReleaseDeploymentLease gives up the lease held by deploymentId and starts the queued deployment it is handed to.
+// If that deployment cannot start, the lease is passed on again. Nothing happens if deploymentId does not hold the
+// lease.
+func (h *DeployTaskStateChangeHandler) ReleaseDeploymentLease(ctx context.Context, applicationId string, deploymentId string) error {
+	for {
+		next, err := h.releaseLease(ctx, applicationId, deploymentId)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		if h.startQueuedDeployment(ctx, applicationId, *next) {
+			return nil
+		}
+		deploymentId = next.DeploymentId
+	}
+}
+
+// releaseLease deletes the lease if nothing is queued behind it, otherwise hands it to the first queued deployment
+// and returns that deployment.
+func (h *DeployTaskStateChangeHandler) releaseLease(ctx context.Context, applicationId string, deploymentId string) (*models.QueuedDeployment, error) {
+	queue := expression.Name(models.LeaseQueueField)
+	holder := expression.Name(models.LeaseDeploymentIdField)
+	for attempt := 0; attempt < leaseUpdateAttempts; attempt++ {
+		deleteExpressions, err := expression.NewBuilder().
+			WithCondition(holder.Equal(expression.Value(deploymentId)).
+				And(expression.AttributeNotExists(queue).Or(queue.Size().Equal(expression.Value(0))))).
+			Build()
+		if err != nil {
+			return nil, fmt.Errorf("error building lease release expression for application %s: %w", applicationId, err)
+		}
+		_, err = h.DynamoDBApi.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			Key:                                 models.LeaseKey(applicationId),
+			TableName:                           aws.String(h.DeploymentLeasesTable),
+			ConditionExpression:                 deleteExpressions.Condition(),
+			ExpressionAttributeNames:            deleteExpressions.Names(),
+			ExpressionAttributeValues:           deleteExpressions.Values(),
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		})
+		if err == nil {
+			h.logger.Info("released deployment lease")
+			return nil, nil
+		}
+		var conditionFailedError *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionFailedError) {
+			return nil, fmt.Errorf("error releasing deployment lease of application %s: %w", applicationId, err)
+		}
+		lease, err := dydbutils.FromItem[models.DeploymentLease](conditionFailedError.Item)
+		if err != nil {
+			return nil, err
+		}
+		if lease == nil || lease.DeploymentId != deploymentId || len(lease.Queue) == 0 {
+			// another deployment holds the lease, or it has gone
+			return nil, nil
+		}
+
+		next := lease.Queue[0]
+		now := time.Now()
+		updateExpressions, err := expression.NewBuilder().
+			WithCondition(holder.Equal(expression.Value(deploymentId)).
+				And(expression.Name(models.LeaseQueueField + "[0]." + models.LeaseDeploymentIdField).Equal(expression.Value(next.DeploymentId)))).
+			WithUpdate(expression.Set(holder, expression.Value(next.DeploymentId)).
+				Set(expression.Name(models.LeaseAcquiredAtField), expression.Value(now.UTC())).
+				Set(expression.Name(models.LeaseExpiresAtField), expression.Value(now.Add(models.DeploymentLeaseDuration).Unix())).
+				Remove(expression.Name(models.LeaseQueueField + "[0]"))).
+			Build()
+		if err != nil {
+			return nil, fmt.Errorf("error building lease hand over expression for application %s: %w", applicationId, err)
+		}
+		_, err = h.DynamoDBApi.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			Key:                       models.LeaseKey(applicationId),
+			TableName:                 aws.String(h.DeploymentLeasesTable),
+			ConditionExpression:       updateExpressions.Condition(),
+			ExpressionAttributeNames:  updateExpressions.Names(),
+			ExpressionAttributeValues: updateExpressions.Values(),
+			UpdateExpression:          updateExpressions.Update(),
+		})
+		if err == nil {
+			h.logger.Info("handed deployment lease to queued deployment", slog.String("nextDeploymentId", next.DeploymentId))
+			return &next, nil
+		}
+		if !errors.As(err, &conditionFailedError) {
+			return nil, fmt.Errorf("error handing over deployment lease of application %s: %w", applicationId, err)
+		}
+		// the queue changed, so look again
+	}
+	return nil, fmt.Errorf("deployment lease of application %s kept changing while being released", applicationId)
+}
+
+// startQueuedDeployment releases the provisioner job of a deployment that has been handed the lease, for the
+// service's dispatcher to run. It returns false if the deployment will not run.
+func (h *DeployTaskStateChangeHandler) startQueuedDeployment(ctx context.Context, applicationId string, queued models.QueuedDeployment) bool {
+	logger := h.logger.With(slog.String("nextDeploymentId", queued.DeploymentId))
+	if dispatched, err := h.DispatchDeployment(ctx, applicationId, queued.DeploymentId); err != nil || !dispatched {
+		if err != nil {
+			logger.Error("error dispatching queued deployment", slog.Any("error", err))
+		} else {
+			logger.Info("queued deployment was cancelled")
+		}
+		return false
+	}
+
+	released, err := h.ReleaseDeploymentJob(ctx, queued.DeploymentId)
+	if err == nil && !released {
+		err = fmt.Errorf("no waiting job for deployment %s", queued.DeploymentId)
+	}
+	if err != nil {
+		logger.Error("error releasing job of queued deployment", slog.Any("error", err))
+		h.failQueuedDeployment(ctx, applicationId, queued.DeploymentId, err)
+		return false
+	}
+
+	if err := h.updateApplicationStatus(ctx, applicationId, string(statemachine.Pending), h.ApplicationsTable); err != nil {
+		logger.Warn("error updating application status", slog.Any("error", err))
+	}
+	h.appendStep(ctx, applicationId, queued.DeploymentId, models.StepEvent{Step: models.StepProvisioning, Time: time.Now().UTC()})
+	logger.Info("released job of queued deployment")
+	return true
+}
+
+// ReleaseDeploymentJob makes the waiting job of a deployment pending. It returns false if the job is not waiting.
+func (h *DeployTaskStateChangeHandler) ReleaseDeploymentJob(ctx context.Context, deploymentId string) (bool, error) {
+	status := expression.Name(models.DeploymentJobStatusField)
+	expressions, err := expression.NewBuilder().
+		WithCondition(status.Equal(expression.Value(models.JobStatusWaiting))).
+		WithUpdate(expression.Set(status, expression.Value(models.JobStatusPending)).
+			Set(expression.Name(models.DeploymentJobNextAttemptAtField), expression.Value(time.Now().UTC()))).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("error building release expression for job %s: %w", deploymentId, err)
+	}
+	_, err = h.DynamoDBApi.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       models.DeploymentJobKey(deploymentId),
+		TableName:                 aws.String(h.DeploymentJobsTable),
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	var conditionFailedError *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailedError) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error releasing job %s: %w", deploymentId, err)
+	}
+	return true, nil
+}
+
+// DispatchDeployment moves a queued deployment to NOT_STARTED. It returns false if the deployment is no longer
+// queued, because it was cancelled while it waited.
+func (h *DeployTaskStateChangeHandler) DispatchDeployment(ctx context.Context, applicationId string, deploymentId string) (bool, error) {
+	lastStatus := expression.Name(models.DeploymentLastStatusField)
+	cancelled := expression.Name(models.DeploymentCancelledField)
+	expressions, err := expression.NewBuilder().
+		WithCondition(lastStatus.Equal(expression.Value(models.DeploymentStatusQueued)).
+			And(expression.AttributeNotExists(cancelled).Or(cancelled.Equal(expression.Value(false))))).
+		WithUpdate(expression.Set(lastStatus, expression.Value(models.DeploymentStatusNotStarted))).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("error building dispatch expression for deployment %s: %w", deploymentId, err)
+	}
+	_, err = h.DynamoDBApi.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       models.DeploymentKeyItem(applicationId, deploymentId),
+		TableName:                 aws.String(h.DeploymentsTable),
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	var conditionFailedError *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailedError) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error dispatching deployment %s: %w", deploymentId, err)
+	}
+	return true, nil
+}
+
+// failQueuedDeployment records that a dispatched deployment could not be started
+func (h *DeployTaskStateChangeHandler) failQueuedDeployment(ctx context.Context, applicationId string, deploymentId string, cause error) {
+	h.failDeployment(ctx, applicationId, deploymentId, h.ApplicationsTable, cause)
+}
+
+// failDeployment marks a deployment errored, and its application, in applicationsTable, errored with cause
+func (h *DeployTaskStateChangeHandler) failDeployment(ctx context.Context, applicationId string, deploymentId string, applicationsTable string, cause error) {
+	if err := h.setDeploymentAttribute(ctx, applicationId, deploymentId, models.DeploymentErroredField, true); err != nil {
+		h.logger.Warn("error setting errored on deployment", slog.String("failedDeploymentId", deploymentId), slog.Any("error", err))
+	}
+	h.appendStep(ctx, applicationId, deploymentId, models.StepEvent{Step: models.StepDone, Outcome: models.StepFailed, Time: time.Now().UTC()})
+	status := statemachine.ErrorStatus(cause.Error())
+	if err := h.updateApplicationStatus(ctx, applicationId, status, applicationsTable); err != nil {
+		h.logger.Warn("error updating application status", slog.Any("error", err))
+	}
+}
+
+func (h *DeployTaskStateChangeHandler) appendStep(ctx context.Context, applicationId string, deploymentId string, step models.StepEvent) {
+	if err := h.AppendDeploymentStep(ctx, applicationId, deploymentId, step); err != nil {
+		h.logger.Warn("error appending step to deployment timeline", slog.String("stepDeploymentId", deploymentId), slog.Any("error", err))
+	}
+	h.SendDeploymentStepEvent(applicationId, deploymentId, step)
+}
+
+func (h *DeployTaskStateChangeHandler) setDeploymentAttribute(ctx context.Context, applicationId string, deploymentId string, name string, value any) error {
+	expressions, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name(name), expression.Value(value))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building %s update expression for deployment %s: %w", name, deploymentId, err)
+	}
+	_, err = h.DynamoDBApi.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       models.DeploymentKeyItem(applicationId, deploymentId),
+		TableName:                 aws.String(h.DeploymentsTable),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating %s of deployment %s: %w", name, deploymentId, err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/pennsieve/app-deploy-service/status/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// leaseDynamoDBApi fails the lease release with the given lease, as if it had a queue, and records every update
+type leaseDynamoDBApi struct {
+	Lease        *models.DeploymentLease
+	DeleteItemIn *dynamodb.DeleteItemInput
+	UpdateItemIn []*dynamodb.UpdateItemInput
+	// DispatchErr is returned from the update dispatching a queued deployment
+	DispatchErr error
+	// JobErr is returned from the update releasing a queued deployment's job
+	JobErr error
+	// Job and Deployment are returned from GetItem on the jobs and deployments tables
+	Job        *models.DeploymentJob
+	Deployment *models.Deployment
+}
+
+func (a *leaseDynamoDBApi) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	var item map[string]types.AttributeValue
+	var err error
+	if aws.ToString(params.TableName) == "jobs" && a.Job != nil {
+		item, err = attributevalue.MarshalMap(a.Job)
+	} else if aws.ToString(params.TableName) == "deployments" && a.Deployment != nil {
+		item, err = attributevalue.MarshalMap(a.Deployment)
+	}
+	return &dynamodb.GetItemOutput{Item: item}, err
+}
+
+func (a *leaseDynamoDBApi) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	a.DeleteItemIn = params
+	if a.Lease == nil {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	item, err := attributevalue.MarshalMap(a.Lease)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &types.ConditionalCheckFailedException{Item: item}
+}
+
+func (a *leaseDynamoDBApi) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	a.UpdateItemIn = append(a.UpdateItemIn, params)
+	if aws.ToString(params.TableName) == "deployments" && a.DispatchErr != nil && len(a.UpdateItemIn) == 2 {
+		return nil, a.DispatchErr
+	}
+	if aws.ToString(params.TableName) == "jobs" && a.JobErr != nil {
+		return nil, a.JobErr
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (a *leaseDynamoDBApi) tables() []string {
+	var tables []string
+	for _, in := range a.UpdateItemIn {
+		tables = append(tables, aws.ToString(in.TableName))
+	}
+	return tables
+}
+
+type leaseECSApi struct{}
+
+func (a *leaseECSApi) DescribeTasks(_ context.Context, _ *ecs.DescribeTasksInput, _ ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	return &ecs.DescribeTasksOutput{}, nil
+}
+
+func newLeaseTestHandler(dynamoDBApi *leaseDynamoDBApi) *DeployTaskStateChangeHandler {
+	return NewDeployTaskStateChangeHandler(&leaseECSApi{}, dynamoDBApi, "applications", "deployments").
+		WithDeploymentLeases("leases", "jobs", "provisioner")
+}
+
+func TestDeployTaskStateChangeHandler_ReleaseDeploymentLease_NothingQueued(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{}
+	h := newLeaseTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.ReleaseDeploymentLease(context.Background(), "app-1", "deploy-1"))
+
+	require.NotNil(t, dynamoDBApi.DeleteItemIn)
+	assert.Equal(t, "leases", aws.ToString(dynamoDBApi.DeleteItemIn.TableName))
+	assert.Equal(t, models.LeaseKey("app-1"), dynamoDBApi.DeleteItemIn.Key)
+	assert.Contains(t, dynamoDBApi.DeleteItemIn.ExpressionAttributeValues, ":0")
+	assert.Empty(t, dynamoDBApi.UpdateItemIn)
+}
+
+func TestDeployTaskStateChangeHandler_ReleaseDeploymentLease_NotHolder(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{Lease: &models.DeploymentLease{
+		ApplicationId: "app-1",
+		DeploymentId:  "deploy-2",
+		Queue:         []models.QueuedDeployment{{DeploymentId: "deploy-3"}},
+	}}
+	h := newLeaseTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.ReleaseDeploymentLease(context.Background(), "app-1", "deploy-1"))
+
+	assert.Empty(t, dynamoDBApi.UpdateItemIn)
+}
+
+func TestDeployTaskStateChangeHandler_ReleaseDeploymentLease_HandsOver(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{Lease: &models.DeploymentLease{
+		ApplicationId: "app-1",
+		DeploymentId:  "deploy-1",
+		Queue:         []models.QueuedDeployment{{DeploymentId: "deploy-2"}},
+	}}
+	h := newLeaseTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.ReleaseDeploymentLease(context.Background(), "app-1", "deploy-1"))
+
+	// hand over, dispatch, job release, application status, provisioning step
+	assert.Equal(t, []string{"leases", "deployments", "jobs", "applications", "deployments"}, dynamoDBApi.tables())
+	handOver := dynamoDBApi.UpdateItemIn[0]
+	assert.Contains(t, aws.ToString(handOver.UpdateExpression), "REMOVE")
+	assert.Contains(t, handOver.ExpressionAttributeValues, ":0")
+	dispatch := dynamoDBApi.UpdateItemIn[1]
+	assert.Equal(t, models.DeploymentKeyItem("app-1", "deploy-2"), dispatch.Key)
+	release := dynamoDBApi.UpdateItemIn[2]
+	assert.Equal(t, models.DeploymentJobKey("deploy-2"), release.Key)
+	assert.Contains(t, release.ExpressionAttributeValues, ":0")
+	assert.Equal(t, &types.AttributeValueMemberS{Value: models.JobStatusWaiting}, release.ExpressionAttributeValues[":0"])
+}
+
+func TestDeployTaskStateChangeHandler_ReleaseDeploymentLease_JobNotWaiting(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{
+		Lease: &models.DeploymentLease{
+			ApplicationId: "app-1",
+			DeploymentId:  "deploy-1",
+			Queue:         []models.QueuedDeployment{{DeploymentId: "deploy-2"}},
+		},
+		JobErr: &types.ConditionalCheckFailedException{},
+	}
+	h := newLeaseTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.ReleaseDeploymentLease(context.Background(), "app-1", "deploy-1"))
+
+	// the deployment is failed: errored, done step, application status
+	assert.Equal(t, []string{"leases", "deployments", "jobs", "deployments", "deployments", "applications"}, dynamoDBApi.tables())
+}
+
+func TestDeployTaskStateChangeHandler_ReleaseDeploymentLease_QueuedDeploymentCancelled(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{
+		Lease: &models.DeploymentLease{
+			ApplicationId: "app-1",
+			DeploymentId:  "deploy-1",
+			Queue:         []models.QueuedDeployment{{DeploymentId: "deploy-2"}},
+		},
+		DispatchErr: &types.ConditionalCheckFailedException{},
+	}
+	h := newLeaseTestHandler(dynamoDBApi)
+
+	// the fake keeps returning the same lease, which deploy-2 does not hold, so the lease is left with it
+	require.NoError(t, h.ReleaseDeploymentLease(context.Background(), "app-1", "deploy-1"))
+
+	assert.Equal(t, []string{"leases", "deployments"}, dynamoDBApi.tables())
+}
+
+func TestDeployTaskStateChangeHandler_IsProvisionerTask(t *testing.T) {
+	h := newLeaseTestHandler(&leaseDynamoDBApi{})
+
+	assert.True(t, h.IsProvisionerTask(models.Detail{Group: "family:provisioner"}))
+	assert.False(t, h.IsProvisionerTask(models.Detail{Group: "family:deployer"}))
+	assert.False(t, NewDeployTaskStateChangeHandler(nil, nil, "", "").IsProvisionerTask(models.Detail{Group: "family:"}))
+}
+
+func TestDeployTaskStateChangeHandler_HandleProvisionerTask_Running(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{}
+	h := newLeaseTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.Handle(context.Background(), models.TaskStateChangeEvent{
+		Detail: models.Detail{Group: "family:provisioner", LastStatus: "RUNNING"},
+	}))
+	assert.Nil(t, dynamoDBApi.DeleteItemIn)
+	assert.Empty(t, dynamoDBApi.UpdateItemIn)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+	"github.com/pennsieve/app-deploy-service/status/dydbutils"
+	"github.com/pennsieve/app-deploy-service/status/models"
+	"log/slog"
+	"time"
+)
+
+// IsTransientFailure reports whether a stopped provisioner task failed transiently: either the provisioner exited
+// with statemachine.RetryExitCode, or ECS stopped the task for a reason running it again may not hit.
+func IsTransientFailure(detail models.Detail) bool {
+	if IsCancelled(detail) {
+		return false
+	}
+	for _, c := range detail.Containers {
+		if c.ExitCode == statemachine.RetryExitCode {
+			return true
+		}
+	}
+	return statemachine.TransientStop(detail.StopCode, detail.StoppedReason)
+}
+
+// RetryDeployment requeues the job of a deployment whose provisioner task failed transiently, for the dispatcher to
+// run it again once the delay of its action's retry policy has passed. A deployment that is not retried, because
+// its action is not or it is out of attempts, is failed. It reports whether the deployment is still running, so
+// keeps its lease.
+func (h *DeployTaskStateChangeHandler) RetryDeployment(ctx context.Context, ids DeploymentApplicationIds, detail models.Detail) (bool, error) {
+	attempt := 1
+	if len(h.DeploymentJobsTable) > 0 {
+		job, err := h.GetDeploymentJob(ctx, ids.DeploymentId)
+		if err != nil {
+			return false, err
+		}
+		if job != nil {
+			attempt = max(job.Attempt, 1)
+			if policy, ok := statemachine.Policy(job.Action); ok && policy.Retries(attempt) {
+				return h.retryJob(ctx, ids, *job, detail, attempt+1, time.Now().Add(policy.Delay(attempt)))
+			}
+		}
+	}
+
+	h.logger.Warn("deployment failed transiently and is not retried", slog.Int("attempt", attempt))
+	cause := fmt.Errorf("deployment failed after %d attempt(s): %s", attempt, h.lastError(ctx, ids, detail))
+	h.failDeployment(ctx, ids.ApplicationId, ids.DeploymentId, h.applicationsTable(ids), cause)
+	return false, nil
+}
+
+func (h *DeployTaskStateChangeHandler) retryJob(ctx context.Context, ids DeploymentApplicationIds, job models.DeploymentJob, detail models.Detail, attempt int, at time.Time) (bool, error) {
+	logger := h.logger.With(slog.Int("attempt", attempt), slog.Time("nextAttemptAt", at))
+	requeued, err := h.RequeueDeploymentJob(ctx, job.JobId, detail.TaskArn, attempt, at, detail.StoppedReason)
+	if err != nil {
+		return false, err
+	}
+	if !requeued {
+		// the job has moved on since this task was run, so this event has been handled already
+		logger.Info("job of deployment is no longer dispatched to this task")
+		return true, nil
+	}
+	logger.Info("requeued job of deployment that failed transiently")
+
+	if err := h.ResetDeploymentForRetry(ctx, ids.ApplicationId, ids.DeploymentId, attempt); err != nil {
+		logger.Warn("error resetting deployment for its next attempt", slog.Any("error", err))
+	}
+	now := time.Now().UTC()
+	h.appendStep(ctx, ids.ApplicationId, ids.DeploymentId, models.StepEvent{Step: models.StepRetry, Time: now})
+	h.appendStep(ctx, ids.ApplicationId, ids.DeploymentId, models.StepEvent{Step: models.StepProvisioning, Time: now})
+	return true, nil
+}
+
+// GetDeploymentJob returns the job of a deployment, or nil if it has none
+func (h *DeployTaskStateChangeHandler) GetDeploymentJob(ctx context.Context, deploymentId string) (*models.DeploymentJob, error) {
+	out, err := h.DynamoDBApi.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            models.DeploymentJobKey(deploymentId),
+		TableName:      aws.String(h.DeploymentJobsTable),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting job %s: %w", deploymentId, err)
+	}
+	return dydbutils.FromItem[models.DeploymentJob](out.Item)
+}
+
+// RequeueDeploymentJob makes the job dispatched to taskArn pending again, for attempt, to be run no earlier than
+// at. It returns false if the job is no longer dispatched to taskArn.
+func (h *DeployTaskStateChangeHandler) RequeueDeploymentJob(ctx context.Context, jobId string, taskArn string, attempt int, at time.Time, reason string) (bool, error) {
+	status := expression.Name(models.DeploymentJobStatusField)
+	update := expression.Set(status, expression.Value(models.JobStatusPending)).
+		Set(expression.Name(models.DeploymentJobAttemptField), expression.Value(attempt)).
+		Set(expression.Name(models.DeploymentJobAttemptsField), expression.Value(0)).
+		Set(expression.Name(models.DeploymentJobNextAttemptAtField), expression.Value(at.UTC())).
+		// a pending job must not expire
+		Remove(expression.Name(models.DeploymentJobExpiresAtField))
+	if len(reason) > 0 {
+		update = update.Set(expression.Name(models.DeploymentJobLastErrorField), expression.Value(reason))
+	}
+	expressions, err := expression.NewBuilder().
+		WithCondition(status.Equal(expression.Value(models.JobStatusDispatched)).
+			And(expression.Name(models.DeploymentJobTaskArnField).Equal(expression.Value(taskArn)))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("error building requeue expression for job %s: %w", jobId, err)
+	}
+	_, err = h.DynamoDBApi.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       models.DeploymentJobKey(jobId),
+		TableName:                 aws.String(h.DeploymentJobsTable),
+		ConditionExpression:       expressions.Condition(),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	var conditionFailedError *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailedError) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error requeueing job %s: %w", jobId, err)
+	}
+	return true, nil
+}
+
+// ResetDeploymentForRetry records the attempt a deployment is on and clears what its last deployer task reported,
+// so that the next deployer task's events are not ignored as older than it.
+func (h *DeployTaskStateChangeHandler) ResetDeploymentForRetry(ctx context.Context, applicationId string, deploymentId string, attempt int) error {
+	expressions, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name(models.DeploymentAttemptField), expression.Value(attempt)).
+			Set(expression.Name(models.DeploymentLastStatusField), expression.Value(models.DeploymentStatusNotStarted)).
+			Remove(expression.Name(models.DeploymentVersionField)).
+			Remove(expression.Name(models.DeploymentErroredField)).
+			Remove(expression.Name(models.DeploymentStopCodeField)).
+			Remove(expression.Name(models.DeploymentStoppedReasonField)).
+			Remove(expression.Name(models.DeploymentStoppedAtField))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building retry expression for deployment %s: %w", deploymentId, err)
+	}
+	_, err = h.DynamoDBApi.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       models.DeploymentKeyItem(applicationId, deploymentId),
+		TableName:                 aws.String(h.DeploymentsTable),
+		ExpressionAttributeNames:  expressions.Names(),
+		ExpressionAttributeValues: expressions.Values(),
+		UpdateExpression:          expressions.Update(),
+	})
+	if err != nil {
+		return fmt.Errorf("error resetting deployment %s for retry: %w", deploymentId, err)
+	}
+	return nil
+}
+
+// lastError is the transient error the provisioner recorded on the deployment, or why ECS stopped its task
+func (h *DeployTaskStateChangeHandler) lastError(ctx context.Context, ids DeploymentApplicationIds, detail models.Detail) string {
+	out, err := h.DynamoDBApi.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:       models.DeploymentKeyItem(ids.ApplicationId, ids.DeploymentId),
+		TableName: aws.String(h.DeploymentsTable),
+	})
+	if err != nil {
+		h.logger.Warn("error getting deployment", slog.Any("error", err))
+	} else if deployment, err := dydbutils.FromItem[models.Deployment](out.Item); err == nil && deployment != nil && len(deployment.LastError) > 0 {
+		return deployment.LastError
+	}
+	return detail.StoppedReason
+}
+
+// applicationsTable is the table of the application, or App Store version, a deployment is for
+func (h *DeployTaskStateChangeHandler) applicationsTable(ids DeploymentApplicationIds) string {
+	if len(ids.ApplicationsTable) > 0 {
+		return ids.ApplicationsTable
+	}
+	return h.ApplicationsTable
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/pennsieve/app-deploy-service/statemachine"
+	"github.com/pennsieve/app-deploy-service/status/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// taggedECSApi describes every task as tagged with deploy-1 of app-1
+type taggedECSApi struct{}
+
+func (a *taggedECSApi) DescribeTasks(_ context.Context, params *ecs.DescribeTasksInput, _ ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	return &ecs.DescribeTasksOutput{Tasks: []ecsTypes.Task{{
+		TaskArn: aws.String(params.Tasks[0]),
+		Tags: []ecsTypes.Tag{
+			{Key: aws.String(DeploymentIdTag), Value: aws.String("deploy-1")},
+			{Key: aws.String(ApplicationIdTag), Value: aws.String("app-1")},
+		},
+	}}}, nil
+}
+
+func newRetryTestHandler(dynamoDBApi *leaseDynamoDBApi) *DeployTaskStateChangeHandler {
+	return NewDeployTaskStateChangeHandler(&taggedECSApi{}, dynamoDBApi, "applications", "deployments").
+		WithDeploymentLeases("leases", "jobs", "provisioner")
+}
+
+func provisionerStopped(exitCode int) models.TaskStateChangeEvent {
+	return models.TaskStateChangeEvent{Detail: models.Detail{
+		Group:         "family:provisioner",
+		TaskArn:       "task-1",
+		LastStatus:    models.StateStopped,
+		StopCode:      "EssentialContainerExited",
+		StoppedReason: "Essential container in task exited",
+		Containers:    []models.Container{{ExitCode: exitCode}},
+	}}
+}
+
+func TestIsTransientFailure(t *testing.T) {
+	assert.True(t, IsTransientFailure(provisionerStopped(statemachine.RetryExitCode).Detail))
+	assert.True(t, IsTransientFailure(models.Detail{StopCode: "TaskFailedToStart", StoppedReason: "CannotPullContainerError: timeout"}))
+	assert.False(t, IsTransientFailure(provisionerStopped(1).Detail))
+	assert.False(t, IsTransientFailure(models.Detail{
+		StopCode:      models.StopCodeUserInitiated,
+		StoppedReason: DeploymentCancelledReason,
+		Containers:    []models.Container{{ExitCode: statemachine.RetryExitCode}},
+	}))
+}
+
+func TestDeployTaskStateChangeHandler_HandleProvisionerTask_Retries(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{Job: &models.DeploymentJob{
+		JobId:   "deploy-1",
+		Status:  models.JobStatusDispatched,
+		Action:  "DEPLOY",
+		TaskArn: "task-1",
+	}}
+	h := newRetryTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.Handle(context.Background(), provisionerStopped(statemachine.RetryExitCode)))
+
+	// the deployment keeps its lease while it is retried
+	assert.Nil(t, dynamoDBApi.DeleteItemIn)
+	// requeue, deployment reset, retry and provisioning steps
+	assert.Equal(t, []string{"jobs", "deployments", "deployments", "deployments"}, dynamoDBApi.tables())
+	requeue := dynamoDBApi.UpdateItemIn[0]
+	assert.Equal(t, models.DeploymentJobKey("deploy-1"), requeue.Key)
+	assert.Contains(t, aws.ToString(requeue.UpdateExpression), "REMOVE")
+	assert.Contains(t, requeue.ExpressionAttributeValues, ":0")
+	assert.Contains(t, requeue.ExpressionAttributeValues, ":1")
+	values := requeue.ExpressionAttributeValues
+	assert.Contains(t, []types.AttributeValue{values[":0"], values[":1"]}, &types.AttributeValueMemberS{Value: models.JobStatusDispatched})
+	assert.Contains(t, values, ":2")
+
+	reset := dynamoDBApi.UpdateItemIn[1]
+	assert.Equal(t, models.DeploymentKeyItem("app-1", "deploy-1"), reset.Key)
+	assert.Contains(t, reset.ExpressionAttributeNames, "#0")
+	assert.Contains(t, reset.ExpressionAttributeValues, ":0")
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "2"}, reset.ExpressionAttributeValues[":0"])
+}
+
+func TestDeployTaskStateChangeHandler_HandleProvisionerTask_OutOfAttempts(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{
+		Job: &models.DeploymentJob{
+			JobId:   "deploy-1",
+			Status:  models.JobStatusDispatched,
+			Action:  "DEPLOY",
+			TaskArn: "task-1",
+			Attempt: 3,
+		},
+		Deployment: &models.Deployment{LastError: "error assuming role: ThrottlingException"},
+	}
+	h := newRetryTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.Handle(context.Background(), provisionerStopped(statemachine.RetryExitCode)))
+
+	// errored, done step, application status
+	assert.Equal(t, []string{"deployments", "deployments", "applications"}, dynamoDBApi.tables())
+	assert.Contains(t, dynamoDBApi.UpdateItemIn[2].ExpressionAttributeValues, ":0")
+	assert.Equal(t,
+		&types.AttributeValueMemberS{Value: "error: deployment failed after 3 attempt(s): error assuming role: ThrottlingException"},
+		dynamoDBApi.UpdateItemIn[2].ExpressionAttributeValues[":0"])
+	// and gives up its lease
+	assert.NotNil(t, dynamoDBApi.DeleteItemIn)
+}
+
+func TestDeployTaskStateChangeHandler_HandleProvisionerTask_NotRetriedAction(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{Job: &models.DeploymentJob{JobId: "deploy-1", Status: models.JobStatusDispatched, Action: "ROLLBACK"}}
+	h := newRetryTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.Handle(context.Background(), models.TaskStateChangeEvent{Detail: models.Detail{
+		Group:      "family:provisioner",
+		TaskArn:    "task-1",
+		LastStatus: models.StateStopped,
+		StopCode:   "TaskFailedToStart",
+	}}))
+
+	assert.Equal(t, []string{"deployments", "deployments", "applications"}, dynamoDBApi.tables())
+	assert.NotNil(t, dynamoDBApi.DeleteItemIn)
+}
+
+func TestDeployTaskStateChangeHandler_HandleProvisionerTask_Failed(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{}
+	h := newRetryTestHandler(dynamoDBApi)
+
+	// the provisioner recorded its own error, so the lease is all there is left to release
+	require.NoError(t, h.Handle(context.Background(), provisionerStopped(1)))
+
+	assert.Empty(t, dynamoDBApi.UpdateItemIn)
+	assert.NotNil(t, dynamoDBApi.DeleteItemIn)
+}
+
+func TestDeployTaskStateChangeHandler_Handle_DeployerFailedTransiently(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{}
+	h := newRetryTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.Handle(context.Background(), models.TaskStateChangeEvent{Detail: models.Detail{
+		Group:         "family:deployer",
+		TaskArn:       "task-2",
+		LastStatus:    models.StateStopped,
+		StopCode:      "TaskFailedToStart",
+		StoppedReason: "CannotPullContainerError: pull image manifest has been retried 5 time(s)",
+	}}))
+
+	// the deployment is updated, but its outcome is left to the provisioner
+	assert.Equal(t, []string{"deployments"}, dynamoDBApi.tables())
+}
+
+func TestDeployTaskStateChangeHandler_Handle_DeployerCouldNotReachRegistry(t *testing.T) {
+	dynamoDBApi := &leaseDynamoDBApi{}
+	h := newRetryTestHandler(dynamoDBApi)
+
+	require.NoError(t, h.Handle(context.Background(), models.TaskStateChangeEvent{Detail: models.Detail{
+		Group:         "family:deployer",
+		TaskArn:       "task-2",
+		LastStatus:    models.StateStopped,
+		StopCode:      "EssentialContainerExited",
+		StoppedReason: "Essential container in task exited",
+		Containers:    []models.Container{{ExitCode: statemachine.RetryExitCode}},
+	}}))
+
+	// the application is not failed, as the provisioner exits for a retry
+	assert.Equal(t, []string{"deployments"}, dynamoDBApi.tables())
+}
@@ -32,11 +32,24 @@ func init() {
 	if len(deploymentsTable) == 0 {
 		logging.Default.Error("empty or missing env var value", slog.String("missing", handler.DeploymentsTableEnvVar))
 	}
+	deploymentLeasesTable := os.Getenv(handler.DeploymentLeasesTableEnvVar)
+	if len(deploymentLeasesTable) == 0 {
+		logging.Default.Error("empty or missing env var value", slog.String("missing", handler.DeploymentLeasesTableEnvVar))
+	}
+	deploymentJobsTable := os.Getenv(handler.DeploymentJobsTableEnvVar)
+	if len(deploymentJobsTable) == 0 {
+		logging.Default.Error("empty or missing env var value", slog.String("missing", handler.DeploymentJobsTableEnvVar))
+	}
+	provisionerTaskFamily := os.Getenv(handler.ProvisionerTaskFamilyEnvVar)
+	if len(provisionerTaskFamily) == 0 {
+		logging.Default.Error("empty or missing env var value", slog.String("missing", handler.ProvisionerTaskFamilyEnvVar))
+	}
 	stateChangeHandler = handler.NewDeployTaskStateChangeHandler(
 		ecs.NewFromConfig(awsConfig),
 		dynamodb.NewFromConfig(awsConfig),
 		applicationsTable,
-		deploymentsTable)
+		deploymentsTable).
+		WithDeploymentLeases(deploymentLeasesTable, deploymentJobsTable, provisionerTaskFamily)
 
 	if pusherConfig, err := handler.GetPusherConfig(ctx, ssm.NewFromConfig(awsConfig)); err != nil {
 		logging.Default.Warn("unable to get pusher config", slog.Any("error", err))
@@ -21,6 +21,33 @@ const DeploymentStoppedAtField = "stoppedAt"
 const DeploymentStopCodeField = "stopCode"
 const DeploymentStoppedReasonField = "stoppedReason"
 const DeploymentErroredField = "errored"
+const DeploymentCancelledField = "cancelled"
+const DeploymentTimelineField = "timeline"
+const DeploymentAttemptField = "attempt"
+const DeploymentLastErrorField = "lastError"
+
+// Deployment statuses set by the service before there is a deployer task to report on
+const (
+	DeploymentStatusNotStarted = "NOT_STARTED"
+	DeploymentStatusQueued     = "QUEUED"
+)
+
+// StepProvisioning is the first step of a deployment's timeline, started when its provisioner task is run
+const StepProvisioning = "provisioning"
+
+// StepDone is the last step of a deployment's timeline. The status listener records it when the deployer task stops.
+const StepDone = "done"
+
+// StepRetry marks the start of a deployment's next attempt in its timeline. The steps before it are those of
+// earlier attempts.
+const StepRetry = "retry"
+
+// Outcomes of a step
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepCancelled = "cancelled"
+)
 
 type DeploymentKey struct {
 	ApplicationId string `dynamodbav:"applicationId"`
@@ -52,6 +79,19 @@ type Deployment struct {
 	StopCode      string `dynamodbav:"stopCode,omitempty"`
 	StoppedReason string `dynamodbav:"stoppedReason,omitempty"`
 	Errored       bool   `dynamodbav:"errored,omitempty"`
+	Cancelled     bool   `dynamodbav:"cancelled,omitempty"`
+
+	// Attempt is set once a deployment that failed transiently is retried, from 2. LastError is the provisioner's
+	// transient error, if it recorded one.
+	Attempt   int    `dynamodbav:"attempt,omitempty"`
+	LastError string `dynamodbav:"lastError,omitempty"`
+}
+
+// StepEvent is an entry in a deployment's timeline: a step starting, or ending with an outcome.
+type StepEvent struct {
+	Step    string    `dynamodbav:"step"`
+	Outcome string    `dynamodbav:"outcome,omitempty"`
+	Time    time.Time `dynamodbav:"time"`
 }
 
 func DeploymentKeyItem(applicationId, deploymentId string) map[string]types.AttributeValue {
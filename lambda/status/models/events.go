@@ -33,6 +33,8 @@ type Detail struct {
 	Version           int    `json:"version"`
 
 	ClusterArn string `json:"clusterArn"`
+	// Group is "family:" followed by the task definition family
+	Group string `json:"group"`
 
 	Containers []Container `json:"containers"`
 	// CreatedAt The timestamp for the time when the task was created.
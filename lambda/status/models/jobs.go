@@ -0,0 +1,40 @@
+package models
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/status/dydbutils"
+)
+
+// These *Field const must match the dynamodbav struct tags of the service's DeploymentJob
+
+const DeploymentJobIdField = "jobId"
+const DeploymentJobStatusField = "status"
+const DeploymentJobNextAttemptAtField = "nextAttemptAt"
+const DeploymentJobTaskArnField = "taskArn"
+const DeploymentJobAttemptField = "attempt"
+const DeploymentJobAttemptsField = "attempts"
+const DeploymentJobLastErrorField = "lastError"
+const DeploymentJobExpiresAtField = "expiresAt"
+
+// JobStatusWaiting is a job whose deployment is queued for the lease. Once released it is JobStatusPending, and
+// the service's dispatcher runs it.
+const JobStatusWaiting = "WAITING"
+const JobStatusPending = "PENDING"
+
+// JobStatusDispatched is a job whose provisioner task has been run. A task that fails transiently has its job made
+// JobStatusPending again, for the dispatcher to run the next attempt.
+const JobStatusDispatched = "DISPATCHED"
+
+// DeploymentJob is the part of the service's DeploymentJob the status listener reads
+type DeploymentJob struct {
+	JobId   string `dynamodbav:"jobId"`
+	Status  string `dynamodbav:"status"`
+	Action  string `dynamodbav:"action"`
+	TaskArn string `dynamodbav:"taskArn,omitempty"`
+	// Attempt is the attempt the job's task was run for, from 1. Jobs that have not been retried may not have it.
+	Attempt int `dynamodbav:"attempt,omitempty"`
+}
+
+func DeploymentJobKey(jobId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{DeploymentJobIdField: dydbutils.StringAttributeValue(jobId)}
+}
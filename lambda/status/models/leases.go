@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pennsieve/app-deploy-service/status/dydbutils"
+	"time"
+)
+
+// DeploymentLeaseDuration must match the service's. A lease handed to a queued deployment lasts this long.
+const DeploymentLeaseDuration = 3 * time.Hour
+
+// These *Field const must match the dynamodbav struct tags in DeploymentLease
+
+const LeaseApplicationIdField = "applicationId"
+const LeaseDeploymentIdField = "deploymentId"
+const LeaseAcquiredAtField = "acquiredAt"
+const LeaseExpiresAtField = "expiresAt"
+const LeaseQueueField = "queue"
+
+// DeploymentLease is held by the one deployment of an application allowed to run. The service takes it, and queues
+// deployments behind it; this Lambda releases it when the holder's provisioner task stops.
+type DeploymentLease struct {
+	ApplicationId string             `dynamodbav:"applicationId"`
+	DeploymentId  string             `dynamodbav:"deploymentId"`
+	AcquiredAt    time.Time          `dynamodbav:"acquiredAt"`
+	ExpiresAt     int64              `dynamodbav:"expiresAt"`
+	Queue         []QueuedDeployment `dynamodbav:"queue,omitempty"`
+}
+
+// QueuedDeployment is a deployment waiting for the lease. Its provisioner task waits as a job with the deployment's
+// id in the deployment jobs table.
+type QueuedDeployment struct {
+	DeploymentId string `dynamodbav:"deploymentId"`
+}
+
+func LeaseKey(applicationId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{LeaseApplicationIdField: dydbutils.StringAttributeValue(applicationId)}
+}
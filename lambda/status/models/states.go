@@ -1,3 +1,6 @@
 package models
 
 const StateStopped = "STOPPED"
+
+// StopCodeUserInitiated is the ECS stop code of a task stopped with StopTask
+const StopCodeUserInitiated = "UserInitiated"
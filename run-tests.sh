@@ -15,4 +15,8 @@ echo "RUNNING lambda/status TESTS"
 cd "$root_dir/lambda/status"
 go test -v ./...; exit_status=$((exit_status || $? ))
 
+echo "RUNNING statemachine TESTS"
+cd "$root_dir/statemachine"
+go test -v ./...; exit_status=$((exit_status || $? ))
+
 exit $exit_status
\ No newline at end of file
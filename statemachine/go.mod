@@ -0,0 +1,3 @@
+module github.com/pennsieve/app-deploy-service/statemachine
+
+go 1.22
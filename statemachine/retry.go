@@ -0,0 +1,75 @@
+package statemachine
+
+import (
+	"strings"
+	"time"
+)
+
+// RetryExitCode is the exit code of a provisioner that failed transiently, EX_TEMPFAIL from sysexits.h. The
+// provisioner leaves the deployment's status alone and the status listener decides whether to retry it. The
+// deployer exits with it too when its build could not reach a registry.
+const RetryExitCode = 75
+
+// RetryPolicy is how often a deployment whose provisioner or deployer task failed transiently is run again
+type RetryPolicy struct {
+	// MaxAttempts is how many times the deployment is run in all, including the first
+	MaxAttempts int
+	// Delays between attempts start at BaseDelay and double up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// retryPolicies are keyed by provisioner action. Deletes and rollbacks are not retried: a delete that fails part
+// way needs a look before it is run again, and a rollback is quick to request again.
+var retryPolicies = map[string]RetryPolicy{
+	"CREATE":          {MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute},
+	"DEPLOY":          {MaxAttempts: 3, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute},
+	"ADD_TO_APPSTORE": {MaxAttempts: 3, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute},
+}
+
+// Policy returns the retry policy of action, and false if the action is not retried
+func Policy(action string) (RetryPolicy, bool) {
+	policy, ok := retryPolicies[action]
+	return policy, ok
+}
+
+// Retries reports whether a deployment that failed transiently on attempt (from 1) is run again
+func (p RetryPolicy) Retries(attempt int) bool {
+	return attempt < p.MaxAttempts
+}
+
+// Delay is how long to wait before running the attempt after attempt
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// transientStopCodes are ECS stop codes of tasks that were stopped by the platform rather than by what they ran
+var transientStopCodes = []string{"TaskFailedToStart", "SpotInterruption", "TerminationNotice"}
+
+// transientStoppedReasons are found in the stopped reason of tasks that could not pull their image or attach to
+// the network, whatever their stop code
+var transientStoppedReasons = []string{
+	"CannotPullContainerError",
+	"ResourceInitializationError",
+	"Timeout waiting for network interface",
+	"RequestLimitExceeded",
+}
+
+// TransientStop reports whether an ECS task stopped for a reason that running it again may not hit
+func TransientStop(stopCode string, stoppedReason string) bool {
+	for _, code := range transientStopCodes {
+		if stopCode == code {
+			return true
+		}
+	}
+	for _, reason := range transientStoppedReasons {
+		if strings.Contains(stoppedReason, reason) {
+			return true
+		}
+	}
+	return false
+}
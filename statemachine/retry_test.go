@@ -0,0 +1,43 @@
+package statemachine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	policy, ok := Policy("DEPLOY")
+	if !ok {
+		t.Fatal("DEPLOY should be retried")
+	}
+	if !policy.Retries(1) || policy.Retries(policy.MaxAttempts) {
+		t.Errorf("Retries of %+v", policy)
+	}
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 10: 5 * time.Minute} {
+		if got := policy.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	if _, ok := Policy("DELETE"); ok {
+		t.Error("DELETE should not be retried")
+	}
+}
+
+func TestTransientStop(t *testing.T) {
+	for _, tc := range []struct {
+		stopCode, stoppedReason string
+		transient               bool
+	}{
+		{"TaskFailedToStart", "", true},
+		{"SpotInterruption", "", true},
+		{"EssentialContainerExited", "CannotPullContainerError: pull image manifest has been retried 5 time(s)", true},
+		{"EssentialContainerExited", "ResourceInitializationError: unable to pull secrets or registry auth", true},
+		{"EssentialContainerExited", "Essential container in task exited", false},
+		{"UserInitiated", "Deployment cancelled", false},
+	} {
+		if got := TransientStop(tc.stopCode, tc.stoppedReason); got != tc.transient {
+			t.Errorf("TransientStop(%q, %q) = %v, want %v", tc.stopCode, tc.stoppedReason, got, tc.transient)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package statemachine defines the registration states of applications and App Store versions, and the
+// transitions between them. It is shared by the service, the status listener and the provisioner, which each
+// enforce it with a DynamoDB condition on their status updates, so that a late or out of order update (a deployed
+// event arriving after a delete was requested, say) is rejected rather than applied. It also holds the policy for
+// retrying deployments that failed transiently, which the same three agree on.
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrIllegalTransition is returned when a record's current state does not allow the requested one
+var ErrIllegalTransition = errors.New("illegal status transition")
+
+// Attribute is the attribute applications and versions keep their state in
+const Attribute = "registrationStatus"
+
+// State is a registration state. Error states carry a message after the state, "error: {message}" or
+// "delete-error: {message}".
+type State string
+
+const (
+	Registering State = "registering"
+	Pending     State = "pending"
+	Deploying   State = "deploying"
+	Redeploying State = "re-deploying"
+	RollingBack State = "rolling-back"
+	Deployed    State = "deployed"
+	Cancelled   State = "cancelled"
+	Deleting    State = "deleting"
+	Error       State = "error"
+	// DeleteError is an application whose delete failed. It is only reached by the delete itself, so that a late
+	// error from an earlier provisioner run cannot take an application out of deleting.
+	DeleteError State = "delete-error"
+)
+
+// errorStates carry a message after the state
+var errorStates = []State{Error, DeleteError}
+
+// StateOf returns the state a stored status is in
+func StateOf(status string) State {
+	for _, state := range errorStates {
+		if strings.HasPrefix(status, string(state)) {
+			return state
+		}
+	}
+	return State(status)
+}
+
+// ErrorStatus returns the status recording an error with message
+func ErrorStatus(message string) string {
+	return fmt.Sprintf("%s: %s", Error, message)
+}
+
+// DeleteErrorStatus returns the status recording that a delete failed with message
+func DeleteErrorStatus(message string) string {
+	return fmt.Sprintf("%s: %s", DeleteError, message)
+}
+
+// Machine is a set of legal transitions, keyed by the state transitioned to. A state with no entry can only be
+// set when the record is created, and a nil entry can be reached from any state.
+type Machine struct {
+	name string
+	from map[State][]State
+}
+
+// Application is the lifecycle of an application. A deployment is requested (pending), run by the provisioner
+// (deploying, re-deploying or rolling-back) and finished by the status listener (deployed, error or cancelled).
+// Deleting is allowed from any state, as an application can always be deleted. Errors are allowed from any state
+// but deleting, which only the delete's own failure (delete-error) leaves; an application whose delete failed can
+// only be deleted again.
+var Application = Machine{
+	name: "application",
+	from: map[State][]State{
+		Pending:     {Deployed, Error, Cancelled, Pending},
+		Deploying:   {Registering, Pending, Deploying},
+		Redeploying: {Pending, Redeploying},
+		RollingBack: {Pending, RollingBack},
+		Deployed:    {Deploying, Redeploying, RollingBack, Deployed},
+		Cancelled:   {Registering, Pending, Deploying, Redeploying, RollingBack, Cancelled},
+		Deleting:    nil,
+		Error:       {Registering, Pending, Deploying, Redeploying, RollingBack, Deployed, Cancelled, Error},
+		DeleteError: {Deleting, DeleteError},
+	},
+}
+
+// Version is the lifecycle of an App Store version, which is built once.
+var Version = Machine{
+	name: "version",
+	from: map[State][]State{
+		Deploying: {Registering, Deploying},
+		Deployed:  {Deploying, Deployed},
+		Cancelled: {Registering, Deploying, Cancelled},
+		Error:     nil,
+	},
+}
+
+// CanTransition reports whether a record with status from may be updated to status to.
+func (m Machine) CanTransition(from string, to string) bool {
+	sources, ok := m.from[StateOf(to)]
+	if !ok {
+		return false
+	}
+	if sources == nil {
+		return true
+	}
+	for _, source := range sources {
+		if source == StateOf(from) {
+			return true
+		}
+	}
+	return false
+}
+
+// Condition is a DynamoDB condition expression that only passes when the record's state allows a transition.
+// Its placeholders are NamePlaceholder and the keys of Values, so they can be added to any update.
+type Condition struct {
+	// Expression is empty when the transition is allowed from any state
+	Expression string
+	Values     map[string]string
+}
+
+// NamePlaceholder stands for Attribute in a Condition
+const NamePlaceholder = "#registrationStatus"
+
+// Condition returns the condition for updating a record to status. It fails with ErrIllegalTransition if no
+// update can reach that state.
+func (m Machine) Condition(status string) (Condition, error) {
+	sources, ok := m.from[StateOf(status)]
+	if !ok {
+		return Condition{}, fmt.Errorf("%w: no %s transition leads to %q", ErrIllegalTransition, m.name, status)
+	}
+	if sources == nil {
+		return Condition{}, nil
+	}
+
+	condition := Condition{Values: map[string]string{}}
+	var exact, terms []string
+	for i, source := range sources {
+		placeholder := fmt.Sprintf(":from%d", i)
+		condition.Values[placeholder] = string(source)
+		if slices.Contains(errorStates, source) {
+			terms = append(terms, fmt.Sprintf("begins_with(%s, %s)", NamePlaceholder, placeholder))
+		} else {
+			exact = append(exact, placeholder)
+		}
+	}
+	if len(exact) > 0 {
+		sort.Strings(exact)
+		terms = append([]string{fmt.Sprintf("%s IN (%s)", NamePlaceholder, strings.Join(exact, ", "))}, terms...)
+	}
+	condition.Expression = "(" + strings.Join(terms, " OR ") + ")"
+	return condition, nil
+}
+
+// And joins the condition to another condition expression
+func (c Condition) And(expression string) string {
+	if c.Expression == "" {
+		return expression
+	}
+	return expression + " AND " + c.Expression
+}
+
+// Rejected returns the error for an update to status that the record's current status did not allow.
+func (m Machine) Rejected(current string, status string) error {
+	return fmt.Errorf("%w: %s cannot go from %q to %q", ErrIllegalTransition, m.name, current, status)
+}
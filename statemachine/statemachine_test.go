@@ -0,0 +1,90 @@
+package statemachine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplicationTransitions(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"registering", "deploying", true},
+		{"pending", "re-deploying", true},
+		{"re-deploying", "deployed", true},
+		{"deploying", "cancelled", true},
+		{"deployed", "pending", true},
+		{"error: terraform failed", "pending", true},
+		{"deployed", "deleting", true},
+		{"deleting", "delete-error: unable to destroy", true},
+		{"delete-error: unable to destroy", "deleting", true},
+		// a late event must not undo a delete or a cancel
+		{"deleting", "deployed", false},
+		{"deleting", "error: terraform failed", false},
+		{"delete-error: unable to destroy", "pending", false},
+		{"delete-error: unable to destroy", "error: terraform failed", false},
+		{"cancelled", "deployed", false},
+		{"deployed", "re-deploying", false},
+		{"deployed", "registering", false},
+		{"deployed", "unknown", false},
+	} {
+		if got := Application.CanTransition(tc.from, tc.to); got != tc.allowed {
+			t.Errorf("Application.CanTransition(%q, %q) = %v, want %v", tc.from, tc.to, got, tc.allowed)
+		}
+	}
+}
+
+func TestVersionTransitions(t *testing.T) {
+	if !Version.CanTransition("registering", "deploying") {
+		t.Error("a version should deploy after registering")
+	}
+	if Version.CanTransition("deployed", "pending") {
+		t.Error("a version is not redeployed")
+	}
+}
+
+func TestCondition(t *testing.T) {
+	c, err := Application.Condition("deployed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "(#registrationStatus IN (:from0, :from1, :from2, :from3))"
+	if c.Expression != want {
+		t.Errorf("Expression = %q, want %q", c.Expression, want)
+	}
+	if c.Values[":from0"] != "deploying" || len(c.Values) != 4 {
+		t.Errorf("Values = %v", c.Values)
+	}
+	if got := c.And("attribute_exists(uuid)"); got != "attribute_exists(uuid) AND "+want {
+		t.Errorf("And = %q", got)
+	}
+
+	c, err = Application.Condition("pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "(#registrationStatus IN (:from0, :from2, :from3) OR begins_with(#registrationStatus, :from1))"
+	if c.Expression != want {
+		t.Errorf("Expression = %q, want %q", c.Expression, want)
+	}
+
+	// deleting is allowed from any state, so is unconditional
+	c, err = Application.Condition("deleting")
+	if err != nil || c.Expression != "" || c.And("attribute_exists(uuid)") != "attribute_exists(uuid)" {
+		t.Errorf("Condition(deleting) = %+v, %v", c, err)
+	}
+
+	c, err = Application.Condition(DeleteErrorStatus("boom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "(#registrationStatus IN (:from0) OR begins_with(#registrationStatus, :from1))"
+	if c.Expression != want || c.Values[":from0"] != "deleting" || c.Values[":from1"] != "delete-error" {
+		t.Errorf("Condition(delete-error) = %+v", c)
+	}
+
+	if _, err := Application.Condition("registering"); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("Condition(registering) error = %v, want ErrIllegalTransition", err)
+	}
+}
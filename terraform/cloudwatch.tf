@@ -36,7 +36,11 @@ resource "aws_cloudwatch_event_rule" "status_cloudwatch_event_rule" {
   description = "Listens for app deploy task state changes"
   event_pattern = jsonencode({
     "detail" : {
-      "group" : ["family:${aws_ecs_task_definition.app_deployer_ecs_task_definition.family}"],
+      # provisioner tasks are followed to release an application's deployment lease when they stop
+      "group" : [
+        "family:${aws_ecs_task_definition.app_deployer_ecs_task_definition.family}",
+        "family:${aws_ecs_task_definition.app_provisioner_ecs_task_definition.family}",
+      ],
     },
     "detail-type" : ["ECS Task State Change"],
     "source" : ["aws.ecs"]
@@ -49,3 +53,61 @@ resource "aws_cloudwatch_event_target" "status_cloudwatch_event_target" {
   target_id = "${var.environment_name}-${var.service_name}-status-lambda-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
   arn       = aws_lambda_function.status_lambda.arn
 }
+
+// CREATE DISPATCHER LAMBDA CLOUDWATCH LOG GROUP
+resource "aws_cloudwatch_log_group" "dispatcher_lambda_cloudwatch_log_group" {
+  name              = "/aws/lambda/${aws_lambda_function.dispatcher_lambda.function_name}"
+  retention_in_days = 14
+
+  tags = local.common_tags
+}
+
+// a stopped provisioner task makes room for another job
+resource "aws_cloudwatch_event_target" "dispatcher_task_state_event_target" {
+  rule      = aws_cloudwatch_event_rule.status_cloudwatch_event_rule.name
+  target_id = "${var.environment_name}-${var.service_name}-dispatcher-lambda-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  arn       = aws_lambda_function.dispatcher_lambda.arn
+}
+
+// CREATE DISPATCHER SCHEDULE RULE - picks up jobs waiting to be retried
+resource "aws_cloudwatch_event_rule" "dispatcher_schedule_event_rule" {
+  name                = "${var.environment_name}-${var.service_name}-dispatcher-schedule-rule-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  description         = "Dispatches deployment jobs waiting to be retried"
+  schedule_expression = "rate(1 minute)"
+}
+
+resource "aws_cloudwatch_event_target" "dispatcher_schedule_event_target" {
+  rule      = aws_cloudwatch_event_rule.dispatcher_schedule_event_rule.name
+  target_id = "${var.environment_name}-${var.service_name}-dispatcher-schedule-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  arn       = aws_lambda_function.dispatcher_lambda.arn
+}
+
+// CREATE AUTO-DEPLOY LAMBDA CLOUDWATCH LOG GROUP
+resource "aws_cloudwatch_log_group" "autodeploy_lambda_cloudwatch_log_group" {
+  name              = "/aws/lambda/${aws_lambda_function.autodeploy_lambda.function_name}"
+  retention_in_days = 14
+
+  tags = local.common_tags
+}
+
+// CREATE WEBHOOK LAMBDA CLOUDWATCH LOG GROUP
+resource "aws_cloudwatch_log_group" "webhook_lambda_cloudwatch_log_group" {
+  name              = "/aws/lambda/${aws_lambda_function.webhook_lambda.function_name}"
+  retention_in_days = 14
+
+  tags = local.common_tags
+}
+
+// CREATE AUTO-DEPLOY SCHEDULE RULE - polls auto-deploy policies. Schedules are checked to the minute, but only
+// deploy once the poll after their time runs.
+resource "aws_cloudwatch_event_rule" "autodeploy_schedule_event_rule" {
+  name                = "${var.environment_name}-${var.service_name}-autodeploy-schedule-rule-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  description         = "Deploys applications whose auto-deploy schedule is due or that have a new matching tag"
+  schedule_expression = "rate(5 minutes)"
+}
+
+resource "aws_cloudwatch_event_target" "autodeploy_schedule_event_target" {
+  rule      = aws_cloudwatch_event_rule.autodeploy_schedule_event_rule.name
+  target_id = "${var.environment_name}-${var.service_name}-autodeploy-schedule-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  arn       = aws_lambda_function.autodeploy_lambda.arn
+}
@@ -0,0 +1,22 @@
+# Entrypoint of the deployer, run by the busybox shell of kaniko's debug image with the command the provisioner
+# gives the deployer task. It exits with 75 (EX_TEMPFAIL, the statemachine's RetryExitCode) when kaniko failed
+# because it could not reach a registry, so that the deployment is retried rather than failed. Any other failure
+# keeps kaniko's exit code.
+
+executor="${KANIKO_EXECUTOR:-/kaniko/executor}"
+# kaniko leaves /kaniko out of the image it builds
+log="${KANIKO_LOG:-/kaniko/deployer.log}"
+
+# kaniko's output is kept to be checked once it exits, and its exit code with it as tee's is the pipeline's
+{
+  "$executor" "$@" 2>&1
+  echo $? >"$log.status"
+} | tee "$log"
+status=$(cat "$log.status")
+if [ "$status" -ne 0 ] &&
+  grep -E 'error pushing image|checking push permission|retrieving image' "$log" |
+  grep -qE 'i/o timeout|TLS handshake timeout|connection reset by peer|connection refused|no such host|unexpected EOF|502 Bad Gateway|503 Service Unavailable|504 Gateway Timeout|429 Too Many Requests|TOOMANYREQUESTS'; then
+  echo "deployer: kaniko could not reach the registry, exiting for a retry" >&2
+  exit 75
+fi
+exit "$status"
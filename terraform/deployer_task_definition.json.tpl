@@ -15,6 +15,7 @@
     ],
     "name": "${tier}",
     "image": "${image_url}:${image_tag}",
+    "entryPoint": ${entry_point},
     "cpu": ${container_cpu},
     "memory": ${container_memory},
     "essential": true
@@ -8,6 +8,35 @@ resource "aws_dynamodb_table" "applications_table" {
     type = "S"
   }
 
+  attribute {
+    name = "organizationId"
+    type = "S"
+  }
+
+  attribute {
+    name = "createdAt"
+    type = "S"
+  }
+
+  attribute {
+    name = "nameSortKey"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "organizationId-createdAt-index"
+    hash_key        = "organizationId"
+    range_key       = "createdAt"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name            = "organizationId-nameSortKey-index"
+    hash_key        = "organizationId"
+    range_key       = "nameSortKey"
+    projection_type = "ALL"
+  }
+
   ttl {
     attribute_name = "TimeToExist"
     enabled        = true
@@ -140,6 +169,18 @@ resource "aws_dynamodb_table" "deployments_table" {
     type = "S"
   }
 
+  attribute {
+    name = "initiatedAt"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "applicationId-initiatedAt-index"
+    hash_key        = "applicationId"
+    range_key       = "initiatedAt"
+    projection_type = "ALL"
+  }
+
   ttl {
     attribute_name = "TimeToExist"
     enabled        = true
@@ -153,4 +194,98 @@ resource "aws_dynamodb_table" "deployments_table" {
       "service_name" = var.service_name
     },
   )
-}
\ No newline at end of file
+}
+
+resource "aws_dynamodb_table" "idempotency_table" {
+  name         = "${var.environment_name}-${var.service_name}-idempotency-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "idempotencyKey"
+
+  attribute {
+    name = "idempotencyKey"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  tags = merge(
+    local.common_tags,
+    {
+      "Name"         = "${var.environment_name}-${var.service_name}-idempotency-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+      "name"         = "${var.environment_name}-${var.service_name}-idempotency-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+      "service_name" = var.service_name
+    },
+  )
+}
+
+resource "aws_dynamodb_table" "deployment_leases_table" {
+  name         = "${var.environment_name}-${var.service_name}-deployment-leases-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "applicationId"
+
+  attribute {
+    name = "applicationId"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  tags = merge(
+    local.common_tags,
+    {
+      "Name"         = "${var.environment_name}-${var.service_name}-deployment-leases-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+      "name"         = "${var.environment_name}-${var.service_name}-deployment-leases-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+      "service_name" = var.service_name
+    },
+  )
+}
+
+resource "aws_dynamodb_table" "deployment_jobs_table" {
+  name             = "${var.environment_name}-${var.service_name}-deployment-jobs-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  billing_mode     = "PAY_PER_REQUEST"
+  hash_key         = "jobId"
+  stream_enabled   = true
+  stream_view_type = "NEW_IMAGE"
+
+  attribute {
+    name = "jobId"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "createdAt"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "status-createdAt-index"
+    hash_key        = "status"
+    range_key       = "createdAt"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  tags = merge(
+    local.common_tags,
+    {
+      "Name"         = "${var.environment_name}-${var.service_name}-deployment-jobs-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+      "name"         = "${var.environment_name}-${var.service_name}-deployment-jobs-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+      "service_name" = var.service_name
+    },
+  )
+}
@@ -41,6 +41,9 @@ data "template_file" "app_deployer_ecs_task_definition" {
     aws_region_shortname      = data.terraform_remote_state.region.outputs.aws_region_shortname
     container_cpu             = var.deployer_task_cpu
     container_memory          = var.deployer_task_memory
+    # kaniko runs under a script that reports registry network failures with an exit code of their own, for
+    # deployments to be retried
+    entry_point               = jsonencode(["/busybox/sh", "-c", file("${path.module}/deployer_entrypoint.sh"), "deployer"])
     environment_name          = var.environment_name
     image_tag                 = var.deployer_image_tag
     image_url                 = var.deployer_image_url
@@ -59,7 +62,8 @@ resource "aws_ecs_task_definition" "app_deployer_ecs_task_definition" {
   cpu                = var.deployer_task_cpu
   memory             = var.deployer_task_memory
   task_role_arn      = aws_iam_role.app_provisioner_fargate_task_iam_role.arn # TODO: update
-  execution_role_arn = aws_iam_role.app_provisioner_fargate_task_iam_role.arn # TODO: update
+  # only ECS reads build secrets, so the builds themselves cannot
+  execution_role_arn = aws_iam_role.app_deployer_execution_role.arn
 
   depends_on = [data.template_file.app_deployer_ecs_task_definition]
 }
\ No newline at end of file
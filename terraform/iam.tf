@@ -80,11 +80,24 @@ data "aws_iam_policy_document" "service_iam_policy_document" {
       "ecs:DescribeTasks",
       "ecs:RunTask",
       "ecs:ListTasks",
+      "ecs:StopTask",
       "ecs:TagResource"
     ]
     resources = ["*"]
   }
 
+  statement {
+    sid    = "TaskLogsPermissions"
+    effect = "Allow"
+    actions = [
+      "logs:GetLogEvents"
+    ]
+    resources = [
+      "${aws_cloudwatch_log_group.app_provisioner_fargate_cloudwatch_log_group.arn}:*",
+      "${aws_cloudwatch_log_group.app_deployer_fargate_cloudwatch_log_group.arn}:*",
+    ]
+  }
+
   statement {
     sid    = "ECSPassRole"
     effect = "Allow"
@@ -112,6 +125,19 @@ data "aws_iam_policy_document" "service_iam_policy_document" {
     ]
   }
 
+  statement {
+    sid    = "SourceTokensPermissions"
+    effect = "Allow"
+
+    actions = [
+      "ssm:PutParameter",
+    ]
+
+    resources = [
+      "arn:aws:ssm:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:parameter/${local.source_tokens_path}/*",
+    ]
+  }
+
   statement {
     sid    = "ContentSyncS3Permissions"
     effect = "Allow"
@@ -153,11 +179,32 @@ data "aws_iam_policy_document" "service_iam_policy_document" {
       aws_dynamodb_table.deployments_table.arn,
       "${aws_dynamodb_table.deployments_table.arn}/*",
       aws_dynamodb_table.app_access_table.arn,
-      "${aws_dynamodb_table.app_access_table.arn}/*"
+      "${aws_dynamodb_table.app_access_table.arn}/*",
+      aws_dynamodb_table.idempotency_table.arn,
+      aws_dynamodb_table.deployment_leases_table.arn,
+      aws_dynamodb_table.deployment_jobs_table.arn,
+      "${aws_dynamodb_table.deployment_jobs_table.arn}/*"
     ]
 
   }
 
+  # the dispatcher is invoked as jobs become pending
+  statement {
+    sid    = "DispatcherLambdaAccessToJobsStream"
+    effect = "Allow"
+
+    actions = [
+      "dynamodb:DescribeStream",
+      "dynamodb:GetRecords",
+      "dynamodb:GetShardIterator",
+      "dynamodb:ListStreams"
+    ]
+
+    resources = [
+      aws_dynamodb_table.deployment_jobs_table.stream_arn
+    ]
+  }
+
 }
 
 # Status Lambda
@@ -230,7 +277,8 @@ data "aws_iam_policy_document" "status_iam_policy_document" {
       "dynamodb:Query",
       "dynamodb:BatchWriteItem",
       "dynamodb:PutItem",
-      "dynamodb:UpdateItem"
+      "dynamodb:UpdateItem",
+      "dynamodb:DeleteItem"
     ]
 
     resources = [
@@ -241,7 +289,11 @@ data "aws_iam_policy_document" "status_iam_policy_document" {
       aws_dynamodb_table.appstore_versions_table.arn,
       "${aws_dynamodb_table.appstore_versions_table.arn}/*",
       aws_dynamodb_table.deployments_table.arn,
-      "${aws_dynamodb_table.deployments_table.arn}/*"
+      "${aws_dynamodb_table.deployments_table.arn}/*",
+      aws_dynamodb_table.deployment_leases_table.arn,
+      # releases the job of the next queued deployment of an application when the lease is handed to it, and
+      # requeues the job of a deployment that failed transiently
+      aws_dynamodb_table.deployment_jobs_table.arn
     ]
 
   }
@@ -431,6 +483,31 @@ data "aws_iam_policy_document" "app_provisioner_fargate_iam_policy_document" {
     ]
   }
 
+  statement {
+    sid    = "SourceTokensPermissions"
+    effect = "Allow"
+
+    actions = [
+      "ssm:GetParameter",
+      "ssm:DeleteParameter",
+    ]
+
+    resources = [
+      "arn:aws:ssm:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:parameter/${local.source_tokens_path}/*",
+    ]
+  }
+
+  statement {
+    sid    = "DeployerTaskDefinitionPermissions"
+    effect = "Allow"
+    actions = [
+      "ecs:DescribeTaskDefinition",
+      "ecs:RegisterTaskDefinition",
+      "ecs:DeregisterTaskDefinition",
+    ]
+    resources = ["*"]
+  }
+
   statement {
     sid    = "PrivateECRPush"
     effect = "Allow"
@@ -439,6 +516,7 @@ data "aws_iam_policy_document" "app_provisioner_fargate_iam_policy_document" {
       "ecr:BatchCheckLayerAvailability",
       "ecr:GetDownloadUrlForLayer",
       "ecr:BatchGetImage",
+      "ecr:DescribeImages",
       "ecr:PutImage",
       "ecr:InitiateLayerUpload",
       "ecr:UploadLayerPart",
@@ -492,3 +570,62 @@ data "aws_iam_policy_document" "app_provisioner_fargate_iam_policy_document" {
   }
 
 }
+
+# Deployer task execution role, which ECS reads build secrets with when a build starts
+resource "aws_iam_role" "app_deployer_execution_role" {
+  name = "${var.environment_name}-${var.service_name}-deployer-execution-role-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  path = "/service-roles/"
+
+  assume_role_policy = <<EOF
+{
+    "Version": "2012-10-17",
+    "Statement": [
+    {
+        "Action": "sts:AssumeRole",
+        "Effect": "Allow",
+        "Principal": {
+        "Service": "ecs-tasks.amazonaws.com"
+        }
+    }
+    ]
+}
+EOF
+
+}
+
+resource "aws_iam_role_policy_attachment" "app_deployer_execution_role_policy_attachment" {
+  role       = aws_iam_role.app_deployer_execution_role.id
+  policy_arn = aws_iam_policy.app_deployer_execution_policy.arn
+}
+
+resource "aws_iam_policy" "app_deployer_execution_policy" {
+  name   = "${var.environment_name}-${var.service_name}-deployer-execution-policy-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  policy = data.aws_iam_policy_document.app_deployer_execution_policy_document.json
+}
+
+data "aws_iam_policy_document" "app_deployer_execution_policy_document" {
+  statement {
+    sid    = "DeployerLogPermissions"
+    effect = "Allow"
+    actions = [
+      "logs:CreateLogStream",
+      "logs:PutLogEvents",
+    ]
+    resources = ["${aws_cloudwatch_log_group.app_deployer_fargate_cloudwatch_log_group.arn}:*"]
+  }
+
+  statement {
+    sid    = "BuildSecretsPermissions"
+    effect = "Allow"
+    actions = [
+      "kms:Decrypt",
+      "ssm:GetParameters",
+      "secretsmanager:GetSecretValue",
+    ]
+    resources = [
+      "arn:aws:ssm:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:parameter/${local.build_secrets_path}/*",
+      "arn:aws:secretsmanager:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:secret:${local.build_secrets_path}/*",
+      data.aws_kms_key.ssm_kms_key.arn,
+    ]
+  }
+}
@@ -30,13 +30,21 @@ resource "aws_lambda_function" "service_lambda" {
       LOG_LEVEL                        = "info",
       TASK_DEF_CONTAINER_NAME          = var.tier,
       DEPLOYER_TASK_DEF_CONTAINER_NAME = var.deployer_tier,
+      PROVISIONER_LOG_GROUP            = aws_cloudwatch_log_group.app_provisioner_fargate_cloudwatch_log_group.name,
+      DEPLOYER_LOG_GROUP               = aws_cloudwatch_log_group.app_deployer_fargate_cloudwatch_log_group.name,
       APPLICATIONS_TABLE               = aws_dynamodb_table.applications_table.name,
       APPSTORE_APPLICATIONS_TABLE      = aws_dynamodb_table.appstore_applications_table.name,
       APPSTORE_VERSIONS_TABLE          = aws_dynamodb_table.appstore_versions_table.name,
       DEPLOYMENTS_TABLE                = aws_dynamodb_table.deployments_table.name,
       APP_ACCESS_TABLE                 = aws_dynamodb_table.app_access_table.name,
+      IDEMPOTENCY_TABLE                = aws_dynamodb_table.idempotency_table.name,
+      DEPLOYMENT_LEASES_TABLE          = aws_dynamodb_table.deployment_leases_table.name,
+      DEPLOYMENT_JOBS_TABLE            = aws_dynamodb_table.deployment_jobs_table.name,
       ACCOUNTS_TABLE                   = data.terraform_remote_state.account_service.outputs.accounts_table_name
       CONTENT_SYNC_BUCKET              = aws_s3_bucket.content_sync_bucket.id
+      CORS_ALLOWED_ORIGINS             = join(",", local.cors_allowed_origins)
+      BUILD_SECRETS_PATH               = local.build_secrets_path
+      SOURCE_TOKENS_PATH               = local.source_tokens_path
     }
   }
 }
@@ -68,10 +76,199 @@ resource "aws_lambda_function" "status_lambda" {
       APPLICATIONS_TABLE          = aws_dynamodb_table.applications_table.name,
       APPSTORE_APPLICATIONS_TABLE = aws_dynamodb_table.appstore_applications_table.name,
       DEPLOYMENTS_TABLE           = aws_dynamodb_table.deployments_table.name
+      DEPLOYMENT_LEASES_TABLE     = aws_dynamodb_table.deployment_leases_table.name
+      DEPLOYMENT_JOBS_TABLE       = aws_dynamodb_table.deployment_jobs_table.name
+      PROVISIONER_TASK_FAMILY     = aws_ecs_task_definition.app_provisioner_ecs_task_definition.family
     }
   }
 }
 
+# Runs queued provisioner tasks within the concurrency limits. One instance at a time, so that two never count
+# the running tasks at once and overshoot the limits.
+resource "aws_lambda_function" "dispatcher_lambda" {
+  description                    = "App Deploy Job Dispatcher"
+  function_name                  = "${var.environment_name}-${var.service_name}-dispatcher-lambda-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  handler                        = "bootstrap"
+  runtime                        = "provided.al2"
+  architectures                  = ["arm64"]
+  role                           = aws_iam_role.service_lambda_role.arn
+  timeout                        = 300
+  memory_size                    = 128
+  reserved_concurrent_executions = 1
+  s3_bucket                      = var.lambda_bucket
+  s3_key                         = "${var.service_name}/${var.service_name}-dispatcher-${var.image_tag}.zip"
+
+  vpc_config {
+    subnet_ids = tolist(data.terraform_remote_state.vpc.outputs.private_subnet_ids)
+    security_group_ids = [
+      data.terraform_remote_state.platform_infrastructure.outputs.rehydration_service_security_group_id
+    ]
+  }
+
+  environment {
+    variables = {
+      ENV                         = var.environment_name
+      REGION                      = var.aws_region
+      LOG_LEVEL                   = "info",
+      CLUSTER_ARN                 = data.terraform_remote_state.fargate.outputs.ecs_cluster_arn,
+      PROVISIONER_TASK_FAMILY     = aws_ecs_task_definition.app_provisioner_ecs_task_definition.family
+      APPLICATIONS_TABLE          = aws_dynamodb_table.applications_table.name,
+      APPSTORE_VERSIONS_TABLE     = aws_dynamodb_table.appstore_versions_table.name,
+      DEPLOYMENTS_TABLE           = aws_dynamodb_table.deployments_table.name,
+      DEPLOYMENT_LEASES_TABLE     = aws_dynamodb_table.deployment_leases_table.name,
+      DEPLOYMENT_JOBS_TABLE       = aws_dynamodb_table.deployment_jobs_table.name,
+      DISPATCH_ACCOUNT_LIMIT      = var.dispatch_account_limit
+      DISPATCH_COMPUTE_NODE_LIMIT = var.dispatch_compute_node_limit
+    }
+  }
+}
+
+# a job is dispatched as soon as it becomes pending
+resource "aws_lambda_event_source_mapping" "dispatcher_jobs_stream" {
+  event_source_arn  = aws_dynamodb_table.deployment_jobs_table.stream_arn
+  function_name     = aws_lambda_function.dispatcher_lambda.arn
+  starting_position = "LATEST"
+
+  filter_criteria {
+    filter {
+      pattern = jsonencode({
+        "dynamodb" : {
+          "NewImage" : {
+            "status" : { "S" : ["PENDING"] }
+          }
+        }
+      })
+    }
+  }
+}
+
+# Deploys applications whose auto-deploy policy is due. It requests deployments the way POST /deploy does, so it
+# shares the service's role and the environment deployments are started with. One instance at a time, so that
+# overlapping polls do not both deploy the same new tag.
+resource "aws_lambda_function" "autodeploy_lambda" {
+  description                    = "App Deploy Auto-Deploy Poller"
+  function_name                  = "${var.environment_name}-${var.service_name}-autodeploy-lambda-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  handler                        = "bootstrap"
+  runtime                        = "provided.al2"
+  architectures                  = ["arm64"]
+  role                           = aws_iam_role.service_lambda_role.arn
+  timeout                        = 300
+  memory_size                    = 128
+  reserved_concurrent_executions = 1
+  s3_bucket                      = var.lambda_bucket
+  s3_key                         = "${var.service_name}/${var.service_name}-autodeploy-${var.image_tag}.zip"
+
+  vpc_config {
+    subnet_ids = tolist(data.terraform_remote_state.vpc.outputs.private_subnet_ids)
+    security_group_ids = [
+      data.terraform_remote_state.platform_infrastructure.outputs.rehydration_service_security_group_id
+    ]
+  }
+
+  environment {
+    variables = {
+      ENV                              = var.environment_name
+      REGION                           = var.aws_region
+      LOG_LEVEL                        = "info",
+      TASK_DEF_ARN                     = aws_ecs_task_definition.app_provisioner_ecs_task_definition.arn,
+      DEPLOYER_TASK_DEF_ARN            = aws_ecs_task_definition.app_deployer_ecs_task_definition.arn,
+      CLUSTER_ARN                      = data.terraform_remote_state.fargate.outputs.ecs_cluster_arn,
+      SUBNET_IDS                       = join(",", data.terraform_remote_state.vpc.outputs.private_subnet_ids),
+      SECURITY_GROUP                   = data.terraform_remote_state.platform_infrastructure.outputs.rehydration_fargate_security_group_id,
+      TASK_DEF_CONTAINER_NAME          = var.tier,
+      DEPLOYER_TASK_DEF_CONTAINER_NAME = var.deployer_tier,
+      APPLICATIONS_TABLE               = aws_dynamodb_table.applications_table.name,
+      DEPLOYMENTS_TABLE                = aws_dynamodb_table.deployments_table.name,
+      DEPLOYMENT_LEASES_TABLE          = aws_dynamodb_table.deployment_leases_table.name,
+      DEPLOYMENT_JOBS_TABLE            = aws_dynamodb_table.deployment_jobs_table.name,
+      ACCOUNTS_TABLE                   = data.terraform_remote_state.account_service.outputs.accounts_table_name
+      GITHUB_TOKEN_PARAMETER           = "/${var.environment_name}/${var.service_name}/github-token"
+      GITLAB_TOKEN_PARAMETER           = "/${var.environment_name}/${var.service_name}/gitlab-token"
+      BITBUCKET_TOKEN_PARAMETER        = "/${var.environment_name}/${var.service_name}/bitbucket-token"
+      BUILD_SECRETS_PATH               = local.build_secrets_path
+      SOURCE_TOKENS_PATH               = local.source_tokens_path
+    }
+  }
+}
+
+resource "aws_lambda_function" "webhook_lambda" {
+  description   = "App Deploy GitHub Webhook Receiver"
+  function_name = "${var.environment_name}-${var.service_name}-webhook-lambda-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  handler       = "bootstrap"
+  runtime       = "provided.al2"
+  architectures = ["arm64"]
+  role          = aws_iam_role.service_lambda_role.arn
+  timeout       = 300
+  memory_size   = 128
+  s3_bucket     = var.lambda_bucket
+  s3_key        = "${var.service_name}/${var.service_name}-webhook-${var.image_tag}.zip"
+
+  vpc_config {
+    subnet_ids = tolist(data.terraform_remote_state.vpc.outputs.private_subnet_ids)
+    security_group_ids = [
+      data.terraform_remote_state.platform_infrastructure.outputs.rehydration_service_security_group_id
+    ]
+  }
+
+  environment {
+    variables = {
+      ENV                              = var.environment_name
+      PENNSIEVE_DOMAIN                 = data.terraform_remote_state.account.outputs.domain_name,
+      REGION                           = var.aws_region
+      LOG_LEVEL                        = "info",
+      TASK_DEF_ARN                     = aws_ecs_task_definition.app_provisioner_ecs_task_definition.arn,
+      DEPLOYER_TASK_DEF_ARN            = aws_ecs_task_definition.app_deployer_ecs_task_definition.arn,
+      CLUSTER_ARN                      = data.terraform_remote_state.fargate.outputs.ecs_cluster_arn,
+      SUBNET_IDS                       = join(",", data.terraform_remote_state.vpc.outputs.private_subnet_ids),
+      SECURITY_GROUP                   = data.terraform_remote_state.platform_infrastructure.outputs.rehydration_fargate_security_group_id,
+      TASK_DEF_CONTAINER_NAME          = var.tier,
+      DEPLOYER_TASK_DEF_CONTAINER_NAME = var.deployer_tier,
+      APPLICATIONS_TABLE               = aws_dynamodb_table.applications_table.name,
+      APPSTORE_APPLICATIONS_TABLE      = aws_dynamodb_table.appstore_applications_table.name,
+      APPSTORE_VERSIONS_TABLE          = aws_dynamodb_table.appstore_versions_table.name,
+      DEPLOYMENTS_TABLE                = aws_dynamodb_table.deployments_table.name,
+      APP_ACCESS_TABLE                 = aws_dynamodb_table.app_access_table.name,
+      DEPLOYMENT_LEASES_TABLE          = aws_dynamodb_table.deployment_leases_table.name,
+      DEPLOYMENT_JOBS_TABLE            = aws_dynamodb_table.deployment_jobs_table.name,
+      ACCOUNTS_TABLE                   = data.terraform_remote_state.account_service.outputs.accounts_table_name
+      CONTENT_SYNC_BUCKET              = aws_s3_bucket.content_sync_bucket.id
+      GITHUB_WEBHOOK_SECRET_PARAMETER  = "/${var.environment_name}/${var.service_name}/github-webhook-secret"
+      BUILD_SECRETS_PATH               = local.build_secrets_path
+      SOURCE_TOKENS_PATH               = local.source_tokens_path
+    }
+  }
+}
+
+// GitHub delivers webhooks without Pennsieve credentials, so they are authenticated by their signature instead
+resource "aws_lambda_function_url" "webhook_lambda_url" {
+  function_name      = aws_lambda_function.webhook_lambda.function_name
+  authorization_type = "NONE"
+}
+
+resource "aws_lambda_permission" "autodeploy_schedule_permission" {
+  statement_id  = "AllowExecutionFromSchedule"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.autodeploy_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.autodeploy_schedule_event_rule.arn
+}
+
+resource "aws_lambda_permission" "dispatcher_schedule_permission" {
+  statement_id  = "AllowExecutionFromSchedule"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.dispatcher_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.dispatcher_schedule_event_rule.arn
+}
+
+resource "aws_lambda_permission" "dispatcher_task_state_permission" {
+  statement_id  = "AllowExecutionFromTaskStateChange"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.dispatcher_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.status_cloudwatch_event_rule.arn
+}
+
 resource "aws_lambda_permission" "status_rule_permission" {
   statement_id  = "AllowExecutionFromCloudWatch"
   action        = "lambda:InvokeFunction"
@@ -16,4 +16,8 @@ output "applications_table_name" {
 
 output "applications_table_arn" {
   value = aws_dynamodb_table.applications_table.arn
-}
\ No newline at end of file
+}
+
+output "webhook_lambda_url" {
+  value = aws_lambda_function_url.webhook_lambda_url.function_url
+}
@@ -49,8 +49,9 @@ variable "deployer_image_url" {
   default = "gcr.io/kaniko-project/executor"
 }
 
+# the debug image has the busybox shell the deployer's entrypoint runs in
 variable "deployer_image_tag" {
-  default = "latest"
+  default = "debug"
 } 
 
 variable "deployer_tier" {
@@ -65,10 +66,25 @@ variable "deployer_task_memory" {
   default = "24576"
 }
 
+// provisioner tasks the dispatcher runs at once, in the account and for any one compute node
+variable "dispatch_account_limit" {
+  default = "20"
+}
+
+variable "dispatch_compute_node_limit" {
+  default = "5"
+}
+
 locals {
   common_tags = {
     aws_account      = var.aws_account
     aws_region       = data.aws_region.current_region.name
     environment_name = var.environment_name
   }
+
+  // organizations' build secrets are kept below this path, in SSM and Secrets Manager alike
+  build_secrets_path = "${var.environment_name}/${var.service_name}/build-secrets"
+
+  // the source tokens of queued provisioner tasks are kept below this path in SSM, rather than with their jobs
+  source_tokens_path = "${var.environment_name}/${var.service_name}/source-tokens"
 }
\ No newline at end of file